@@ -0,0 +1,278 @@
+package BRope
+
+// An Anchor is a position in a rope that moves with the edits of the rope, like a mark or a cursor
+type Anchor int
+
+// The Bias of an anchor decides where it goes when text is inserted right at it, or when the text
+// around it is replaced. Left stays before the new text, right moves behind it.
+type Bias int
+
+const (
+	BiasLeft Bias = iota
+	BiasRight
+)
+
+// An AnchorSet keeps anchors of a rope and moves them through its edits. An edit only visits the
+// anchors in the interval it replaces, the ones behind it are moved at once, so it takes O(k log n)
+// for k anchors in the interval.
+//
+// The anchors are the nodes of a treap ordered by offset, where each node keeps the distance to the
+// anchor before it and the sum of the distances of its subtree.
+type AnchorSet struct {
+	root  *anchorNode
+	nodes map[Anchor]*anchorNode
+	next  Anchor
+	// state of the generator of priorities, which is fixed so edits are deterministic
+	seed uint32
+}
+
+type anchorNode struct {
+	anchor Anchor
+	bias   Bias
+	// distance to the anchor before this one, or to 0 for the first one
+	gap int
+	// sum of the gaps of the subtree, which is the distance from before the subtree to its last anchor
+	sum                 int
+	priority            uint32
+	left, right, parent *anchorNode
+}
+
+func NewAnchorSet() *AnchorSet {
+	return &AnchorSet{nodes: map[Anchor]*anchorNode{}, seed: 2463534242}
+}
+
+func (s *AnchorSet) Len() int {
+	return len(s.nodes)
+}
+
+// Add creates an anchor at offset
+func (s *AnchorSet) Add(offset int, bias Bias) Anchor {
+	s.next++
+	// xorshift
+	s.seed ^= s.seed << 13
+	s.seed ^= s.seed >> 17
+	s.seed ^= s.seed << 5
+	n := &anchorNode{anchor: s.next, bias: bias, priority: s.seed}
+	s.nodes[n.anchor] = n
+	s.insert(n, offset)
+	return n.anchor
+}
+
+// Remove deletes an anchor, removing one that does not exist does nothing
+func (s *AnchorSet) Remove(a Anchor) {
+	n, ok := s.nodes[a]
+	if !ok {
+		return
+	}
+	delete(s.nodes, a)
+	s.detach(n)
+}
+
+// Offset returns the offset of an anchor
+func (s *AnchorSet) Offset(a Anchor) (int, bool) {
+	n, ok := s.nodes[a]
+	if !ok {
+		return 0, false
+	}
+	offset := n.left.total() + n.gap
+	for ; n.parent != nil; n = n.parent {
+		if n.parent.right == n {
+			offset += n.parent.left.total() + n.parent.gap
+		}
+	}
+	return offset, true
+}
+
+// Move puts an anchor to another offset
+func (s *AnchorSet) Move(a Anchor, offset int) {
+	if n, ok := s.nodes[a]; ok {
+		s.detach(n)
+		s.insert(n, offset)
+	}
+}
+
+// Edit moves the anchors through an edit that replaced iv with inserted runes. Anchors in the replaced
+// text go to the start of the new text if they have a left bias, and behind it if they have a right bias.
+func (s *AnchorSet) Edit(iv Interval, inserted int) {
+	before, rest := splitAnchors(s.root, 0, func(offset int, bias Bias) bool {
+		return offset < iv.Lo || offset == iv.Lo && bias == BiasLeft
+	})
+	replaced, after := splitAnchors(rest, before.total(), func(offset int, _ Bias) bool {
+		return offset < iv.Hi
+	})
+	// the first anchor behind the edit was as far from the last replaced one as it is from the edit's end
+	after = addToFirstGap(after, replaced.total()+inserted-iv.Len())
+	s.root = mergeAnchors(before, after)
+	s.setParent(s.root, nil)
+
+	moved := []*anchorNode{}
+	collectAnchors(replaced, &moved)
+	for _, n := range moved {
+		offset := iv.Lo
+		if n.bias == BiasRight {
+			offset += inserted
+		}
+		n.left, n.right, n.parent = nil, nil, nil
+		s.insert(n, offset)
+	}
+}
+
+// ApplyDelta moves the anchors through the edits of a delta
+func (s *AnchorSet) ApplyDelta(d Delta) {
+	// the edits are in offsets of the old rope, the last one first keeps the offsets before it valid
+	edits := d.Edits()
+	for i := len(edits) - 1; i >= 0; i-- {
+		s.Edit(edits[i].Interval, edits[i].Insert.Len())
+	}
+}
+
+// Range calls f with the anchors in iv in the order of their offsets, until f returns false
+func (s *AnchorSet) Range(iv Interval, f func(a Anchor, offset int) bool) {
+	var visit func(n *anchorNode, base int) bool
+	visit = func(n *anchorNode, base int) bool {
+		if n == nil {
+			return true
+		}
+		offset := base + n.left.total() + n.gap
+		if offset >= iv.Lo && !visit(n.left, base) {
+			return false
+		}
+		if offset >= iv.Lo && offset < iv.Hi && !f(n.anchor, offset) {
+			return false
+		}
+		return offset >= iv.Hi || visit(n.right, offset)
+	}
+	visit(s.root, 0)
+}
+
+// Inserts a node without children at offset, behind the anchors that come before it
+func (s *AnchorSet) insert(n *anchorNode, offset int) {
+	before, after := splitAnchors(s.root, 0, func(o int, bias Bias) bool {
+		return o < offset || o == offset && bias <= n.bias
+	})
+	n.gap = offset - before.total()
+	n.left, n.right = nil, nil
+	n.update()
+	after = addToFirstGap(after, -n.gap)
+	s.root = mergeAnchors(mergeAnchors(before, n), after)
+	s.setParent(s.root, nil)
+}
+
+// Takes a node out of the tree, the anchor behind it keeps its offset
+func (s *AnchorSet) detach(n *anchorNode) {
+	if n.right == nil {
+		// the anchor behind n is the first ancestor that has n in its left subtree
+		for c, p := n, n.parent; p != nil; c, p = p, p.parent {
+			if p.left == c {
+				p.gap += n.gap
+				break
+			}
+		}
+	}
+	right := addToFirstGap(n.right, n.gap)
+	joined := mergeAnchors(n.left, right)
+	parent := n.parent
+	s.setParent(joined, parent)
+	switch {
+	case parent == nil:
+		s.root = joined
+	case parent.left == n:
+		parent.left = joined
+	default:
+		parent.right = joined
+	}
+	for p := parent; p != nil; p = p.parent {
+		p.update()
+	}
+	n.left, n.right, n.parent = nil, nil, nil
+}
+
+func (s *AnchorSet) setParent(n, parent *anchorNode) {
+	if n != nil {
+		n.parent = parent
+	}
+}
+
+func (n *anchorNode) total() int {
+	if n == nil {
+		return 0
+	}
+	return n.sum
+}
+
+func (n *anchorNode) update() {
+	n.sum = n.left.total() + n.gap + n.right.total()
+	if n.left != nil {
+		n.left.parent = n
+	}
+	if n.right != nil {
+		n.right.parent = n
+	}
+}
+
+// Splits the tree into the anchors for which left is true and the ones after them. base is the offset
+// before the tree. The first anchor of the right tree keeps its gap to the anchor before it.
+func splitAnchors(n *anchorNode, base int, left func(offset int, bias Bias) bool) (*anchorNode, *anchorNode) {
+	if n == nil {
+		return nil, nil
+	}
+	offset := base + n.left.total() + n.gap
+	if left(offset, n.bias) {
+		l, r := splitAnchors(n.right, offset, left)
+		n.right = l
+		n.update()
+		if r != nil {
+			r.parent = nil
+		}
+		return n, r
+	}
+	l, r := splitAnchors(n.left, base, left)
+	n.left = r
+	n.update()
+	if l != nil {
+		l.parent = nil
+	}
+	return l, n
+}
+
+// Joins two trees, all anchors of a come before the ones of b
+func mergeAnchors(a, b *anchorNode) *anchorNode {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if a.priority > b.priority {
+		a.right = mergeAnchors(a.right, b)
+		a.update()
+		return a
+	}
+	b.left = mergeAnchors(a, b.left)
+	b.update()
+	return b
+}
+
+// Adds delta to the gap of the first anchor of the tree
+func addToFirstGap(n *anchorNode, delta int) *anchorNode {
+	if n == nil || delta == 0 {
+		return n
+	}
+	if n.left != nil {
+		addToFirstGap(n.left, delta)
+	} else {
+		n.gap += delta
+	}
+	n.sum += delta
+	return n
+}
+
+// Appends the nodes of the tree in order
+func collectAnchors(n *anchorNode, nodes *[]*anchorNode) {
+	if n == nil {
+		return
+	}
+	collectAnchors(n.left, nodes)
+	*nodes = append(*nodes, n)
+	collectAnchors(n.right, nodes)
+}
@@ -0,0 +1,144 @@
+package BRope
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func expectAnchor(s *AnchorSet, a Anchor, expected int, t *testing.T) {
+	t.Helper()
+	if offset, ok := s.Offset(a); !ok || offset != expected {
+		t.Fatalf("expected anchor %v at %v, got %v %v", a, expected, offset, ok)
+	}
+}
+
+func TestAnchorBias(t *testing.T) {
+	s := NewAnchorSet()
+	left := s.Add(5, BiasLeft)
+	right := s.Add(5, BiasRight)
+	before := s.Add(2, BiasRight)
+	after := s.Add(8, BiasLeft)
+
+	// an insertion at the anchors
+	s.Edit(IV(5, 5), 3)
+	expectAnchor(s, left, 5, t)
+	expectAnchor(s, right, 8, t)
+	expectAnchor(s, before, 2, t)
+	expectAnchor(s, after, 11, t)
+
+	// a replacement of the text around them
+	s.Edit(IV(4, 9), 2)
+	expectAnchor(s, left, 4, t)
+	expectAnchor(s, right, 6, t)
+	expectAnchor(s, after, 8, t)
+
+	// a deletion that ends at an anchor
+	s.Edit(IV(2, 8), 0)
+	expectAnchor(s, before, 2, t)
+	expectAnchor(s, after, 2, t)
+
+	s.Remove(after)
+	if _, ok := s.Offset(after); ok || s.Len() != 3 {
+		t.Fatalf("expected the anchor to be removed")
+	}
+	s.Move(before, 20)
+	expectAnchor(s, before, 20, t)
+	expectAnchor(s, left, 2, t)
+}
+
+func TestAnchorDelta(t *testing.T) {
+	s := NewAnchorSet()
+	a, b, c := s.Add(1, BiasRight), s.Add(4, BiasRight), s.Add(9, BiasRight)
+	builder := NewDeltaBuilder(10)
+	builder.Insert(0, NewRopeString("xx"))
+	builder.Delete(IV(3, 5))
+	builder.Replace(IV(8, 10), NewRopeString("yyy"))
+	s.ApplyDelta(builder.Build())
+	expectAnchor(s, a, 3, t)
+	expectAnchor(s, b, 5, t)
+	expectAnchor(s, c, 11, t)
+}
+
+func TestAnchorRange(t *testing.T) {
+	s := NewAnchorSet()
+	for _, offset := range []int{7, 1, 3, 3, 9, 5} {
+		s.Add(offset, BiasLeft)
+	}
+	got := []int{}
+	s.Range(IV(3, 9), func(_ Anchor, offset int) bool {
+		got = append(got, offset)
+		return offset < 5
+	})
+	if len(got) != 3 || got[0] != 3 || got[1] != 3 || got[2] != 5 {
+		t.Fatalf("expected the anchors from 3 until f stops, got %v", got)
+	}
+}
+
+// Compares the set with offsets that are moved one by one
+func TestAnchorsRandomEdits(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	s := NewAnchorSet()
+	type model struct {
+		offset int
+		bias   Bias
+	}
+	expected := map[Anchor]*model{}
+	length := 1000
+	for i := 0; i < 2000; i++ {
+		switch op := rng.Intn(10); {
+		case op < 4 || len(expected) == 0:
+			offset, bias := rng.Intn(length+1), Bias(rng.Intn(2))
+			expected[s.Add(offset, bias)] = &model{offset, bias}
+		case op < 5:
+			for a := range expected {
+				s.Remove(a)
+				delete(expected, a)
+				break
+			}
+		case op < 6:
+			for a, m := range expected {
+				m.offset = rng.Intn(length + 1)
+				s.Move(a, m.offset)
+				break
+			}
+		default:
+			lo := rng.Intn(length + 1)
+			hi := min(length, lo+rng.Intn(20))
+			inserted := rng.Intn(20)
+			s.Edit(IV(lo, hi), inserted)
+			for _, m := range expected {
+				switch {
+				case m.offset < lo || m.offset == lo && m.bias == BiasLeft:
+				case m.offset < hi || m.offset == lo:
+					m.offset = lo
+					if m.bias == BiasRight {
+						m.offset += inserted
+					}
+				default:
+					m.offset += inserted - (hi - lo)
+				}
+			}
+			length += inserted - (hi - lo)
+		}
+		if s.Len() != len(expected) {
+			t.Fatalf("step %v: expected %v anchors, got %v", i, len(expected), s.Len())
+		}
+		for a, m := range expected {
+			expectAnchor(s, a, m.offset, t)
+		}
+	}
+
+	offsets := []int{}
+	s.Range(IV(0, length+1), func(_ Anchor, offset int) bool {
+		offsets = append(offsets, offset)
+		return true
+	})
+	for i := 1; i < len(offsets); i++ {
+		if offsets[i] < offsets[i-1] {
+			t.Fatalf("expected the anchors in order, got %v", offsets)
+		}
+	}
+	if len(offsets) != len(expected) {
+		t.Fatalf("expected to range over %v anchors, got %v", len(expected), len(offsets))
+	}
+}
@@ -0,0 +1,126 @@
+package BRope
+
+import "unicode/utf8"
+
+// Builder builds a rope from a stream of utf-8 encoded bytes in linear time.
+//
+// The input is cut into leaves of at most MAX_LEAF runes that are pushed onto a TreeBuilder,
+// so the resulting tree is balanced and no leaf is oversized. Leaves preferably end after a newline,
+// utf-8 sequences split between two writes are decoded correctly and "\r\n" is never split into two leaves,
+// since metrics treat the border of two leaves as a grapheme boundary.
+type Builder struct {
+	tree TreeBuilder
+	// decoded runes that do not fill a leaf yet
+	pending []rune
+	// incomplete utf-8 sequence at the end of the last write
+	carry []byte
+}
+
+func NewBuilder() *Builder {
+	return &Builder{tree: NewTreeBuilder(), pending: make([]rune, 0, 4*MAX_LEAF)}
+}
+
+func (b *Builder) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(b.carry) > 0 {
+		// complete the sequence of the last write
+		for len(p) > 0 && !utf8.FullRune(b.carry) {
+			b.carry = append(b.carry, p[0])
+			p = p[1:]
+		}
+		if !utf8.FullRune(b.carry) {
+			return n, nil
+		}
+		b.pending = append(b.pending, []rune(string(b.carry))...)
+		b.carry = b.carry[:0]
+	}
+
+	complete := len(p) - incompleteSuffix(p)
+	for i := 0; i < complete; {
+		r, size := rune(p[i]), 1
+		if r >= utf8.RuneSelf {
+			r, size = utf8.DecodeRune(p[i:complete])
+		}
+		b.pending = append(b.pending, r)
+		i += size
+		if len(b.pending) == cap(b.pending) {
+			b.flushLeaves()
+		}
+	}
+	b.carry = append(b.carry, p[complete:]...)
+
+	b.flushLeaves()
+	return n, nil
+}
+
+func (b *Builder) WriteString(s string) (int, error) {
+	return b.Write([]byte(s))
+}
+
+func (b *Builder) WriteRunes(rs []rune) {
+	b.pending = append(b.pending, rs...)
+	b.flushLeaves()
+}
+
+// Build returns the rope of everything written so far. The builder must not be used afterwards.
+func (b *Builder) Build() Rope {
+	if len(b.carry) > 0 {
+		b.pending = append(b.pending, []rune(string(b.carry))...)
+		b.carry = nil
+	}
+	if len(b.pending) > 0 {
+		b.tree.PushLeaves(splitLeaves(b.pending))
+		b.pending = nil
+	}
+	return b.tree.Build()
+}
+
+// Pushes full leaves, keeping the rest until more input arrives
+func (b *Builder) flushLeaves() {
+	start := 0
+	for len(b.pending)-start > MAX_LEAF {
+		split := start + leafSplit(b.pending[start:])
+		b.tree.PushLeaf(StringLeaf{cloneRunes(b.pending[start:split])})
+		start = split
+	}
+	if start > 0 {
+		b.pending = b.pending[:copy(b.pending, b.pending[start:])]
+	}
+}
+
+// Cuts runes into leaves of at most MAX_LEAF runes. The leaves share the memory of runes.
+func splitLeaves(runes []rune) []Leaf {
+	leaves := make([]Leaf, 0, len(runes)/MAX_LEAF+1)
+	for len(runes) > 0 {
+		split := leafSplit(runes)
+		leaves = append(leaves, StringLeaf{runes[:split:split]})
+		runes = runes[split:]
+	}
+	return leaves
+}
+
+// Returns the length of the next leaf at the start of runes. The leaf ends after a newline if there
+// is one between MIN_LEAF and MAX_LEAF.
+func leafSplit(runes []rune) int {
+	if len(runes) <= MAX_LEAF {
+		return len(runes)
+	}
+	for i := MAX_LEAF; i > MIN_LEAF; i-- {
+		if runes[i-1] == '\n' {
+			return i
+		}
+	}
+	return avoidCRLFSplit(runes, MAX_LEAF)
+}
+
+// Moves a split point between '\r' and '\n' one rune to the left
+func avoidCRLFSplit(runes []rune, split int) int {
+	if split > 0 && split < len(runes) && runes[split-1] == '\r' && runes[split] == '\n' {
+		return split - 1
+	}
+	return split
+}
+
+func cloneRunes(runes []rune) []rune {
+	return append(make([]rune, 0, len(runes)), runes...)
+}
@@ -0,0 +1,66 @@
+package BRope
+
+import (
+	"strings"
+	"testing"
+)
+
+func leavesOf(r Rope) []Leaf {
+	c := NewCursor(r, 0)
+	leaf, _ := c.GetLeaf()
+	leaves := []Leaf{leaf}
+	for {
+		leaf, ok := c.NextLeaf()
+		if !ok {
+			return leaves
+		}
+		leaves = append(leaves, leaf)
+	}
+}
+
+func TestBuilderLeafSizes(t *testing.T) {
+	s := strings.Repeat("no newline in here ", 2000) + strings.Repeat("a line\r\n", 3000)
+	b := NewBuilder()
+	// odd chunk sizes split utf-8 sequences and "\r\n"
+	for i := 0; i < len(s); i += 333 {
+		b.WriteString(s[i:min(i+333, len(s))])
+	}
+	rope := b.Build()
+	expectString(s, rope, t)
+
+	leaves := leavesOf(rope)
+	for i, leaf := range leaves {
+		if leaf.Len() > MAX_LEAF {
+			t.Fatalf("leaf %v is bigger than MAX_LEAF: %v", i, leaf.Len())
+		}
+		if i < len(leaves)-1 && leaf.Len() < MIN_LEAF {
+			t.Fatalf("leaf %v is smaller than MIN_LEAF: %v", i, leaf.Len())
+		}
+		if runes := leaf.Runes(); runes[len(runes)-1] == '\r' {
+			t.Fatalf("leaf %v splits \\r\\n", i)
+		}
+	}
+}
+
+func TestBuilderUtf8(t *testing.T) {
+	s := strings.Repeat("日本語😀", 1000)
+	b := NewBuilder()
+	for i := 0; i < len(s); i++ {
+		b.Write([]byte{s[i]})
+	}
+	expectString(s, b.Build(), t)
+}
+
+func TestNewRopeSplitsLeaves(t *testing.T) {
+	s := strings.Repeat("x", 10*MAX_LEAF)
+	rope := NewRopeString(s)
+	expectString(s, rope, t)
+	if rope.Height() == 0 {
+		t.Fatalf("expected NewRope to build multiple leaves")
+	}
+	for _, leaf := range leavesOf(rope) {
+		if leaf.Len() > MAX_LEAF {
+			t.Fatalf("leaf is bigger than MAX_LEAF: %v", leaf.Len())
+		}
+	}
+}
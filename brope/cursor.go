@@ -0,0 +1,199 @@
+package BRope
+
+// A Cursor is a position inside a rope that can be moved by any Metric.
+//
+// The cursor remembers the leaf that contains its position, so stepping inside of a leaf is cheap,
+// while seeking or crossing into another leaf is a descent from the root in O(log n).
+// Since ropes are immutable, a cursor stays valid for the rope it was created with.
+type Cursor struct {
+	root     Node
+	position int
+
+	// leaf containing the position and the offset of the leaf inside the rope
+	leaf         Leaf
+	offsetOfLeaf int
+}
+
+func NewCursor(root Node, position int) *Cursor {
+	c := &Cursor{root: root}
+	c.Set(position)
+	return c
+}
+
+func (c *Cursor) Root() Node {
+	return c.root
+}
+
+func (c *Cursor) Pos() int {
+	return c.position
+}
+
+// Set moves the cursor to position, which is clamped to [0, root.Len()].
+func (c *Cursor) Set(position int) {
+	c.position = max(0, min(position, c.root.Len()))
+	if c.leaf != nil && c.position >= c.offsetOfLeaf && c.position < c.offsetOfLeaf+c.leaf.Len() {
+		// still inside of the same leaf
+		return
+	}
+	c.descend(c.position)
+}
+
+// Seek moves the cursor to the boundary of m with the given measure and returns the new position.
+func (c *Cursor) Seek(m Metric, measured int) int {
+	c.Set(c.root.CountBaseUnits(m, measured))
+	return c.position
+}
+
+// GetLeaf returns the leaf containing the cursor and the position of the cursor inside of it.
+// At the end of the rope this is the last leaf with an offset equal to its length.
+func (c *Cursor) GetLeaf() (Leaf, int) {
+	return c.leaf, c.position - c.offsetOfLeaf
+}
+
+// Moves the cursor to the start of the next leaf and returns it.
+func (c *Cursor) NextLeaf() (Leaf, bool) {
+	end := c.offsetOfLeaf + c.leaf.Len()
+	if end >= c.root.Len() {
+		return nil, false
+	}
+	c.Set(end)
+	return c.leaf, true
+}
+
+// Moves the cursor to the start of the previous leaf and returns it.
+func (c *Cursor) PrevLeaf() (Leaf, bool) {
+	if c.offsetOfLeaf == 0 {
+		return nil, false
+	}
+	c.descend(c.offsetOfLeaf - 1)
+	c.position = c.offsetOfLeaf
+	return c.leaf, true
+}
+
+// Returns the rune after the cursor without moving it.
+func (c *Cursor) PeekRune() (rune, bool) {
+	leaf, offset := c.GetLeaf()
+	if offset >= leaf.Len() {
+		return 0, false
+	}
+	return leaf.Runes()[offset], true
+}
+
+// Returns the rune after the cursor and moves the cursor past it.
+func (c *Cursor) NextRune() (rune, bool) {
+	r, ok := c.PeekRune()
+	if ok {
+		c.Set(c.position + 1)
+	}
+	return r, ok
+}
+
+// Moves the cursor before the previous rune and returns it.
+func (c *Cursor) PrevRune() (rune, bool) {
+	if c.position == 0 {
+		return 0, false
+	}
+	c.Set(c.position - 1)
+	return c.PeekRune()
+}
+
+func (c *Cursor) IsBoundary(m Metric) bool {
+	if c.position == 0 {
+		return true
+	}
+	leaf, offset := c.GetLeaf()
+	if offset == 0 {
+		if !m.CanFragment() {
+			return true
+		}
+		c.descend(c.position - 1)
+		leaf, offset = c.GetLeaf()
+		defer c.descend(c.position)
+	}
+	return m.IsBoundary(leaf, offset)
+}
+
+// Moves the cursor to the next boundary of m and returns its position.
+// If there is none, the cursor stays where it is.
+func (c *Cursor) Next(m Metric) (int, bool) {
+	if c.position >= c.root.Len() {
+		return c.position, false
+	}
+	leaf, offset := c.GetLeaf()
+	if next, ok := m.Next(leaf, offset); ok {
+		c.Set(c.offsetOfLeaf + next)
+		return c.position, true
+	}
+	if !m.CanFragment() {
+		c.Set(c.offsetOfLeaf + leaf.Len())
+		return c.position, true
+	}
+
+	// the boundary is in another leaf, find it by its measure
+	measured := c.root.Count(m, c.position)
+	if measured+1 > c.root.Measure(m) {
+		return c.position, false
+	}
+	c.Set(c.root.CountBaseUnits(m, measured+1))
+	return c.position, true
+}
+
+// Moves the cursor to the previous boundary of m and returns its position.
+// If there is none, the cursor stays where it is.
+func (c *Cursor) Prev(m Metric) (int, bool) {
+	if c.position == 0 {
+		return 0, false
+	}
+	leaf, offset := c.GetLeaf()
+	if offset == 0 {
+		c.descend(c.position - 1)
+		leaf, offset = c.GetLeaf()
+	}
+	if prev, ok := m.Prev(leaf, offset); ok {
+		c.Set(c.offsetOfLeaf + prev)
+		return c.position, true
+	}
+	if !m.CanFragment() {
+		c.Set(c.offsetOfLeaf)
+		return c.position, true
+	}
+
+	// the boundary is in another leaf, find it by its measure
+	measured := c.root.Count(m, c.position-1)
+	c.Set(c.root.CountBaseUnits(m, measured))
+	return c.position, true
+}
+
+// Returns the current position if it is a boundary of m, otherwise moves to the next boundary.
+func (c *Cursor) AtOrNext(m Metric) (int, bool) {
+	if c.IsBoundary(m) {
+		return c.position, true
+	}
+	return c.Next(m)
+}
+
+// Returns the current position if it is a boundary of m, otherwise moves to the previous boundary.
+func (c *Cursor) AtOrPrev(m Metric) (int, bool) {
+	if c.IsBoundary(m) {
+		return c.position, true
+	}
+	return c.Prev(m)
+}
+
+// Finds the leaf containing position, which is the later leaf if position is at the border of two leaves.
+func (c *Cursor) descend(position int) {
+	cur := c.root
+	offset := 0
+	for !cur.isLeaf() {
+		children := cur.getChildren()
+		for i, child := range children {
+			if position < offset+child.Len() || i == len(children)-1 {
+				cur = child
+				break
+			}
+			offset += child.Len()
+		}
+	}
+	c.leaf = cur.getLeaf()
+	c.offsetOfLeaf = offset
+}
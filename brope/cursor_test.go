@@ -0,0 +1,156 @@
+package BRope
+
+import (
+	"strings"
+	"testing"
+)
+
+// Builds a rope with many leaves out of lines that are 100 runes long
+func bigLineRope(lines int) (Rope, string) {
+	var sb strings.Builder
+	for i := 0; i < lines; i++ {
+		line := "line " + strings.Repeat("x", 94) + "\n"
+		sb.WriteString(line)
+	}
+	s := sb.String()
+
+	b := NewTreeBuilder()
+	runes := []rune(s)
+	for i := 0; i < len(runes); i += 300 {
+		b.PushLeaf(StringLeaf{runes[i:min(i+300, len(runes))]})
+	}
+	return b.Build(), s
+}
+
+func TestMultiLeafLineOffsets(t *testing.T) {
+	rope, s := bigLineRope(100)
+	if rope.Height() == 0 {
+		t.Fatalf("expected rope with multiple leaves")
+	}
+	expectString(s, rope, t)
+	expectInt(101, rope.LineCount(), t)
+
+	for line := 0; line <= 100; line++ {
+		expectInt(line*100, rope.OffsetOfLine(line), t)
+		expectInt(line, rope.LineOfOffset(line*100), t)
+	}
+	expectInt(3, rope.LineOfOffset(399), t)
+}
+
+func TestMetricCount(t *testing.T) {
+	rope := NewRopeString("aä€😀\n")
+
+	expectInt(5, rope.Measure(BaseMetric{}), t)
+	expectInt(1+2+3+4+1, rope.Measure(Utf8Metric{}), t)
+	expectInt(1+1+1+2+1, rope.Measure(Utf16Metric{}), t)
+	expectInt(1, rope.Measure(LinesMetric{}), t)
+
+	expectInt(6, rope.Count(Utf8Metric{}, 3), t)
+	expectInt(3, rope.CountBaseUnits(Utf8Metric{}, 6), t)
+	expectInt(5, rope.Count(Utf16Metric{}, 4), t)
+	expectInt(4, rope.CountBaseUnits(Utf16Metric{}, 5), t)
+}
+
+func TestCursorLines(t *testing.T) {
+	rope, _ := bigLineRope(50)
+	c := NewCursor(rope, 0)
+
+	for line := 1; line <= 50; line++ {
+		pos, ok := c.Next(LinesMetric{})
+		if !ok {
+			t.Fatalf("expected next line %v", line)
+		}
+		expectInt(line*100, pos, t)
+	}
+	if _, ok := c.Next(LinesMetric{}); ok {
+		t.Fatalf("expected no line after the last one")
+	}
+
+	c.Set(250)
+	pos, _ := c.Prev(LinesMetric{})
+	expectInt(200, pos, t)
+	pos, _ = c.Prev(LinesMetric{})
+	expectInt(100, pos, t)
+	pos, _ = c.Prev(LinesMetric{})
+	expectInt(0, pos, t)
+	if _, ok := c.Prev(LinesMetric{}); ok {
+		t.Fatalf("expected no line before the first one")
+	}
+
+	c.Set(300)
+	expectInt(1, boolToInt(c.IsBoundary(LinesMetric{})), t)
+	c.Set(301)
+	expectInt(0, boolToInt(c.IsBoundary(LinesMetric{})), t)
+	pos, _ = c.AtOrPrev(LinesMetric{})
+	expectInt(300, pos, t)
+
+	expectInt(1700, c.Seek(LinesMetric{}, 17), t)
+}
+
+func TestCursorRunes(t *testing.T) {
+	rope, s := bigLineRope(20)
+	c := NewCursor(rope, 0)
+
+	var sb strings.Builder
+	for {
+		r, ok := c.NextRune()
+		if !ok {
+			break
+		}
+		sb.WriteRune(r)
+	}
+	expectString(s, rope, t)
+	if sb.String() != s {
+		t.Fatalf("runes read by cursor do not match rope")
+	}
+
+	r, _ := c.PrevRune()
+	expectInt('\n', int(r), t)
+	expectInt(len(s)-1, c.Pos(), t)
+}
+
+func TestCursorLeaves(t *testing.T) {
+	rope, s := bigLineRope(20)
+	c := NewCursor(rope, 0)
+
+	leaf, _ := c.GetLeaf()
+	content := string(leaf.Runes())
+	for {
+		leaf, ok := c.NextLeaf()
+		if !ok {
+			break
+		}
+		content += string(leaf.Runes())
+	}
+	if content != s {
+		t.Fatalf("leaves do not add up to the rope")
+	}
+}
+
+func TestCursorGraphemes(t *testing.T) {
+	// e + combining acute accent, family emoji joined by ZWJ, CRLF
+	rope := NewRopeString("é👨‍👩‍👧\r\nx")
+	c := NewCursor(rope, 0)
+
+	expectInt(4, rope.Measure(GraphemeMetric{}), t)
+
+	pos, _ := c.Next(GraphemeMetric{})
+	expectInt(2, pos, t)
+	pos, _ = c.Next(GraphemeMetric{})
+	expectInt(7, pos, t)
+	pos, _ = c.Next(GraphemeMetric{})
+	expectInt(9, pos, t)
+	pos, _ = c.Prev(GraphemeMetric{})
+	expectInt(7, pos, t)
+
+	c.Set(1)
+	expectInt(0, boolToInt(c.IsBoundary(GraphemeMetric{})), t)
+	expectInt(2, rope.CountBaseUnits(GraphemeMetric{}, 1), t)
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,361 @@
+package BRope
+
+import "sort"
+
+// A Delta describes a change of a rope as a sequence of elements that either copy an interval of the
+// base rope or insert new content. Applying the elements in order builds the new rope.
+//
+// It is a reimplementation of the delta of the xi-editor. Deltas can be applied, inverted, composed
+// and transformed against concurrent deltas, which makes them the common currency for undo,
+// change notifications and collaborative editing.
+//
+// Deltas built with a DeltaBuilder are in canonical form: copied intervals are ascending and
+// do not overlap, adjacent copies and inserts are merged. All operations assume this form.
+type Delta struct {
+	Els []DeltaElement
+	// length of the rope the delta applies to
+	BaseLen int
+}
+
+type DeltaElement interface {
+	isDeltaElement()
+}
+
+// Copies the interval of the base rope
+type CopyElement struct {
+	Interval
+}
+
+// Inserts new content
+type InsertElement struct {
+	Node
+}
+
+func (CopyElement) isDeltaElement()   {}
+func (InsertElement) isDeltaElement() {}
+
+// A replacement of an interval of the base rope with new content
+type Edit struct {
+	Interval
+	Insert Node
+}
+
+// SimpleEdit creates a delta that replaces iv of a rope of length baseLen with toInsert.
+func SimpleEdit(iv Interval, toInsert Node, baseLen int) Delta {
+	b := NewDeltaBuilder(baseLen)
+	b.Replace(iv, toInsert)
+	return b.Build()
+}
+
+// Length of the rope that results from applying the delta
+func (d Delta) NewLen() int {
+	l := 0
+	for _, el := range d.Els {
+		switch el := el.(type) {
+		case CopyElement:
+			l += el.Len()
+		case InsertElement:
+			l += el.Len()
+		}
+	}
+	return l
+}
+
+// Whether applying the delta does not change the rope
+func (d Delta) IsIdentity() bool {
+	switch len(d.Els) {
+	case 0:
+		return d.BaseLen == 0
+	case 1:
+		c, ok := d.Els[0].(CopyElement)
+		return ok && c.Interval == IV(0, d.BaseLen)
+	default:
+		return false
+	}
+}
+
+func (d Delta) Apply(base Node) Node {
+	if base.Len() != d.BaseLen {
+		panic("Delta: base length does not match the rope")
+	}
+	b := NewTreeBuilder()
+	// small pieces are collected and pushed as whole leaves, merging them into the last leaf
+	// one by one would copy the leaf for every piece
+	pending := []rune{}
+	flush := func() {
+		if len(pending) > 0 {
+			b.PushLeaves(splitLeaves(pending))
+			pending = []rune{}
+		}
+	}
+	for _, el := range d.Els {
+		switch el := el.(type) {
+		case CopyElement:
+			if el.Len() < MIN_LEAF {
+				pending = append(pending, base.slice(el.Interval).Runes()...)
+			} else {
+				flush()
+				b.PushSlice(base, el.Interval)
+			}
+		case InsertElement:
+			if el.Len() < MIN_LEAF {
+				pending = append(pending, el.Runes()...)
+			} else {
+				flush()
+				b.Push(el.Node)
+			}
+		}
+		if len(pending) >= MAX_LEAF {
+			flush()
+		}
+	}
+	flush()
+	return b.Build()
+}
+
+// Edits returns the delta as a list of ascending, non overlapping replacements of the base rope.
+func (d Delta) Edits() []Edit {
+	edits := []Edit{}
+	basePos := 0
+	pending := EmptyRope()
+	flush := func(hi int) {
+		if hi > basePos || !pending.IsEmpty() {
+			edits = append(edits, Edit{IV(basePos, hi), pending})
+			pending = EmptyRope()
+		}
+	}
+	for _, el := range d.Els {
+		switch el := el.(type) {
+		case CopyElement:
+			flush(el.Lo)
+			basePos = el.Hi
+		case InsertElement:
+			pending = concat(pending, el.Node)
+		}
+	}
+	flush(d.BaseLen)
+	return edits
+}
+
+// Summary returns the smallest interval of the base rope that covers all changes and the length
+// of the content replacing it.
+func (d Delta) Summary() (iv Interval, newLen int) {
+	edits := d.Edits()
+	if len(edits) == 0 {
+		return IV(d.BaseLen, d.BaseLen), 0
+	}
+	first, last := edits[0], edits[len(edits)-1]
+	iv = IV(first.Lo, last.Hi)
+	return iv, d.NewLen() - (d.BaseLen - iv.Len())
+}
+
+// Invert returns the delta that undoes d. base is the rope d applies to.
+func (d Delta) Invert(base Node) Delta {
+	b := NewDeltaBuilder(d.NewLen())
+	basePos, newPos := 0, 0
+	for _, el := range d.Els {
+		switch el := el.(type) {
+		case CopyElement:
+			if el.Lo > basePos {
+				b.Insert(newPos, base.slice(IV(basePos, el.Lo)))
+			}
+			basePos = el.Hi
+			newPos += el.Len()
+		case InsertElement:
+			b.Delete(IV(newPos, newPos+el.Len()))
+			newPos += el.Len()
+		}
+	}
+	if d.BaseLen > basePos {
+		b.Insert(newPos, base.slice(IV(basePos, d.BaseLen)))
+	}
+	return b.Build()
+}
+
+// Compose returns a delta that has the same effect as applying d and then next.
+func (d Delta) Compose(next Delta) Delta {
+	if next.BaseLen != d.NewLen() {
+		panic("Delta: can only compose with a delta based on the result of this one")
+	}
+
+	// offsets of the elements of d in the rope after applying d
+	starts := make([]int, len(d.Els)+1)
+	for i, el := range d.Els {
+		starts[i+1] = starts[i] + elementLen(el)
+	}
+
+	result := Delta{BaseLen: d.BaseLen}
+	for _, el := range next.Els {
+		switch el := el.(type) {
+		case InsertElement:
+			result.push(el)
+		case CopyElement:
+			i := sort.Search(len(d.Els), func(i int) bool { return starts[i+1] > el.Lo })
+			for ; i < len(d.Els) && starts[i] < el.Hi; i++ {
+				start := starts[i]
+				overlap := el.Interval.Intersection(IV(start, starts[i+1])).Translate(-start)
+				switch prev := d.Els[i].(type) {
+				case CopyElement:
+					result.push(CopyElement{overlap.Translate(prev.Lo)})
+				case InsertElement:
+					result.push(InsertElement{prev.slice(overlap)})
+				}
+			}
+		}
+	}
+	return result
+}
+
+// Transform rewrites d, so that it can be applied after other. Both deltas have to be based on
+// the same rope. Concurrent insertions at the same offset are ordered by after: if true, the content
+// inserted by d ends up behind the content inserted by other.
+//
+// Content inserted by other is never deleted by the transformed delta, so transforming both deltas
+// against each other with opposite values for after converges to the same rope.
+func (d Delta) Transform(other Delta, after bool) Delta {
+	if d.BaseLen != other.BaseLen {
+		panic("Delta: can only transform deltas based on the same rope")
+	}
+	otherEdits := other.Edits()
+	b := NewDeltaBuilder(other.NewLen())
+	for _, e := range d.Edits() {
+		b.Insert(transformInsertion(otherEdits, e, after), e.Insert)
+
+		// the parts of the interval that other did not touch are deleted
+		cur := e.Lo
+		for _, oe := range otherEdits {
+			if oe.Lo >= e.Hi {
+				break
+			}
+			if oe.Hi < cur || (oe.IsEmpty() && oe.Lo <= cur) {
+				continue
+			}
+			if oe.Lo > cur {
+				b.Delete(IV(transformOffset(otherEdits, cur, true), transformOffset(otherEdits, oe.Lo, false)))
+			}
+			cur = max(cur, oe.Hi)
+		}
+		if cur < e.Hi {
+			b.Delete(IV(transformOffset(otherEdits, cur, true), transformOffset(otherEdits, e.Hi, false)))
+		}
+	}
+	return b.Build()
+}
+
+// Finds the offset where the content inserted by e goes after applying the edits of other.
+func transformInsertion(otherEdits []Edit, e Edit, after bool) int {
+	for _, oe := range otherEdits {
+		if oe.Lo > e.Lo {
+			break
+		}
+		if oe.Lo == e.Lo {
+			// both edits start at the same offset
+			offset := transformOffset(otherEdits, oe.Lo, false)
+			if after {
+				offset += oe.Insert.Len()
+			}
+			return offset
+		}
+		if e.Lo < oe.Hi {
+			// e starts inside of the interval replaced by other
+			return transformOffset(otherEdits, oe.Lo, false) + oe.Insert.Len()
+		}
+	}
+	return transformOffset(otherEdits, e.Lo, after)
+}
+
+// TransformOffset maps an offset of the base rope to the rope after applying the delta.
+// If content was inserted right at offset, after decides whether the offset moves behind it.
+func (d Delta) TransformOffset(offset int, after bool) int {
+	return transformOffset(d.Edits(), offset, after)
+}
+
+func transformOffset(edits []Edit, offset int, after bool) int {
+	shift := 0
+	for _, e := range edits {
+		if e.Hi < offset || (e.Hi == offset && (e.Lo < offset || after)) {
+			shift += e.Insert.Len() - e.Len()
+			continue
+		}
+		if e.Lo < offset && offset < e.Hi {
+			// the offset was deleted, move it to the edge of the replacement
+			if after {
+				return e.Lo + shift + e.Insert.Len()
+			}
+			return e.Lo + shift
+		}
+		break
+	}
+	return offset + shift
+}
+
+// Appends el, merging it with the last element if possible
+func (d *Delta) push(el DeltaElement) {
+	if elementLen(el) == 0 {
+		return
+	}
+	if len(d.Els) > 0 {
+		last := d.Els[len(d.Els)-1]
+		switch el := el.(type) {
+		case CopyElement:
+			if prev, ok := last.(CopyElement); ok && prev.Hi == el.Lo {
+				d.Els[len(d.Els)-1] = CopyElement{IV(prev.Lo, el.Hi)}
+				return
+			}
+		case InsertElement:
+			if prev, ok := last.(InsertElement); ok {
+				d.Els[len(d.Els)-1] = InsertElement{concat(prev.Node, el.Node)}
+				return
+			}
+		}
+	}
+	d.Els = append(d.Els, el)
+}
+
+func elementLen(el DeltaElement) int {
+	switch el := el.(type) {
+	case CopyElement:
+		return el.Len()
+	case InsertElement:
+		return el.Len()
+	default:
+		panic("Unknown delta element type")
+	}
+}
+
+// DeltaBuilder builds a delta from replacements, which have to be given in ascending order and must not overlap.
+type DeltaBuilder struct {
+	delta Delta
+	// end of the last replaced interval
+	lastOffset int
+}
+
+func NewDeltaBuilder(baseLen int) DeltaBuilder {
+	return DeltaBuilder{delta: Delta{BaseLen: baseLen}}
+}
+
+// Replaces iv of the base rope with toInsert
+func (b *DeltaBuilder) Replace(iv Interval, toInsert Node) {
+	if iv.Lo < b.lastOffset || iv.Hi > b.delta.BaseLen || iv.Hi < iv.Lo {
+		panic("DeltaBuilder: replacements have to be ascending, non overlapping and inside the base rope")
+	}
+	b.delta.push(CopyElement{IV(b.lastOffset, iv.Lo)})
+	if toInsert.NodeBody != nil {
+		b.delta.push(InsertElement{toInsert})
+	}
+	b.lastOffset = iv.Hi
+}
+
+func (b *DeltaBuilder) Delete(iv Interval) {
+	b.Replace(iv, EmptyRope())
+}
+
+func (b *DeltaBuilder) Insert(offset int, toInsert Node) {
+	b.Replace(IV(offset, offset), toInsert)
+}
+
+func (b *DeltaBuilder) Build() Delta {
+	b.delta.push(CopyElement{IV(b.lastOffset, b.delta.BaseLen)})
+	b.lastOffset = b.delta.BaseLen
+	return b.delta
+}
@@ -0,0 +1,96 @@
+package BRope
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestDeltaApply(t *testing.T) {
+	base := NewRopeString("hello world")
+	b := NewDeltaBuilder(base.Len())
+	b.Replace(IV(0, 5), NewRopeString("goodbye"))
+	b.Insert(11, NewRopeString("!"))
+	d := b.Build()
+
+	expectString("goodbye world!", d.Apply(base), t)
+	expectInt(14, d.NewLen(), t)
+
+	iv, newLen := d.Summary()
+	expectInt(0, iv.Lo, t)
+	expectInt(11, iv.Hi, t)
+	expectInt(14, newLen, t)
+}
+
+func TestDeltaInvert(t *testing.T) {
+	base := NewRopeString("hello world")
+	d := SimpleEdit(IV(2, 8), NewRopeString("XY"), base.Len())
+	changed := d.Apply(base)
+	expectString("heXYrld", changed, t)
+
+	inverse := d.Invert(base)
+	expectString("hello world", inverse.Apply(changed), t)
+}
+
+func TestDeltaCompose(t *testing.T) {
+	base := NewRopeString("hello world")
+	d1 := SimpleEdit(IV(5, 5), NewRopeString(","), base.Len())
+	d2 := SimpleEdit(IV(0, 1), NewRopeString("j"), d1.NewLen())
+
+	composed := d1.Compose(d2)
+	expectString("jello, world", composed.Apply(base), t)
+	expectString(d2.Apply(d1.Apply(base)).String(), composed.Apply(base), t)
+}
+
+func TestDeltaTransform(t *testing.T) {
+	base := NewRopeString("abcdef")
+	d1 := SimpleEdit(IV(1, 1), NewRopeString("X"), base.Len())
+	d2 := SimpleEdit(IV(1, 1), NewRopeString("Y"), base.Len())
+
+	left := d2.Transform(d1, true).Apply(d1.Apply(base))
+	right := d1.Transform(d2, false).Apply(d2.Apply(base))
+	expectString("aXYbcdef", left, t)
+	expectString("aXYbcdef", right, t)
+
+	expectInt(1, d1.TransformOffset(1, false), t)
+	expectInt(2, d1.TransformOffset(1, true), t)
+	expectInt(4, d1.TransformOffset(3, false), t)
+}
+
+func randomDelta(rng *rand.Rand, baseLen int) Delta {
+	b := NewDeltaBuilder(baseLen)
+	offset := 0
+	for offset < baseLen && rng.Intn(4) > 0 {
+		lo := offset + rng.Intn(baseLen-offset+1)
+		hi := lo + rng.Intn(baseLen-lo+1)/2
+		text := ""
+		for i := rng.Intn(4); i > 0; i-- {
+			text += string(rune('A' + rng.Intn(26)))
+		}
+		b.Replace(IV(lo, hi), NewRopeString(text))
+		offset = hi + 1
+	}
+	return b.Build()
+}
+
+func TestDeltaRandomized(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	for i := 0; i < 1000; i++ {
+		base := NewRopeString("0123456789abcdefghij"[:rng.Intn(21)])
+		d1 := randomDelta(rng, base.Len())
+		d2 := randomDelta(rng, base.Len())
+
+		// inverse restores the base
+		expectString(base.String(), d1.Invert(base).Apply(d1.Apply(base)), t)
+
+		// composition matches sequential application
+		d3 := randomDelta(rng, d1.NewLen())
+		expectString(d3.Apply(d1.Apply(base)).String(), d1.Compose(d3).Apply(base), t)
+
+		// transformed deltas converge
+		left := d2.Transform(d1, true).Apply(d1.Apply(base))
+		right := d1.Transform(d2, false).Apply(d2.Apply(base))
+		if left.String() != right.String() {
+			t.Fatalf("transformed deltas diverge on '%v': '%v' != '%v'", base, left, right)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package BRope
+
+import (
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+)
+
+// A Metric measures the rope in some unit (lines, bytes, grapheme clusters, ...) and knows
+// where the boundaries of that unit are inside a leaf. It is modeled after the metrics of the xi-editor.
+//
+// The base unit of the rope is a rune, so every offset given to or returned from a metric is in runes.
+// A boundary at offset b means that a unit ends right before b, for example the boundaries of the
+// LinesMetric are the offsets right after a '\n'. Offset 0 of the rope is always a boundary.
+type Metric interface {
+	// Size of a node in units of the metric
+	Measure(info NodeInfo) int
+	// Converts a measure inside the leaf into an offset in base units
+	ToBaseUnits(l Leaf, inMeasuredUnits int) int
+	// Converts an offset in base units inside the leaf into the measure of [0, offset)
+	FromBaseUnits(l Leaf, inBaseUnits int) int
+	IsBoundary(l Leaf, offset int) bool
+	// Last boundary strictly before offset inside the leaf
+	Prev(l Leaf, offset int) (int, bool)
+	// First boundary strictly after offset inside the leaf
+	Next(l Leaf, offset int) (int, bool)
+	// Whether a leaf can contain no boundary at all. If false, the end of every leaf is a boundary.
+	CanFragment() bool
+}
+
+// Measures runes, every offset is a boundary.
+type BaseMetric struct{}
+
+// Measures lines, the boundaries are the offsets after each '\n'.
+type LinesMetric struct{}
+
+// Measures the length in bytes of the rope encoded as utf-8.
+type Utf8Metric struct{}
+
+// Measures the length in code units of the rope encoded as utf-16. Used by LSP positions.
+type Utf16Metric struct{}
+
+// Measures grapheme clusters (user perceived characters).
+// Leaf boundaries are treated as cluster boundaries, so a cluster that was split by an edit
+// into two leaves is counted twice.
+type GraphemeMetric struct{}
+
+func (BaseMetric) Measure(info NodeInfo) int           { return info.len }
+func (BaseMetric) ToBaseUnits(l Leaf, in int) int      { return min(in, l.Len()) }
+func (BaseMetric) FromBaseUnits(l Leaf, in int) int    { return min(in, l.Len()) }
+func (BaseMetric) IsBoundary(l Leaf, offset int) bool  { return true }
+func (BaseMetric) Prev(l Leaf, offset int) (int, bool) { return prevRune(l, offset) }
+func (BaseMetric) Next(l Leaf, offset int) (int, bool) { return nextRune(l, offset) }
+func (BaseMetric) CanFragment() bool                   { return false }
+
+func (LinesMetric) Measure(info NodeInfo) int { return info.newlines }
+
+func (LinesMetric) ToBaseUnits(l Leaf, in int) int {
+	if in <= 0 {
+		return 0
+	}
+	for i, r := range l.Runes() {
+		if r == '\n' {
+			in--
+			if in == 0 {
+				return i + 1
+			}
+		}
+	}
+	return l.Len()
+}
+
+func (LinesMetric) FromBaseUnits(l Leaf, in int) int {
+	newlines := 0
+	for _, r := range l.Runes()[:min(in, l.Len())] {
+		if r == '\n' {
+			newlines++
+		}
+	}
+	return newlines
+}
+
+func (LinesMetric) IsBoundary(l Leaf, offset int) bool {
+	return offset > 0 && l.Runes()[offset-1] == '\n'
+}
+
+func (LinesMetric) Prev(l Leaf, offset int) (int, bool) {
+	runes := l.Runes()
+	for i := offset - 2; i >= 0; i-- {
+		if runes[i] == '\n' {
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+func (LinesMetric) Next(l Leaf, offset int) (int, bool) {
+	runes := l.Runes()
+	for i := offset; i < len(runes); i++ {
+		if runes[i] == '\n' {
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+func (LinesMetric) CanFragment() bool { return true }
+
+func (Utf8Metric) Measure(info NodeInfo) int { return info.utf8 }
+
+func (Utf8Metric) ToBaseUnits(l Leaf, in int) int {
+	return toBaseUnitsBy(l, in, utf8RuneLen)
+}
+
+func (Utf8Metric) FromBaseUnits(l Leaf, in int) int {
+	return fromBaseUnitsBy(l, in, utf8RuneLen)
+}
+
+func (Utf8Metric) IsBoundary(l Leaf, offset int) bool  { return true }
+func (Utf8Metric) Prev(l Leaf, offset int) (int, bool) { return prevRune(l, offset) }
+func (Utf8Metric) Next(l Leaf, offset int) (int, bool) { return nextRune(l, offset) }
+func (Utf8Metric) CanFragment() bool                   { return false }
+
+func (Utf16Metric) Measure(info NodeInfo) int { return info.utf16 }
+
+func (Utf16Metric) ToBaseUnits(l Leaf, in int) int {
+	return toBaseUnitsBy(l, in, utf16RuneLen)
+}
+
+func (Utf16Metric) FromBaseUnits(l Leaf, in int) int {
+	return fromBaseUnitsBy(l, in, utf16RuneLen)
+}
+
+func (Utf16Metric) IsBoundary(l Leaf, offset int) bool  { return true }
+func (Utf16Metric) Prev(l Leaf, offset int) (int, bool) { return prevRune(l, offset) }
+func (Utf16Metric) Next(l Leaf, offset int) (int, bool) { return nextRune(l, offset) }
+func (Utf16Metric) CanFragment() bool                   { return false }
+
+func (GraphemeMetric) Measure(info NodeInfo) int { return info.graphemes }
+
+func (GraphemeMetric) ToBaseUnits(l Leaf, in int) int {
+	if in <= 0 {
+		return 0
+	}
+	boundaries := graphemeBoundaries(l.Runes())
+	if in > len(boundaries) {
+		return l.Len()
+	}
+	return boundaries[in-1]
+}
+
+func (GraphemeMetric) FromBaseUnits(l Leaf, in int) int {
+	return countGraphemes(l.Runes()[:min(in, l.Len())])
+}
+
+func (GraphemeMetric) IsBoundary(l Leaf, offset int) bool {
+	if offset == 0 {
+		return true
+	}
+	for _, b := range graphemeBoundaries(l.Runes()) {
+		if b >= offset {
+			return b == offset
+		}
+	}
+	return false
+}
+
+func (GraphemeMetric) Prev(l Leaf, offset int) (int, bool) {
+	if offset <= 0 {
+		return 0, false
+	}
+	prev := 0
+	for _, b := range graphemeBoundaries(l.Runes()) {
+		if b >= offset {
+			break
+		}
+		prev = b
+	}
+	return prev, true
+}
+
+func (GraphemeMetric) Next(l Leaf, offset int) (int, bool) {
+	for _, b := range graphemeBoundaries(l.Runes()) {
+		if b > offset {
+			return b, true
+		}
+	}
+	return 0, false
+}
+
+func (GraphemeMetric) CanFragment() bool { return false }
+
+// Measure of the whole rope in units of m
+func (n Node) Measure(m Metric) int {
+	return m.Measure(n.NodeInfo)
+}
+
+// Count converts an offset in base units into units of m, by measuring [0, offset).
+func (n Node) Count(m Metric, offset int) int {
+	offset = max(0, min(offset, n.Len()))
+	cur := n
+	measured := 0
+	for !cur.isLeaf() {
+		children := cur.getChildren()
+		for i, child := range children {
+			if offset < child.Len() || i == len(children)-1 {
+				cur = child
+				break
+			}
+			measured += m.Measure(child.NodeInfo)
+			offset -= child.Len()
+		}
+	}
+	return measured + m.FromBaseUnits(cur.getLeaf(), offset)
+}
+
+// CountBaseUnits converts a measure in units of m into an offset in base units.
+// It is the inverse of Count on the boundaries of m.
+func (n Node) CountBaseUnits(m Metric, measured int) int {
+	cur := n
+	offset := 0
+	for !cur.isLeaf() {
+		children := cur.getChildren()
+		for i, child := range children {
+			childMeasure := m.Measure(child.NodeInfo)
+			if measured <= childMeasure || i == len(children)-1 {
+				cur = child
+				break
+			}
+			measured -= childMeasure
+			offset += child.Len()
+		}
+	}
+	return offset + m.ToBaseUnits(cur.getLeaf(), measured)
+}
+
+func prevRune(l Leaf, offset int) (int, bool) {
+	if offset <= 0 {
+		return 0, false
+	}
+	return offset - 1, true
+}
+
+func nextRune(l Leaf, offset int) (int, bool) {
+	if offset >= l.Len() {
+		return 0, false
+	}
+	return offset + 1, true
+}
+
+func toBaseUnitsBy(l Leaf, in int, runeLen func(rune) int) int {
+	acc := 0
+	for i, r := range l.Runes() {
+		if acc >= in {
+			return i
+		}
+		acc += runeLen(r)
+	}
+	return l.Len()
+}
+
+func fromBaseUnitsBy(l Leaf, in int, runeLen func(rune) int) int {
+	acc := 0
+	for _, r := range l.Runes()[:min(in, l.Len())] {
+		acc += runeLen(r)
+	}
+	return acc
+}
+
+// Invalid runes are written as utf8.RuneError, which is 3 bytes long
+func utf8RuneLen(r rune) int {
+	if n := utf8.RuneLen(r); n > 0 {
+		return n
+	}
+	return utf8.RuneLen(utf8.RuneError)
+}
+
+func utf16RuneLen(r rune) int {
+	if r >= 0x10000 && r <= utf8.MaxRune {
+		return 2
+	}
+	return 1
+}
+
+// Returns the end offsets of all grapheme clusters in runes
+func graphemeBoundaries(runes []rune) []int {
+	boundaries := make([]int, 0, len(runes))
+	if isSimpleText(runes) {
+		for i := range runes {
+			boundaries = append(boundaries, i+1)
+		}
+		return boundaries
+	}
+
+	offset := 0
+	state := -1
+	str := string(runes)
+	var cluster string
+	for len(str) > 0 {
+		cluster, str, _, state = uniseg.FirstGraphemeClusterInString(str, state)
+		offset += utf8.RuneCountInString(cluster)
+		boundaries = append(boundaries, offset)
+	}
+	return boundaries
+}
+
+func countGraphemes(runes []rune) int {
+	if isSimpleText(runes) {
+		return len(runes)
+	}
+	return uniseg.GraphemeClusterCount(string(runes))
+}
+
+// Text in which every rune is its own grapheme cluster. Combining marks start at U+0300,
+// '\r' is excluded because "\r\n" is a single cluster.
+func isSimpleText(runes []rune) bool {
+	for _, r := range runes {
+		if r >= 0x300 || r == '\r' {
+			return false
+		}
+	}
+	return true
+}
@@ -2,6 +2,7 @@ package BRope
 
 import (
 	"slices"
+	"unicode/utf8"
 )
 
 const (
@@ -23,7 +24,6 @@ const (
 // LineOfOffset
 
 // TODO Features:
-// Cursor with Metrics
 // Parameterized b-tree
 
 type Leaf interface {
@@ -64,14 +64,18 @@ func (s StringLeaf) Interval() Interval {
 	return Interval{0, s.Len()}
 }
 
+// Creates a rope of leaves that share the memory of s
 func NewRope(s []rune) Node {
-	leaf := StringLeaf{s}
-	return NodeFromLeaf(leaf)
+	if len(s) <= MAX_LEAF {
+		return NodeFromLeaf(StringLeaf{s})
+	}
+	b := NewTreeBuilder()
+	b.PushLeaves(splitLeaves(s))
+	return b.Build()
 }
 
 func NewRopeString(s string) Node {
-	leaf := StringLeaf{[]rune(s)}
-	return NodeFromLeaf(leaf)
+	return NewRope([]rune(s))
 }
 
 func EmptyRope() Node {
@@ -95,20 +99,43 @@ type NodeInfo struct {
 	len int
 	// amount of '\n' in a string
 	newlines int
+	// length of the string encoded as utf-8 and utf-16
+	utf8, utf16 int
+	// amount of grapheme clusters, see GraphemeMetric
+	graphemes int
 }
 
 func (n *NodeInfo) compute(leaf Leaf) {
 	n.len = leaf.Len()
+	simple := true
 	for _, char := range leaf.Runes() {
-		if char == '\n' {
-			n.newlines++
+		if char < utf8.RuneSelf {
+			// ascii fast path
+			if char == '\n' {
+				n.newlines++
+			}
+			simple = simple && char != '\r'
+			n.utf8++
+			n.utf16++
+			continue
 		}
+		simple = simple && char < 0x300
+		n.utf8 += utf8RuneLen(char)
+		n.utf16 += utf16RuneLen(char)
+	}
+	if simple {
+		n.graphemes = n.len
+	} else {
+		n.graphemes = countGraphemes(leaf.Runes())
 	}
 }
 
 func (n *NodeInfo) accumulate(other NodeInfo) {
 	n.len = n.len + other.len
 	n.newlines = n.newlines + other.newlines
+	n.utf8 = n.utf8 + other.utf8
+	n.utf16 = n.utf16 + other.utf16
+	n.graphemes = n.graphemes + other.graphemes
 }
 
 // Type of node values.
@@ -146,7 +173,7 @@ func NodeFromNodes(nodes []Node) Node {
 	}
 	height := nodes[0].height
 	len := nodes[0].len
-	info := NodeInfo{}
+	info := nodes[0].NodeInfo
 	for _, n := range nodes[1:] {
 		if height != n.height {
 			panic("Invariance: All nodes are same height")
@@ -235,21 +262,37 @@ func mergeLeaves(rope1 Node, rope2 Node) Node {
 	if bothOk {
 		return NodeFromNodes([]Node{rope1, rope2})
 	} else {
-		leaf1 := rope1.getLeaf()
-		leaf2 := rope2.getLeaf()
-		if leaf1.Len()+leaf2.Len() <= MAX_LEAF {
-			// TODO currently always copy for safety. Later one could use context on write to also mutate in place, if only one referen to node
-			newRunes := slices.Concat(slices.Clone(leaf1.Runes()), slices.Clone(leaf2.Runes()))
-			newLeaf := StringLeaf{newRunes}
-			return NodeFromLeaf(newLeaf)
-		} else {
-			space := MAX_LEAF - leaf1.Len()
-			nv := slices.Concat(slices.Clone(leaf1.Runes()), slices.Clone(leaf2.Runes()[:space]))
-			new1 := StringLeaf{nv}
-			new2 := StringLeaf{slices.Clone(leaf2.Runes()[space:])}
-			return NodeFromNodes([]Node{NodeFromLeaf(new1), NodeFromLeaf(new2)})
+		// TODO currently always copy for safety. Later one could use context on write to also mutate in place, if only one referen to node
+		left, right := pushMaybeSplit(rope1.getLeaf(), rope2.getLeaf())
+		if right == nil {
+			return NodeFromLeaf(left)
+		}
+		return NodeFromNodes([]Node{NodeFromLeaf(left), NodeFromLeaf(right)})
+	}
+}
+
+// Appends leaf2 to leaf1. If the result does not fit into a single leaf, it is split
+// into two leaves that both satisfy IsOkChild. right is nil if no split was needed.
+func pushMaybeSplit(leaf1 Leaf, leaf2 Leaf) (left Leaf, right Leaf) {
+	runes := slices.Concat(leaf1.Runes(), leaf2.Runes())
+	if len(runes) <= MAX_LEAF {
+		return StringLeaf{runes}, nil
+	}
+	splitpoint := findLeafSplitForMerge(runes)
+	return StringLeaf{runes[:splitpoint:splitpoint]}, StringLeaf{runes[splitpoint:]}
+}
+
+// Finds a split point so that both halves are at least MIN_LEAF long, preferring to
+// split right after a newline.
+func findLeafSplitForMerge(runes []rune) int {
+	splitpoint := min(MAX_LEAF, len(runes)-MIN_LEAF)
+	minsplit := min(max(MIN_LEAF, len(runes)-MAX_LEAF), splitpoint)
+	for i := splitpoint - 1; i >= minsplit-1; i-- {
+		if runes[i] == '\n' {
+			return i + 1
 		}
 	}
+	return avoidCRLFSplit(runes, splitpoint)
 }
 
 // Concatenates two ropes (strings)
@@ -262,7 +305,7 @@ func concat(rope1 Node, rope2 Node) Node {
 		children2 := rope2.getChildren()
 		// recursion base
 		if h1 == h2-1 && rope1.isOkChild() {
-			mergeNodes([]Node{rope1}, children2)
+			return mergeNodes([]Node{rope1}, children2)
 		}
 		newrope := concat(rope1, children2[0])
 		if newrope.Height() == h2-1 {
@@ -274,7 +317,7 @@ func concat(rope1 Node, rope2 Node) Node {
 		children1 := rope1.getChildren()
 		// recursion base
 		if h2 == h1-1 && rope2.isOkChild() {
-			mergeNodes([]Node{rope1}, children1)
+			return mergeNodes(children1, []Node{rope2})
 		}
 		lasti := len(children1) - 1
 		newrope := concat(children1[lasti], rope2)
@@ -1,20 +1,14 @@
 package BRope
 
-import "slices"
+import "strings"
 
 type Rope = Node
 
 func (n Rope) String() string {
-	if n.isLeaf() {
-		return string(n.getLeaf().Runes())
-	}
-
-	children := n.getChildren()
-	str := ""
-	for _, child := range children {
-		str += child.String()
-	}
-	return str
+	var sb strings.Builder
+	sb.Grow(n.Measure(Utf8Metric{}))
+	n.WriteTo(&sb)
+	return sb.String()
 }
 
 // Unsafe operation, gives a mutable view of the rope content
@@ -23,10 +17,11 @@ func (n Rope) Runes() []rune {
 		return n.getLeaf().Runes()
 	}
 
-	children := n.getChildren()
-	rs := []rune{}
-	for _, child := range children {
-		rs = slices.Concat(rs, child.Runes())
+	rs := make([]rune, 0, n.Len())
+	c := NewCursor(n, 0)
+	leaf, _ := c.GetLeaf()
+	for ok := true; ok; leaf, ok = c.NextLeaf() {
+		rs = append(rs, leaf.Runes()...)
 	}
 	return rs
 }
@@ -35,72 +30,17 @@ func (n Rope) Runes() []rune {
 // line [0, inf)
 // \n \n \n \n \n
 func (r Rope) OffsetOfLine(line int) int {
-	maxLine := r.NodeInfo.newlines
-	if line > maxLine {
+	if line > r.NodeInfo.newlines {
 		// maybe return error value if offset is not contained in the rope
 		return r.NodeInfo.len
 	}
-
-	cur := r
-	len := 0
-	for cur.Height() > 0 {
-		children := cur.getChildren()
-		for _, child := range children {
-			// note that lineCount == line is in the next leaf, since we start with 0
-			// 2 '\n', lines in [0, 2], line 2 could be between this and the next leaf, but it does not matter, we know the offset
-			if child.NodeInfo.newlines >= line {
-				cur = child
-				break
-			}
-			line -= child.NodeInfo.newlines
-			len += child.Len()
-		}
-	}
-
-	slice := cur.getLeaf().Runes()
-	if line > 0 && slices.Index(slice, '\n') == -1 {
-		// line is bigger than the amount of newlines in the leaf
-		// maybe return error value if offset is not contained in the rope
-		return len + cur.NodeInfo.len
-	}
-
-	for line > 0 {
-		pos := slices.Index(slice, '\n')
-		if (pos == -1) { panic("OffsetOfLine: Expected slice to contain newline") }
-		len += pos+1 // there are pos character before the position
-		line--
-		slice = slice[pos+1:]
-	}
-	return len
+	return r.CountBaseUnits(LinesMetric{}, line)
 }
 
 // Invariance (Inverse): LineOfOffset(OffsetOfLine(offset)) == offset
 // offset [0, inf)
 func (r Rope) LineOfOffset(offset int) int {
-	cur := r
-	lines := 0
-
-	for cur.Height() > 0 {
-		children := r.getChildren()
-		for _, child := range children {
-			// len 2 = offset in [0, 1]
-			if child.NodeInfo.len > offset {
-				cur = child
-				break;
-			}
-			lines += child.NodeInfo.newlines
-			offset -= child.NodeInfo.len
-		}
-	}
-
-	newlines := 0
-	for _, char := range cur.getLeaf().Runes()[:offset] {
-		if char == '\n' {
-			newlines++
-		}
-	}
-
-	return lines + newlines
+	return r.Count(LinesMetric{}, offset)
 }
 
 // lines are separated by '\n', so '\n' is not part of the line
@@ -144,4 +84,9 @@ func (r Rope) DeleteAt(row, col int) Rope {
 	offsetUntilRow := r.OffsetOfLine(row)
 	i := offsetUntilRow + col
 	return r.Edit(IV(i-1, i), NewRope([]rune{}))
-}
\ No newline at end of file
+}
+
+// Returns the part of the rope inside of iv
+func (r Rope) Slice(iv Interval) Rope {
+	return r.slice(iv.Intersection(IV(0, r.Length())))
+}
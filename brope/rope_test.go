@@ -2,7 +2,9 @@ package BRope
 
 import (
 	"fmt"
+	"math/rand"
 	"runtime/debug"
+	"strings"
 	"testing"
 	"unsafe"
 )
@@ -25,8 +27,27 @@ func expectInt(a, b int, t *testing.T) {
 	}
 }
 
-func TestBigString(t * testing.T) {
-	// TODO
+func TestBigString(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	s := ""
+	r := EmptyRope()
+	for i := 0; i < 500; i++ {
+		pos := 0
+		if len(s) > 0 {
+			pos = rng.Intn(len(s) + 1)
+		}
+		if rng.Intn(3) > 0 || len(s) == 0 {
+			ins := strings.Repeat(string(rune('a'+rng.Intn(26))), rng.Intn(2*MAX_LEAF)) + "\n"
+			s = s[:pos] + ins + s[pos:]
+			r = r.Edit(IV(pos, pos), NewRopeString(ins))
+		} else {
+			end := min(len(s), pos+rng.Intn(3*MAX_LEAF))
+			s = s[:pos] + s[end:]
+			r = r.Edit(IV(pos, end), EmptyRope())
+		}
+		expectString(s, r, t)
+		expectInt(strings.Count(s, "\n")+1, r.LineCount(), t)
+	}
 }
 
 func TestLineOffsets(t *testing.T) {
@@ -1,33 +1,230 @@
 package BRope
 
 import (
+	"errors"
 	"io"
+	"unicode/utf8"
 )
 
-// Rope -> Buffer
-// This implementation is probably not the most efficient, but suffices for now.
-func (r Rope) Read(p []byte) (n int, err error) {
-	bs := []byte(r.String())
+var errUnreadRune = errors.New("BRope: UnreadRune can only follow ReadRune")
+var errNegativeOffset = errors.New("BRope: negative offset")
 
-	n  += copy(p, bs)
-	err = io.EOF
+// Reader reads a rope as utf-8 encoded bytes or as runes. It walks the leaves of the rope with a Cursor,
+// so reading the whole rope takes constant extra memory.
+//
+// Offsets given to Seek and ReadAt are in bytes, SeekRune and RuneOffset work on rune offsets.
+type Reader struct {
+	cursor *Cursor
+	// bytes of the last rune that did not fit into the buffer given to Read
+	pending []byte
+	buf     [utf8.UTFMax]byte
+	// whether the last operation was ReadRune
+	canUnread bool
+}
+
+func NewReader(r Rope) *Reader {
+	return &Reader{cursor: NewCursor(r, 0)}
+}
+
+func (r *Reader) Read(p []byte) (n int, err error) {
+	r.canUnread = false
+	n = copy(p, r.pending)
+	r.pending = r.pending[n:]
+
+	for n < len(p) {
+		leaf, offset := r.cursor.GetLeaf()
+		if offset >= leaf.Len() {
+			if _, ok := r.cursor.NextLeaf(); !ok {
+				break
+			}
+			continue
+		}
+
+		runes := leaf.Runes()[offset:]
+		i := 0
+		for i < len(runes) && n < len(p) {
+			if n+utf8.UTFMax <= len(p) {
+				n += utf8.EncodeRune(p[n:], runes[i])
+				i++
+				continue
+			}
+			// the rune might not fit, keep what is left of it for the next read
+			size := utf8.EncodeRune(r.buf[:], runes[i])
+			copied := copy(p[n:], r.buf[:size])
+			n += copied
+			i++
+			if copied < size {
+				r.pending = r.buf[copied:size]
+				break
+			}
+		}
+		r.cursor.Set(r.cursor.Pos() + i)
+	}
+
+	if n == 0 && len(p) > 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// ReadRune implements io.RuneReader. The rest of a rune partially returned by Read is skipped.
+func (r *Reader) ReadRune() (ch rune, size int, err error) {
+	r.pending = nil
+	ch, ok := r.cursor.NextRune()
+	if !ok {
+		r.canUnread = false
+		return 0, 0, io.EOF
+	}
+	r.canUnread = true
+	return ch, utf8RuneLen(ch), nil
+}
+
+// UnreadRune implements io.RuneScanner.
+func (r *Reader) UnreadRune() error {
+	if !r.canUnread {
+		return errUnreadRune
+	}
+	r.canUnread = false
+	r.cursor.PrevRune()
+	return nil
+}
+
+// Seek implements io.Seeker, offset is in bytes.
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	r.canUnread = false
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.byteOffset() + offset
+	case io.SeekEnd:
+		abs = int64(r.cursor.Root().Measure(Utf8Metric{})) + offset
+	default:
+		return 0, errors.New("BRope: invalid whence")
+	}
+	if abs < 0 {
+		return 0, errNegativeOffset
+	}
+
+	// past the end the reader is at the end, like a bytes.Reader
+	root := r.cursor.Root()
+	runeOffset, skip := root.runeAtByte(min(int(abs), root.Measure(Utf8Metric{})))
+	r.cursor.Set(runeOffset)
+	r.pending = nil
+	if skip > 0 {
+		// the offset is in the middle of a rune
+		if ch, ok := r.cursor.NextRune(); ok {
+			size := utf8.EncodeRune(r.buf[:], ch)
+			r.pending = r.buf[skip:size]
+		}
+	}
+	return abs, nil
+}
 
-	return
+// SeekRune moves the reader to the rune offset.
+func (r *Reader) SeekRune(offset int) {
+	r.canUnread = false
+	r.pending = nil
+	r.cursor.Set(offset)
+}
+
+// Offset of the next rune that is read
+func (r *Reader) RuneOffset() int {
+	return r.cursor.Pos()
+}
+
+func (r *Reader) byteOffset() int64 {
+	return int64(r.cursor.Root().Count(Utf8Metric{}, r.cursor.Pos()) - len(r.pending))
+}
+
+// Returns the offset of the rune containing the byte at offset, and how many bytes of the rune precede it.
+func (n Rope) runeAtByte(offset int) (runeOffset int, skip int) {
+	runeOffset = n.CountBaseUnits(Utf8Metric{}, offset)
+	start := n.Count(Utf8Metric{}, runeOffset)
+	if start > offset {
+		runeOffset--
+		start = n.Count(Utf8Metric{}, runeOffset)
+	}
+	return runeOffset, max(0, offset-start)
+}
+
+// ReadAt implements io.ReaderAt, off is in bytes.
+func (n Rope) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+	if off >= int64(n.Measure(Utf8Metric{})) {
+		return 0, io.EOF
+	}
+	r := NewReader(n)
+	r.Seek(off, io.SeekStart)
+	read, err := io.ReadFull(r, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return read, err
+}
+
+// WriteTo implements io.WriterTo. The rope is written leaf by leaf.
+func (n Rope) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	buf := make([]byte, 0, MAX_LEAF*utf8.UTFMax)
+	c := NewCursor(n, 0)
+	leaf, _ := c.GetLeaf()
+	for ok := true; ok; leaf, ok = c.NextLeaf() {
+		buf = buf[:0]
+		for _, r := range leaf.Runes() {
+			buf = utf8.AppendRune(buf, r)
+		}
+		m, err := w.Write(buf)
+		written += int64(m)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ReadFrom implements io.ReaderFrom, everything read from src is appended to the rope.
+// The content is cut into properly sized leaves by a Builder.
+func (r *Rope) ReadFrom(src io.Reader) (int64, error) {
+	b := NewBuilder()
+	buf := make([]byte, 32*1024)
+	read, err := io.CopyBuffer(b, src, buf)
+	r.append(b.Build())
+	return read, err
 }
 
 // Buffer -> Rope
+// The bytes are appended to the rope. A utf-8 sequence split between two writes is decoded
+// as invalid runes, use ReadFrom or a Builder to avoid that.
 func (r *Rope) Write(p []byte) (n int, err error) {
-	// Read from the rope into p.
-	rs := []rune(string(p))
+	b := NewBuilder()
+	b.Write(p)
+	r.append(b.Build())
+	return len(p), nil
+}
 
-	if r.NodeBody == nil {
-		*r = NewRope(rs)
+func (r *Rope) append(other Rope) {
+	if r.NodeBody == nil || r.IsEmpty() {
+		*r = other
 	} else {
-		*r = concat(*r, NewRope(rs))
+		*r = concat(*r, other)
 	}
-
-	// Read from the rope into p.
-	return len(rs), nil
 }
 
 func (r *Rope) Close() error { return nil }
+
+// Length of an incomplete utf-8 sequence at the end of p
+func incompleteSuffix(p []byte) int {
+	for i := 1; i <= utf8.UTFMax && i <= len(p); i++ {
+		if utf8.RuneStart(p[len(p)-i]) {
+			if utf8.FullRune(p[len(p)-i:]) {
+				return 0
+			}
+			return i
+		}
+	}
+	return 0
+}
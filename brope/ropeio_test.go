@@ -1,17 +1,135 @@
 package BRope
 
 import (
+	"bytes"
 	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestIO(t *testing.T) {
 	r := NewRopeString("Hello, world!")
 	var r2 Rope
 
-	io.Copy(&r2, r)
+	io.Copy(&r2, NewReader(r))
 
 	if r.String() != r2.String() {
 		t.Errorf("Expected %s, got %s", r.String(), r2.String())
 	}
-}
\ No newline at end of file
+}
+func TestReaderSmallBuffer(t *testing.T) {
+	rope, s := bigLineRope(50)
+	rope = rope.Edit(IV(10, 10), NewRopeString("äö€😀"))
+	s = s[:10] + "äö€😀" + s[10:]
+
+	// buffer sizes that split multi byte runes
+	for _, size := range []int{1, 2, 3, 7, 4096} {
+		r := NewReader(rope)
+		var out bytes.Buffer
+		buf := make([]byte, size)
+		for {
+			n, err := r.Read(buf)
+			out.Write(buf[:n])
+			if err == io.EOF {
+				break
+			}
+		}
+		if out.String() != s {
+			t.Fatalf("reading with buffer size %v does not return the rope", size)
+		}
+	}
+}
+
+func TestReadAt(t *testing.T) {
+	rope := NewRopeString("aä€b")
+	p := make([]byte, 3)
+
+	n, err := rope.ReadAt(p, 2)
+	expectInt(3, n, t)
+	if err != nil || string(p) != "\xa4€"[:3] {
+		t.Fatalf("expected to read from the middle of a rune, got %q %v", p, err)
+	}
+
+	n, err = rope.ReadAt(p, 6)
+	expectInt(1, n, t)
+	if err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestReadPastEnd(t *testing.T) {
+	rope := NewRopeString("aä")
+	p := make([]byte, 3)
+	for _, off := range []int64{3, 5} {
+		if n, err := rope.ReadAt(p, off); n != 0 || err != io.EOF {
+			t.Fatalf("expected EOF reading at %v, got %v %v", off, n, err)
+		}
+	}
+
+	r := NewReader(rope)
+	if abs, err := r.Seek(5, io.SeekStart); abs != 5 || err != nil {
+		t.Fatalf("expected to seek past the end, got %v %v", abs, err)
+	}
+	if n, err := r.Read(p); n != 0 || err != io.EOF {
+		t.Fatalf("expected EOF past the end, got %v %v", n, err)
+	}
+	if _, err := r.Seek(2, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.Read(p); n != 0 || err != io.EOF {
+		t.Fatalf("expected EOF past the end, got %v %v", n, err)
+	}
+	// seeking back in reads again
+	r.Seek(-2, io.SeekEnd)
+	if n, _ := r.Read(p); string(p[:n]) != "ä" {
+		t.Fatalf("expected the last rune, got %q", p[:n])
+	}
+}
+
+func TestWriteToReadFrom(t *testing.T) {
+	rope, s := bigLineRope(30)
+	rope = rope.Edit(IV(1000, 1000), NewRopeString("日本語"))
+	s = s[:1000] + "日本語" + s[1000:]
+
+	var out bytes.Buffer
+	n, _ := rope.WriteTo(&out)
+	expectInt(len(s), int(n), t)
+	if out.String() != s {
+		t.Fatalf("WriteTo does not write the rope")
+	}
+
+	// one byte at a time splits every multi byte rune
+	var read Rope
+	read.ReadFrom(iotest.OneByteReader(strings.NewReader(s)))
+	expectString(s, read, t)
+}
+
+func TestRuneReader(t *testing.T) {
+	rope := NewRopeString("aä€😀")
+	r := NewReader(rope)
+
+	ch, size, _ := r.ReadRune()
+	expectInt('a', int(ch), t)
+	expectInt(1, size, t)
+	ch, size, _ = r.ReadRune()
+	expectInt('ä', int(ch), t)
+	expectInt(2, size, t)
+	r.UnreadRune()
+	expectInt(1, r.RuneOffset(), t)
+
+	r.Seek(3, io.SeekStart)
+	ch, _, _ = r.ReadRune()
+	expectInt('€', int(ch), t)
+	pos, _ := r.Seek(-4, io.SeekEnd)
+	expectInt(6, int(pos), t)
+	ch, _, _ = r.ReadRune()
+	expectInt('😀', int(ch), t)
+	if _, _, err := r.ReadRune(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+
+	r.SeekRune(1)
+	ch, _, _ = r.ReadRune()
+	expectInt('ä', int(ch), t)
+}
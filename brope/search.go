@@ -0,0 +1,335 @@
+package BRope
+
+import (
+	"io"
+	"regexp"
+	"unicode"
+)
+
+// A Pattern can be searched for in a rope, see FindNext, FindPrev and FindAll.
+// Searching works on the leaves of the rope directly, the rope is never flattened.
+//
+// A match is returned as its groups, the first group is the whole match. Groups of a regexp that
+// did not take part in the match are IV(-1, -1).
+type Pattern interface {
+	// First match starting in [from, limit]
+	next(r Rope, from, limit int) ([]Interval, bool)
+	// Last match starting in [limit, from)
+	prev(r Rope, from, limit int) ([]Interval, bool)
+	// Non overlapping matches starting inside of iv
+	all(r Rope, iv Interval) [][]Interval
+}
+
+// Literal matches the runes of s. If ignoreCase is set, runes are compared by their simple case folding.
+func Literal(s string, ignoreCase bool) Pattern {
+	l := literal{runes: []rune(s), ignoreCase: ignoreCase}
+	if ignoreCase {
+		for i, r := range l.runes {
+			l.runes[i] = foldRune(r)
+		}
+	}
+	return l
+}
+
+// Regexp matches re, which is run over the rope as an io.RuneReader.
+//
+// Go regexps cannot look behind the position they start at, so searching from an offset reads the
+// rune before it too, to give ^ and \b their meaning there. A match has to end in the line of the
+// last offset it may start at, otherwise it is not found.
+func Regexp(re *regexp.Regexp) Pattern {
+	// the rune before the offset is matched by the dot, the match of re is the first group
+	return regex{re, regexp.MustCompile(`(?s:.)(` + re.String() + `)`)}
+}
+
+// CompilePattern returns a literal pattern if text contains no regexp syntax, otherwise it compiles text
+// as a regexp in multi line mode.
+func CompilePattern(text string, ignoreCase bool) (Pattern, error) {
+	if regexp.QuoteMeta(text) == text {
+		return Literal(text, ignoreCase), nil
+	}
+	flags := "(?m)"
+	if ignoreCase {
+		flags = "(?mi)"
+	}
+	re, err := regexp.Compile(flags + text)
+	if err != nil {
+		return nil, err
+	}
+	return Regexp(re), nil
+}
+
+// FindNext returns the first match starting at or after from.
+func (n Rope) FindNext(p Pattern, from int) (Interval, bool) {
+	groups, ok := n.FindNextSubmatch(p, from)
+	if !ok {
+		return Interval{}, false
+	}
+	return groups[0], true
+}
+
+// FindNextSubmatch returns the groups of the first match starting at or after from.
+func (n Rope) FindNextSubmatch(p Pattern, from int) ([]Interval, bool) {
+	from = max(0, min(from, n.Len()))
+	return p.next(n, from, n.Len())
+}
+
+// FindPrev returns the last match starting before from.
+func (n Rope) FindPrev(p Pattern, from int) (Interval, bool) {
+	from = max(0, min(from, n.Len()))
+	groups, ok := p.prev(n, from, 0)
+	if !ok {
+		return Interval{}, false
+	}
+	return groups[0], true
+}
+
+// FindAll returns the non overlapping matches starting inside of iv, for example to highlight the visible lines.
+func (n Rope) FindAll(p Pattern, iv Interval) []Interval {
+	all := n.FindAllSubmatch(p, iv)
+	matches := make([]Interval, len(all))
+	for i, groups := range all {
+		matches[i] = groups[0]
+	}
+	return matches
+}
+
+// FindAllSubmatch returns the groups of the non overlapping matches starting inside of iv.
+func (n Rope) FindAllSubmatch(p Pattern, iv Interval) [][]Interval {
+	iv = iv.Intersection(IV(0, n.Len()))
+	if iv.IsEmpty() {
+		return [][]Interval{}
+	}
+	return p.all(n, iv)
+}
+
+type literal struct {
+	runes      []rune
+	ignoreCase bool
+}
+
+func (l literal) next(r Rope, from, limit int) ([]Interval, bool) {
+	m := len(l.runes)
+	if m == 0 || from > limit {
+		return nil, false
+	}
+
+	// the window holds the runes from winStart on, the last m-1 runes of a leaf are kept
+	// to find matches that cross into the next leaf
+	c := NewCursor(r, from)
+	leaf, offset := c.GetLeaf()
+	window := []rune{}
+	winStart := from
+	for {
+		window = append(window, leaf.Runes()[offset:]...)
+		if i := l.index(window); i >= 0 {
+			return []Interval{IV(winStart+i, winStart+i+m)}, winStart+i <= limit
+		}
+		keep := min(len(window), m-1)
+		winStart += len(window) - keep
+		window = window[:copy(window, window[len(window)-keep:])]
+
+		var ok bool
+		if leaf, ok = c.NextLeaf(); !ok || winStart > limit {
+			return nil, false
+		}
+		offset = 0
+	}
+}
+
+func (l literal) prev(r Rope, from, limit int) ([]Interval, bool) {
+	m := len(l.runes)
+	if m == 0 || from <= limit {
+		return nil, false
+	}
+
+	// a match starting before from may end up to m-1 runes after it
+	tail := r.slice(IV(from, min(from+m-1, r.Len()))).Runes()
+	c := NewCursor(r, from-1)
+	leaf, offset := c.GetLeaf()
+	prefix := leaf.Runes()[:offset+1]
+	winStart := from - 1 - offset
+	for {
+		window := append(append(make([]rune, 0, len(prefix)+len(tail)), prefix...), tail...)
+		if i := l.lastIndex(window); i >= 0 {
+			return []Interval{IV(winStart+i, winStart+i+m)}, winStart+i >= limit
+		}
+		if winStart <= limit {
+			return nil, false
+		}
+		tail = window[:min(len(window), m-1)]
+
+		var ok bool
+		if leaf, ok = c.PrevLeaf(); !ok {
+			return nil, false
+		}
+		prefix = leaf.Runes()
+		winStart -= len(prefix)
+	}
+}
+
+func (l literal) all(r Rope, iv Interval) [][]Interval {
+	matches := [][]Interval{}
+	for pos := iv.Lo; pos < iv.Hi; {
+		groups, ok := l.next(r, pos, iv.Hi-1)
+		if !ok {
+			break
+		}
+		matches = append(matches, groups)
+		pos = groups[0].Hi
+	}
+	return matches
+}
+
+func (l literal) index(window []rune) int {
+	for i := 0; i+len(l.runes) <= len(window); i++ {
+		if l.matchesAt(window, i) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (l literal) lastIndex(window []rune) int {
+	for i := len(window) - len(l.runes); i >= 0; i-- {
+		if l.matchesAt(window, i) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (l literal) matchesAt(window []rune, i int) bool {
+	for j, r := range l.runes {
+		w := window[i+j]
+		if l.ignoreCase {
+			w = foldRune(w)
+		}
+		if w != r {
+			return false
+		}
+	}
+	return true
+}
+
+// Maps all runes that are equal under simple case folding to the same rune
+func foldRune(r rune) rune {
+	min := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < min {
+			min = f
+		}
+	}
+	return min
+}
+
+type regex struct {
+	re *regexp.Regexp
+	// re after any rune, to search from an offset with the rune before it as context
+	context *regexp.Regexp
+}
+
+func (x regex) next(r Rope, from, limit int) ([]Interval, bool) {
+	if from > limit {
+		return nil, false
+	}
+	groups, ok := x.find(r, from, lineEnd(r, limit))
+	if !ok {
+		return nil, false
+	}
+	return groups, groups[0].Lo <= limit
+}
+
+func (x regex) prev(r Rope, from, limit int) ([]Interval, bool) {
+	if from <= limit {
+		return nil, false
+	}
+	end := lineEnd(r, from)
+	line := r.LineOfOffset(from)
+
+	// search windows of doubling number of lines before from, each one ends where the one after it starts
+	hi := from
+	for lines := 1; ; lines *= 2 {
+		start := max(limit, r.OffsetOfLine(max(0, line-lines+1)))
+		var last []Interval
+		x.each(r, start, hi, end, func(groups []Interval) { last = groups })
+		if last != nil {
+			return last, true
+		}
+		if start <= limit || line-lines+1 <= 0 {
+			return nil, false
+		}
+		hi = start
+	}
+}
+
+func (x regex) all(r Rope, iv Interval) [][]Interval {
+	matches := [][]Interval{}
+	x.each(r, iv.Lo, iv.Hi, lineEnd(r, iv.Hi-1), func(groups []Interval) { matches = append(matches, groups) })
+	return matches
+}
+
+// Calls f with the non overlapping matches starting in [pos, hi) and ending before end, in order.
+// Like regexp's FindAll, an empty match right behind a match is skipped.
+func (x regex) each(r Rope, pos, hi, end int, f func(groups []Interval)) {
+	last := -1
+	for pos < hi {
+		groups, ok := x.find(r, pos, end)
+		if !ok || groups[0].Lo >= hi {
+			return
+		}
+		match := groups[0]
+		pos = max(match.Hi, match.Lo+1)
+		if match.IsEmpty() && match.Lo == last {
+			continue
+		}
+		f(groups)
+		last = match.Hi
+	}
+}
+
+// Returns the first match of the regexp starting in [pos, end) of the rope and ending before end. The
+// rune before pos is read too, so ^ and \b see what comes before the match. The byte offsets of the
+// match are converted into rune offsets.
+func (x regex) find(r Rope, pos, end int) ([]Interval, bool) {
+	re := x.re
+	if pos > 0 {
+		re, pos = x.context, pos-1
+	}
+	reader := NewReader(r)
+	reader.SeekRune(pos)
+	loc := re.FindReaderSubmatchIndex(&boundedRuneReader{reader, end})
+	if loc == nil {
+		return nil, false
+	}
+	if re == x.context {
+		loc = loc[2:]
+	}
+	base := r.Count(Utf8Metric{}, pos)
+	groups := make([]Interval, len(loc)/2)
+	for i := range groups {
+		if loc[2*i] < 0 {
+			groups[i] = IV(-1, -1)
+			continue
+		}
+		groups[i] = IV(r.CountBaseUnits(Utf8Metric{}, base+loc[2*i]), r.CountBaseUnits(Utf8Metric{}, base+loc[2*i+1]))
+	}
+	return groups, true
+}
+
+// Offset of the end of the line containing offset, including the '\n'
+func lineEnd(r Rope, offset int) int {
+	return r.OffsetOfLine(r.LineOfOffset(offset) + 1)
+}
+
+// Reads the runes of a Reader up to the rune offset end
+type boundedRuneReader struct {
+	r   *Reader
+	end int
+}
+
+func (b *boundedRuneReader) ReadRune() (rune, int, error) {
+	if b.r.RuneOffset() >= b.end {
+		return 0, 0, io.EOF
+	}
+	return b.r.ReadRune()
+}
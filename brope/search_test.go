@@ -0,0 +1,223 @@
+package BRope
+
+import (
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// Builds a rope out of leaves of the given size, so matches cross leaf borders
+func smallLeafRope(s string, size int) Rope {
+	b := NewTreeBuilder()
+	runes := []rune(s)
+	for i := 0; i < len(runes); i += size {
+		b.PushLeaf(StringLeaf{runes[i:min(i+size, len(runes))]})
+	}
+	return b.Build()
+}
+
+func expectMatch(expected Interval, actual Interval, ok bool, t *testing.T) {
+	t.Helper()
+	if !ok || actual != expected {
+		t.Fatalf("expected match [%d, %d), got [%d, %d) (found: %v)", expected.Lo, expected.Hi, actual.Lo, actual.Hi, ok)
+	}
+}
+
+func TestLiteralSearch(t *testing.T) {
+	rope := smallLeafRope("foo bar foo baz fOO", 3)
+
+	match, ok := rope.FindNext(Literal("foo", false), 0)
+	expectMatch(IV(0, 3), match, ok, t)
+	match, ok = rope.FindNext(Literal("foo", false), 1)
+	expectMatch(IV(8, 11), match, ok, t)
+	if _, ok = rope.FindNext(Literal("foo", false), 9); ok {
+		t.Fatalf("expected no match")
+	}
+	match, ok = rope.FindNext(Literal("foo", true), 9)
+	expectMatch(IV(16, 19), match, ok, t)
+
+	match, ok = rope.FindPrev(Literal("foo", false), 19)
+	expectMatch(IV(8, 11), match, ok, t)
+	match, ok = rope.FindPrev(Literal("foo", false), 8)
+	expectMatch(IV(0, 3), match, ok, t)
+	if _, ok = rope.FindPrev(Literal("foo", false), 0); ok {
+		t.Fatalf("expected no match")
+	}
+}
+
+func TestRegexpSearch(t *testing.T) {
+	rope := smallLeafRope("ä first line\nsecond line\nthird", 4)
+	re := Regexp(regexp.MustCompile(`(?m)^\pL+`))
+
+	match, ok := rope.FindNext(re, 0)
+	expectMatch(IV(0, 1), match, ok, t)
+	// searching from the middle of a word does not match its rest
+	match, ok = rope.FindNext(re, 3)
+	expectMatch(IV(13, 19), match, ok, t)
+	match, ok = rope.FindPrev(re, 25)
+	expectMatch(IV(13, 19), match, ok, t)
+	match, ok = rope.FindPrev(re, rope.Len())
+	expectMatch(IV(25, 30), match, ok, t)
+
+	matches := rope.FindAll(Regexp(regexp.MustCompile(`line`)), IV(0, rope.Len()))
+	if len(matches) != 2 || matches[0] != IV(8, 12) || matches[1] != IV(20, 24) {
+		t.Fatalf("unexpected matches %d", matches)
+	}
+}
+
+func TestCompilePattern(t *testing.T) {
+	rope := NewRopeString("a.c abc")
+	p, _ := CompilePattern("a.c", false)
+	matches := rope.FindAll(p, IV(0, rope.Len()))
+	expectInt(2, len(matches), t)
+
+	p, _ = CompilePattern("ABC", true)
+	match, ok := rope.FindNext(p, 0)
+	expectMatch(IV(4, 7), match, ok, t)
+
+	if _, err := CompilePattern("a(", false); err == nil {
+		t.Fatalf("expected an error for an invalid regexp")
+	}
+}
+
+// Compares searching the rope with searching the flattened string
+func TestSearchRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	alphabet := []rune("ab\nü")
+	for iteration := 0; iteration < 50; iteration++ {
+		runes := make([]rune, 200)
+		for i := range runes {
+			runes[i] = alphabet[rng.Intn(len(alphabet))]
+		}
+		s := string(runes)
+		rope := smallLeafRope(s, 1+rng.Intn(10))
+
+		needle := []rune("abü")[:1+rng.Intn(3)]
+		literal := Literal(string(needle), false)
+		re := Regexp(regexp.MustCompile(regexp.QuoteMeta(string(needle))))
+		for from := 0; from <= len(runes); from++ {
+			next, prev := -1, -1
+			for i := 0; i+len(needle) <= len(runes); i++ {
+				if string(runes[i:i+len(needle)]) == string(needle) {
+					if i >= from && next < 0 {
+						next = i
+					}
+					if i < from {
+						prev = i
+					}
+				}
+			}
+			for i, p := range []Pattern{literal, re} {
+				match, ok := rope.FindNext(p, from)
+				if (next >= 0) != ok || (ok && match != IV(next, next+len(needle))) {
+					t.Fatalf("%q: expected next match at %v from %v, got %d", s, next, from, match.Lo)
+				}
+				match, ok = rope.FindPrev(p, from)
+				// the regexp only finds the last match of the non overlapping ones
+				if i == 0 && ((prev >= 0) != ok || (ok && match != IV(prev, prev+len(needle)))) {
+					t.Fatalf("%q: expected previous match at %v from %v, got %d", s, prev, from, match.Lo)
+				}
+				if i == 1 && (prev >= 0) != ok {
+					t.Fatalf("%q: expected previous match from %v", s, from)
+				}
+			}
+		}
+	}
+}
+
+// Compares the matches of regexps in the rope with the ones of the flattened string
+func TestRegexpFindAllRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	alphabet := []rune("ab \nü")
+	for iteration := 0; iteration < 50; iteration++ {
+		runes := make([]rune, 300)
+		for i := range runes {
+			runes[i] = alphabet[rng.Intn(len(alphabet))]
+		}
+		s := string(runes)
+		rope := smallLeafRope(s, 1+rng.Intn(10))
+		for _, expr := range []string{`a*`, `\bab`, `(?m)^b|ü$`, `a\nb`} {
+			re := regexp.MustCompile(expr)
+			expected := []Interval{}
+			for _, loc := range re.FindAllStringIndex(s, -1) {
+				// an empty match at the end of the rope does not start inside of it
+				if loc[0] < len(s) {
+					expected = append(expected, IV(len([]rune(s[:loc[0]])), len([]rune(s[:loc[1]]))))
+				}
+			}
+			got := rope.FindAll(Regexp(re), IV(0, rope.Len()))
+			if len(got) != len(expected) {
+				t.Fatalf("%q %v: expected %v matches, got %v", s, expr, len(expected), len(got))
+			}
+			for i := range got {
+				expectMatch(expected[i], got[i], true, t)
+			}
+			if len(expected) > 0 {
+				last := expected[len(expected)-1]
+				match, ok := rope.FindPrev(Regexp(re), rope.Len())
+				if !ok || match.Lo < last.Lo {
+					t.Fatalf("%q %v: expected the last match at %v, got %v %v", s, expr, last.Lo, match.Lo, ok)
+				}
+			}
+		}
+	}
+}
+
+func TestFindAllLimit(t *testing.T) {
+	rope, _ := bigLineRope(100)
+	p := Literal("line", false)
+	matches := rope.FindAll(p, IV(150, 450))
+	expectInt(3, len(matches), t)
+	expectInt(200, matches[0].Lo, t)
+	if strings.Count(rope.String(), "line") != len(rope.FindAll(p, IV(0, rope.Len()))) {
+		t.Fatalf("expected to find every line")
+	}
+}
+
+func TestRegexpContext(t *testing.T) {
+	rope := smallLeafRope("xxx foofoo\nxx", 3)
+	re := Regexp(regexp.MustCompile(`(?m)^x|\bfoo`))
+	matches := rope.FindAll(re, IV(0, rope.Len()))
+	if len(matches) != 3 || matches[0] != IV(0, 1) || matches[1] != IV(4, 7) || matches[2] != IV(11, 12) {
+		t.Fatalf("unexpected matches %d", matches)
+	}
+
+	// the match at the start of the line must not make ^ match right behind it
+	match, ok := rope.FindNext(re, 1)
+	expectMatch(IV(4, 7), match, ok, t)
+	match, ok = rope.FindNext(re, 5)
+	expectMatch(IV(11, 12), match, ok, t)
+	match, ok = rope.FindPrev(re, 11)
+	expectMatch(IV(4, 7), match, ok, t)
+}
+
+func TestRegexpContextOfLongLines(t *testing.T) {
+	line := strings.Repeat("ab", 1500)
+	rope := smallLeafRope(line+"\nab", 100)
+	re := Regexp(regexp.MustCompile(`(?m)^a|\bb`))
+	// far from the start of the line neither ^ nor \b match where the search starts
+	match, ok := rope.FindNext(re, 2001)
+	expectMatch(IV(3001, 3002), match, ok, t)
+	match, ok = rope.FindNext(re, 2000)
+	expectMatch(IV(3001, 3002), match, ok, t)
+	if _, ok := rope.FindNext(Regexp(regexp.MustCompile(`^ab`)), 3001); ok {
+		t.Fatalf("expected ^ to only match at the start of the rope without multi line mode")
+	}
+}
+
+func TestSubmatch(t *testing.T) {
+	rope := smallLeafRope("ä=1, b=2, c", 2)
+	re := Regexp(regexp.MustCompile(`(\pL)(=(\d))?`))
+	all := rope.FindAllSubmatch(re, IV(0, rope.Len()))
+	expectInt(3, len(all), t)
+	expected := []Interval{IV(0, 3), IV(0, 1), IV(1, 3), IV(2, 3)}
+	for i, group := range all[0] {
+		expectMatch(expected[i], group, true, t)
+	}
+	expectMatch(IV(-1, -1), all[2][2], true, t)
+
+	groups, ok := rope.FindNextSubmatch(re, 1)
+	expectMatch(IV(5, 8), groups[0], ok, t)
+	expectMatch(IV(7, 8), groups[3], ok, t)
+}
@@ -45,17 +45,9 @@ func (t *TreeBuilder) Push(toInsert Node) {
 				// efficiently merge leaf nodes
 				// cut off last node
 				*tos = (*tos)[:len(*tos)-1]
-				leaf1 := lastLayerLastNode.getLeaf()
-				leaf2 := toInsert.getLeaf()
-				if leaf1.Len()+leaf2.Len() <= MAX_LEAF {
-					newRunes := slices.Concat(leaf1.Runes(), leaf2.Runes())
-					newLeaf := StringLeaf{newRunes}
-					*tos = append(*tos, NodeFromLeaf(newLeaf))
-				} else {
-					space := MAX_LEAF - leaf1.Len()
-					left := StringLeaf{slices.Concat(leaf1.Runes(), leaf2.Runes()[:space])}
-					right := StringLeaf{leaf2.Runes()[space:]}
-					*tos = append(*tos, NodeFromLeaf(left))
+				left, right := pushMaybeSplit(lastLayerLastNode.getLeaf(), toInsert.getLeaf())
+				*tos = append(*tos, NodeFromLeaf(left))
+				if right != nil {
 					*tos = append(*tos, NodeFromLeaf(right))
 				}
 			} else {
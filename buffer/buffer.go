@@ -2,29 +2,124 @@ package buffer
 
 import (
 	"bufio"
-	"io"
 	"log"
 	BRope "main/brope"
+	"main/syntax"
 	"os"
 )
 
 type file string
 
 type Buffer struct {
-	File string
-	Rope BRope.Rope
+	File    string
+	Rope    BRope.Rope
+	History *History
+	Marks   *Marks
+	// the selections besides the one of the cursor
+	Selections *Selections
+	// the tokens of the lines, nil if there is no grammar for the file
+	Syntax *syntax.Highlighter
+	// the revision that was last read from or written to the file
+	saved *Revision
+}
+
+func NewBuffer(file string, rope BRope.Rope) *Buffer {
+	b := &Buffer{File: file, Rope: rope, History: NewHistory(rope), Marks: NewMarks(), Selections: NewSelections()}
+	b.saved = b.History.Current()
+	return b
+}
+
+// Modified returns whether the buffer differs from the revision that was last read from or written to
+// its file. Undoing back to that revision makes it unmodified again.
+func (b *Buffer) Modified() bool {
+	return b.History.Current() != b.saved
+}
+
+// Edit replaces iv with text and records the edit in the history. cursor is the rope offset of the cursor
+// before the edit. Returns the offset after the inserted text, which is where the cursor should go.
+func (b *Buffer) Edit(iv BRope.Interval, text []rune, cursor int) int {
+	before := b.Rope
+	b.Rope = b.Rope.Edit(iv, BRope.NewRope(text))
+	after := iv.Lo + len(text)
+	b.History.Record(b.Rope, iv, len(text), cursor, after)
+	b.moveAnchors(iv, len(text))
+	b.rehighlight(before, b.Rope, iv, len(text))
+	b.changed(iv.Lo)
+	return after
+}
+
+// ApplyDelta applies a batch of edits as a single revision, so they are undone together.
+func (b *Buffer) ApplyDelta(d BRope.Delta, cursor int, cursorAfter int) {
+	if d.IsIdentity() {
+		return
+	}
+	before := b.Rope
+	b.Rope = d.Apply(b.Rope)
+	iv, inserted := d.Summary()
+	b.History.Record(b.Rope, iv, inserted, cursor, cursorAfter)
+	b.Marks.anchors.ApplyDelta(d)
+	b.Selections.anchors.ApplyDelta(d)
+	b.rehighlight(before, b.Rope, iv, inserted)
+	b.changed(iv.Lo)
+}
+
+// Moves the marks and the selections through an edit that replaced iv with inserted runes
+func (b *Buffer) moveAnchors(iv BRope.Interval, inserted int) {
+	b.Marks.anchors.Edit(iv, inserted)
+	b.Selections.anchors.Edit(iv, inserted)
+}
+
+// Tells the highlighter of an edit that replaced iv of before with inserted runes
+func (b *Buffer) rehighlight(before, after BRope.Rope, iv BRope.Interval, inserted int) {
+	if b.Syntax != nil {
+		b.Syntax.Edit(before, after, iv, inserted)
+	}
+}
+
+func (b *Buffer) Undo() (cursor int, ok bool) {
+	from := b.History.Current()
+	b.Rope, cursor, ok = b.History.Undo()
+	b.moveMarks(from, b.History.Current())
+	return
+}
+
+func (b *Buffer) Redo() (cursor int, ok bool) {
+	from := b.History.Current()
+	b.Rope, cursor, ok = b.History.Redo()
+	b.moveMarks(from, b.History.Current())
+	return
+}
+
+func (b *Buffer) Earlier(count int) (cursor int, ok bool) {
+	from := b.History.Current()
+	b.Rope, cursor, ok = b.History.Earlier(count)
+	b.moveMarks(from, b.History.Current())
+	return
+}
+
+func (b *Buffer) Later(count int) (cursor int, ok bool) {
+	from := b.History.Current()
+	b.Rope, cursor, ok = b.History.Later(count)
+	b.moveMarks(from, b.History.Current())
+	return
 }
 
 type Buffers struct {
 	Open map[string]*Buffer
+	// upper case marks of files that are not open
+	fileMarks map[rune]FileMark
+	// the grammars buffers are highlighted with
+	Grammars *syntax.Registry
 
 	log *log.Logger
 }
 
 func NewBuffers(log *log.Logger) *Buffers {
 	return &Buffers{
-		Open: make(map[string]*Buffer),
-		log:  log,
+		Open:      make(map[string]*Buffer),
+		fileMarks: make(map[rune]FileMark),
+		Grammars:  syntax.NewRegistry(),
+		log:       log,
 	}
 }
 
@@ -35,7 +130,7 @@ func (b *Buffers) OpenTemp() (*Buffer, error) {
 		return nil, err
 	}
 
-	buf := &Buffer{File: temp.Name(), Rope: BRope.EmptyRope()}
+	buf := NewBuffer(temp.Name(), BRope.EmptyRope())
 	b.Open[temp.Name()] = buf
 
 	return buf, nil
@@ -48,8 +143,12 @@ func (b *Buffers) OpenFile(file string) (*Buffer, error) {
 		return nil, err
 	}
 
-	buf := &Buffer{File: file, Rope: rope}
+	buf := NewBuffer(file, rope)
+	if grammar := b.Grammars.ForFile(file, string(rope.GetLine(0))); grammar != nil {
+		buf.Syntax = syntax.NewHighlighter(grammar, rope)
+	}
 	b.Open[file] = buf
+	b.openFileMarks(buf)
 
 	return buf, nil
 }
@@ -61,9 +160,8 @@ func Read(path string) (BRope.Rope, error) {
 	}
 	defer file.Close()
 
-	var dest BRope.Rope
-	src := bufio.NewReader(file)
-	_, err = io.Copy(&dest, src)
+	dest := BRope.EmptyRope()
+	_, err = dest.ReadFrom(file)
 
 	if err != nil {
 		return BRope.EmptyRope(), err
@@ -73,8 +171,7 @@ func Read(path string) (BRope.Rope, error) {
 }
 
 func (b *Buffers) WriteClose(file string) error {
-	err := write(file, b.Open[file].Rope)
-	if err != nil {
+	if err := b.Write(file); err != nil {
 		return err
 	}
 
@@ -82,31 +179,54 @@ func (b *Buffers) WriteClose(file string) error {
 }
 
 func (b *Buffers) Write(file string) error {
-	err := write(file, b.Open[file].Rope)
-	if err != nil {
-		return err
-	}
+	return b.Open[file].Save(file)
+}
 
-	return nil
+// Names returns the files of the open buffers
+func (b *Buffers) Names() []string {
+	names := make([]string, 0, len(b.Open))
+	for name := range b.Open {
+		names = append(names, name)
+	}
+	return names
 }
 
 func (b *Buffers) Close(file string) error {
+	if buffer, ok := b.Open[file]; ok {
+		for name, mark := range buffer.fileMarks() {
+			b.fileMarks[name] = mark
+		}
+	}
 	delete(b.Open, file)
 	return nil
 }
 
-func write(path string, buffer io.Reader) error {
+// Save writes the content of the buffer to path, the file of the buffer stays the same. Writing it to
+// its own file makes the buffer unmodified.
+func (b *Buffer) Save(path string) error {
+	if err := write(path, b.Rope); err != nil {
+		return err
+	}
+	if path == b.File {
+		b.saved = b.History.Current()
+	}
+	return nil
+}
+
+// Streams the rope to the file leaf by leaf
+func write(path string, rope BRope.Rope) error {
 	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	_, err = io.Copy(file, buffer)
+	w := bufio.NewWriter(file)
+	_, err = rope.WriteTo(w)
 
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return w.Flush()
 }
@@ -0,0 +1,159 @@
+package buffer
+
+import (
+	BRope "main/brope"
+	"time"
+)
+
+// The History of a buffer is an undo tree. Every edit creates a new Revision as child of
+// the current one, so undoing and then editing starts a new branch instead of throwing away the old one.
+//
+// Since ropes are immutable, a revision simply keeps the root of the rope after its edit.
+// Unchanged parts of the tree are shared between revisions, so snapshots are cheap.
+type History struct {
+	root    *Revision
+	current *Revision
+	// all revisions in the order they were created, revisions[i].Seq == i
+	revisions []*Revision
+
+	// revision that is amended while an undo group is open
+	group    *Revision
+	grouping bool
+}
+
+type Revision struct {
+	// chronological number of the revision, the original content is 0
+	Seq  int
+	Time time.Time
+	// the content of the buffer after the edit
+	Rope BRope.Rope
+	// interval of the rope that was changed by the edit
+	Edit BRope.Interval
+	// rope offset of the cursor before and after the edit
+	CursorBefore, CursorAfter int
+
+	parent   *Revision
+	children []*Revision
+	// the child that redo follows, which is the most recently created or visited one
+	redo *Revision
+}
+
+func NewHistory(rope BRope.Rope) *History {
+	root := &Revision{Seq: 0, Time: time.Now(), Rope: rope}
+	return &History{root: root, current: root, revisions: []*Revision{root}}
+}
+
+func (h *History) Current() *Revision {
+	return h.current
+}
+
+// Record adds a revision for an edit that replaced iv of the current rope with inserted runes.
+// Inside of an undo group, consecutive edits are merged into a single revision.
+func (h *History) Record(rope BRope.Rope, iv BRope.Interval, inserted int, cursorBefore, cursorAfter int) *Revision {
+	edit := BRope.IV(iv.Lo, iv.Lo+inserted)
+
+	if h.grouping && h.group != nil && h.group == h.current {
+		rev := h.current
+		rev.Rope = rope
+		rev.Edit = transformInterval(rev.Edit, iv, inserted).Union(edit)
+		rev.CursorAfter = cursorAfter
+		rev.Time = time.Now()
+		return rev
+	}
+
+	rev := &Revision{
+		Seq:          len(h.revisions),
+		Time:         time.Now(),
+		Rope:         rope,
+		Edit:         edit,
+		CursorBefore: cursorBefore,
+		CursorAfter:  cursorAfter,
+		parent:       h.current,
+	}
+	h.current.children = append(h.current.children, rev)
+	h.current.redo = rev
+	h.revisions = append(h.revisions, rev)
+	h.current = rev
+	if h.grouping {
+		h.group = rev
+	}
+	return rev
+}
+
+// Starts an undo group, all edits until EndGroup are undone as one (e.g. an insert session).
+// Does nothing if a group is already open.
+func (h *History) BeginGroup() {
+	if h.grouping {
+		return
+	}
+	h.grouping = true
+	h.group = nil
+}
+
+func (h *History) EndGroup() {
+	h.grouping = false
+	h.group = nil
+}
+
+// Undo moves to the parent revision. It returns the rope to restore and where to place the cursor.
+func (h *History) Undo() (rope BRope.Rope, cursor int, ok bool) {
+	h.EndGroup()
+	if h.current.parent == nil {
+		return h.current.Rope, 0, false
+	}
+	undone := h.current
+	h.current = undone.parent
+	h.current.redo = undone
+	return h.current.Rope, undone.CursorBefore, true
+}
+
+// Redo moves to the child revision that was undone last.
+func (h *History) Redo() (rope BRope.Rope, cursor int, ok bool) {
+	h.EndGroup()
+	if h.current.redo == nil {
+		return h.current.Rope, 0, false
+	}
+	h.current = h.current.redo
+	return h.current.Rope, h.current.CursorAfter, true
+}
+
+// Earlier moves to the chronologically previous revision, regardless of the branch it is on (vim's g-).
+func (h *History) Earlier(count int) (rope BRope.Rope, cursor int, ok bool) {
+	return h.jump(h.current.Seq - count)
+}
+
+// Later moves to the chronologically next revision, regardless of the branch it is on (vim's g+).
+func (h *History) Later(count int) (rope BRope.Rope, cursor int, ok bool) {
+	return h.jump(h.current.Seq + count)
+}
+
+func (h *History) jump(seq int) (BRope.Rope, int, bool) {
+	h.EndGroup()
+	seq = max(0, min(seq, len(h.revisions)-1))
+	if seq == h.current.Seq {
+		return h.current.Rope, 0, false
+	}
+	target := h.revisions[seq]
+	// make redo follow the path to the target revision
+	for rev := target; rev.parent != nil; rev = rev.parent {
+		rev.parent.redo = rev
+	}
+	h.current = target
+	return target.Rope, target.CursorAfter, true
+}
+
+// Maps an interval of the rope before an edit to the rope after it.
+// The edit replaced iv with inserted runes.
+func transformInterval(of BRope.Interval, iv BRope.Interval, inserted int) BRope.Interval {
+	transform := func(offset int) int {
+		switch {
+		case offset <= iv.Lo:
+			return offset
+		case offset >= iv.Hi:
+			return offset - iv.Len() + inserted
+		default:
+			return iv.Lo
+		}
+	}
+	return BRope.IV(transform(of.Lo), transform(of.Hi))
+}
@@ -0,0 +1,125 @@
+package buffer
+
+import (
+	BRope "main/brope"
+	"main/syntax"
+	"path/filepath"
+	"testing"
+)
+
+func expectContent(expected string, b *Buffer, t *testing.T) {
+	if b.Rope.String() != expected {
+		t.Fatalf("expected '%v', got '%v'", expected, b.Rope.String())
+	}
+}
+
+func TestUndoRedo(t *testing.T) {
+	b := NewBuffer("test", BRope.NewRopeString("foo"))
+	b.Edit(BRope.IV(3, 3), []rune("bar"), 3)
+	b.Edit(BRope.IV(0, 1), []rune{}, 1)
+	expectContent("oobar", b, t)
+
+	cursor, _ := b.Undo()
+	expectContent("foobar", b, t)
+	if cursor != 1 {
+		t.Fatalf("expected cursor to be restored to 1, got %v", cursor)
+	}
+	b.Undo()
+	expectContent("foo", b, t)
+	if _, ok := b.Undo(); ok {
+		t.Fatalf("expected nothing to undo")
+	}
+
+	b.Redo()
+	b.Redo()
+	expectContent("oobar", b, t)
+	if _, ok := b.Redo(); ok {
+		t.Fatalf("expected nothing to redo")
+	}
+}
+
+func TestUndoGroup(t *testing.T) {
+	b := NewBuffer("test", BRope.EmptyRope())
+	b.History.BeginGroup()
+	for i, r := range "hello" {
+		b.Edit(BRope.IV(i, i), []rune{r}, i)
+	}
+	b.History.EndGroup()
+	b.Edit(BRope.IV(5, 5), []rune("!"), 5)
+	expectContent("hello!", b, t)
+
+	b.Undo()
+	expectContent("hello", b, t)
+	b.Undo()
+	expectContent("", b, t)
+}
+
+func TestUndoBranches(t *testing.T) {
+	b := NewBuffer("test", BRope.NewRopeString("a"))
+	b.Edit(BRope.IV(1, 1), []rune("b"), 1)
+	b.Undo()
+	b.Edit(BRope.IV(1, 1), []rune("c"), 1)
+	expectContent("ac", b, t)
+
+	// the branch with "ab" is still reachable chronologically
+	b.Earlier(1)
+	expectContent("ab", b, t)
+	b.Earlier(1)
+	expectContent("a", b, t)
+	b.Later(2)
+	expectContent("ac", b, t)
+
+	// redo follows the branch that was visited last
+	b.Earlier(1)
+	b.Undo()
+	b.Redo()
+	expectContent("ab", b, t)
+}
+
+func TestUndoRehighlights(t *testing.T) {
+	b := NewBuffer("test.go", BRope.NewRopeString("a\nb\nc"))
+	b.Syntax = syntax.NewHighlighter(syntax.NewRegistry().ForFile(b.File, ""), b.Rope)
+	comment := func(line int) bool {
+		tokens := b.Syntax.Tokens(b.Rope, line)
+		return len(tokens) == 1 && tokens[0].Scope == "comment.block.go"
+	}
+	b.Edit(BRope.IV(0, 0), []rune("/*\n"), 0)
+	if !comment(3) {
+		t.Fatalf("expected the last line in the comment")
+	}
+	b.Undo()
+	if comment(2) {
+		t.Fatalf("expected the comment to be undone")
+	}
+	b.Redo()
+	if !comment(3) {
+		t.Fatalf("expected the comment to be redone")
+	}
+}
+
+func TestModified(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.txt")
+	b := NewBuffer(path, BRope.NewRopeString("a"))
+	if b.Modified() {
+		t.Fatalf("expected a new buffer to be unmodified")
+	}
+	b.Edit(BRope.IV(1, 1), []rune("b"), 1)
+	if !b.Modified() {
+		t.Fatalf("expected an edit to modify the buffer")
+	}
+	b.Undo()
+	if b.Modified() {
+		t.Fatalf("expected undoing the edit to make the buffer unmodified again")
+	}
+	b.Redo()
+	if err := b.Save(filepath.Join(filepath.Dir(path), "other.txt")); err != nil || !b.Modified() {
+		t.Fatalf("expected writing another file to keep the buffer modified, got %v", err)
+	}
+	if err := b.Save(path); err != nil || b.Modified() {
+		t.Fatalf("expected writing the file to make the buffer unmodified, got %v", err)
+	}
+	b.Undo()
+	if !b.Modified() {
+		t.Fatalf("expected undoing past the written revision to modify the buffer")
+	}
+}
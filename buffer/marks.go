@@ -0,0 +1,251 @@
+package buffer
+
+import (
+	"fmt"
+	BRope "main/brope"
+	"path/filepath"
+)
+
+// the most positions a jump or change list keeps
+const maxPositions = 100
+
+// Marks are positions of a buffer that move with the text around them, they are anchors that are moved
+// by every edit, undo and redo. Text inserted at a mark goes before it, a mark in text that is replaced
+// moves behind the new text.
+type Marks struct {
+	anchors *BRope.AnchorSet
+	// marks set with "m", the previous context "'", the last change "." and the last insert "^"
+	named map[rune]BRope.Anchor
+	// walked by Ctrl-O and Ctrl-I
+	jumps positionList
+	// walked by "g;" and "g,"
+	changes positionList
+}
+
+// A positionList is a list of positions that is walked back and forth, the newest one is the last
+type positionList struct {
+	positions []BRope.Anchor
+	// the position the list was walked to, len(positions) if it is not walked
+	index int
+}
+
+func NewMarks() *Marks {
+	return &Marks{anchors: BRope.NewAnchorSet(), named: map[rune]BRope.Anchor{}}
+}
+
+func (m *Marks) Set(name rune, offset int) {
+	if anchor, ok := m.named[name]; ok {
+		m.anchors.Move(anchor, offset)
+	} else {
+		m.named[name] = m.anchors.Add(offset, BRope.BiasRight)
+	}
+}
+
+func (m *Marks) Get(name rune) (int, bool) {
+	anchor, ok := m.named[name]
+	if !ok {
+		return 0, false
+	}
+	return m.anchors.Offset(anchor)
+}
+
+func (m *Marks) Delete(name rune) {
+	if anchor, ok := m.named[name]; ok {
+		m.anchors.Remove(anchor)
+		delete(m.named, name)
+	}
+}
+
+// Named returns the names and offsets of the marks
+func (m *Marks) Named() map[rune]int {
+	named := make(map[rune]int, len(m.named))
+	for name := range m.named {
+		named[name], _ = m.Get(name)
+	}
+	return named
+}
+
+// Adds a position, older positions in the same line are dropped
+func (m *Marks) push(l *positionList, offset int, line func(offset int) int) {
+	kept := l.positions[:0]
+	for _, anchor := range l.positions {
+		if p, _ := m.anchors.Offset(anchor); line(p) != line(offset) {
+			kept = append(kept, anchor)
+		} else {
+			m.anchors.Remove(anchor)
+		}
+	}
+	l.positions = append(kept, m.anchors.Add(offset, BRope.BiasRight))
+	if n := len(l.positions); n > maxPositions {
+		for _, anchor := range l.positions[:n-maxPositions] {
+			m.anchors.Remove(anchor)
+		}
+		l.positions = l.positions[n-maxPositions:]
+	}
+	l.index = len(l.positions)
+}
+
+// Walks count positions, back for a negative count. Fails if there is no position that far.
+func (m *Marks) walk(l *positionList, count int) (int, bool) {
+	index := l.index + count
+	if index < 0 || index >= len(l.positions) {
+		return 0, false
+	}
+	l.index = index
+	return m.anchors.Offset(l.positions[index])
+}
+
+// PushJump adds the position the cursor jumps away from to the jump list, it is the "'" mark too
+func (b *Buffer) PushJump(offset int) {
+	b.Marks.Set('\'', offset)
+	b.Marks.push(&b.Marks.jumps, offset, b.Rope.LineOfOffset)
+}
+
+// Jump walks the jump list by count, back for a negative count. When walking back starts, the position
+// of the cursor is added, so that walking forward returns to it.
+func (b *Buffer) Jump(count int, cursor int) (int, bool) {
+	l := &b.Marks.jumps
+	if count < 0 && l.index == len(l.positions) {
+		b.Marks.push(l, cursor, b.Rope.LineOfOffset)
+		l.index--
+	}
+	return b.Marks.walk(l, count)
+}
+
+// Change walks the change list by count, back for a negative count
+func (b *Buffer) Change(count int) (int, bool) {
+	return b.Marks.walk(&b.Marks.changes, count)
+}
+
+// Remembers a change at offset as the "." mark and in the change list
+func (b *Buffer) changed(offset int) {
+	b.Marks.Set('.', offset)
+	b.Marks.push(&b.Marks.changes, offset, b.Rope.LineOfOffset)
+}
+
+// Moves the marks, selections and tokens from the revision from to the revision to, by undoing the edits up to
+// the revision both come from and redoing the ones down to to
+func (b *Buffer) moveMarks(from, to *Revision) {
+	down := []*Revision{}
+	for from != to {
+		if from.Seq > to.Seq {
+			// undo from
+			before := from.Edit.Len() - (from.Rope.Length() - from.parent.Rope.Length())
+			b.moveAnchors(from.Edit, max(0, before))
+			b.rehighlight(from.Rope, from.parent.Rope, from.Edit, max(0, before))
+			from = from.parent
+		} else {
+			down = append(down, to)
+			to = to.parent
+		}
+	}
+	for i := len(down) - 1; i >= 0; i-- {
+		rev := down[i]
+		replaced := rev.Edit.Len() - (rev.Rope.Length() - rev.parent.Rope.Length())
+		b.moveAnchors(BRope.IV(rev.Edit.Lo, rev.Edit.Lo+max(0, replaced)), rev.Edit.Len())
+		b.rehighlight(rev.parent.Rope, rev.Rope, BRope.IV(rev.Edit.Lo, rev.Edit.Lo+max(0, replaced)), rev.Edit.Len())
+	}
+}
+
+// A FileMark is an upper case mark, which is kept for a file instead of a buffer. Marks of open buffers
+// are kept in their Marks, so they move with the edits. Marks of files that are not open are kept
+// by line and column, since the file may change.
+type FileMark struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Col  int    `json:"col"`
+}
+
+// SetFileMark sets an upper case mark in a buffer and removes it from all other files
+func (b *Buffers) SetFileMark(name rune, buffer *Buffer, offset int) {
+	for _, open := range b.Open {
+		open.Marks.Delete(name)
+	}
+	delete(b.fileMarks, name)
+	buffer.Marks.Set(name, offset)
+}
+
+// FileMark returns the buffer and offset of an upper case mark. The file of the mark is opened
+// if it is not open yet.
+func (b *Buffers) FileMark(name rune) (*Buffer, int, error) {
+	for _, open := range b.Open {
+		if offset, ok := open.Marks.Get(name); ok {
+			return open, offset, nil
+		}
+	}
+	mark, ok := b.fileMarks[name]
+	if !ok {
+		return nil, 0, fmt.Errorf("mark %c is not set", name)
+	}
+	buffer, err := b.OpenFile(mark.File)
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not open %v: %v", mark.File, err)
+	}
+	offset, _ := buffer.Marks.Get(name)
+	return buffer, offset, nil
+}
+
+// FileMarks returns the upper case marks of all files
+func (b *Buffers) FileMarks() map[rune]FileMark {
+	marks := map[rune]FileMark{}
+	for name, mark := range b.fileMarks {
+		marks[name] = mark
+	}
+	for _, open := range b.Open {
+		for name, mark := range open.fileMarks() {
+			marks[name] = mark
+		}
+	}
+	return marks
+}
+
+// SetFileMarks adds upper case marks, like the ones of the last session
+func (b *Buffers) SetFileMarks(marks map[rune]FileMark) {
+	for name, mark := range marks {
+		b.fileMarks[name] = mark
+	}
+	for _, open := range b.Open {
+		b.openFileMarks(open)
+	}
+}
+
+// Moves the marks of a file that was opened into its buffer
+func (b *Buffers) openFileMarks(buffer *Buffer) {
+	for name, mark := range b.fileMarks {
+		if mark.File == absPath(buffer.File) {
+			delete(b.fileMarks, name)
+			buffer.Marks.Set(name, buffer.offsetOf(mark))
+		}
+	}
+}
+
+// The upper case marks of the buffer by line and column
+func (b *Buffer) fileMarks() map[rune]FileMark {
+	marks := map[rune]FileMark{}
+	for name, offset := range b.Marks.Named() {
+		if name >= 'A' && name <= 'Z' {
+			line := b.Rope.LineOfOffset(offset)
+			marks[name] = FileMark{File: absPath(b.File), Line: line, Col: offset - b.Rope.OffsetOfLine(line)}
+		}
+	}
+	return marks
+}
+
+// File marks are kept with absolute paths, so they work from any directory
+func absPath(file string) string {
+	if abs, err := filepath.Abs(file); err == nil {
+		return abs
+	}
+	return file
+}
+
+// The offset of the line and column of a file mark, within the rope
+func (b *Buffer) offsetOf(mark FileMark) int {
+	line := max(0, min(mark.Line, b.Rope.LineCount()-1))
+	start := b.Rope.OffsetOfLine(line)
+	end := b.Rope.Length()
+	if line+1 < b.Rope.LineCount() {
+		end = b.Rope.OffsetOfLine(line+1) - 1
+	}
+	return start + max(0, min(mark.Col, end-start))
+}
@@ -0,0 +1,134 @@
+package buffer
+
+import (
+	"log"
+	BRope "main/brope"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func expectMark(b *Buffer, name rune, expected int, t *testing.T) {
+	t.Helper()
+	if offset, ok := b.Marks.Get(name); !ok || offset != expected {
+		t.Fatalf("expected mark %c at %v, got %v %v", name, expected, offset, ok)
+	}
+}
+
+func TestMarksMoveWithEdits(t *testing.T) {
+	b := NewBuffer("test", BRope.NewRopeString("foo bar baz"))
+	b.Marks.Set('a', 4)
+	b.Marks.Set('b', 9)
+	b.Marks.Set('c', 0)
+
+	b.Edit(BRope.IV(0, 0), []rune("xx"), 0)
+	expectMark(b, 'a', 6, t)
+	expectMark(b, 'c', 2, t)
+
+	// the text of a is deleted
+	b.Edit(BRope.IV(5, 10), nil, 5)
+	expectContent("xxfoobaz", b, t)
+	expectMark(b, 'a', 5, t)
+	expectMark(b, 'b', 6, t)
+
+	builder := BRope.NewDeltaBuilder(b.Rope.Length())
+	builder.Insert(0, BRope.NewRopeString("1"))
+	builder.Replace(BRope.IV(2, 5), BRope.NewRopeString("F"))
+	builder.Insert(6, BRope.NewRopeString("22"))
+	b.ApplyDelta(builder.Build(), 0, 0)
+	expectContent("1xxFb22az", b, t)
+	// c was in the replaced text
+	expectMark(b, 'c', 4, t)
+	expectMark(b, 'b', 7, t)
+	expectMark(b, '.', 0, t)
+
+	b.Undo()
+	expectContent("xxfoobaz", b, t)
+	expectMark(b, 'b', 6, t)
+	b.Undo()
+	b.Undo()
+	expectContent("foo bar baz", b, t)
+	expectMark(b, 'b', 9, t)
+	b.Later(3)
+	expectContent("1xxFb22az", b, t)
+	expectMark(b, 'b', 7, t)
+}
+
+func TestJumpList(t *testing.T) {
+	b := NewBuffer("test", BRope.NewRopeString("a\nb\nc\nd"))
+	b.PushJump(0)
+	b.PushJump(2)
+	b.PushJump(0)
+	if offset, ok := b.Jump(-1, 6); !ok || offset != 0 {
+		t.Fatalf("expected to jump back to 0, got %v %v", offset, ok)
+	}
+	if offset, ok := b.Jump(-1, 0); !ok || offset != 2 {
+		t.Fatalf("expected the older jump in the same line to be dropped, got %v %v", offset, ok)
+	}
+	if _, ok := b.Jump(-1, 2); ok {
+		t.Fatalf("expected no older jump")
+	}
+	if offset, ok := b.Jump(2, 2); !ok || offset != 6 {
+		t.Fatalf("expected to jump forward to the cursor, got %v %v", offset, ok)
+	}
+
+	b.Edit(BRope.IV(0, 0), []rune("x\n"), 0)
+	if offset, ok := b.Jump(-2, 8); !ok || offset != 4 {
+		t.Fatalf("expected the jumps to move with the edit, got %v %v", offset, ok)
+	}
+}
+
+func TestChangeList(t *testing.T) {
+	b := NewBuffer("test", BRope.NewRopeString("a\nb\nc"))
+	b.Edit(BRope.IV(0, 0), []rune("x"), 0)
+	b.Edit(BRope.IV(1, 1), []rune("y"), 1)
+	b.Edit(BRope.IV(6, 6), []rune("z"), 6)
+	expectContent("xya\nb\nzc", b, t)
+	if offset, ok := b.Change(-1); !ok || offset != 6 {
+		t.Fatalf("expected the last change, got %v %v", offset, ok)
+	}
+	if offset, ok := b.Change(-1); !ok || offset != 1 {
+		t.Fatalf("expected changes in the same line to be merged, got %v %v", offset, ok)
+	}
+	if _, ok := b.Change(-1); ok {
+		t.Fatalf("expected no older change")
+	}
+	if offset, ok := b.Change(1); !ok || offset != 6 {
+		t.Fatalf("expected to walk forward, got %v %v", offset, ok)
+	}
+}
+
+func TestFileMarks(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first"), filepath.Join(dir, "second")
+	os.WriteFile(first, []byte("one\ntwo"), 0664)
+	os.WriteFile(second, []byte("three\nfour"), 0664)
+
+	buffers := NewBuffers(log.Default())
+	a, _ := buffers.OpenFile(first)
+	b, _ := buffers.OpenFile(second)
+	buffers.SetFileMark('A', a, 5)
+	buffers.SetFileMark('A', b, 7)
+	if _, ok := a.Marks.Get('A'); ok {
+		t.Fatalf("expected the mark to be removed from the other buffer")
+	}
+	b.Edit(BRope.IV(0, 0), []rune("0\n"), 0)
+	if buffer, offset, err := buffers.FileMark('A'); err != nil || buffer != b || offset != 9 {
+		t.Fatalf("expected the mark in the second buffer at 9, got %v %v", offset, err)
+	}
+	marks := buffers.FileMarks()
+	if mark := marks['A']; mark.File != second || mark.Line != 2 || mark.Col != 1 {
+		t.Fatalf("unexpected file mark %v", mark)
+	}
+
+	// a new session with the marks of the old one
+	buffers = NewBuffers(log.Default())
+	buffers.SetFileMarks(marks)
+	if _, _, err := buffers.FileMark('B'); err == nil {
+		t.Fatalf("expected an error for a mark that is not set")
+	}
+	buffer, offset, err := buffers.FileMark('A')
+	if err != nil || buffer.File != second || offset != 7 {
+		t.Fatalf("expected the file of the mark to be opened, got %v %v", offset, err)
+	}
+}
@@ -0,0 +1,82 @@
+package buffer
+
+import (
+	BRope "main/brope"
+	"sort"
+)
+
+// A Selection is the text between its anchor, where selecting started, and its head, where its cursor is.
+// A cursor is a selection whose anchor is its head.
+type Selection struct {
+	Anchor, Head int
+}
+
+func (s Selection) Lo() int {
+	return min(s.Anchor, s.Head)
+}
+
+func (s Selection) Hi() int {
+	return max(s.Anchor, s.Head)
+}
+
+// Selections are the selections of a buffer besides the primary one, which is the cursor of the window.
+// Their anchors and heads are anchors of the rope, so they move with the edits like marks do.
+type Selections struct {
+	anchors    *BRope.AnchorSet
+	selections []selectionAnchors
+}
+
+type selectionAnchors struct {
+	anchor, head BRope.Anchor
+}
+
+func NewSelections() *Selections {
+	return &Selections{anchors: BRope.NewAnchorSet()}
+}
+
+func (s *Selections) Len() int {
+	return len(s.selections)
+}
+
+// All returns the selections ordered by their heads
+func (s *Selections) All() []Selection {
+	all := make([]Selection, len(s.selections))
+	for i, sel := range s.selections {
+		all[i].Anchor, _ = s.anchors.Offset(sel.anchor)
+		all[i].Head, _ = s.anchors.Offset(sel.head)
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Head < all[j].Head || all[i].Head == all[j].Head && all[i].Anchor < all[j].Anchor
+	})
+	return all
+}
+
+// Add adds a selection, unless there is one with the same anchor and head
+func (s *Selections) Add(sel Selection) {
+	s.Set(append(s.All(), sel))
+}
+
+// Set replaces the selections, selections with the same anchor and head are kept once
+func (s *Selections) Set(selections []Selection) {
+	s.Clear()
+	seen := map[Selection]bool{}
+	for _, sel := range selections {
+		if seen[sel] {
+			continue
+		}
+		seen[sel] = true
+		// text inserted at a cursor goes before it, so typing at every cursor moves all of them
+		s.selections = append(s.selections, selectionAnchors{
+			anchor: s.anchors.Add(sel.Anchor, BRope.BiasRight),
+			head:   s.anchors.Add(sel.Head, BRope.BiasRight),
+		})
+	}
+}
+
+func (s *Selections) Clear() {
+	for _, sel := range s.selections {
+		s.anchors.Remove(sel.anchor)
+		s.anchors.Remove(sel.head)
+	}
+	s.selections = nil
+}
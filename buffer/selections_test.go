@@ -0,0 +1,40 @@
+package buffer
+
+import (
+	BRope "main/brope"
+	"reflect"
+	"testing"
+)
+
+func expectSelections(b *Buffer, expected []Selection, t *testing.T) {
+	t.Helper()
+	if got := b.Selections.All(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected selections %v, got %v", expected, got)
+	}
+}
+
+func TestSelections(t *testing.T) {
+	b := NewBuffer("test", BRope.NewRopeString("foo bar baz"))
+	b.Selections.Add(Selection{Anchor: 8, Head: 10})
+	b.Selections.Add(Selection{Anchor: 2, Head: 0})
+	b.Selections.Add(Selection{Anchor: 8, Head: 10})
+	expectSelections(b, []Selection{{2, 0}, {8, 10}}, t)
+
+	// text inserted at a cursor goes before it
+	b.Edit(BRope.IV(0, 0), []rune("x"), 0)
+	expectSelections(b, []Selection{{3, 1}, {9, 11}}, t)
+	b.Edit(BRope.IV(4, 9), nil, 4)
+	expectContent("xfoobaz", b, t)
+	expectSelections(b, []Selection{{3, 1}, {4, 6}}, t)
+
+	b.Undo()
+	expectSelections(b, []Selection{{3, 1}, {9, 11}}, t)
+	b.Redo()
+	expectSelections(b, []Selection{{3, 1}, {4, 6}}, t)
+
+	b.Selections.Clear()
+	expectSelections(b, []Selection{}, t)
+	if b.Selections.anchors.Len() != 0 {
+		t.Fatalf("expected the anchors of cleared selections to be removed")
+	}
+}
@@ -0,0 +1,167 @@
+package buffer
+
+import (
+	"errors"
+	"fmt"
+	BRope "main/brope"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// A Substitution replaces the matches of a regexp, it is parsed from the text of ":s/pattern/replacement/flags".
+//
+// The replacement can refer to the whole match with & or \0 and to groups with \1 to \9.
+// \n inserts a newline, \& a literal &.
+type Substitution struct {
+	Pattern     string
+	Replacement string
+	// replace every match of a line instead of only the first one
+	Global     bool
+	IgnoreCase bool
+	// ask before each replacement
+	Confirm bool
+}
+
+// ParseSubstitution parses "/pattern/replacement/flags". Any punctuation can be used instead of '/',
+// the delimiter is escaped with a backslash.
+func ParseSubstitution(text string) (Substitution, error) {
+	sub := Substitution{}
+	delim, size := firstRune(text)
+	if size == 0 || unicode.IsLetter(delim) || unicode.IsDigit(delim) || unicode.IsSpace(delim) || delim == '\\' {
+		return sub, errors.New("substitute needs a pattern like /pattern/replacement/")
+	}
+
+	parts := splitUnescaped(text[size:], delim)
+	if parts[0] == "" {
+		return sub, errors.New("empty pattern")
+	}
+	// the escaped delimiter stays escaped if it means something in a regexp
+	sub.Pattern = strings.ReplaceAll(parts[0], `\`+string(delim), regexp.QuoteMeta(string(delim)))
+	if len(parts) > 1 {
+		sub.Replacement = strings.ReplaceAll(parts[1], `\`+string(delim), string(delim))
+	}
+	if len(parts) > 2 {
+		for _, flag := range strings.TrimSpace(parts[2]) {
+			switch flag {
+			case 'g':
+				sub.Global = true
+			case 'i':
+				sub.IgnoreCase = true
+			case 'c':
+				sub.Confirm = true
+			default:
+				return sub, fmt.Errorf("unknown substitute flag '%c'", flag)
+			}
+		}
+	}
+	if len(parts) > 3 {
+		return sub, errors.New("trailing characters after the flags")
+	}
+	return sub, nil
+}
+
+func firstRune(s string) (rune, int) {
+	for _, r := range s {
+		return r, len(string(r))
+	}
+	return 0, 0
+}
+
+// Splits s at every delim that is not preceded by a backslash, the backslashes are kept
+func splitUnescaped(s string, delim rune) []string {
+	parts := []string{}
+	var part strings.Builder
+	escaped := false
+	for _, r := range s {
+		if r == delim && !escaped {
+			parts = append(parts, part.String())
+			part.Reset()
+			continue
+		}
+		escaped = r == '\\' && !escaped
+		part.WriteRune(r)
+	}
+	return append(parts, part.String())
+}
+
+func (s Substitution) regexp() (*regexp.Regexp, error) {
+	flags := "(?m)"
+	if s.IgnoreCase {
+		flags = "(?mi)"
+	}
+	return regexp.Compile(flags + s.Pattern)
+}
+
+// Matches returns the groups of the matches starting in iv, which are replaced by the substitution.
+// Unless the substitution is global, only the first match of each line is returned.
+func (b *Buffer) Matches(s Substitution, iv BRope.Interval) ([][]BRope.Interval, error) {
+	re, err := s.regexp()
+	if err != nil {
+		return nil, err
+	}
+	all := b.Rope.FindAllSubmatch(BRope.Regexp(re), iv)
+	if s.Global {
+		return all, nil
+	}
+
+	matches := [][]BRope.Interval{}
+	lastLine := -1
+	for _, groups := range all {
+		if line := b.Rope.LineOfOffset(groups[0].Lo); line != lastLine {
+			matches = append(matches, groups)
+			lastLine = line
+		}
+	}
+	return matches, nil
+}
+
+// Substitute replaces the matches with the replacement of s as a single edit, which is undone in one step.
+// The matches have to be ascending, as returned by Matches. cursor is the rope offset of the cursor before
+// the edit. Returns the offset of the start of the last replacement.
+func (b *Buffer) Substitute(s Substitution, matches [][]BRope.Interval, cursor int) int {
+	if len(matches) == 0 {
+		return cursor
+	}
+	builder := BRope.NewDeltaBuilder(b.Rope.Length())
+	after, shift := cursor, 0
+	for _, groups := range matches {
+		replacement := s.expand(b.Rope, groups)
+		builder.Replace(groups[0], BRope.NewRope(replacement))
+		after = groups[0].Lo + shift
+		shift += len(replacement) - groups[0].Len()
+	}
+	b.ApplyDelta(builder.Build(), cursor, after)
+	return after
+}
+
+// Expands the replacement for the groups of a match
+func (s Substitution) expand(rope BRope.Rope, groups []BRope.Interval) []rune {
+	group := func(i int) []rune {
+		if i >= len(groups) || groups[i].Lo < 0 {
+			return nil
+		}
+		return rope.Slice(groups[i]).Runes()
+	}
+
+	result := []rune{}
+	escaped := false
+	for _, r := range s.Replacement {
+		switch {
+		case escaped && r >= '0' && r <= '9':
+			result = append(result, group(int(r-'0'))...)
+		case escaped && r == 'n':
+			result = append(result, '\n')
+		case escaped && r == 't':
+			result = append(result, '\t')
+		case escaped:
+			result = append(result, r)
+		case r == '&':
+			result = append(result, group(0)...)
+		case r != '\\':
+			result = append(result, r)
+		}
+		escaped = r == '\\' && !escaped
+	}
+	return result
+}
@@ -0,0 +1,74 @@
+package buffer
+
+import (
+	BRope "main/brope"
+	"strings"
+	"testing"
+)
+
+func substitute(b *Buffer, text string, iv BRope.Interval, t *testing.T) {
+	sub, err := ParseSubstitution(text)
+	if err != nil {
+		t.Fatalf("could not parse %q: %v", text, err)
+	}
+	matches, err := b.Matches(sub, iv)
+	if err != nil {
+		t.Fatalf("could not compile %q: %v", text, err)
+	}
+	b.Substitute(sub, matches, 0)
+}
+
+func TestParseSubstitution(t *testing.T) {
+	sub, err := ParseSubstitution(`#a\#b#c/d#gic`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Pattern != `a#b` || sub.Replacement != "c/d" || !sub.Global || !sub.IgnoreCase || !sub.Confirm {
+		t.Fatalf("unexpected substitution %+v", sub)
+	}
+	if sub, _ = ParseSubstitution(`/a\/b`); sub.Pattern != "a/b" || sub.Replacement != "" {
+		t.Fatalf("unexpected substitution %+v", sub)
+	}
+	for _, invalid := range []string{"", "abc", "//x/", "/a/b/x", "/a/b/g/"} {
+		if _, err := ParseSubstitution(invalid); err == nil {
+			t.Fatalf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	b := NewBuffer("test", BRope.NewRopeString("foo foo\nbar foo\nfoo"))
+	all := BRope.IV(0, b.Rope.Length())
+
+	substitute(b, "/foo/x/", all, t)
+	expectContent("x foo\nbar x\nx", b, t)
+	b.Undo()
+	expectContent("foo foo\nbar foo\nfoo", b, t)
+
+	substitute(b, "/foo/x/g", BRope.IV(0, 8), t)
+	expectContent("x x\nbar foo\nfoo", b, t)
+	b.Undo()
+
+	substitute(b, `/(\w+) (\w+)/\2 \1 [&]\n/`, all, t)
+	expectContent("foo foo [foo foo]\n\nfoo bar [bar foo]\n\nfoo", b, t)
+	b.Undo()
+
+	substitute(b, "/^/> /g", all, t)
+	expectContent("> foo foo\n> bar foo\n> foo", b, t)
+	b.Undo()
+
+	substitute(b, "/FOO/x/i", all, t)
+	expectContent("x foo\nbar x\nx", b, t)
+	if _, ok := b.Undo(); !ok {
+		t.Fatalf("expected the substitution to be undoable")
+	}
+}
+
+func TestSubstituteManyMatches(t *testing.T) {
+	text := strings.Repeat("ab ", 100000)
+	b := NewBuffer("test", BRope.NewRopeString(text))
+	substitute(b, "/b/cd/g", BRope.IV(0, b.Rope.Length()), t)
+	expectContent(strings.Repeat("acd ", 100000), b, t)
+	b.Undo()
+	expectContent(text, b, t)
+}
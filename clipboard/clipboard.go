@@ -0,0 +1,64 @@
+// Package clipboard reaches the system clipboard, through the terminal with OSC 52 or through commands
+// like xclip.
+package clipboard
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// A Provider reads and writes the clipboard. primary selects the primary selection of X11 and Wayland,
+// providers without one use the clipboard instead.
+type Provider interface {
+	Copy(text string, primary bool) error
+	Paste(primary bool) (string, error)
+}
+
+// Names of the providers for the clipboard option of the config
+var Names = []string{"osc52", "xclip", "xsel", "wl-clipboard", "pbcopy", "command"}
+
+// New returns the provider called name. "command" runs the shell commands copy and paste, an empty name
+// picks a provider that works in the environment. The OSC 52 provider is passed in, since it writes
+// to the terminal.
+func New(name, copy, paste string, osc52 *OSC52) (Provider, error) {
+	if name == "" {
+		name = detect(os.Getenv, exec.LookPath, runtime.GOOS)
+	}
+	switch name {
+	case "osc52":
+		return osc52, nil
+	case "command":
+		if copy == "" {
+			return nil, fmt.Errorf("the clipboard command to copy is not configured")
+		}
+		return NewShellCommand(copy, paste), nil
+	}
+	if command, ok := commands[name]; ok {
+		return command, nil
+	}
+	return nil, fmt.Errorf("unknown clipboard provider %q", name)
+}
+
+// Picks a provider for the environment. Over SSH the local clipboard is only reached through the terminal.
+func detect(getenv func(string) string, lookPath func(string) (string, error), goos string) string {
+	installed := func(command string) bool {
+		_, err := lookPath(command)
+		return err == nil
+	}
+	switch {
+	case getenv("SSH_CONNECTION") != "" || getenv("SSH_TTY") != "":
+		return "osc52"
+	case getenv("WAYLAND_DISPLAY") != "" && installed("wl-copy"):
+		return "wl-clipboard"
+	case getenv("DISPLAY") != "" && installed("xclip"):
+		return "xclip"
+	case getenv("DISPLAY") != "" && installed("xsel"):
+		return "xsel"
+	case goos == "darwin" && installed("pbcopy"):
+		return "pbcopy"
+	default:
+		return "osc52"
+	}
+}
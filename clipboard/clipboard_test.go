@@ -0,0 +1,101 @@
+package clipboard
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestOSC52(t *testing.T) {
+	var out bytes.Buffer
+	o := NewOSC52(&out)
+	if err := o.Copy("hello", false); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "\x1b]52;c;aGVsbG8=\x07" {
+		t.Fatalf("unexpected escape sequence %q", got)
+	}
+	out.Reset()
+	if err := o.Copy("x", true); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "\x1b]52;p;eA==\x07" {
+		t.Fatalf("unexpected escape sequence for the primary selection %q", got)
+	}
+	if text, _ := o.Paste(false); text != "hello" {
+		t.Fatalf("expected the copied text, got %q", text)
+	}
+	o.Pasted("pasted")
+	if text, _ := o.Paste(false); text != "pasted" {
+		t.Fatalf("expected the pasted text, got %q", text)
+	}
+	if text, _ := o.Paste(true); text != "x" {
+		t.Fatalf("expected the primary selection, got %q", text)
+	}
+	if err := NewOSC52(nil).Copy("x", false); err == nil {
+		t.Fatalf("expected an error without a terminal")
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		env       map[string]string
+		installed []string
+		goos      string
+		expected  string
+	}{
+		{map[string]string{"SSH_CONNECTION": "1", "DISPLAY": ":0"}, []string{"xclip"}, "linux", "osc52"},
+		{map[string]string{"WAYLAND_DISPLAY": "wayland-0"}, []string{"wl-copy", "xclip"}, "linux", "wl-clipboard"},
+		{map[string]string{"WAYLAND_DISPLAY": "wayland-0", "DISPLAY": ":0"}, []string{"xclip"}, "linux", "xclip"},
+		{map[string]string{"DISPLAY": ":0"}, []string{"xsel"}, "linux", "xsel"},
+		{map[string]string{}, []string{"xclip"}, "linux", "osc52"},
+		{map[string]string{}, []string{"pbcopy"}, "darwin", "pbcopy"},
+	}
+	for _, test := range tests {
+		lookPath := func(command string) (string, error) {
+			for _, c := range test.installed {
+				if c == command {
+					return "/usr/bin/" + c, nil
+				}
+			}
+			return "", errors.New("not found")
+		}
+		getenv := func(name string) string { return test.env[name] }
+		if got := detect(getenv, lookPath, test.goos); got != test.expected {
+			t.Fatalf("%v with %v: expected %v, got %v", test.env, test.installed, test.expected, got)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	osc52 := NewOSC52(nil)
+	if p, err := New("osc52", "", "", osc52); err != nil || p != osc52 {
+		t.Fatalf("expected the OSC 52 provider, got %v %v", p, err)
+	}
+	if p, err := New("xclip", "", "", osc52); err != nil || p != commands["xclip"] {
+		t.Fatalf("expected the xclip provider, got %v %v", p, err)
+	}
+	if _, err := New("command", "", "", osc52); err == nil {
+		t.Fatalf("expected an error without a copy command")
+	}
+	if _, err := New("clippy", "", "", osc52); err == nil {
+		t.Fatalf("expected an error for an unknown provider")
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	file := t.TempDir() + "/clipboard"
+	c := NewShellCommand("cat > "+file, "cat "+file)
+	if err := c.Copy("a\nb", false); err != nil {
+		t.Fatal(err)
+	}
+	if text, err := c.Paste(false); err != nil || text != "a\nb" {
+		t.Fatalf("expected the copied text, got %q %v", text, err)
+	}
+	if err := NewShellCommand("exit 1", "").Copy("x", false); err == nil {
+		t.Fatalf("expected the failing command to return an error")
+	}
+	if _, err := NewShellCommand("true", "").Paste(false); err == nil {
+		t.Fatalf("expected an error without a paste command")
+	}
+}
@@ -0,0 +1,76 @@
+package clipboard
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// A Command copies by writing to the stdin of a command and pastes by reading the stdout of another one
+type Command struct {
+	// arguments of the commands for the clipboard and for the primary selection, which is optional
+	copy, copyPrimary   []string
+	paste, pastePrimary []string
+}
+
+var commands = map[string]*Command{
+	"xclip": {
+		copy: []string{"xclip", "-i", "-selection", "clipboard"}, copyPrimary: []string{"xclip", "-i", "-selection", "primary"},
+		paste: []string{"xclip", "-o", "-selection", "clipboard"}, pastePrimary: []string{"xclip", "-o", "-selection", "primary"},
+	},
+	"xsel": {
+		copy: []string{"xsel", "--clipboard", "--input"}, copyPrimary: []string{"xsel", "--primary", "--input"},
+		paste: []string{"xsel", "--clipboard", "--output"}, pastePrimary: []string{"xsel", "--primary", "--output"},
+	},
+	"wl-clipboard": {
+		copy: []string{"wl-copy"}, copyPrimary: []string{"wl-copy", "--primary"},
+		paste: []string{"wl-paste", "--no-newline"}, pastePrimary: []string{"wl-paste", "--primary", "--no-newline"},
+	},
+	"pbcopy": {
+		copy:  []string{"pbcopy"},
+		paste: []string{"pbpaste"},
+	},
+}
+
+// NewShellCommand returns a provider that runs the commands with sh, paste may be empty
+func NewShellCommand(copy, paste string) *Command {
+	c := &Command{copy: []string{"sh", "-c", copy}}
+	if paste != "" {
+		c.paste = []string{"sh", "-c", paste}
+	}
+	return c
+}
+
+func (c *Command) Copy(text string, primary bool) error {
+	args := c.copy
+	if primary && c.copyPrimary != nil {
+		args = c.copyPrimary
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%v failed: %v %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func (c *Command) Paste(primary bool) (string, error) {
+	args := c.paste
+	if primary && c.pastePrimary != nil {
+		args = c.pastePrimary
+	}
+	if args == nil {
+		return "", fmt.Errorf("no command to paste is configured")
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%v failed: %v %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
@@ -0,0 +1,54 @@
+package clipboard
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// OSC52 copies with the OSC 52 escape sequence, the terminal puts the text into the clipboard of the
+// machine it runs on, even over SSH. Inside of tmux this needs "set -g set-clipboard on".
+//
+// Terminals rarely allow reading the clipboard, so pasting returns the text that was last copied or
+// pasted into the terminal.
+type OSC52 struct {
+	// the terminal, nil if there is none
+	w    io.Writer
+	last [2]string
+}
+
+func NewOSC52(w io.Writer) *OSC52 {
+	return &OSC52{w: w}
+}
+
+func (o *OSC52) Copy(text string, primary bool) error {
+	if o.w == nil {
+		return errors.New("OSC 52 needs a terminal")
+	}
+	selection := "c"
+	if primary {
+		selection = "p"
+	}
+	if _, err := fmt.Fprintf(o.w, "\x1b]52;%s;%s\x07", selection, base64.StdEncoding.EncodeToString([]byte(text))); err != nil {
+		return err
+	}
+	o.last[index(primary)] = text
+	return nil
+}
+
+func (o *OSC52) Paste(primary bool) (string, error) {
+	return o.last[index(primary)], nil
+}
+
+// Pasted remembers text that the terminal pasted, which is what is in its clipboard
+func (o *OSC52) Pasted(text string) {
+	o.last[index(false)] = text
+}
+
+func index(primary bool) int {
+	if primary {
+		return 1
+	}
+	return 0
+}
@@ -1,40 +1,326 @@
 package commands
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode"
 )
 
-type cmd func()
 type Commands struct {
 	log *log.Logger
-	commands map[string]cmd
+	commands map[string]*Command
+	// completers of the arguments by the kind of their parameter
+	completers map[ParamKind]Completer
+}
+
+// A Command can be run from the command line. Its parameters, and whether it takes a range or a bang,
+// are checked before it runs, so Run only gets valid arguments.
+type Command struct {
+	Name string
+	// names that select the command only when typed exactly, e.g. "s" for "substitute"
+	Aliases []string
+	Params  []Param
+	// whether the command takes a range like "1,5" before its name
+	Range bool
+	// whether the range can be line 0, the line before the first one, for commands that insert after a line
+	ZeroLine bool
+	// whether the command takes a '!' right after its name
+	Bang bool
+	Run  func(Args) error
+}
+
+type ParamKind int
+
+const (
+	// a word or a quoted string
+	String ParamKind = iota
+	// a file path, parsed like a string
+	Path
+	// a non negative number
+	Count
+	// the rest of the command line as it was typed, e.g. the pattern of :substitute
+	Raw
+	// the name of an open buffer, parsed like a string
+	Buffer
+	// the name of an option of the config, parsed like a string
+	Option
+	// the name of a color theme, parsed like a string
+	Theme
+)
+
+type Param struct {
+	Name     string
+	Kind     ParamKind
+	Optional bool
+}
+
+// Args are the parsed parts of a command line.
+// For "1,5s/a/b/" the range is "1,5" and the text is "/a/b/".
+type Args struct {
+	Range string
+	Bang  bool
+	// the command line after the name and the bang
+	Text string
+	// arguments by the name of their parameter
+	values map[string]string
+	// the range can be line 0, see Command.ZeroLine
+	zeroLine bool
 }
 
 func NewCommands(log *log.Logger) *Commands {
-	return &Commands{log: log, commands: make(map[string]cmd)}
+	return &Commands{log: log, commands: make(map[string]*Command), completers: make(map[ParamKind]Completer)}
 }
 
-func (c *Commands) Exec(command string) {
-	if cmd := c.findCommandByLongestPrefix(command); cmd != nil {
-		cmd()
-	} else {
-		c.log.Printf("Command %s not found\n", command)
+func (c *Commands) Register(command Command) {
+	c.commands[command.Name] = &command
+}
+
+// Exec parses the command line and runs the command. Errors of the command line and of the command
+// itself are returned, so they can be shown to the user.
+func (c *Commands) Exec(line string) error {
+	rng, name, text := split(line)
+	if name == "" {
+		return fmt.Errorf("not a command: %s", strings.TrimSpace(line))
+	}
+	cmd, err := c.find(name)
+	if err != nil {
+		return err
+	}
+
+	args := Args{Range: rng, values: map[string]string{}, zeroLine: cmd.ZeroLine}
+	if rng != "" && !cmd.Range {
+		return fmt.Errorf("%s does not take a range", cmd.Name)
+	}
+	if strings.HasPrefix(text, "!") {
+		if cmd.Bang {
+			args.Bang = true
+			text = text[1:]
+		} else if len(cmd.Params) == 0 || cmd.Params[0].Kind != Raw {
+			return fmt.Errorf("%s does not take a bang (!)", cmd.Name)
+		}
+	}
+	args.Text = strings.TrimLeft(text, " ")
+	if err := args.parse(cmd); err != nil {
+		return err
 	}
+	c.log.Printf("Running command %s", cmd.Name)
+	return cmd.Run(args)
 }
 
-func (c *Commands) findCommandByLongestPrefix(commandPrefix string) cmd {
-	longest := -1
-	var longestCmd cmd
-	for name, cmd := range c.commands {
-		if strings.HasPrefix(name, commandPrefix) && len(name) > longest {
-			longest = len(name)
-			longestCmd = cmd
+// Splits a command line into the range, the name of the command and the text after it
+func split(command string) (rng string, name string, text string) {
+	command = strings.TrimSpace(command)
+	i := strings.IndexFunc(command, func(r rune) bool { return !strings.ContainsRune("0123456789.$%,+- ", r) })
+	if i < 0 {
+		return command, "", ""
+	}
+	rng, command = strings.TrimSpace(command[:i]), command[i:]
+	i = strings.IndexFunc(command, func(r rune) bool { return !unicode.IsLetter(r) })
+	if i < 0 {
+		return rng, command, ""
+	}
+	return rng, command[:i], command[i:]
+}
+
+// Finds the command by its name, an alias or an unambiguous prefix of its name
+func (c *Commands) find(name string) (*Command, error) {
+	if cmd, ok := c.commands[name]; ok {
+		return cmd, nil
+	}
+	candidates := []string{}
+	for _, cmd := range c.commands {
+		for _, alias := range cmd.Aliases {
+			if alias == name {
+				return cmd, nil
+			}
+		}
+		if strings.HasPrefix(cmd.Name, name) {
+			candidates = append(candidates, cmd.Name)
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("unknown command: %s", name)
+	case 1:
+		return c.commands[candidates[0]], nil
+	default:
+		sort.Strings(candidates)
+		return nil, fmt.Errorf("ambiguous command %s: %s", name, strings.Join(candidates, ", "))
+	}
+}
+
+// Assigns the words of the text to the parameters of the command
+func (a *Args) parse(cmd *Command) error {
+	rest := a.Text
+	for _, param := range cmd.Params {
+		if param.Kind == Raw {
+			a.values[param.Name] = rest
+			rest = ""
+			if a.values[param.Name] == "" && !param.Optional {
+				return fmt.Errorf("%s: missing argument %s", cmd.Name, param.Name)
+			}
+			continue
+		}
+
+		word, remaining, ok, err := nextWord(rest)
+		if err != nil {
+			return fmt.Errorf("%s: %v", cmd.Name, err)
+		}
+		if !ok {
+			if !param.Optional {
+				return fmt.Errorf("%s: missing argument %s", cmd.Name, param.Name)
+			}
+			continue
 		}
+		if param.Kind == Count {
+			if n, err := strconv.Atoi(word); err != nil || n < 0 {
+				return fmt.Errorf("%s: %s has to be a number, not %q", cmd.Name, param.Name, word)
+			}
+		}
+		a.values[param.Name] = word
+		rest = remaining
+	}
+	if strings.TrimSpace(rest) != "" {
+		return fmt.Errorf("%s: too many arguments: %s", cmd.Name, strings.TrimSpace(rest))
 	}
-	return longestCmd
+	return nil
 }
 
-func (c *Commands) Register(name string, command cmd) {
-	c.commands[name] = command
+var errUnterminatedQuote = errors.New("unterminated quote")
+
+// Returns the next word of s and the text after it. Words are separated by spaces and can be quoted.
+// Inside of double quotes a backslash escapes the next character, single quotes are taken literally.
+func nextWord(s string) (word string, rest string, ok bool, err error) {
+	s = strings.TrimLeft(s, " \t")
+	if s == "" {
+		return "", "", false, nil
+	}
+
+	var sb strings.Builder
+	var quote rune
+	escaped := false
+	for i, r := range s {
+		switch {
+		case escaped:
+			sb.WriteRune(r)
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			sb.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ' ' || r == '\t':
+			return sb.String(), s[i:], true, nil
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	if quote != 0 {
+		return "", "", false, errUnterminatedQuote
+	}
+	return sb.String(), "", true, nil
+}
+
+// Has returns whether an argument was given for the parameter.
+func (a Args) Has(param string) bool {
+	_, ok := a.values[param]
+	return ok
+}
+
+// String returns the argument of the parameter, or "" if it was not given.
+func (a Args) String(param string) string {
+	return a.values[param]
+}
+
+// Count returns the argument of a Count parameter, or def if it was not given.
+func (a Args) Count(param string, def int) int {
+	if n, err := strconv.Atoi(a.values[param]); err == nil {
+		return n
+	}
+	return def
+}
+
+// Lines resolves the range into the first and the last line it covers, both zero based and inclusive.
+// current is the line of the cursor and last the last line of the buffer. Without a range the current line is used.
+// Line 0 is resolved to -1 for commands that take it, and is invalid for the others.
+//
+// Supported are line numbers, '.' for the current line, '$' for the last line, offsets like ".+3" or "$-1",
+// "%" for all lines and two addresses separated by ','.
+func (a Args) Lines(current, last int) (first int, second int, err error) {
+	rng := strings.ReplaceAll(a.Range, " ", "")
+	if rng == "%" {
+		return 0, last, nil
+	}
+	lo, hi, found := strings.Cut(rng, ",")
+	lowest := 0
+	if a.zeroLine {
+		lowest = -1
+	}
+	if first, err = address(lo, current, lowest, last); err != nil {
+		return
+	}
+	second = first
+	if found {
+		if second, err = address(hi, current, lowest, last); err != nil {
+			return
+		}
+	}
+	if first > second {
+		first, second = second, first
+	}
+	return first, second, nil
+}
+
+// Resolves a single address of a range into a line between lowest and last
+func address(addr string, current, lowest, last int) (int, error) {
+	line := current
+	rest := addr
+	switch {
+	case strings.HasPrefix(addr, "."):
+		rest = addr[1:]
+	case strings.HasPrefix(addr, "$"):
+		line, rest = last, addr[1:]
+	case addr != "" && unicode.IsDigit(rune(addr[0])):
+		end := strings.IndexFunc(addr, func(r rune) bool { return !unicode.IsDigit(r) })
+		if end < 0 {
+			end = len(addr)
+		}
+		n, _ := strconv.Atoi(addr[:end])
+		line, rest = n-1, addr[end:]
+	}
+
+	// offsets, a sign without a number counts as 1
+	for rest != "" {
+		sign := 1
+		switch rest[0] {
+		case '+':
+		case '-':
+			sign = -1
+		default:
+			return 0, fmt.Errorf("invalid address %q", addr)
+		}
+		rest = rest[1:]
+		end := strings.IndexFunc(rest, func(r rune) bool { return !unicode.IsDigit(r) })
+		if end < 0 {
+			end = len(rest)
+		}
+		n := 1
+		if end > 0 {
+			n, _ = strconv.Atoi(rest[:end])
+		}
+		line += sign * n
+		rest = rest[end:]
+	}
+
+	if line < lowest || line > last {
+		return 0, fmt.Errorf("invalid range %q", addr)
+	}
+	return line, nil
 }
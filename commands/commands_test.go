@@ -0,0 +1,127 @@
+package commands
+
+import (
+	"io"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct{ command, rng, name, text string }{
+		{"write", "", "write", ""},
+		{"write foo.txt", "", "write", " foo.txt"},
+		{"w!", "", "w", "!"},
+		{"%s/a/b/g", "%", "s", "/a/b/g"},
+		{" 1, $-2substitute #a#b#", "1, $-2", "substitute", " #a#b#"},
+		{"5", "5", "", ""},
+	}
+	for _, test := range tests {
+		rng, name, text := split(test.command)
+		if rng != test.rng || name != test.name || text != test.text {
+			t.Fatalf("split %q: expected (%q, %q, %q), got (%q, %q, %q)", test.command, test.rng, test.name, test.text, rng, name, text)
+		}
+	}
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		rng           string
+		first, second int
+	}{
+		{"", 4, 4},
+		{"%", 0, 9},
+		{"3", 2, 2},
+		{"1,$", 0, 9},
+		{".,.+2", 4, 6},
+		{"$-1,.", 4, 8},
+		{".-,+", 3, 5},
+	}
+	for _, test := range tests {
+		first, second, err := Args{Range: test.rng}.Lines(4, 9)
+		if err != nil || first != test.first || second != test.second {
+			t.Fatalf("range %q: expected %v,%v, got %v,%v (%v)", test.rng, test.first, test.second, first, second, err)
+		}
+	}
+	for _, invalid := range []string{"11", "0", ".-5", "1,x"} {
+		if _, _, err := (Args{Range: invalid}).Lines(4, 9); err == nil {
+			t.Fatalf("expected an error for range %q", invalid)
+		}
+	}
+	// commands that insert after a line take line 0, before the first one
+	if first, second, err := (Args{Range: "0", zeroLine: true}).Lines(4, 9); err != nil || first != -1 || second != -1 {
+		t.Fatalf("expected line 0 to be -1, got %v,%v (%v)", first, second, err)
+	}
+	if _, _, err := (Args{Range: "0-1", zeroLine: true}).Lines(4, 9); err == nil {
+		t.Fatalf("expected an error for a range before line 0")
+	}
+}
+
+func TestExec(t *testing.T) {
+	c := NewCommands(log.New(io.Discard, "", 0))
+	var got Args
+	run := func(args Args) error {
+		got = args
+		return nil
+	}
+	c.Register(Command{Name: "write", Aliases: []string{"w"}, Bang: true, Params: []Param{{Name: "file", Kind: Path, Optional: true}}, Run: run})
+	c.Register(Command{Name: "wall", Run: run})
+	c.Register(Command{Name: "earlier", Params: []Param{{Name: "count", Kind: Count}}, Run: run})
+	c.Register(Command{Name: "substitute", Aliases: []string{"s"}, Range: true, Params: []Param{{Name: "pattern", Kind: Raw}}, Run: run})
+	c.Register(Command{Name: "read", Aliases: []string{"r"}, Range: true, ZeroLine: true, Params: []Param{{Name: "file", Kind: Path}}, Run: run})
+
+	if err := c.Exec(`w! "my file.txt"`); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Bang || got.String("file") != "my file.txt" {
+		t.Fatalf("unexpected arguments %+v", got)
+	}
+	if err := c.Exec(`wr 'a\b'`); err != nil || got.Bang || got.String("file") != `a\b` {
+		t.Fatalf("unexpected arguments %+v (%v)", got, err)
+	}
+	if err := c.Exec("write"); err != nil || got.Has("file") {
+		t.Fatalf("unexpected arguments %+v (%v)", got, err)
+	}
+	if err := c.Exec("ea 12"); err != nil || got.Count("count", 1) != 12 {
+		t.Fatalf("unexpected arguments %+v (%v)", got, err)
+	}
+	if err := c.Exec("%s/a b/c/g"); err != nil || got.Range != "%" || got.String("pattern") != "/a b/c/g" {
+		t.Fatalf("unexpected arguments %+v (%v)", got, err)
+	}
+	if err := c.Exec("0r a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if first, _, err := got.Lines(4, 9); err != nil || first != -1 {
+		t.Fatalf("expected :read to take line 0, got %v (%v)", first, err)
+	}
+
+	errors := map[string]string{
+		"wa!":      "bang",
+		"x":        "unknown command",
+		"ea":       "missing argument count",
+		"ea many":  "has to be a number",
+		"ea 1 2":   "too many arguments",
+		"1,2write": "does not take a range",
+		`write "a`: "unterminated quote",
+		"s":        "missing argument pattern",
+		"writ a b": "too many arguments",
+		"wa x":     "too many arguments",
+		"wal":      "",
+		"":         "not a command",
+	}
+	for line, message := range errors {
+		err := c.Exec(line)
+		if message == "" {
+			if err != nil {
+				t.Fatalf("%q: unexpected error %v", line, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Fatalf("%q: expected an error containing %q, got %v", line, message, err)
+		}
+	}
+	if err := c.Exec("w"); err != nil {
+		t.Fatalf("the alias should win over the ambiguous prefix: %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A Completer returns the candidates for the prefix of an argument
+type Completer func(prefix string) []string
+
+// Completion are the candidates for the word before the cursor, which starts at Start.
+type Completion struct {
+	Start      int
+	Candidates []string
+	// candidate that is currently inserted, -1 before the first Tab
+	Selected int
+	// the word as it was typed, restored after cycling through all candidates
+	Typed string
+}
+
+// SetCompleter sets the completer for arguments of parameters with the kind. Paths are completed
+// without a completer.
+func (c *Commands) SetCompleter(kind ParamKind, completer Completer) {
+	c.completers[kind] = completer
+}
+
+// Complete returns the completion of the word that ends at the end of line, which is the command line
+// up to the cursor. Returns nil if there is nothing to complete.
+func (c *Commands) Complete(line string) *Completion {
+	runes := []rune(line)
+	_, name, text := split(line)
+	// split trims the spaces that end the last word
+	text += line[len(strings.TrimRight(line, " \t")):]
+	// the name is still being typed
+	if text == "" && name != "" && strings.HasSuffix(line, name) {
+		return newCompletion(len(runes)-len([]rune(name)), name, c.names(name))
+	}
+	if name == "" {
+		if strings.TrimSpace(line) == "" {
+			return newCompletion(len(runes), "", c.names(""))
+		}
+		return nil
+	}
+	cmd, err := c.find(name)
+	if err != nil {
+		return nil
+	}
+	text = strings.TrimPrefix(text, "!")
+
+	// the word before the cursor, including its quotes, is the argument of the parameter after the
+	// words in front of it
+	typed := lastField(text)
+	index := 0
+	for rest := text[:len(text)-len(typed)]; ; index++ {
+		_, r, ok, err := nextWord(rest)
+		if !ok || err != nil {
+			break
+		}
+		rest = r
+	}
+	if index >= len(cmd.Params) || cmd.Params[index].Kind == Raw {
+		return nil
+	}
+	word := unquote(typed)
+	start := len(runes) - len([]rune(typed))
+
+	var candidates []string
+	switch kind := cmd.Params[index].Kind; {
+	case kind == Path:
+		candidates = completePath(word)
+	case c.completers[kind] != nil:
+		candidates = filterPrefix(c.completers[kind](word), word)
+	}
+	sort.Strings(candidates)
+	for i, candidate := range candidates {
+		candidates[i] = quote(candidate)
+	}
+	return newCompletion(start, typed, candidates)
+}
+
+func newCompletion(start int, typed string, candidates []string) *Completion {
+	if len(candidates) == 0 {
+		return nil
+	}
+	return &Completion{Start: start, Candidates: candidates, Selected: -1, Typed: typed}
+}
+
+// Next selects the next candidate and returns the text that replaces the word. After the last candidate,
+// the typed word is returned. Prev does the same backwards.
+func (c *Completion) Next() string {
+	return c.move(1)
+}
+
+func (c *Completion) Prev() string {
+	return c.move(-1)
+}
+
+func (c *Completion) move(step int) string {
+	// -1 stands for the typed word
+	n := len(c.Candidates) + 1
+	c.Selected = (c.Selected+1+step+n)%n - 1
+	if c.Selected < 0 {
+		return c.Typed
+	}
+	return c.Candidates[c.Selected]
+}
+
+// Names of the commands that start with prefix
+func (c *Commands) names(prefix string) []string {
+	names := []string{}
+	for name := range c.commands {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the files and directories that start with prefix, directories end with a slash.
+// Hidden files are only returned if the prefix of their name starts with a dot.
+func completePath(prefix string) []string {
+	dir, base := filepath.Split(prefix)
+	readDir := dir
+	if strings.HasPrefix(dir, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			readDir = filepath.Join(home, dir[2:])
+		}
+	}
+	if readDir == "" {
+		readDir = "."
+	}
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+
+	paths := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+		if entry.IsDir() {
+			name += "/"
+		}
+		paths = append(paths, dir+name)
+	}
+	return paths
+}
+
+func filterPrefix(candidates []string, prefix string) []string {
+	filtered := []string{}
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) {
+			filtered = append(filtered, candidate)
+		}
+	}
+	return filtered
+}
+
+// Quotes a candidate that contains spaces or quotes, so it is parsed as a single word
+func quote(s string) string {
+	if !strings.ContainsAny(s, " \t\"'\\") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// Removes the quotes of a word, which may still miss its closing quote
+func unquote(word string) string {
+	for _, closing := range []string{"", `"`, "'"} {
+		if w, _, ok, err := nextWord(word + closing); ok && err == nil {
+			return w
+		}
+	}
+	return word
+}
+
+// Returns the last word of s including its quotes, as it was typed
+func lastField(s string) string {
+	start, quote := 0, rune(0)
+	escaped := false
+	for i, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ' ' || r == '\t':
+			start = i + 1
+		}
+	}
+	return s[start:]
+}
@@ -0,0 +1,127 @@
+package commands
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLine(t *testing.T) {
+	l := Line{}
+	for _, r := range "wrte x" {
+		l.Insert(r)
+	}
+	l.Home()
+	l.Right()
+	l.Right()
+	l.Insert('i')
+	if l.String() != "write x" || l.Cursor != 3 {
+		t.Fatalf("unexpected line %q with cursor %d", l.String(), l.Cursor)
+	}
+	l.End()
+	l.DeleteWord()
+	if l.String() != "write " {
+		t.Fatalf("unexpected line %q", l.String())
+	}
+	l.Left()
+	l.Backspace()
+	l.Delete()
+	if l.String() != "writ" || l.Cursor != 4 {
+		t.Fatalf("unexpected line %q with cursor %d", l.String(), l.Cursor)
+	}
+	l.Cursor = 2
+	l.ReplaceBeforeCursor(0, "read")
+	if l.String() != "readit" || l.Cursor != 4 {
+		t.Fatalf("unexpected line %q with cursor %d", l.String(), l.Cursor)
+	}
+	l.DeleteToStart()
+	if l.String() != "it" || l.Cursor != 0 {
+		t.Fatalf("unexpected line %q with cursor %d", l.String(), l.Cursor)
+	}
+}
+
+func TestLineInsertText(t *testing.T) {
+	l := Line{}
+	l.Set("s//")
+	l.Left()
+	inserted := l.InsertText("a\r\nb\rc\n")
+	if l.String() != "s/a b c/" || l.Cursor != 7 || inserted != "a b c" {
+		t.Fatalf("unexpected line %q with cursor %d", l.String(), l.Cursor)
+	}
+}
+
+func completionCommands() *Commands {
+	c := NewCommands(log.New(io.Discard, "", 0))
+	run := func(Args) error { return nil }
+	c.Register(Command{Name: "write", Params: []Param{{Name: "file", Kind: Path, Optional: true}}, Run: run})
+	c.Register(Command{Name: "wall", Run: run})
+	c.Register(Command{Name: "substitute", Params: []Param{{Name: "pattern", Kind: Raw}}, Range: true, Run: run})
+	c.Register(Command{Name: "buffer", Params: []Param{{Name: "buffer", Kind: Buffer}}, Run: run})
+	c.SetCompleter(Buffer, func(string) []string { return []string{"main.go", "my file.txt", "other.go"} })
+	return c
+}
+
+func expectCompletion(line string, start int, candidates []string, c *Commands, t *testing.T) {
+	t.Helper()
+	completion := c.Complete(line)
+	if candidates == nil {
+		if completion != nil {
+			t.Fatalf("complete %q: expected no completion, got %+v", line, completion)
+		}
+		return
+	}
+	if completion == nil {
+		t.Fatalf("complete %q: expected %v, got no completion", line, candidates)
+	}
+	if completion.Start != start || !reflect.DeepEqual(completion.Candidates, candidates) {
+		t.Fatalf("complete %q: expected %v at %d, got %v at %d", line, candidates, start, completion.Candidates, completion.Start)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	c := completionCommands()
+	expectCompletion("w", 0, []string{"wall", "write"}, c, t)
+	expectCompletion("1,5su", 3, []string{"substitute"}, c, t)
+	expectCompletion("", 0, []string{"buffer", "substitute", "wall", "write"}, c, t)
+	expectCompletion("x", 0, nil, c, t)
+	expectCompletion("buffer m", 7, []string{"main.go", `"my file.txt"`}, c, t)
+	expectCompletion(`buffer "my`, 7, []string{`"my file.txt"`}, c, t)
+	expectCompletion("buffer ", 7, []string{"main.go", `"my file.txt"`, "other.go"}, c, t)
+	expectCompletion("buffer main.go ", 0, nil, c, t)
+	expectCompletion("s/a", 0, nil, c, t)
+	expectCompletion("wall ", 0, nil, c, t)
+}
+
+func TestCompletePath(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"alpha.txt", "also.go", ".hidden", "beta"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	os.Mkdir(filepath.Join(dir, "alps"), 0755)
+
+	c := completionCommands()
+	prefix := dir + "/"
+	expectCompletion("write "+prefix+"al", 6, []string{prefix + "alpha.txt", prefix + "alps/", prefix + "also.go"}, c, t)
+	expectCompletion("write "+prefix+".", 6, []string{prefix + ".hidden"}, c, t)
+	expectCompletion("write "+prefix, 6, []string{prefix + "alpha.txt", prefix + "alps/", prefix + "also.go", prefix + "beta"}, c, t)
+	expectCompletion("write "+prefix+"x", 0, nil, c, t)
+}
+
+func TestCompletionCycle(t *testing.T) {
+	completion := completionCommands().Complete("w")
+	expected := []string{"wall", "write", "w", "wall"}
+	for _, e := range expected {
+		if next := completion.Next(); next != e {
+			t.Fatalf("expected %q, got %q", e, next)
+		}
+	}
+	if prev := completion.Prev(); prev != "w" {
+		t.Fatalf("expected the typed word, got %q", prev)
+	}
+	if prev := completion.Prev(); prev != "write" {
+		t.Fatalf("expected write, got %q", prev)
+	}
+}
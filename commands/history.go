@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"os"
+	"strings"
+)
+
+// Number of command lines that are remembered
+const historySize = 200
+
+// History remembers the executed command lines across sessions. Browsing it with Prev and Next only shows
+// the lines that start with the text that was typed before browsing started, like in vim.
+type History struct {
+	entries []string
+	// file the history is persisted in, nothing is persisted if it is empty
+	path string
+
+	// entry shown while browsing, len(entries) while not browsing
+	index int
+	typed string
+}
+
+// LoadHistory reads the history from path, one command line per line. A missing file is an empty history.
+func LoadHistory(path string) *History {
+	h := &History{path: path}
+	if content, err := os.ReadFile(path); err == nil {
+		for _, line := range strings.Split(string(content), "\n") {
+			if line != "" {
+				h.entries = append(h.entries, line)
+			}
+		}
+	}
+	if len(h.entries) > historySize {
+		h.entries = h.entries[len(h.entries)-historySize:]
+	}
+	h.index = len(h.entries)
+	return h
+}
+
+// Add appends a command line, an older equal line is removed. The history file is rewritten.
+func (h *History) Add(line string) error {
+	h.Reset()
+	if strings.TrimSpace(line) == "" || strings.Contains(line, "\n") {
+		return nil
+	}
+	for i, entry := range h.entries {
+		if entry == line {
+			h.entries = append(h.entries[:i], h.entries[i+1:]...)
+			break
+		}
+	}
+	h.entries = append(h.entries, line)
+	if len(h.entries) > historySize {
+		h.entries = h.entries[1:]
+	}
+	h.index = len(h.entries)
+
+	if h.path == "" {
+		return nil
+	}
+	return os.WriteFile(h.path, []byte(strings.Join(h.entries, "\n")+"\n"), 0664)
+}
+
+// Prev returns the previous command line starting with typed. typed is only used when browsing starts.
+func (h *History) Prev(typed string) (string, bool) {
+	if h.index == len(h.entries) {
+		h.typed = typed
+	}
+	for i := h.index - 1; i >= 0; i-- {
+		if strings.HasPrefix(h.entries[i], h.typed) {
+			h.index = i
+			return h.entries[i], true
+		}
+	}
+	return "", false
+}
+
+// Next returns the next command line starting with the typed text. Past the newest entry, the typed text
+// itself is returned.
+func (h *History) Next() (string, bool) {
+	if h.index == len(h.entries) {
+		return "", false
+	}
+	for i := h.index + 1; i < len(h.entries); i++ {
+		if strings.HasPrefix(h.entries[i], h.typed) {
+			h.index = i
+			return h.entries[i], true
+		}
+	}
+	h.index = len(h.entries)
+	return h.typed, true
+}
+
+// Reset stops browsing.
+func (h *History) Reset() {
+	h.index = len(h.entries)
+	h.typed = ""
+}
+
+func (h *History) Entries() []string {
+	return h.entries
+}
@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	h := LoadHistory(path)
+	for _, line := range []string{"write", "s/a/b/", "edit x", "set ignoreCase", "s/c/d/"} {
+		h.Add(line)
+	}
+	h.Add("write")
+
+	// browsing with a prefix only shows matching lines
+	for _, expected := range []string{"s/c/d/", "s/a/b/"} {
+		if line, ok := h.Prev("s/"); !ok || line != expected {
+			t.Fatalf("expected %q, got %q", expected, line)
+		}
+	}
+	if _, ok := h.Prev("s/"); ok {
+		t.Fatalf("expected no older line")
+	}
+	if line, _ := h.Next(); line != "s/c/d/" {
+		t.Fatalf("expected s/c/d/, got %q", line)
+	}
+	if line, _ := h.Next(); line != "s/" {
+		t.Fatalf("expected the typed text, got %q", line)
+	}
+	if _, ok := h.Next(); ok {
+		t.Fatalf("expected to be done browsing")
+	}
+
+	// the history is restored from its file, equal lines are only kept once
+	expected := []string{"s/a/b/", "edit x", "set ignoreCase", "s/c/d/", "write"}
+	if entries := LoadHistory(path).Entries(); !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("expected %v, got %v", expected, entries)
+	}
+	if line, _ := LoadHistory(path).Prev(""); line != "write" {
+		t.Fatalf("expected write, got %q", line)
+	}
+}
+
+func TestHistorySize(t *testing.T) {
+	h := LoadHistory("")
+	for i := 0; i < historySize+10; i++ {
+		h.Add(string(rune('a'+i%26)) + string(rune('0'+i/26)))
+	}
+	if len(h.Entries()) != historySize {
+		t.Fatalf("expected %d entries, got %d", historySize, len(h.Entries()))
+	}
+}
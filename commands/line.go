@@ -0,0 +1,93 @@
+package commands
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Line is the text typed into the command line and the position of the cursor in it.
+type Line struct {
+	Text   []rune
+	Cursor int
+}
+
+func (l *Line) String() string {
+	return string(l.Text)
+}
+
+// Set replaces the text and moves the cursor to its end.
+func (l *Line) Set(text string) {
+	l.Text = []rune(text)
+	l.Cursor = len(l.Text)
+}
+
+func (l *Line) Insert(r rune) {
+	l.Text = append(l.Text[:l.Cursor], append([]rune{r}, l.Text[l.Cursor:]...)...)
+	l.Cursor++
+}
+
+// InsertText inserts text at the cursor, like a register or a paste. The command line has a single line,
+// so a line break at the end of text is left out and the others become spaces. Returns the inserted text.
+func (l *Line) InsertText(text string) string {
+	text = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(text)
+	text = strings.ReplaceAll(strings.TrimSuffix(text, "\n"), "\n", " ")
+	for _, r := range text {
+		l.Insert(r)
+	}
+	return text
+}
+
+// Replaces the text from start up to the cursor, for example with a completion
+func (l *Line) ReplaceBeforeCursor(start int, text string) {
+	inserted := []rune(text)
+	l.Text = append(l.Text[:start], append(inserted, l.Text[l.Cursor:]...)...)
+	l.Cursor = start + len(inserted)
+}
+
+// Deletes the rune before the cursor
+func (l *Line) Backspace() {
+	if l.Cursor > 0 {
+		l.Text = append(l.Text[:l.Cursor-1], l.Text[l.Cursor:]...)
+		l.Cursor--
+	}
+}
+
+// Deletes the rune under the cursor
+func (l *Line) Delete() {
+	if l.Cursor < len(l.Text) {
+		l.Text = append(l.Text[:l.Cursor], l.Text[l.Cursor+1:]...)
+	}
+}
+
+// Deletes the word before the cursor and the spaces after it
+func (l *Line) DeleteWord() {
+	start := l.Cursor
+	for start > 0 && unicode.IsSpace(l.Text[start-1]) {
+		start--
+	}
+	for start > 0 && !unicode.IsSpace(l.Text[start-1]) {
+		start--
+	}
+	l.ReplaceBeforeCursor(start, "")
+}
+
+// Deletes everything before the cursor
+func (l *Line) DeleteToStart() {
+	l.ReplaceBeforeCursor(0, "")
+}
+
+func (l *Line) Left() {
+	l.Cursor = max(0, l.Cursor-1)
+}
+
+func (l *Line) Right() {
+	l.Cursor = min(len(l.Text), l.Cursor+1)
+}
+
+func (l *Line) Home() {
+	l.Cursor = 0
+}
+
+func (l *Line) End() {
+	l.Cursor = len(l.Text)
+}
@@ -3,9 +3,13 @@ package config
 import (
 	"embed"
 	"encoding/json"
+	"fmt"
 	"io/fs"
 	"log"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
 
 	"github.com/fsnotify/fsnotify"
 )
@@ -19,6 +23,39 @@ var confFile string
 type EditorConfig struct {
 	RelativeLineNumbers bool `json:"relativeLineNumbers"`
 	TrimFiles   bool   `json:"trimFiles"`
+	// searches ignore case, unless smart case is set and the pattern contains upper case letters
+	IgnoreCase bool `json:"ignoreCase"`
+	SmartCase  bool `json:"smartCase"`
+	// the clipboard provider, like "osc52" or "xclip", empty to pick one. "command" runs clipboardCopy
+	// and clipboardPaste with sh.
+	Clipboard      string `json:"clipboard"`
+	ClipboardCopy  string `json:"clipboardCopy"`
+	ClipboardPaste string `json:"clipboardPaste"`
+	// yanks and deletes without a register go to the clipboard too
+	ClipboardUnnamed bool `json:"clipboardUnnamed"`
+	// lines above and below, and columns left and right of the cursor that are kept visible when scrolling
+	ScrollOff     int `json:"scrollOff"`
+	SideScrollOff int `json:"sideScrollOff"`
+	// soft wrapping of long lines, "off", "window" at the width of the window, or "column" at wrapColumn
+	Wrap       string `json:"wrap"`
+	WrapColumn int    `json:"wrapColumn"`
+	// lines are wrapped after blanks instead of inside of words
+	WrapWords bool `json:"wrapWords"`
+	// wrapped lines are continued with the indent of their start
+	BreakIndent bool `json:"breakIndent"`
+	// the columns between tab stops, tabs are shown up to the next one
+	TabStop int `json:"tabStop"`
+	// buffers are highlighted with the grammar of their file type, more grammars are read from the
+	// syntax directory next to the config file
+	Syntax bool `json:"syntax"`
+	// the color theme, a built in one or one of the themes directory next to the config file
+	ColorScheme string `json:"colorscheme"`
+	// the line of the cursor is highlighted
+	CursorLine bool `json:"cursorLine"`
+	// the segments of the status line of the active window and of the other ones, separated by spaces.
+	// The segments after a "|" are aligned to the right.
+	StatusLine         string `json:"statusLine"`
+	StatusLineInactive string `json:"statusLineInactive"`
 }
 
 type Config struct {
@@ -113,3 +150,72 @@ func (cfg *Config) readConfigIntoMemory() {
 		cfg.log.Fatalf("Could not unmarshal config file: %v", uerr)
 	}
 }
+
+// Dir is the directory of the config file, other state of the editor like the command history is kept there too.
+func (cfg *Config) Dir() string {
+	return confDir
+}
+
+// OptionNames returns the names of the options, as they are written in the config file.
+func OptionNames() []string {
+	names := []string{}
+	t := reflect.TypeOf(EditorConfig{})
+	for i := 0; i < t.NumField(); i++ {
+		names = append(names, t.Field(i).Tag.Get("json"))
+	}
+	return names
+}
+
+// Set changes an option like :set in vim. "name" turns the option on, "noname" turns it off
+// and "name!" toggles it, options that are not on or off are set with "name=value".
+// The config file is not changed.
+func (c *EditorConfig) Set(option string) error {
+	if name, text, ok := strings.Cut(option, "="); ok {
+		field := c.option(name)
+		switch {
+		case !field.IsValid():
+			return fmt.Errorf("unknown option: %s", name)
+		case field.Kind() == reflect.String:
+			field.SetString(text)
+		case field.Kind() == reflect.Int:
+			n, err := strconv.Atoi(text)
+			if err != nil {
+				return fmt.Errorf("option needs a number: %s=%s", name, text)
+			}
+			field.SetInt(int64(n))
+		default:
+			return fmt.Errorf("unknown option: %s", name)
+		}
+		return nil
+	}
+	value := true
+	toggle := strings.HasSuffix(option, "!")
+	name := strings.TrimSuffix(option, "!")
+	field := c.option(name)
+	if !field.IsValid() && strings.HasPrefix(name, "no") {
+		name, value = name[2:], false
+		field = c.option(name)
+	}
+	if !field.IsValid() || toggle && !value {
+		return fmt.Errorf("unknown option: %s", option)
+	}
+	if field.Kind() != reflect.Bool {
+		return fmt.Errorf("option needs a value: %s=", name)
+	}
+	if toggle {
+		value = !field.Bool()
+	}
+	field.SetBool(value)
+	return nil
+}
+
+// Returns the field of the option, or the zero value if there is no such option
+func (c *EditorConfig) option(name string) reflect.Value {
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Tag.Get("json") == name {
+			return v.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
@@ -1,18 +1,28 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	BRope "main/brope"
 	Buffer "main/buffer"
+	"main/clipboard"
 	"main/commands"
 	"main/config"
 	"main/layout"
 	. "main/layout"
+	"main/status"
+	"main/theme"
+	"main/vi"
+	"main/view"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
 )
 
 type Cursor struct {
@@ -57,9 +67,26 @@ type Application struct {
 	config *config.Config
 
   // command to execute is build up and stored here
-	currentCommand string
+	commandLine commands.Line
+  // completion of the word before the cursor of the command line, cycled with Tab
+	completion *commands.Completion
+  // executed command lines, browsed with Up and Down
+	history *commands.History
+  // the last executed command line, for the ":" register
+	lastCommand string
+  // Ctrl-R was typed into the command line, the next key is the register to insert
+	insertRegister bool
   // map of all possible commands and their implementations
 	commands       *commands.Commands
+  // modes and key bindings of the buffer area
+	vi *vi.Engine
+  // file the registers are kept in between runs
+	sessionFile string
+  // copies to the clipboard through the terminal, and remembers what the terminal pasted
+	osc52 *clipboard.OSC52
+  // the terminal is pasting, the keys it sends are collected in pasted and inserted when it is done
+	pasting bool
+	pasted  strings.Builder
 
 	activeInputArea *InputArea
 	inputAreas      map[InputAreaType]*InputArea
@@ -75,9 +102,44 @@ type Application struct {
   // whether the application is still running
 	isAlive bool
 
+  // last search, repeated by n and N. Its matches are highlighted until :nohlsearch
+	searchPattern   BRope.Pattern
+	searchForward   bool
+	highlightSearch bool
+  // substitution with the c flag that waits for the user to confirm its matches
+	confirm *confirmation
+
+  // shown in the status line until the next key press
+	message        string
+	messageIsError bool
+  // quit without writing the buffer, set by :quit!
+	discard bool
+  // the name of the color theme the screen is drawn with, it is loaded again when the colorscheme option changes
+	colorScheme string
+  // the git branches of the files of the buffers, read again when a buffer is opened, written or switched to
+	branches map[*Buffer.Buffer]string
+  // the parsed values of the statusLine options, so they are only parsed again when the options change
+	statusLines map[string]parsedStatusLine
+
 	log *log.Logger
 }
 
+type parsedStatusLine struct {
+	line status.Line
+	err  error
+}
+
+// An interactive substitution, every match is confirmed with y/n/a/q/l. The accepted matches are
+// replaced together when all matches have been answered.
+type confirmation struct {
+	sub      Buffer.Substitution
+	matches  [][]BRope.Interval
+	current  int
+	accepted [][]BRope.Interval
+	// offset of the cursor before the substitution
+	cursor int
+}
+
 type WindowArea struct {
 	box    *Box
 	cursor *Cursor
@@ -91,7 +153,8 @@ type InputArea struct {
 
 type BufferWindow struct {
   inputArea *InputArea
-  buffer *Buffer.Buffer
+  // the buffer shown in the window and its cursor
+  view *view.View
 }
 
 func (win *BufferWindow) send(ev tcell.Event) { 
@@ -129,110 +192,446 @@ func (app *Application) broadcastInputSink(sinks ...InputSink) InputSink {
 }
 
 func (app *Application) handleInputBufferArea(ev tcell.Event) {
-	cursor := app.activeInputArea.area.cursor
 	window := app.window
 	s := app.screen
-	box := app.activeInputArea.area.box
 
 	switch ev := ev.(type) {
 	case *tcell.EventResize:
 		window.update(ev.Size())
 		s.Sync()
 	case *tcell.EventKey:
-		if ev.Key() == tcell.KeyEscape || ev.Key() == tcell.KeyCtrlC {
-			app.quit(s)
-		} else if ev.Key() == tcell.KeyUp {
-			cursor.y = cursor.y - 1
-		} else if ev.Key() == tcell.KeyDown {
-			cursor.y++
-		} else if ev.Key() == tcell.KeyLeft {
-			cursor.x--
-		} else if ev.Key() == tcell.KeyRight {
-			cursor.x++
-		} else if ev.Key() == tcell.KeyCtrlL {
-			s.Sync()
-		} else if ev.Key() == tcell.KeyRune && ev.Rune() == ':' {
-			// switch into command mode
-			app.activeInputArea = app.inputAreas[commandArea]
-		} else if ev.Key() == tcell.KeyRune {
-			x, y := cursor.x-box.min.x, cursor.y-box.min.y
-			app.log.Printf("Inserting '%c' into rope '%v' at Cursor (x=%v, y=%v)", ev.Rune(), app.currentBuffer.Rope.String(), x, y)
-			app.currentBuffer.Rope = app.currentBuffer.Rope.InsertChar(y, x, ev.Rune())
-			cursor.x++
-		} else if ev.Key() == tcell.KeyBackspace || ev.Key() == tcell.KeyBackspace2 {
-			minx, miny := app.activeInputArea.area.box.min.x, app.activeInputArea.area.box.min.y
-			x, y := cursor.x-minx, cursor.y-miny
-			app.currentBuffer.Rope = app.currentBuffer.Rope.DeleteAt(y, x)
-			cursor.x--
-			app.log.Printf("Deleting character. Rope is now:\n '%v'", app.currentBuffer.Rope.String())
-		} else if ev.Key() == tcell.KeyEnter {
-			x, y := cursor.x-box.min.x, cursor.y-box.min.y
-			app.log.Printf("Inserting '\\n' into rope '%v' at Cursor (x=%v, y=%v)", app.currentBuffer.Rope.String(), x, y)
-			app.currentBuffer.Rope = app.currentBuffer.Rope.InsertChar(y, x, '\n')
-			cursor.x = app.activeInputArea.area.box.min.x
-			cursor.y++
+		app.message = ""
+		if app.pasting {
+			app.pasted.WriteString(pastedText(ev))
+			return
+		}
+		if app.confirm != nil {
+			app.confirmKey(ev)
+			return
+		}
+		if app.config.EditorConfig.ClipboardUnnamed {
+			app.vi.Registers().Mirror('+')
+		} else {
+			app.vi.Registers().Mirror(0)
+		}
+		app.vi.Feed(vi.KeyOf(ev))
+	case *tcell.EventPaste:
+		app.pasting = ev.Start()
+		if ev.End() {
+			// inserted at once, so it is a single undo step and not typed key by key
+			text := strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(app.pasted.String())
+			app.pasted.Reset()
+			app.osc52.Pasted(text)
+			app.vi.Paste(text)
 		}
 	case *tcell.EventMouse:
 		x, y := ev.Position()
-		if ev.Buttons() == tcell.Button1 {
-			cursor.x, cursor.y = x, y
+		pastEnd := app.vi.Mode() == vi.Insert || app.vi.Mode() == vi.Replace
+		switch ev.Buttons() {
+		case tcell.Button1:
+			app.currentBuffer.History.EndGroup()
+			app.currentBuffer.Selections.Clear()
+			box := app.activeInputArea.area.box
+			app.view().SetCursor(app.view().OffsetAt(y-box.min.y, x-box.min.x, pastEnd))
+		// the wheel scrolls three lines, like in most terminals
+		case tcell.WheelUp:
+			app.view().Scroll(-3, pastEnd)
+		case tcell.WheelDown:
+			app.view().Scroll(3, pastEnd)
+		}
+	}
+}
+
+// The text of a key the terminal sends while pasting. Terminals send line breaks as carriage returns.
+func pastedText(ev *tcell.EventKey) string {
+	switch ev.Key() {
+	case tcell.KeyRune:
+		return string(ev.Rune())
+	case tcell.KeyEnter:
+		return "\r"
+	case tcell.KeyLF:
+		return "\n"
+	case tcell.KeyTab:
+		return "\t"
+	}
+	return ""
+}
+
+// Buffer and the cursor methods let the vi engine edit the current buffer, the cursor is the one of its view
+func (app *Application) Buffer() *Buffer.Buffer {
+	return app.currentBuffer
+}
+
+func (app *Application) Cursor() int {
+	return app.view().Cursor()
+}
+
+func (app *Application) SetCursor(offset int) {
+	app.view().SetCursor(offset)
+}
+
+func (app *Application) CursorToLine(line int, pastEnd bool) {
+	app.view().CursorToLine(line, pastEnd)
+}
+
+func (app *Application) KeepLineEnd() {
+	app.view().KeepLineEnd()
+}
+
+func (app *Application) RowOffset(offset, rows int) (int, bool) {
+	return app.view().RowOffset(offset, rows)
+}
+
+func (app *Application) TabStop() int {
+	return app.view().TabStop()
+}
+
+// The view of the buffer window
+func (app *Application) view() *view.View {
+	return app.currentArea.(*BufferWindow).view
+}
+
+// SetFileMark and GoToFileMark keep the upper case marks of vi for all buffers
+func (app *Application) SetFileMark(name rune, offset int) {
+	app.buffers.SetFileMark(name, app.currentBuffer, offset)
+}
+
+func (app *Application) GoToFileMark(name rune) (int, bool) {
+	buffer, offset, err := app.buffers.FileMark(name)
+	if err != nil {
+		app.showError(err)
+		return 0, false
+	}
+	if buffer != app.currentBuffer {
+		app.switchBuffer(buffer)
+	}
+	return offset, true
+}
+
+// Returns the clipboard provider of the config
+func (app *Application) clipboard() (clipboard.Provider, error) {
+	cfg := app.config.EditorConfig
+	return clipboard.New(cfg.Clipboard, cfg.ClipboardCopy, cfg.ClipboardPaste, app.osc52)
+}
+
+// Makes the register the clipboard, or the primary selection
+func (app *Application) provideClipboard(name rune, primary bool) {
+	get := func() string {
+		provider, err := app.clipboard()
+		if err != nil {
+			app.showError(err)
+			return ""
+		}
+		text, err := provider.Paste(primary)
+		if err != nil {
+			app.showError(err)
+		}
+		return text
+	}
+	set := func(text string) {
+		provider, err := app.clipboard()
+		if err == nil {
+			err = provider.Copy(text, primary)
+		}
+		if err != nil {
+			app.showError(err)
 		}
 	}
+	app.vi.Registers().Provide(name, get, set)
+}
+
+func (app *Application) undo() {
+	if offset, ok := app.currentBuffer.Undo(); ok {
+		app.SetCursor(offset)
+	}
+}
+
+func (app *Application) redo() {
+	if offset, ok := app.currentBuffer.Redo(); ok {
+		app.SetCursor(offset)
+	}
+}
+
+// Switches into command mode with text already typed
+func (app *Application) openCommandLine(text string) {
+	app.commandLine.Set(text)
+	app.activeInputArea = app.inputAreas[commandArea]
+}
+
+// Searches for text from the cursor and jumps to the first match. An empty text repeats the last search.
+func (app *Application) search(text string, forward bool) {
+	if text != "" {
+		cfg := app.config.EditorConfig
+		ignoreCase := cfg.IgnoreCase && !(cfg.SmartCase && strings.ToLower(text) != text)
+		pattern, err := BRope.CompilePattern(text, ignoreCase)
+		if err != nil {
+			app.showError(fmt.Errorf("invalid search pattern %q: %v", text, err))
+			return
+		}
+		app.searchPattern = pattern
+	}
+	app.searchForward = forward
+	app.searchNext(false)
+}
+
+// Jumps to the next match of the last search, or to the previous one if reverse is set.
+// The search wraps around the end of the buffer.
+func (app *Application) searchNext(reverse bool) {
+	if app.searchPattern == nil {
+		app.showError(errors.New("no previous search pattern"))
+		return
+	}
+	rope := app.currentBuffer.Rope
+	offset := app.Cursor()
+
+	var match BRope.Interval
+	var ok bool
+	if app.searchForward != reverse {
+		if match, ok = rope.FindNext(app.searchPattern, offset+1); !ok {
+			match, ok = rope.FindNext(app.searchPattern, 0)
+		}
+	} else {
+		if match, ok = rope.FindPrev(app.searchPattern, offset); !ok {
+			match, ok = rope.FindPrev(app.searchPattern, rope.Length())
+		}
+	}
+	app.highlightSearch = true
+	if !ok {
+		app.showError(errors.New("pattern not found"))
+		return
+	}
+	app.currentBuffer.PushJump(offset)
+	app.SetCursor(match.Lo)
+}
+
+func (app *Application) substituteCmd(args commands.Args) error {
+	buffer := app.currentBuffer
+	sub, err := Buffer.ParseSubstitution(args.String("pattern"))
+	if err != nil {
+		return err
+	}
+	cfg := app.config.EditorConfig
+	sub.IgnoreCase = sub.IgnoreCase || cfg.IgnoreCase && !(cfg.SmartCase && strings.ToLower(sub.Pattern) != sub.Pattern)
+
+	cursor := app.Cursor()
+	first, last, err := args.Lines(buffer.Rope.LineOfOffset(cursor), buffer.Rope.LineCount()-1)
+	if err != nil {
+		return err
+	}
+	matches, err := buffer.Matches(sub, BRope.IV(buffer.Rope.OffsetOfLine(first), buffer.Rope.OffsetOfLine(last+1)))
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %v", sub.Pattern, err)
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("pattern not found: %v", sub.Pattern)
+	}
+
+	if sub.Confirm {
+		app.confirm = &confirmation{sub: sub, matches: matches, cursor: cursor}
+		app.SetCursor(matches[0][0].Lo)
+		return nil
+	}
+	app.SetCursor(buffer.Substitute(sub, matches, cursor))
+	app.showMessage("%v substitutions", len(matches))
+	return nil
+}
+
+// Answers the question of an interactive substitution for the current match
+func (app *Application) confirmKey(ev *tcell.EventKey) {
+	c := app.confirm
+	match := c.matches[c.current]
+	done := false
+	switch {
+	case ev.Key() == tcell.KeyRune && ev.Rune() == 'y':
+		c.accepted = append(c.accepted, match)
+	case ev.Key() == tcell.KeyRune && ev.Rune() == 'n':
+	case ev.Key() == tcell.KeyRune && ev.Rune() == 'a':
+		c.accepted = append(c.accepted, c.matches[c.current:]...)
+		done = true
+	case ev.Key() == tcell.KeyRune && ev.Rune() == 'l':
+		c.accepted = append(c.accepted, match)
+		done = true
+	case ev.Key() == tcell.KeyRune && ev.Rune() == 'q', ev.Key() == tcell.KeyEscape:
+		done = true
+	default:
+		return
+	}
+
+	c.current++
+	if !done && c.current < len(c.matches) {
+		app.SetCursor(c.matches[c.current][0].Lo)
+		return
+	}
+	app.confirm = nil
+	if len(c.accepted) > 0 {
+		app.SetCursor(app.currentBuffer.Substitute(c.sub, c.accepted, c.cursor))
+	}
+	app.showMessage("%v of %v matches substituted", len(c.accepted), len(c.matches))
+}
+
+func (app *Application) showMessage(format string, a ...any) {
+	app.message = fmt.Sprintf(format, a...)
+	app.messageIsError = false
+	app.log.Print(app.message)
+}
+
+func (app *Application) showError(err error) {
+	app.message = err.Error()
+	app.messageIsError = true
+	app.log.Printf("Error: %v", err)
 }
 
 func (app *Application) handleInputCommandArea(ev tcell.Event) {
-	cursor := app.activeInputArea.area.cursor
 	window := app.window
 	s := app.screen
+	line := &app.commandLine
 
-	// TODO we need to be able to change the current command at any position via the cursor
 	switch ev := ev.(type) {
 	case *tcell.EventResize:
 		window.update(ev.Size())
 		s.Sync()
+	case *tcell.EventPaste:
+		app.pasting = ev.Start()
+		if ev.End() {
+			app.completion = nil
+			text := strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(app.pasted.String())
+			app.pasted.Reset()
+			app.osc52.Pasted(text)
+			// recorded as the keys that type it, like the keys typed into the command line
+			for _, r := range line.InsertText(text) {
+				app.vi.Record(vi.RuneKey(r))
+			}
+		}
 	case *tcell.EventKey:
-		if ev.Key() == tcell.KeyEscape {
-			app.currentCommand = ""
-			app.activeInputArea = app.inputAreas[bufferArea]
-			// invalidate cursor, causing them to be clamped again next time
-			cursor.x, cursor.y = -1, -1
-			app.activeInputArea = app.inputAreas[bufferArea]
+		// the keys of a paste are text, a pasted Enter does not run the command
+		if app.pasting {
+			app.pasted.WriteString(pastedText(ev))
+			return
+		}
+		if ev.Key() != tcell.KeyTab && ev.Key() != tcell.KeyBacktab {
+			app.completion = nil
+		}
+		if ev.Key() != tcell.KeyUp && ev.Key() != tcell.KeyDown {
+			app.history.Reset()
+		}
+
+		if app.insertRegister {
+			app.insertRegister = false
+			if reg, ok := app.vi.Registers().Get(ev.Rune()); ev.Key() == tcell.KeyRune && ok {
+				line.InsertText(reg.String())
+			}
+		} else if ev.Key() == tcell.KeyEscape {
+			app.closeCommandLine()
+		} else if ev.Key() == tcell.KeyCtrlR {
+			app.insertRegister = true
 		} else if ev.Key() == tcell.KeyCtrlC {
 			app.quit(s)
-		} else if ev.Key() == tcell.KeyLeft {
-			cursor.x--
-		} else if ev.Key() == tcell.KeyRight {
-			cursor.x++
+		} else if ev.Key() == tcell.KeyTab || ev.Key() == tcell.KeyBacktab {
+			app.complete(ev.Key() == tcell.KeyBacktab)
+		} else if ev.Key() == tcell.KeyUp {
+			if text, ok := app.history.Prev(line.String()); ok {
+				line.Set(text)
+			}
+		} else if ev.Key() == tcell.KeyDown {
+			if text, ok := app.history.Next(); ok {
+				line.Set(text)
+			}
+		} else if ev.Key() == tcell.KeyLeft || ev.Key() == tcell.KeyCtrlB {
+			line.Left()
+		} else if ev.Key() == tcell.KeyRight || ev.Key() == tcell.KeyCtrlF {
+			line.Right()
+		} else if ev.Key() == tcell.KeyHome || ev.Key() == tcell.KeyCtrlA {
+			line.Home()
+		} else if ev.Key() == tcell.KeyEnd || ev.Key() == tcell.KeyCtrlE {
+			line.End()
 		} else if ev.Key() == tcell.KeyCtrlL {
 			s.Sync()
 		} else if ev.Key() == tcell.KeyRune {
-			rune := ev.Rune()
-			app.currentCommand += string(rune)
-			cursor.x++
+			line.Insert(ev.Rune())
 		} else if ev.Key() == tcell.KeyBackspace || ev.Key() == tcell.KeyBackspace2 {
-			if len(app.currentCommand) > 0 {
-				app.currentCommand = app.currentCommand[:len(app.currentCommand)-1]
+			// like in vim, deleting from an empty command line leaves it
+			if len(line.Text) == 0 {
+				app.closeCommandLine()
 			}
-			cursor.x--
+			line.Backspace()
+		} else if ev.Key() == tcell.KeyDelete {
+			line.Delete()
+		} else if ev.Key() == tcell.KeyCtrlW {
+			line.DeleteWord()
+		} else if ev.Key() == tcell.KeyCtrlU {
+			line.DeleteToStart()
 		} else if ev.Key() == tcell.KeyEnter {
-			app.commands.Exec(app.currentCommand)
-			// invalidate cursor, causing them to be clamped again next time
-			cursor.x, cursor.y = -1, -1
-			app.currentCommand = ""
-			app.activeInputArea = app.inputAreas[bufferArea]
+			command := line.String()
+			app.closeCommandLine()
+			if err := app.history.Add(command); err != nil {
+				app.log.Printf("Could not write the command history: %v", err)
+			}
+			app.lastCommand = command
+			if strings.HasPrefix(command, "/") {
+				app.search(command[1:], true)
+			} else if strings.HasPrefix(command, "?") {
+				app.search(command[1:], false)
+			} else {
+				if err := app.commands.Exec(command); err != nil {
+					app.showError(err)
+				}
+			}
 		}
 	}
 }
 
+func (app *Application) closeCommandLine() {
+	app.commandLine.Set("")
+	app.completion = nil
+	app.history.Reset()
+	// invalidate the cursor, it is placed again when the command line is drawn
+	cursor := app.inputAreas[commandArea].area.cursor
+	cursor.x, cursor.y = -1, -1
+	app.activeInputArea = app.inputAreas[bufferArea]
+}
+
+// Replaces the word before the cursor of the command line with the next candidate of its completion.
+// The first Tab only completes the common prefix of the candidates, if it is longer than the word.
+func (app *Application) complete(reverse bool) {
+	line := &app.commandLine
+	if app.completion == nil {
+		app.completion = app.commands.Complete(string(line.Text[:line.Cursor]))
+		if app.completion == nil {
+			return
+		}
+		if len(app.completion.Candidates) == 1 {
+			line.ReplaceBeforeCursor(app.completion.Start, app.completion.Candidates[0])
+			app.completion = nil
+			return
+		}
+	}
+
+	c := app.completion
+	if reverse {
+		line.ReplaceBeforeCursor(c.Start, c.Prev())
+	} else {
+		line.ReplaceBeforeCursor(c.Start, c.Next())
+	}
+}
+
 func (app *Application) quit(s tcell.Screen) {
 	maybePanic := recover()
 	s.Fini()
 
-	err := app.buffers.WriteClose(app.currentBuffer.File)
-	if err != nil {
-		log.Fatalf("%+v", err)
+	if err := saveSession(app.sessionFile, app.vi.Registers(), app.buffers); err != nil {
+		app.log.Printf("Could not write the session: %v", err)
+	}
+
+	if !app.discard {
+		for _, name := range app.buffers.Names() {
+			rope := app.buffers.Open[name].Rope
+			err := app.buffers.WriteClose(name)
+			if err != nil {
+				log.Fatalf("%+v", err)
+			}
+			app.log.Printf("Wrote rope with %v runes to file %v", rope.Length(), name)
+		}
 	}
-	app.log.Printf("Wrote rope to file %v:\n'%v'", app.currentBuffer.File, app.currentBuffer.Rope)
 
 	if maybePanic != nil {
 		panic(maybePanic)
@@ -266,105 +665,232 @@ func (app *Application) lineNumberBox(dims layout.Dimensions) {
 	xmin, ymin, xmax, ymax := dims.Origin.X, dims.Origin.Y, dims.Origin.X+dims.Width, dims.Origin.Y+dims.Height
 
 	if app.activeInputArea.typ == bufferArea {
-		cursor := app.activeInputArea.area.cursor
+		rope := app.currentBuffer.Rope
+		v := app.view()
+		cursorLine := rope.LineOfOffset(v.Cursor())
 		pad := xmax - xmin
 
 		for i := ymin; i < ymax; i++ {
 			drawText(s, xmin, i, xmax, i, DefaultStyle, " ")
 		}
 
-		if !app.config.EditorConfig.RelativeLineNumbers {
-			var lineCount int
-			if app.currentBuffer.Rope.LineCount() == 0 {
-				lineCount = 1
-			} else {
-				lineCount = app.currentBuffer.Rope.LineCount()
-			}
-			for i := 0; i < lineCount; i++ {
-				drawText(s, xmin, i, xmax, i, DefaultStyle, fmt.Sprintf("%*v", pad, i))
-			}
-		} else {
-      // TODO relative liner numbers are not working properly
-			var lineCount int
-			if app.currentBuffer.Rope.LineCount() == 0 {
-				lineCount = 1
-			} else {
-				lineCount = app.currentBuffer.Rope.LineCount()
+		// only the first row of a wrapped line is numbered
+		for i, row := range v.Rows() {
+			line, y := row.Line, ymin+i
+			if row.Lo != rope.OffsetOfLine(line) {
+				continue
 			}
-			if lineCount == 1 {
-				drawText(s, xmin, cursor.y, xmax, cursor.y, DefaultStyle, fmt.Sprintf("%*v", pad, 0))
+			if line == cursorLine {
+				drawText(s, xmin, y, xmax, y, CursorLineNrStyle, fmt.Sprintf("%*v", pad, line))
+			} else if !app.config.EditorConfig.RelativeLineNumbers {
+				drawText(s, xmin, y, xmax, y, DefaultStyle, fmt.Sprintf("%*v", pad, line))
 			} else {
-				for top := 0; top < cursor.y; top++ {
-					drawText(s, xmin, top, xmax, top, LightStyle, fmt.Sprintf("%*v", pad, cursor.y-top))
-				}
-				drawText(s, xmin, cursor.y, xmax, cursor.y, DefaultStyle, fmt.Sprintf("%*v", pad, cursor.y))
-				for bottom := cursor.y + 1; bottom < lineCount; bottom++ {
-					drawText(s, xmin, bottom, xmax, bottom, LightStyle, fmt.Sprintf("%*v", pad, bottom-cursor.y))
-				}
+				drawText(s, xmin, y, xmax, y, LightStyle, fmt.Sprintf("%*v", pad, max(line-cursorLine, cursorLine-line)))
 			}
 		}
 	}
 }
 
+// The columns of the line numbers left of the buffer
+const lineNumberWidth = 3
+
+// The wrap modes of the wrap option, lines are not wrapped for other values
+var wrapModes = map[string]view.WrapMode{"off": view.WrapOff, "window": view.WrapWindow, "column": view.WrapColumn}
+
+// Sizes the view to the window and scrolls it to the cursor, before the line numbers and the buffer are drawn
+func (app *Application) windowBox(dims layout.Dimensions) {
+	cfg := app.config.EditorConfig
+	v := app.view()
+	v.SetSize(dims.Width-lineNumberWidth, dims.Height)
+	v.SetScrollOff(cfg.ScrollOff, cfg.SideScrollOff)
+	v.SetWrap(view.Wrap{Mode: wrapModes[cfg.Wrap], Column: cfg.WrapColumn, Words: cfg.WrapWords, BreakIndent: cfg.BreakIndent})
+	v.SetTabStop(cfg.TabStop)
+	v.Follow()
+}
+
 func (app *Application) bufferBox(dims layout.Dimensions) {
 	app.log.Printf("Drawing buffer box")
 	s := app.screen
 	xmin, ymin, xmax, ymax := dims.Origin.X, dims.Origin.Y, dims.Origin.X+dims.Width, dims.Origin.Y+dims.Height
 
 	if app.activeInputArea.typ == bufferArea {
-		drawRunes(s, xmin, ymin, xmax, ymax, DefaultStyle, app.currentBuffer.Rope.Runes())
+		rope := app.currentBuffer.Rope
+		v := app.view()
+		// only the visible lines are taken from the rope
+		rows := v.Rows()
+		visible := v.Visible()
+		var matches []BRope.Interval
+		if app.confirm != nil {
+			matches = []BRope.Interval{app.confirm.matches[app.confirm.current][0]}
+		} else if app.highlightSearch && app.searchPattern != nil {
+			matches = rope.FindAll(app.searchPattern, visible)
+		}
+		highlights := []highlight{}
+		if app.config.EditorConfig.CursorLine {
+			// the rows of the cursor line are filled to the end of the window
+			line := rope.LineOfOffset(v.Cursor())
+			for i, row := range rows {
+				if row.Line == line {
+					drawText(s, xmin, ymin+i, xmax, ymin+i, theme.Merge(DefaultStyle, CursorLineStyle), strings.Repeat(" ", xmax-xmin))
+				}
+			}
+			lineEnd := rope.OffsetOfLine(line) + len(rope.GetLine(line))
+			highlights = append(highlights, highlight{CursorLineStyle, []BRope.Interval{BRope.IV(rope.OffsetOfLine(line), lineEnd)}})
+		}
+		if app.config.EditorConfig.Syntax && app.currentBuffer.Syntax != nil {
+			highlights = append(highlights, syntaxHighlights(rope, app.currentBuffer.Syntax, rows)...)
+		}
+		highlights = append(highlights, highlight{SearchStyle, matches}, highlight{SelectionStyle, app.vi.OtherSelections()},
+			highlight{VisualStyle, app.vi.Selection()})
+		drawRows(s, xmin, ymin, xmax, ymax, DefaultStyle, rows, v.Left(), highlights...)
+		// the terminal only shows the primary cursor
+		for _, offset := range app.vi.OtherCursors() {
+			row, col := v.Cell(offset)
+			drawCursor(s, xmin+col, ymin+row, xmin, ymin, xmax, ymin+v.Height()-1)
+		}
 		box := Box{Origin{xmin, ymin}, Origin{xmax, ymax}}
 		inputArea := app.inputAreas[bufferArea]
 		inputArea.area.box = &box
+		row, col := v.Cell(v.Cursor())
+		cursor := inputArea.area.cursor
+		cursor.x, cursor.y = xmin+col, ymin+row
 	}
 }
 
-func (app *Application) clampAreaCursor() {
-	cursor := app.activeInputArea.area.cursor
-	box := app.activeInputArea.area.box
-	minx, miny := box.min.x, box.min.y
-	maxx, maxy := box.max.x, box.max.y
+// The status line of the window, its segments are the ones of the statusLine option
+func (app *Application) statusLineBox(dims layout.Dimensions) {
+	app.drawStatusLine(dims.Origin.X, dims.Origin.Y, dims.Origin.X+dims.Width, true)
+}
 
-	// move cursor to end of previous line
-	if app.activeInputArea.typ == bufferArea {
-		if cursor.x < minx && cursor.y > miny {
-			cursor.y--
-			cursor.x = minx + app.currentBuffer.Rope.LastCharInRow(cursor.y) + 1
-		}
+// Draws the status line of a window into the row y, inactive windows have the one of the
+// statusLineInactive option
+func (app *Application) drawStatusLine(xmin, y, xmax int, active bool) {
+	cfg := app.config.EditorConfig
+	spec, style := cfg.StatusLine, StatusLineStyle
+	if !active {
+		spec, style = cfg.StatusLineInactive, StatusLineNCStyle
 	}
+	parsed, ok := app.statusLines[spec]
+	if !ok {
+		parsed.line, parsed.err = status.Parse(spec)
+		app.statusLines[spec] = parsed
+	}
+	if parsed.err != nil {
+		drawText(app.screen, xmin, y, xmax, y, ErrorStyle, runewidth.FillRight(" "+parsed.err.Error(), xmax-xmin))
+		return
+	}
+	drawText(app.screen, xmin, y, xmax, y, style, parsed.line.Format(app.statusInfo(), xmax-xmin))
+}
 
-	// keep cursor in left and right bounds
-	cursor.x = max(cursor.x, minx)
-	cursor.x = min(cursor.x, maxx)
-
-	// keep cursor in top and bottom bounds
-	cursor.y = max(cursor.y, miny)
-	cursor.y = min(cursor.y, maxy)
-
-  // clamp cursor to last line of buffer, should be in range [0, app.currentBuffer.Rope.LineCount())
-  if app.activeInputArea.typ == bufferArea {
-    cursor.y = min(cursor.y, app.currentBuffer.Rope.LineCount()-1)
-  }
-
-	// app.log.Printf("Clamped cursor to (%v, %v)", cursor.x, cursor.y)
+// Reads the git branch of the file of a buffer for its status line
+func (app *Application) readBranch(buffer *Buffer.Buffer) {
+	app.branches[buffer] = status.Branch(filepath.Dir(buffer.File))
 }
 
+// The state of the current window the segments of the status line show
+func (app *Application) statusInfo() status.Info {
+	buffer := app.currentBuffer
+	rope := buffer.Rope
+	cursor := app.Cursor()
+	line := rope.LineOfOffset(cursor)
+	info := status.Info{
+		Mode:       app.vi.Mode().String(),
+		File:       buffer.File,
+		Modified:   buffer.Modified(),
+		Encoding:   "utf-8",
+		LineEnding: "lf",
+		Line:       line + 1,
+		Column:     cursor - rope.OffsetOfLine(line) + 1,
+		Lines:      rope.LineCount(),
+		Branch:     app.branches[buffer],
+		Pending:    app.vi.Pending(),
+	}
+	if app.activeInputArea.typ == commandArea {
+		info.Mode = "Command"
+	}
+	if register := app.vi.Recording(); register != 0 {
+		info.Mode = "Recording @" + string(register) + " " + info.Mode
+	}
+	if others := len(app.vi.OtherCursors()); others > 0 && app.activeInputArea.typ == bufferArea {
+		info.Mode = fmt.Sprintf("%v selections %v", others+1, info.Mode)
+	}
+	if buffer.Syntax != nil {
+		info.FileType = buffer.Syntax.Grammar().Name
+	}
+	// the line ending of the file is the one of its first line
+	if end := rope.OffsetOfLine(1) - 1; rope.LineCount() > 1 && end > 0 && rope.Slice(BRope.IV(end-1, end)).String() == "\r" {
+		info.LineEnding = "crlf"
+	}
+	if selection := app.vi.Selection(); app.vi.Mode().IsVisual() && len(selection) > 0 {
+		for _, iv := range selection {
+			info.SelectedRunes += iv.Hi - iv.Lo
+		}
+		last := max(selection[0].Lo, selection[len(selection)-1].Hi-1)
+		info.SelectedLines = rope.LineOfOffset(last) - rope.LineOfOffset(selection[0].Lo) + 1
+	}
+	return info
+}
 
-func (app *Application) statusLineBox(dims layout.Dimensions) {
+// The command line, and the messages of commands while it is closed
+func (app *Application) commandLineBox(dims layout.Dimensions) {
 	s := app.screen
 	xmin, ymin, xmax, ymax := dims.Origin.X, dims.Origin.Y, dims.Origin.X+dims.Width, dims.Origin.Y+dims.Height
-	// app.log.Printf("Drawing status line box at (%v, %v) to (%v, %v)", xmin, ymin, xmax, ymax)
 	drawBox(s, xmin, ymin, xmax-1, ymax-1, DefaultStyle)
-	drawText(s, xmax-7, ymin+1, xmax-1, ymax-1, DefaultStyle, "Normal")
 
 	prefix := "Cmd: "
 	offset := len(prefix) + 1
+	// Cursor needs to consider 'Cmd: ' prefx. The box is kept up to date while the buffer is active,
+	// so the command line can be opened with text already typed
+	box := Box{Origin{xmin + offset, ymin + 1}, Origin{xmax - 2, ymax - 1}}
+	inputArea := app.inputAreas[commandArea]
+	inputArea.area.box = &box
 	if app.activeInputArea.typ == commandArea {
-		// Cursor needs to consider 'Cmd: ' prefx
-		drawText(s, xmin+1, ymin+1, xmax-1, ymax-1, DefaultStyle, prefix+app.currentCommand)
-		box := Box{Origin{xmin + offset, ymin + 1}, Origin{xmax - 7, ymax - 1}}
-		inputArea := app.inputAreas[commandArea]
-		inputArea.area.box = &box
+		drawText(s, xmin+1, ymin+1, xmax-1, ymax-1, DefaultStyle, prefix+app.commandLine.String())
+		cursor := inputArea.area.cursor
+		cursor.x, cursor.y = box.min.x+runewidth.StringWidth(string(app.commandLine.Text[:app.commandLine.Cursor])), box.min.y
+		if app.completion != nil {
+			app.drawWildmenu(xmin, ymin-1, xmax)
+		}
+	} else if app.confirm != nil {
+		drawText(s, xmin+1, ymin+1, xmax-1, ymax-1, DefaultStyle, fmt.Sprintf("replace with %v (y/n/a/q/l)?", app.confirm.sub.Replacement))
+	} else if app.message != "" {
+		style := DefaultStyle
+		if app.messageIsError {
+			style = ErrorStyle
+		}
+		drawText(s, xmin+1, ymin+1, xmax-1, ymax-1, style, app.message)
+	}
+}
+
+// Draws the candidates of the completion into the row y, starting with the selected one if they do not fit
+func (app *Application) drawWildmenu(xmin, y, xmax int) {
+	s := app.screen
+	candidates := app.completion.Candidates
+	width := func(from, to int) int {
+		w := 2
+		for _, candidate := range candidates[from : to+1] {
+			w += len([]rune(candidate)) + 2
+		}
+		return w
+	}
+	first := 0
+	for first < app.completion.Selected && width(first, app.completion.Selected) > xmax-xmin {
+		first++
+	}
+
+	drawText(s, xmin, y, xmax, y, WildMenuStyle, strings.Repeat(" ", xmax-xmin))
+	x := xmin
+	if first > 0 {
+		drawText(s, x, y, xmax, y, WildMenuStyle, "< ")
+		x += 2
+	}
+	for i := first; i < len(candidates) && x < xmax; i++ {
+		style := WildMenuStyle
+		if i == app.completion.Selected {
+			style = WildMenuSelStyle
+		}
+		drawText(s, x, y, xmax, y, style, candidates[i])
+		x += len([]rune(candidates[i])) + 2
 	}
 }
 
@@ -388,12 +914,16 @@ func main() {
 	config := config.NewConfig(log)
 	config.Init()
 	defer config.Cleanup()
+	history := commands.LoadHistory(filepath.Join(config.Dir(), "history"))
 	commands := commands.NewCommands(log)
 	app := &Application{
 		config:     config,
 		buffers:     Buffer.NewBuffers(log),
 		commands:   commands,
+		history:    history,
 		inputAreas: make(map[InputAreaType]*InputArea, 10),
+		branches:    make(map[*Buffer.Buffer]string),
+		statusLines: make(map[string]parsedStatusLine),
 		window:     window,
 		screen:     s,
 		log:        log,
@@ -421,13 +951,35 @@ func main() {
 	app.inputAreas[commandArea] = commandInputArea
 	app.activeInputArea = bufferInputArea
 
-	commands.Register("help", app.helpCmd)
-	commands.Register("quit", app.quitCmd)
-	commands.Register("exit", app.quitCmd)
-	commands.Register("write", app.writeCmd)
-	commands.Register("read", app.readCmd)
-	commands.Register("hsplit", app.hsplitCmd)
-	commands.Register("files", app.filesCmd)
+	app.registerCommands()
+	app.vi = vi.NewEngine(app)
+	app.registerBindings()
+	app.vi.SetFileMarks(app)
+	// macros are played without drawing, through the area that is active for each key
+	app.vi.SetPlayer(func(keys []vi.Key) {
+		for _, key := range keys {
+			if !app.isAlive {
+				return
+			}
+			app.activeInputArea.sink(key.Event())
+		}
+	})
+	app.vi.Registers().Provide('%', func() string { return app.currentBuffer.File }, nil)
+	app.vi.Registers().Provide(':', func() string { return app.lastCommand }, nil)
+	if tty, ok := s.Tty(); ok {
+		app.osc52 = clipboard.NewOSC52(screenWriter{s, tty})
+	} else {
+		app.osc52 = clipboard.NewOSC52(nil)
+	}
+	app.provideClipboard('+', false)
+	app.provideClipboard('*', true)
+	if err := app.buffers.Grammars.LoadDir(filepath.Join(config.Dir(), "syntax")); err != nil {
+		log.Printf("%v", err)
+	}
+	app.sessionFile = filepath.Join(config.Dir(), "session.json")
+	if err := loadSession(app.sessionFile, app.vi.Registers(), app.buffers); err != nil {
+		log.Printf("Could not read the session: %v", err)
+	}
 
 	flag.Parse()
 	file := flag.Arg(0)
@@ -442,7 +994,7 @@ func main() {
 
     bw := &BufferWindow{
       inputArea: bufferInputArea,
-      buffer: app.currentBuffer,
+      view: view.New(app.currentBuffer),
     }
     app.currentArea = bw
 
@@ -457,13 +1009,15 @@ func main() {
 
     bw := &BufferWindow{
       inputArea: bufferInputArea,
-      buffer: app.currentBuffer,
+      view: view.New(app.currentBuffer),
     }
     app.currentArea = bw
     
-		log.Printf("Read rope from file %v:\n'%v'", file, app.currentBuffer.Rope)
+		log.Printf("Read rope with %v runes from file %v", app.currentBuffer.Rope.Length(), file)
 	}
 
+	app.readBranch(app.currentBuffer)
+
 	// You have to catch panics in a defer, clean up, and
 	// re-raise them - otherwise your application can
 	// die without leaving any diagnostic trace.
@@ -472,22 +1026,30 @@ func main() {
 	layouter := layout.NewLayouter(log)
 
 	layout := Column(
-		FlexItemBox(EmptyBox, Max(Rel(1)), Row(
-			FlexItemBox(app.lineNumberBox, Exact(Abs(3)), nil),
+		FlexItemBox(app.windowBox, Max(Rel(1)), Row(
+			FlexItemBox(app.lineNumberBox, Exact(Abs(lineNumberWidth)), nil),
 			FlexItemBox(app.bufferBox, Max(Rel(1)), nil),
 		)),
-		FlexItemBox(app.statusLineBox, Exact(Abs(3)), nil),
+		FlexItemBox(app.statusLineBox, Exact(Abs(1)), nil),
+		FlexItemBox(app.commandLineBox, Exact(Abs(3)), nil),
 	)
 
 	// Event loop
 	for app.isAlive {
+		app.loadColorScheme()
 		window.update(s.Size())
 		s.Clear()
 		layouter.StartLayouting(layout, window.width, window.height)
-		app.clampAreaCursor()
 
 		cx, cy := app.activeInputArea.area.cursor.x, app.activeInputArea.area.cursor.y
 		s.ShowCursor(cx, cy)
+		if mode := app.vi.Mode(); app.activeInputArea.typ == commandArea || mode == vi.Insert {
+			s.SetCursorStyle(tcell.CursorStyleSteadyBar)
+		} else if mode == vi.Replace || mode == vi.OperatorPending {
+			s.SetCursorStyle(tcell.CursorStyleSteadyUnderline)
+		} else {
+			s.SetCursorStyle(tcell.CursorStyleSteadyBlock)
+		}
 
 		// Update screen
 		s.Show()
@@ -496,33 +1058,289 @@ func main() {
 		ev := s.PollEvent()
 
 		// Process event
+		// pasted keys are text and not commands, the paste is recorded as a whole when it ends
+		if ev, ok := ev.(*tcell.EventKey); ok && !app.pasting {
+			app.vi.Record(vi.KeyOf(ev))
+		}
 		app.activeInputArea.sink(ev)
 	}
 }
 
-func (app *Application) helpCmd() {
-	app.log.Println("Sadly there is no help yet.")
+func (app *Application) registerCommands() {
+	file := commands.Param{Name: "file", Kind: commands.Path}
+	optionalFile := commands.Param{Name: "file", Kind: commands.Path, Optional: true}
+	count := commands.Param{Name: "count", Kind: commands.Count, Optional: true}
+	noArgs := func(f func()) func(commands.Args) error {
+		return func(commands.Args) error {
+			f()
+			return nil
+		}
+	}
+
+	app.commands.Register(commands.Command{Name: "help", Aliases: []string{"h"}, Run: app.helpCmd})
+	app.commands.Register(commands.Command{Name: "quit", Aliases: []string{"q", "exit"}, Bang: true, Run: app.quitCmd})
+	app.commands.Register(commands.Command{Name: "write", Aliases: []string{"w"}, Params: []commands.Param{optionalFile}, Run: app.writeCmd})
+	app.commands.Register(commands.Command{Name: "read", Aliases: []string{"r"}, Params: []commands.Param{file}, Range: true, ZeroLine: true, Run: app.readCmd})
+	app.commands.Register(commands.Command{Name: "edit", Aliases: []string{"e"}, Params: []commands.Param{file}, Run: app.editCmd})
+	app.commands.Register(commands.Command{Name: "buffer", Aliases: []string{"b"}, Params: []commands.Param{{Name: "buffer", Kind: commands.Buffer}}, Run: app.bufferCmd})
+	app.commands.Register(commands.Command{Name: "set", Aliases: []string{"se"}, Params: []commands.Param{{Name: "option", Kind: commands.Option}}, Run: app.setCmd})
+	app.commands.Register(commands.Command{Name: "colorscheme", Aliases: []string{"colo"}, Params: []commands.Param{{Name: "theme", Kind: commands.Theme}}, Run: app.colorschemeCmd})
+	app.commands.Register(commands.Command{Name: "hsplit", Run: app.hsplitCmd})
+	app.commands.Register(commands.Command{Name: "files", Run: app.filesCmd})
+	app.commands.Register(commands.Command{Name: "undo", Aliases: []string{"u"}, Run: noArgs(app.undo)})
+	app.commands.Register(commands.Command{Name: "redo", Aliases: []string{"red"}, Run: noArgs(app.redo)})
+	app.commands.Register(commands.Command{Name: "earlier", Params: []commands.Param{count}, Run: app.earlierCmd})
+	app.commands.Register(commands.Command{Name: "later", Params: []commands.Param{count}, Run: app.laterCmd})
+	app.commands.Register(commands.Command{Name: "nohlsearch", Aliases: []string{"noh"}, Run: noArgs(app.nohlsearch)})
+	app.commands.Register(commands.Command{
+		Name:    "substitute",
+		Aliases: []string{"s"},
+		Params:  []commands.Param{{Name: "pattern", Kind: commands.Raw}},
+		Range:   true,
+		Run:     app.substituteCmd,
+	})
+
+	app.commands.SetCompleter(commands.Buffer, func(string) []string { return app.buffers.Names() })
+	app.commands.SetCompleter(commands.Theme, func(string) []string { return theme.Names(app.themeDir()) })
+	app.commands.SetCompleter(commands.Option, func(prefix string) []string {
+		options := config.OptionNames()
+		if strings.HasPrefix(prefix, "no") {
+			for _, option := range config.OptionNames() {
+				options = append(options, "no"+option)
+			}
+		}
+		return options
+	})
+}
+
+// Binds the keys of the buffer area that are not part of vi's editing
+func (app *Application) registerBindings() {
+	repeat := func(f func()) func(int) {
+		return func(count int) {
+			for i := 0; i < max(1, count); i++ {
+				f()
+			}
+		}
+	}
+	for _, mode := range []vi.Mode{vi.Normal, vi.Visual} {
+		app.vi.Bind(mode, "/", func(int) { app.openCommandLine("/") })
+		app.vi.Bind(mode, "?", func(int) { app.openCommandLine("?") })
+		app.vi.Bind(mode, "n", repeat(func() { app.searchNext(false) }))
+		app.vi.Bind(mode, "N", repeat(func() { app.searchNext(true) }))
+		app.vi.Bind(mode, "<C-l>", func(int) { app.screen.Sync() })
+		app.bindScrolling(mode)
+	}
+	app.vi.Bind(vi.Normal, ":", func(int) { app.openCommandLine("") })
+	// the command line of a selection starts with the range of its lines
+	app.vi.Bind(vi.Visual, ":", func(int) {
+		selection := app.vi.Selection()
+		rope := app.currentBuffer.Rope
+		first := rope.LineOfOffset(selection[0].Lo)
+		last := rope.LineOfOffset(max(selection[0].Lo, selection[len(selection)-1].Hi-1))
+		app.vi.ExitVisual()
+		app.openCommandLine(fmt.Sprintf("%v,%v", first+1, last+1))
+	})
+	app.vi.Bind(vi.Normal, "g-", func(count int) {
+		if offset, ok := app.currentBuffer.Earlier(max(1, count)); ok {
+			app.SetCursor(offset)
+		}
+	})
+	app.vi.Bind(vi.Normal, "g+", func(count int) {
+		if offset, ok := app.currentBuffer.Later(max(1, count)); ok {
+			app.SetCursor(offset)
+		}
+	})
+	app.vi.Bind(vi.Normal, "<C-c>", func(int) { app.isAlive = false })
+	app.vi.Bind(vi.Normal, "ZZ", func(int) { app.isAlive = false })
+	app.vi.Bind(vi.Normal, "ZQ", func(int) {
+		app.discard = true
+		app.isAlive = false
+	})
 }
 
-func (app *Application) quitCmd() {
+// Binds the keys that scroll the view, the cursor moves along when it would leave it
+func (app *Application) bindScrolling(mode vi.Mode) {
+	// a count scrolls count lines, or count pages for Ctrl-F and Ctrl-B
+	lines := func(count, lines int) int {
+		if count > 0 {
+			return count
+		}
+		return max(1, lines)
+	}
+	page := func() int { return max(1, app.view().Height()-2) }
+	app.vi.Bind(mode, "<C-e>", func(count int) { app.view().Scroll(lines(count, 1), false) })
+	app.vi.Bind(mode, "<C-y>", func(count int) { app.view().Scroll(-lines(count, 1), false) })
+	app.vi.Bind(mode, "<C-d>", func(count int) { app.view().ScrollWithCursor(lines(count, app.view().Height()/2), false) })
+	app.vi.Bind(mode, "<C-u>", func(count int) { app.view().ScrollWithCursor(-lines(count, app.view().Height()/2), false) })
+	app.vi.Bind(mode, "<C-f>", func(count int) { app.view().Scroll(max(1, count)*page(), false) })
+	app.vi.Bind(mode, "<C-b>", func(count int) { app.view().Scroll(-max(1, count)*page(), false) })
+	app.vi.Bind(mode, "zt", func(int) { app.view().ScrollCursorTo(view.Top) })
+	app.vi.Bind(mode, "zz", func(int) { app.view().ScrollCursorTo(view.Center) })
+	app.vi.Bind(mode, "zb", func(int) { app.view().ScrollCursorTo(view.Bottom) })
+}
+
+func (app *Application) helpCmd(args commands.Args) error {
+	return errors.New("sadly there is no help yet")
+}
+
+// Quits the editor, the buffer is written unless the command was called with a bang
+func (app *Application) quitCmd(args commands.Args) error {
+	app.discard = args.Bang
 	app.isAlive = false
+	return nil
 }
 
-func (app *Application) writeCmd() {
-	err := app.buffers.Write(app.currentBuffer.File)
+// Writes the buffer to its file, or to the given file without changing the file of the buffer
+func (app *Application) writeCmd(args commands.Args) error {
+	path := app.currentBuffer.File
+	if args.Has("file") {
+		path = args.String("file")
+	}
+	if err := app.currentBuffer.Save(path); err != nil {
+		return fmt.Errorf("could not write %v: %v", path, err)
+	}
+	// the branch may have been switched since the buffer was opened
+	app.readBranch(app.currentBuffer)
+	app.showMessage("%q written, %v lines", path, app.currentBuffer.Rope.LineCount())
+	return nil
+}
+
+// Inserts the content of the file below the line of the range
+func (app *Application) readCmd(args commands.Args) error {
+	buffer := app.currentBuffer
+	path := args.String("file")
+	rope, err := Buffer.Read(path)
+	if err != nil {
+		return fmt.Errorf("could not read %v: %v", path, err)
+	}
+	cursor := app.Cursor()
+	_, line, err := args.Lines(buffer.Rope.LineOfOffset(cursor), buffer.Rope.LineCount()-1)
 	if err != nil {
-		app.log.Fatalf("Could not write buffer content to file: %v", err)
+		return err
 	}
+
+	// inserted after the line, at the start of the buffer for line 0, which is -1
+	offset := 0
+	if line >= 0 {
+		offset = buffer.Rope.OffsetOfLine(line + 1)
+	}
+	text := append([]rune{}, rope.Runes()...)
+	if line == buffer.Rope.LineCount()-1 {
+		// the last line has no newline to insert after
+		text = append([]rune{'\n'}, text...)
+	} else if len(text) > 0 && text[len(text)-1] != '\n' {
+		text = append(text, '\n')
+	}
+	buffer.Edit(BRope.IV(offset, offset), text, cursor)
+	app.SetCursor(buffer.Rope.OffsetOfLine(line + 1))
+	app.showMessage("%q read, %v lines", path, rope.LineCount())
+	return nil
 }
 
-func (app *Application) readCmd() {
-	app.log.Printf("read command not implemented yet.")
+// Opens the file in a new buffer, or switches to its buffer if it is already open
+func (app *Application) editCmd(args commands.Args) error {
+	path := args.String("file")
+	buffer, ok := app.buffers.Open[path]
+	if !ok {
+		var err error
+		if buffer, err = app.buffers.OpenFile(path); err != nil {
+			return fmt.Errorf("could not open %v: %v", path, err)
+		}
+	}
+	app.switchBuffer(buffer)
+	app.showMessage("%q %v lines", path, buffer.Rope.LineCount())
+	return nil
+}
+
+func (app *Application) bufferCmd(args commands.Args) error {
+	name := args.String("buffer")
+	buffer, ok := app.buffers.Open[name]
+	if !ok {
+		return fmt.Errorf("no buffer %v", name)
+	}
+	app.switchBuffer(buffer)
+	return nil
+}
+
+func (app *Application) switchBuffer(buffer *Buffer.Buffer) {
+	app.currentBuffer.History.EndGroup()
+	app.currentBuffer = buffer
+	app.view().SetBuffer(buffer)
+	app.readBranch(buffer)
+}
+
+func (app *Application) setCmd(args commands.Args) error {
+	return app.config.EditorConfig.Set(args.String("option"))
+}
+
+// Switches to a theme, the theme is read again even if it is the current one, so edits of its file show
+func (app *Application) colorschemeCmd(args commands.Args) error {
+	name := args.String("theme")
+	t, err := theme.Load(name, app.themeDir())
+	if err != nil {
+		return err
+	}
+	app.config.EditorConfig.ColorScheme = name
+	app.useColorScheme(name, t)
+	return nil
+}
+
+// User themes are read from the themes directory next to the config file
+func (app *Application) themeDir() string {
+	return filepath.Join(app.config.Dir(), "themes")
+}
+
+// Loads the theme of the colorscheme option if it is not the one the screen is drawn with. The screen
+// shows the closest colors it has to the ones of the theme.
+func (app *Application) loadColorScheme() {
+	name := app.config.EditorConfig.ColorScheme
+	if name == "" {
+		name = "default"
+	}
+	if name == app.colorScheme {
+		return
+	}
+	t, err := theme.Load(name, app.themeDir())
+	if err != nil {
+		app.showError(err)
+		if styles != nil {
+			app.colorScheme = name
+			return
+		}
+		t = theme.Default()
+	}
+	app.useColorScheme(name, t)
+}
+
+// Draws the screen with a theme, name is the value of the colorscheme option it was loaded for
+func (app *Application) useColorScheme(name string, t *theme.Theme) {
+	app.colorScheme = name
+	useTheme(t.Styles(app.screen.Colors()))
+	app.screen.SetStyle(DefaultStyle)
 }
 
-func (app *Application) hsplitCmd() {
-	app.log.Printf("hsplit command not implemented yet.")
+func (app *Application) hsplitCmd(args commands.Args) error {
+	return errors.New("hsplit is not implemented yet")
 }
 
-func (app *Application) filesCmd() {
-	app.log.Printf("files command not implemented yet.")
+func (app *Application) filesCmd(args commands.Args) error {
+	return errors.New("files is not implemented yet")
 }
+
+func (app *Application) earlierCmd(args commands.Args) error {
+	if offset, ok := app.currentBuffer.Earlier(args.Count("count", 1)); ok {
+		app.SetCursor(offset)
+	}
+	return nil
+}
+
+func (app *Application) laterCmd(args commands.Args) error {
+	if offset, ok := app.currentBuffer.Later(args.Count("count", 1)); ok {
+		app.SetCursor(offset)
+	}
+	return nil
+}
+
+func (app *Application) nohlsearch() {
+	app.highlightSearch = false
+}
\ No newline at end of file
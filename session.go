@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	BRope "main/brope"
+	Buffer "main/buffer"
+	"main/vi"
+	"os"
+)
+
+// registers with more runes are not kept in the session file
+const maxSessionRegister = 100000
+
+// A Session is the state of the editor that is kept between runs
+type Session struct {
+	Registers map[string]SessionRegister `json:"registers"`
+	// the upper case marks
+	FileMarks map[string]Buffer.FileMark `json:"fileMarks"`
+}
+
+type SessionRegister struct {
+	Text string        `json:"text"`
+	Kind vi.RegionKind `json:"kind"`
+}
+
+// Reads the session file into the registers and file marks, a missing file is an empty session
+func loadSession(path string, registers *vi.Registers, buffers *Buffer.Buffers) error {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var session Session
+	if err := json.Unmarshal(content, &session); err != nil {
+		return err
+	}
+	for name, reg := range session.Registers {
+		if runes := []rune(name); len(runes) == 1 {
+			registers.Set(runes[0], vi.Register{Text: BRope.NewRopeString(reg.Text), Kind: reg.Kind})
+		}
+	}
+	marks := map[rune]Buffer.FileMark{}
+	for name, mark := range session.FileMarks {
+		if runes := []rune(name); len(runes) == 1 {
+			marks[runes[0]] = mark
+		}
+	}
+	buffers.SetFileMarks(marks)
+	return nil
+}
+
+func saveSession(path string, registers *vi.Registers, buffers *Buffer.Buffers) error {
+	session := Session{Registers: map[string]SessionRegister{}, FileMarks: map[string]Buffer.FileMark{}}
+	for name, reg := range registers.Stored() {
+		if reg.Text.Length() <= maxSessionRegister {
+			session.Registers[string(name)] = SessionRegister{Text: reg.String(), Kind: reg.Kind}
+		}
+	}
+	for name, mark := range buffers.FileMarks() {
+		session.FileMarks[string(name)] = mark
+	}
+	content, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0664)
+}
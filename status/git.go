@@ -0,0 +1,59 @@
+package status
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Branch returns the git branch of the repository dir is in, or the start of the commit if no branch
+// is checked out. Returns the empty string outside of a repository.
+func Branch(dir string) string {
+	gitDir, ok := findGitDir(dir)
+	if !ok {
+		return ""
+	}
+	head, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return ""
+	}
+	ref := strings.TrimSpace(string(head))
+	if branch, ok := strings.CutPrefix(ref, "ref: refs/heads/"); ok {
+		return branch
+	}
+	return ref[:min(len(ref), 7)]
+}
+
+// Finds the .git directory of dir or of the directories above it. In worktrees and submodules .git is
+// a file that names the directory.
+func findGitDir(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	for {
+		path := filepath.Join(dir, ".git")
+		if info, err := os.Stat(path); err == nil {
+			if info.IsDir() {
+				return path, true
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", false
+			}
+			gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+			if !ok {
+				return "", false
+			}
+			if !filepath.IsAbs(gitDir) {
+				gitDir = filepath.Join(dir, gitDir)
+			}
+			return gitDir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,129 @@
+package status
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// Info is the state of a window that the segments of its status line show
+type Info struct {
+	// the mode of vi, with the register a macro is recorded into and the number of selections
+	Mode     string
+	File     string
+	Modified bool
+	// the name of the grammar of the buffer, empty if it has none
+	FileType   string
+	Encoding   string
+	LineEnding string
+	// the line and column of the cursor, counted from 1, and the lines of the buffer
+	Line, Column, Lines int
+	// the lines and runes of the selection of visual mode, 0 outside of it
+	SelectedLines, SelectedRunes int
+	// the diagnostics of the buffer by level
+	Errors, Warnings, Infos, Hints int
+	// the git branch of the file, empty outside of a repository
+	Branch string
+	// the keys of the command that is being typed
+	Pending string
+}
+
+// A Segment is a part of the status line, segments that are empty are left out
+type Segment func(info Info) string
+
+// Segments are the segments status lines are built of, by the names they have in the config
+var Segments = map[string]Segment{
+	"mode": func(info Info) string { return info.Mode },
+	"file": func(info Info) string {
+		if info.File == "" {
+			return "[No Name]"
+		}
+		return info.File
+	},
+	"modified": func(info Info) string {
+		if info.Modified {
+			return "[+]"
+		}
+		return ""
+	},
+	"filetype":   func(info Info) string { return strings.ToLower(info.FileType) },
+	"encoding":   func(info Info) string { return info.Encoding },
+	"lineending": func(info Info) string { return info.LineEnding },
+	"position":   func(info Info) string { return fmt.Sprintf("%v:%v", info.Line, info.Column) },
+	// the share of the lines of the buffer up to the cursor
+	"percent": func(info Info) string { return fmt.Sprintf("%v%%", info.Line*100/max(1, info.Lines)) },
+	"selection": func(info Info) string {
+		switch {
+		case info.SelectedLines > 1:
+			return fmt.Sprintf("%v lines", info.SelectedLines)
+		case info.SelectedRunes > 0:
+			return fmt.Sprintf("%v chars", info.SelectedRunes)
+		}
+		return ""
+	},
+	"diagnostics": func(info Info) string {
+		counts := []string{}
+		for _, level := range []struct {
+			sign  string
+			count int
+		}{{"E", info.Errors}, {"W", info.Warnings}, {"I", info.Infos}, {"H", info.Hints}} {
+			if level.count > 0 {
+				counts = append(counts, fmt.Sprintf("%v%v", level.sign, level.count))
+			}
+		}
+		return strings.Join(counts, " ")
+	},
+	"branch":  func(info Info) string { return info.Branch },
+	"pending": func(info Info) string { return info.Pending },
+}
+
+// A Line is the order of the segments of a status line, the left ones start at its left end and
+// the right ones end at its right end
+type Line struct {
+	Left, Right []string
+}
+
+// Parse reads a status line from the names of its segments separated by spaces, a "|" separates the
+// left segments from the right ones. For example "mode file modified | position".
+func Parse(spec string) (Line, error) {
+	line := Line{}
+	side := &line.Left
+	for _, name := range strings.Fields(spec) {
+		if name == "|" {
+			if side == &line.Right {
+				return Line{}, fmt.Errorf("status line %q has more than one |", spec)
+			}
+			side = &line.Right
+			continue
+		}
+		if _, ok := Segments[name]; !ok {
+			return Line{}, fmt.Errorf("unknown status line segment %v", name)
+		}
+		*side = append(*side, name)
+	}
+	return line, nil
+}
+
+// Format returns the status line for a window, width columns wide. When the segments do not fit the
+// left ones are cut off, since the right ones are shorter and change more often.
+func (l Line) Format(info Info, width int) string {
+	join := func(names []string) string {
+		parts := []string{}
+		for _, name := range names {
+			if text := Segments[name](info); text != "" {
+				parts = append(parts, text)
+			}
+		}
+		return strings.Join(parts, "  ")
+	}
+	// the segments are kept off the ends of the line
+	left, right := " "+join(l.Left), join(l.Right)+" "
+	rightWidth := runewidth.StringWidth(right)
+	if rightWidth > width {
+		// the end of the line has the position of the cursor
+		return runewidth.TruncateLeft(right, rightWidth-width, "")
+	}
+	left = runewidth.Truncate(left, width-rightWidth-2, "<")
+	return runewidth.FillRight(left, width-rightWidth) + right
+}
@@ -0,0 +1,85 @@
+package status
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	line, err := Parse("mode  file modified | position percent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Line{Left: []string{"mode", "file", "modified"}, Right: []string{"position", "percent"}}
+	if !reflect.DeepEqual(line, expected) {
+		t.Fatalf("expected %v, got %v", expected, line)
+	}
+	if line, err := Parse("| position"); err != nil || len(line.Left) != 0 || len(line.Right) != 1 {
+		t.Fatalf("expected only a right segment, got %v %v", line, err)
+	}
+	for spec, expected := range map[string]string{
+		"mode nope":       "unknown status line segment nope",
+		"mode | file | x": "more than one |",
+	} {
+		if _, err := Parse(spec); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected an error with %q for %q, got %v", expected, spec, err)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	line, _ := Parse("mode file modified selection pending | diagnostics branch filetype lineending position percent")
+	info := Info{Mode: "Normal", File: "main.go", FileType: "Go", LineEnding: "lf", Line: 5, Column: 3, Lines: 20, Branch: "main"}
+	for _, c := range []struct {
+		change   func(info *Info)
+		width    int
+		expected string
+	}{
+		{func(*Info) {}, 60, " Normal  main.go                     main  go  lf  5:3  25% "},
+		{func(info *Info) {
+			info.Modified, info.Pending, info.Errors, info.Hints = true, "2d", 2, 1
+		}, 60, " Normal  main.go  [+]  2d     E2 H1  main  go  lf  5:3  25% "},
+		{func(info *Info) {
+			info.Mode, info.SelectedLines, info.SelectedRunes = "Visual", 1, 4
+		}, 60, " Visual  main.go  4 chars            main  go  lf  5:3  25% "},
+		{func(info *Info) { info.SelectedLines = 3 }, 60, " Normal  main.go  3 lines            main  go  lf  5:3  25% "},
+		// the left segments are cut off first
+		{func(info *Info) { info.File = "" }, 40, " Normal  [No N<  main  go  lf  5:3  25% "},
+		{func(*Info) {}, 10, " 5:3  25% "},
+	} {
+		info := info
+		c.change(&info)
+		if got := line.Format(info, c.width); got != c.expected {
+			t.Fatalf("expected %q, got %q", c.expected, got)
+		}
+	}
+}
+
+func TestBranch(t *testing.T) {
+	dir := t.TempDir()
+	if branch := Branch(dir); branch != "" {
+		t.Fatalf("expected no branch outside of a repository, got %v", branch)
+	}
+	os.MkdirAll(filepath.Join(dir, ".git"), 0755)
+	os.MkdirAll(filepath.Join(dir, "a", "b"), 0755)
+	os.WriteFile(filepath.Join(dir, ".git", "HEAD"), []byte("ref: refs/heads/feature/x\n"), 0644)
+	if branch := Branch(filepath.Join(dir, "a", "b")); branch != "feature/x" {
+		t.Fatalf("expected the branch of the repository above, got %q", branch)
+	}
+	os.WriteFile(filepath.Join(dir, ".git", "HEAD"), []byte("0123456789abcdef0123456789abcdef01234567\n"), 0644)
+	if branch := Branch(dir); branch != "0123456" {
+		t.Fatalf("expected the commit of a detached head, got %q", branch)
+	}
+
+	// a worktree names its git directory in a .git file
+	worktree := filepath.Join(dir, "a", "b")
+	os.MkdirAll(filepath.Join(dir, "worktree"), 0755)
+	os.WriteFile(filepath.Join(dir, "worktree", "HEAD"), []byte("ref: refs/heads/other\n"), 0644)
+	os.WriteFile(filepath.Join(worktree, ".git"), []byte("gitdir: ../../worktree\n"), 0644)
+	if branch := Branch(worktree); branch != "other" {
+		t.Fatalf("expected the branch of the worktree, got %q", branch)
+	}
+}
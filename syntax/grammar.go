@@ -0,0 +1,259 @@
+package syntax
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Grammar describes the tokens of a language with regular expressions, in the format of TextMate
+// grammars that Sublime Text and VS Code use too. Rules either match a token within a line, or begin
+// a region like a string or a comment that goes on until its end matches, possibly lines later.
+// The expressions are the ones of the regexp package, so look arounds and the like are not supported.
+type Grammar struct {
+	Name      string
+	ScopeName string
+	// the extensions of the files in the language, or their names, like "go" or "Makefile"
+	FileTypes []string
+	// matches the first line of a file in the language that has none of the file types, like a shebang
+	FirstLine *regexp.Regexp
+
+	root *rule
+}
+
+type rule struct {
+	// the scope of the text the rule matches, like "string.quoted.double"
+	name string
+	// the scope of the text between begin and end
+	contentName string
+
+	match, begin *regexp.Regexp
+	// the end of a region is compiled when it begins if it refers to the groups of begin
+	end       *regexp.Regexp
+	endSource string
+	// the expression can only match at the start of a line
+	anchored bool
+
+	captures, beginCaptures, endCaptures []capture
+
+	patterns []*rule
+	// the rule is replaced by the repository entry or the grammar it names
+	include string
+	target  *rule
+	// the rules that are tried inside of the rule, see rules
+	expanded []*rule
+}
+
+// The scope of a group of a match
+type capture struct {
+	group int
+	name  string
+}
+
+// The JSON of a grammar, plist grammars have to be converted
+type grammarFile struct {
+	Name           string              `json:"name"`
+	ScopeName      string              `json:"scopeName"`
+	FileTypes      []string            `json:"fileTypes"`
+	FirstLineMatch string              `json:"firstLineMatch"`
+	Patterns       []ruleFile          `json:"patterns"`
+	Repository     map[string]ruleFile `json:"repository"`
+}
+
+type ruleFile struct {
+	Name          string                 `json:"name"`
+	ContentName   string                 `json:"contentName"`
+	Match         string                 `json:"match"`
+	Begin         string                 `json:"begin"`
+	End           string                 `json:"end"`
+	Captures      map[string]captureFile `json:"captures"`
+	BeginCaptures map[string]captureFile `json:"beginCaptures"`
+	EndCaptures   map[string]captureFile `json:"endCaptures"`
+	Patterns      []ruleFile             `json:"patterns"`
+	Include       string                 `json:"include"`
+}
+
+type captureFile struct {
+	Name string `json:"name"`
+}
+
+// Groups of begin that end refers to, like \1
+var backReference = regexp.MustCompile(`\\[1-9]`)
+
+// LoadGrammar reads a grammar from JSON
+func LoadGrammar(data []byte) (*Grammar, error) {
+	var file grammarFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	g := &Grammar{Name: file.Name, ScopeName: file.ScopeName, FileTypes: file.FileTypes}
+	if g.Name == "" {
+		return nil, fmt.Errorf("grammar %v has no name", file.ScopeName)
+	}
+	if file.FirstLineMatch != "" {
+		re, err := regexp.Compile(file.FirstLineMatch)
+		if err != nil {
+			return nil, fmt.Errorf("%v: firstLineMatch: %v", g.Name, err)
+		}
+		g.FirstLine = re
+	}
+
+	repository := map[string]*rule{}
+	for name, r := range file.Repository {
+		compiled, err := compileRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("%v: repository %v: %v", g.Name, name, err)
+		}
+		repository[name] = compiled
+	}
+	// the text outside of all rules has no scope
+	g.root = &rule{}
+	for i, r := range file.Patterns {
+		compiled, err := compileRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("%v: pattern %v: %v", g.Name, i, err)
+		}
+		g.root.patterns = append(g.root.patterns, compiled)
+	}
+
+	// includes are resolved once all rules are known, since they can refer to each other
+	var resolve func(r *rule) error
+	resolve = func(r *rule) error {
+		switch {
+		case r.include == "":
+		case r.include == "$self" || r.include == "$base":
+			r.target = g.root
+		case strings.HasPrefix(r.include, "#"):
+			target, ok := repository[r.include[1:]]
+			if !ok {
+				return fmt.Errorf("%v: unknown include %v", g.Name, r.include)
+			}
+			r.target = target
+		}
+		// other grammars are not included, their text is left without scopes
+		for _, p := range r.patterns {
+			if err := resolve(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := resolve(g.root); err != nil {
+		return nil, err
+	}
+	for _, r := range repository {
+		if err := resolve(r); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// The rules that are tried inside of r, with the includes and the rules that only group others replaced
+// by the rules they stand for
+func (r *rule) rules() []*rule {
+	if r.expanded != nil {
+		return r.expanded
+	}
+	r.expanded = []*rule{}
+	seen := map[*rule]bool{}
+	var add func(patterns []*rule)
+	add = func(patterns []*rule) {
+		for _, p := range patterns {
+			// an include can name a repository entry that is an include too
+			for hops := 0; p.target != nil && hops < 8; hops++ {
+				p = p.target
+			}
+			if p.match != nil || p.begin != nil {
+				r.expanded = append(r.expanded, p)
+			} else if p.include == "" && !seen[p] {
+				seen[p] = true
+				add(p.patterns)
+			}
+		}
+	}
+	add(r.patterns)
+	return r.expanded
+}
+
+func compileRule(file ruleFile) (*rule, error) {
+	r := &rule{name: file.Name, contentName: file.ContentName, include: file.Include}
+	var err error
+	compile := func(source, what string) *regexp.Regexp {
+		if source == "" || err != nil {
+			return nil
+		}
+		re, compileErr := regexp.Compile(source)
+		if compileErr != nil {
+			err = fmt.Errorf("%v: %v", what, compileErr)
+		}
+		return re
+	}
+	r.match = compile(file.Match, "match")
+	r.begin = compile(file.Begin, "begin")
+	if r.begin != nil {
+		if file.End == "" {
+			return nil, fmt.Errorf("begin %q without end", file.Begin)
+		}
+		r.endSource = file.End
+		if !backReference.MatchString(file.End) {
+			r.end = compile(file.End, "end")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.anchored = strings.HasPrefix(file.Match, "^") || strings.HasPrefix(file.Begin, "^")
+
+	if r.captures, err = compileCaptures(file.Captures); err != nil {
+		return nil, err
+	}
+	if r.beginCaptures, err = compileCaptures(file.BeginCaptures); err != nil {
+		return nil, err
+	}
+	if r.endCaptures, err = compileCaptures(file.EndCaptures); err != nil {
+		return nil, err
+	}
+	for i, p := range file.Patterns {
+		compiled, err := compileRule(p)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %v: %v", i, err)
+		}
+		r.patterns = append(r.patterns, compiled)
+	}
+	return r, nil
+}
+
+// Captures are sorted by their group, so inner groups are painted over outer ones
+func compileCaptures(file map[string]captureFile) ([]capture, error) {
+	captures := []capture{}
+	for group, c := range file {
+		n, err := strconv.Atoi(group)
+		if err != nil {
+			return nil, fmt.Errorf("capture %q is not a group", group)
+		}
+		captures = append(captures, capture{n, c.Name})
+	}
+	sort.Slice(captures, func(i, j int) bool { return captures[i].group < captures[j].group })
+	return captures, nil
+}
+
+// The end of a region that begins with the groups of match in line, back references to them are
+// replaced by their text
+func (r *rule) endFor(line string, match []int) (*regexp.Regexp, string, error) {
+	if r.end != nil {
+		return r.end, r.endSource, nil
+	}
+	source := backReference.ReplaceAllStringFunc(r.endSource, func(ref string) string {
+		group := int(ref[1] - '0')
+		if 2*group+1 >= len(match) || match[2*group] < 0 {
+			return ""
+		}
+		return regexp.QuoteMeta(line[match[2*group]:match[2*group+1]])
+	})
+	end, err := regexp.Compile(source)
+	return end, source, err
+}
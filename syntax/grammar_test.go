@@ -0,0 +1,127 @@
+package syntax
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const testGrammar = `{
+  "name": "Test",
+  "scopeName": "source.test",
+  "patterns": [
+    {"include": "#comments"},
+    {"match": "\\b(if|else)\\b", "name": "keyword"},
+    {"match": "(\\w+)\\(", "captures": {"1": {"name": "function"}}},
+    {"begin": "\"", "end": "\"", "name": "string", "patterns": [{"match": "\\\\.", "name": "escape"}]},
+    {"begin": "<<(\\w+)", "end": "^\\1$", "name": "heredoc"},
+    {"match": "^#.*", "name": "directive"}
+  ],
+  "repository": {
+    "comments": {"patterns": [
+      {"begin": "/\\*", "end": "\\*/", "name": "comment", "contentName": "comment.body"}
+    ]}
+  }
+}`
+
+func loadTestGrammar(t *testing.T) *Grammar {
+	t.Helper()
+	g, err := LoadGrammar([]byte(testGrammar))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+// Shows the tokens of line like "if(if) x" as "[if:keyword] [x:function]"
+func showTokens(line string, tokens []Token) string {
+	runes := []rune(line)
+	shown := []string{}
+	for _, token := range tokens {
+		shown = append(shown, fmt.Sprintf("[%v:%v]", string(runes[token.Lo:token.Hi]), token.Scope))
+	}
+	return strings.Join(shown, " ")
+}
+
+func expectTokens(g *Grammar, lines []string, expected []string, t *testing.T) {
+	t.Helper()
+	state := g.Start()
+	for i, line := range lines {
+		var tokens []Token
+		tokens, state = g.Tokenize(line, state)
+		if got := showTokens(line, tokens); got != expected[i] {
+			t.Fatalf("line %q: expected %v, got %v", line, expected[i], got)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	g := loadTestGrammar(t)
+	expectTokens(g, []string{
+		`if x else`,
+		`f(a) "s\"t" if`,
+		`a /* b`,
+		`c */ if`,
+		`#x if`,
+		`ä "ö`,
+		`ü" if`,
+	}, []string{
+		`[if:keyword] [else:keyword]`,
+		`[f:function] ["s:string] [\":escape] [t":string] [if:keyword]`,
+		`[/*:comment] [ b:comment.body]`,
+		`[c :comment.body] [*/:comment] [if:keyword]`,
+		`[#x if:directive]`,
+		`["ö:string]`,
+		`[ü":string] [if:keyword]`,
+	}, t)
+}
+
+func TestTokenizeBackReferences(t *testing.T) {
+	g := loadTestGrammar(t)
+	expectTokens(g, []string{
+		`x <<END`,
+		`if`,
+		`END if`,
+		`END`,
+		`if`,
+	}, []string{
+		`[<<END:heredoc]`,
+		`[if:heredoc]`,
+		`[END if:heredoc]`,
+		`[END:heredoc]`,
+		`[if:keyword]`,
+	}, t)
+}
+
+func TestLoadGrammarErrors(t *testing.T) {
+	for _, c := range []struct{ grammar, err string }{
+		{`{"name": "T", "patterns": [{"match": "("}]}`, "missing closing )"},
+		{`{"name": "T", "patterns": [{"begin": "a"}]}`, "without end"},
+		{`{"name": "T", "patterns": [{"include": "#nope"}]}`, "unknown include #nope"},
+		{`{"name": "T", "patterns": [{"match": "a", "captures": {"x": {}}}]}`, "not a group"},
+		{`{"scopeName": "source.t"}`, "has no name"},
+	} {
+		if _, err := LoadGrammar([]byte(c.grammar)); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Fatalf("expected %q to fail with %q, got %v", c.grammar, c.err, err)
+		}
+	}
+}
+
+func TestRecursiveIncludes(t *testing.T) {
+	g, err := LoadGrammar([]byte(`{
+	  "name": "T",
+	  "patterns": [{"include": "#expr"}],
+	  "repository": {
+	    "expr": {"patterns": [
+	      {"begin": "\\(", "end": "\\)", "name": "group", "patterns": [{"include": "#expr"}]},
+	      {"match": "\\d+", "name": "number"},
+	      {"include": "#more"}
+	    ]},
+	    "more": {"patterns": [{"include": "#expr"}, {"match": "x", "name": "x"}]}
+	  }
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectTokens(g, []string{"1 (2 (x)) 3"}, []string{"[1:number] [(:group] [2:number] [ (:group] [x:x] [)):group] [3:number]"}, t)
+}
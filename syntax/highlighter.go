@@ -0,0 +1,91 @@
+package syntax
+
+import (
+	BRope "main/brope"
+)
+
+// A Highlighter keeps the tokens of the lines of a buffer. Lines are tokenized when they are asked for,
+// from the first line whose tokens are not known on. After an edit only the edited lines are tokenized
+// again, and the lines after them until they start in the same state as before, so an edit at the top
+// of a long file does not tokenize all of it again unless it opens a comment or the like.
+type Highlighter struct {
+	grammar *Grammar
+	lines   []lineTokens
+	// the lines before it are tokenized and start in the state the line before them ends in
+	frontier int
+}
+
+type lineTokens struct {
+	// the state the line starts in, nil for lines that were inserted and not tokenized yet
+	start, end *State
+	tokens     []Token
+	// the tokens are the ones of the line in state start
+	done bool
+}
+
+func NewHighlighter(grammar *Grammar, r BRope.Rope) *Highlighter {
+	h := &Highlighter{grammar: grammar}
+	h.reset(r)
+	return h
+}
+
+func (h *Highlighter) Grammar() *Grammar {
+	return h.grammar
+}
+
+func (h *Highlighter) reset(r BRope.Rope) {
+	h.lines = make([]lineTokens, r.LineCount())
+	h.lines[0].start = h.grammar.Start()
+	h.frontier = 0
+}
+
+// Edit moves the tokens of the lines through an edit that replaced iv of before with inserted runes,
+// which made after. The lines of the edit are tokenized again when they are asked for.
+func (h *Highlighter) Edit(before, after BRope.Rope, iv BRope.Interval, inserted int) {
+	if len(h.lines) != before.LineCount() {
+		h.reset(after)
+		return
+	}
+	first := before.LineOfOffset(iv.Lo)
+	removed := before.LineOfOffset(iv.Hi) - first
+	added := after.LineOfOffset(iv.Lo+inserted) - first
+	if added != removed {
+		lines := make([]lineTokens, 0, len(h.lines)-removed+added)
+		lines = append(lines, h.lines[:first+1]...)
+		lines = append(lines, make([]lineTokens, added)...)
+		lines = append(lines, h.lines[first+1+removed:]...)
+		h.lines = lines
+	} else {
+		for i := first + 1; i <= first+added; i++ {
+			h.lines[i] = lineTokens{}
+		}
+	}
+	// the edited line still starts in the same state, since the lines before it did not change
+	h.lines[first].done = false
+	h.frontier = min(h.frontier, first)
+}
+
+// Tokens returns the tokens of line of r, which is the rope after the edits the highlighter was told of
+func (h *Highlighter) Tokens(r BRope.Rope, line int) []Token {
+	if len(h.lines) != r.LineCount() {
+		h.reset(r)
+	}
+	if line < 0 || line >= len(h.lines) {
+		return nil
+	}
+	for ; h.frontier <= line; h.frontier++ {
+		l := &h.lines[h.frontier]
+		if !l.done {
+			l.tokens, l.end = h.grammar.Tokenize(string(r.GetLine(h.frontier)), l.start)
+			l.done = true
+		}
+		if h.frontier+1 < len(h.lines) {
+			next := &h.lines[h.frontier+1]
+			// the lines after the edit are tokenized again until they start in the state they did before
+			if !l.end.equal(next.start) {
+				next.start, next.done = l.end, false
+			}
+		}
+	}
+	return h.lines[line].tokens
+}
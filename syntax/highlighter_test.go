@@ -0,0 +1,94 @@
+package syntax
+
+import (
+	BRope "main/brope"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A rope that is edited and its highlighter
+type editedRope struct {
+	h    *Highlighter
+	rope BRope.Rope
+}
+
+func (e *editedRope) edit(iv BRope.Interval, text string) {
+	after := e.rope.Edit(iv, BRope.NewRopeString(text))
+	e.h.Edit(e.rope, after, iv, len([]rune(text)))
+	e.rope = after
+}
+
+// Returns the lines up to line that are tokenized when they are asked for
+func (e *editedRope) tokenized(line int) []int {
+	lines := []int{}
+	for i := e.h.frontier; i <= line && i < len(e.h.lines); i++ {
+		if !e.h.lines[i].done {
+			lines = append(lines, i)
+		}
+		e.h.Tokens(e.rope, i)
+	}
+	return lines
+}
+
+func expectTokenized(e *editedRope, line int, expected []int, t *testing.T) {
+	t.Helper()
+	if got := e.tokenized(line); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected lines %v to be tokenized, got %v", expected, got)
+	}
+}
+
+func expectLineTokens(e *editedRope, line int, expected string, t *testing.T) {
+	t.Helper()
+	text := string(e.rope.GetLine(line))
+	if got := showTokens(text, e.h.Tokens(e.rope, line)); got != expected {
+		t.Fatalf("line %v %q: expected %v, got %v", line, text, expected, got)
+	}
+}
+
+func TestHighlighterEdits(t *testing.T) {
+	lines := make([]string, 1000)
+	for i := range lines {
+		lines[i] = "if x"
+	}
+	rope := BRope.NewRopeString(strings.Join(lines, "\n"))
+	e := &editedRope{NewHighlighter(loadTestGrammar(t), rope), rope}
+	e.tokenized(999)
+	expectLineTokens(e, 999, "[if:keyword]", t)
+
+	// an edit inside of a line only tokenizes that line
+	e.edit(BRope.IV(10, 10), "else ")
+	expectTokenized(e, 999, []int{2}, t)
+	expectLineTokens(e, 2, "[else:keyword] [if:keyword]", t)
+
+	// opening a comment tokenizes the lines up to its end, closing it the lines after it again
+	start := e.rope.OffsetOfLine(10)
+	e.edit(BRope.IV(start, start), "/*")
+	e.edit(BRope.IV(e.rope.OffsetOfLine(20), e.rope.OffsetOfLine(20)), "*/")
+	expectLineTokens(e, 15, "[if x:comment.body]", t)
+	expectLineTokens(e, 21, "[if:keyword]", t)
+	e.edit(BRope.IV(start, start+2), "")
+	expectTokenized(e, 999, []int{10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}, t)
+	expectLineTokens(e, 15, "[if:keyword]", t)
+
+	// lines are inserted and removed with the tokens of the lines after them
+	e.edit(BRope.IV(start, start), "x\n/*\n")
+	expectTokenized(e, 12, []int{10, 11, 12}, t)
+	expectLineTokens(e, 12, "[if x:comment.body]", t)
+	e.edit(BRope.IV(start, e.rope.OffsetOfLine(12)), "")
+	// the line after the comment was asked for in the comment before
+	expectTokenized(e, 999, []int{10, 11}, t)
+	expectLineTokens(e, 999, "[if:keyword]", t)
+	if len(e.h.lines) != 1000 {
+		t.Fatalf("expected 1000 lines, got %v", len(e.h.lines))
+	}
+}
+
+func TestHighlighterOnlyTokenizesAskedLines(t *testing.T) {
+	rope := BRope.NewRopeString(strings.Repeat("if\n", 100))
+	e := &editedRope{NewHighlighter(loadTestGrammar(t), rope), rope}
+	e.h.Tokens(rope, 10)
+	if e.h.frontier != 11 || e.h.lines[11].done {
+		t.Fatalf("expected the lines up to 10 to be tokenized, got up to %v", e.h.frontier)
+	}
+}
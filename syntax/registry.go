@@ -0,0 +1,93 @@
+package syntax
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//go:embed grammars/*.json
+var builtin embed.FS
+
+// A Registry holds the grammars the editor knows, the built in ones and the ones of the user
+type Registry struct {
+	grammars []*Grammar
+}
+
+// NewRegistry returns a registry of the built in grammars
+func NewRegistry() *Registry {
+	reg := &Registry{}
+	entries, err := builtin.ReadDir("grammars")
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		data, err := builtin.ReadFile("grammars/" + entry.Name())
+		if err != nil {
+			panic(err)
+		}
+		g, err := LoadGrammar(data)
+		if err != nil {
+			panic(fmt.Sprintf("built in grammar %v: %v", entry.Name(), err))
+		}
+		reg.Add(g)
+	}
+	return reg
+}
+
+// Add adds a grammar, which replaces a grammar of the same name
+func (reg *Registry) Add(g *Grammar) {
+	for i, other := range reg.grammars {
+		if other.Name == g.Name {
+			reg.grammars[i] = g
+			return
+		}
+	}
+	reg.grammars = append(reg.grammars, g)
+}
+
+// LoadDir adds the grammars of the JSON files in dir. A missing dir has no grammars.
+// Grammars that cannot be loaded are skipped and returned as one error.
+func (reg *Registry) LoadDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	failed := []string{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			var g *Grammar
+			if g, err = LoadGrammar(data); err == nil {
+				reg.Add(g)
+				continue
+			}
+		}
+		failed = append(failed, fmt.Sprintf("%v: %v", filepath.Base(path), err))
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not load grammars: %v", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// ForFile returns the grammar of a file by its extension or name, or by its first line, nil if there is none
+func (reg *Registry) ForFile(path string, firstLine string) *Grammar {
+	name := filepath.Base(path)
+	ext := strings.TrimPrefix(filepath.Ext(name), ".")
+	for _, g := range reg.grammars {
+		for _, fileType := range g.FileTypes {
+			if fileType == name || fileType == ext {
+				return g
+			}
+		}
+	}
+	for _, g := range reg.grammars {
+		if g.FirstLine != nil && g.FirstLine.MatchString(firstLine) {
+			return g
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package syntax
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestForFile(t *testing.T) {
+	reg := NewRegistry()
+	for _, c := range []struct{ path, firstLine, grammar string }{
+		{"main.go", "", "Go"},
+		{"/a/b/config.json", "", "JSON"},
+		{"README.md", "", "Markdown"},
+		{"build.sh", "", "Shell"},
+		{"/home/x/.bashrc", "", "Shell"},
+		{"build", "#!/usr/bin/env bash", "Shell"},
+		{"build", "#!/bin/sh -e", "Shell"},
+	} {
+		if g := reg.ForFile(c.path, c.firstLine); g == nil || g.Name != c.grammar {
+			t.Fatalf("expected %v for %v, got %v", c.grammar, c.path, g)
+		}
+	}
+	if g := reg.ForFile("notes.txt", "hello"); g != nil {
+		t.Fatalf("expected no grammar for a text file, got %v", g.Name)
+	}
+}
+
+func TestBuiltinGrammars(t *testing.T) {
+	reg := NewRegistry()
+	for _, c := range []struct {
+		file     string
+		lines    []string
+		expected []string
+	}{
+		{"a.go", []string{
+			`func (b *B) Len() int { return len(b.x) } // n`,
+			`s := "a\n" + ` + "`raw",
+			"text` /* c",
+			`*/ x := 0x1F`,
+		}, []string{
+			`[func:storage.type.function.go] [Len:entity.name.function.go] [int:storage.type.builtin.go] [return:keyword.control.go] [len:support.function.builtin.go] [// n:comment.line.double-slash.go]`,
+			`["a:string.quoted.double.go] [\n:constant.character.escape.go] [":string.quoted.double.go] [` + "`raw:string.quoted.raw.go]",
+			"[text`:string.quoted.raw.go] [/* c:comment.block.go]",
+			`[*/:comment.block.go] [0x1F:constant.numeric.go]`,
+		}},
+		{"a.json", []string{`{"a": "b\t", "c": [1.5, true]}`}, []string{
+			`["a":support.type.property-name.json] ["b:string.quoted.double.json] [\t:constant.character.escape.json] [":string.quoted.double.json] ["c":support.type.property-name.json] [1.5:constant.numeric.json] [true:constant.language.json]`,
+		}},
+		{"a.md", []string{"# Title", "some `code` and **bold**", "```go", "x := 1", "```"}, []string{
+			`[#:punctuation.definition.heading.markdown] [ Title:markup.heading.markdown]`,
+			"[`code`:markup.inline.raw.markdown] [**bold**:markup.bold.markdown]",
+			"[```:markup.fenced_code.block.markdown] [go:fenced_code.block.language.markdown]",
+			`[x := 1:markup.raw.block.markdown]`,
+			"[```:markup.fenced_code.block.markdown]",
+		}},
+		{"a.sh", []string{`if [ -n "$x" ]; then # c`, `  cat <<EOF`, `$y`, `EOF`}, []string{
+			`[if:keyword.control.shell] [":string.quoted.double.shell] [$x:variable.other.shell] [":string.quoted.double.shell] [then:keyword.control.shell] [# c:comment.line.number-sign.shell]`,
+			`[<<EOF:string.unquoted.heredoc.shell]`,
+			`[$y:string.unquoted.heredoc.shell]`,
+			`[EOF:string.unquoted.heredoc.shell]`,
+		}},
+	} {
+		expectTokens(reg.ForFile(c.file, ""), c.lines, c.expected, t)
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "test.json"), []byte(strings.Replace(testGrammar, `"name": "Test"`, `"name": "Test", "fileTypes": ["tst"]`, 1)), 0644)
+	os.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{"name": "Broken", "patterns": [{"match": "("}]}`), 0644)
+	reg := NewRegistry()
+	if err := reg.LoadDir(dir); err == nil || !strings.Contains(err.Error(), "broken.json") {
+		t.Fatalf("expected the broken grammar to fail, got %v", err)
+	}
+	if g := reg.ForFile("a.tst", ""); g == nil || g.Name != "Test" {
+		t.Fatalf("expected the grammar of the dir, got %v", g)
+	}
+	if err := reg.LoadDir(filepath.Join(dir, "missing")); err != nil {
+		t.Fatalf("expected a missing dir to have no grammars, got %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package syntax
+
+import (
+	"regexp"
+)
+
+// A Token is a run of runes of a line with the same scope
+type Token struct {
+	// the rune offsets of the token in its line
+	Lo, Hi int
+	// the innermost scope of the runes, like "keyword.control.go"
+	Scope string
+}
+
+// A State is the stack of regions a line ends in, like a comment that goes on in the next line.
+// States are not changed once they are made, so lines can share them.
+type State struct {
+	parent *State
+	// the rule that began the region, the root rule of the grammar at the bottom of the stack
+	rule *rule
+	end  *regexp.Regexp
+	// the source of end, back references of the rule are replaced by the text they matched
+	endSource string
+	depth     int
+}
+
+// The number of nested regions, begins inside of deeper ones are not tried so a grammar cannot nest
+// regions without end
+const maxDepth = 64
+
+// Lines are only tokenized up to this many bytes, the rest of longer lines gets the scope the line ends in
+const maxLineLength = 4000
+
+// Start returns the state at the start of a file
+func (g *Grammar) Start() *State {
+	return &State{rule: g.root}
+}
+
+func (s *State) equal(other *State) bool {
+	for s != other {
+		if s == nil || other == nil || s.rule != other.rule || s.endSource != other.endSource {
+			return false
+		}
+		s, other = s.parent, other.parent
+	}
+	return true
+}
+
+// The scope of the text inside of the region
+func (s *State) scope() string {
+	for ; s != nil; s = s.parent {
+		if s.rule.contentName != "" {
+			return s.rule.contentName
+		}
+		if s.rule.name != "" {
+			return s.rule.name
+		}
+	}
+	return ""
+}
+
+// Tokenize returns the tokens of line, which starts in state, and the state it ends in. Like in TextMate,
+// the rule that matches first in the line wins, and the end of the region at the same position as a rule.
+func (g *Grammar) Tokenize(line string, state *State) ([]Token, *State) {
+	text := line
+	if len(text) > maxLineLength {
+		text = text[:maxLineLength]
+	}
+	scopes := make([]string, len(line))
+	paint := func(lo, hi int, scope string) {
+		for i := lo; i < hi && scope != ""; i++ {
+			scopes[i] = scope
+		}
+	}
+	paintCaptures := func(match []int, captures []capture) {
+		for _, c := range captures {
+			if 2*c.group+1 < len(match) && match[2*c.group] >= 0 {
+				paint(match[2*c.group], match[2*c.group+1], c.name)
+			}
+		}
+	}
+
+	// the matches of the rules in the line, a rule that matched after pos matches there again
+	found := map[*regexp.Regexp][]int{}
+	find := func(re *regexp.Regexp, pos int) []int {
+		if match, ok := found[re]; ok && (match == nil || match[0] >= pos) {
+			return match
+		}
+		match := re.FindStringSubmatchIndex(text[pos:])
+		for i := range match {
+			if match[i] >= 0 {
+				match[i] += pos
+			}
+		}
+		found[re] = match
+		return match
+	}
+
+	pos := 0
+	// a region cannot end empty where it began, or it would begin again
+	begunAt := -1
+	for steps := 0; steps < 2*len(text)+maxDepth; steps++ {
+		var best []int
+		var bestRule *rule
+		if state.end != nil {
+			if match := find(state.end, pos); match != nil && !(match[0] == match[1] && pos == begunAt) {
+				best = match
+			}
+		}
+		for _, r := range state.rule.rules() {
+			if best != nil && best[0] == pos {
+				break
+			}
+			if r.anchored && pos > 0 || r.begin != nil && state.depth >= maxDepth {
+				continue
+			}
+			re := r.match
+			if re == nil {
+				re = r.begin
+			}
+			match := find(re, pos)
+			if match == nil || r.match != nil && match[0] == match[1] {
+				continue
+			}
+			if best == nil || match[0] < best[0] {
+				best, bestRule = match, r
+			}
+		}
+		if best == nil {
+			break
+		}
+
+		lo, hi := best[0], best[1]
+		paint(pos, lo, state.scope())
+		switch {
+		case bestRule == nil:
+			// the end of the region
+			paint(lo, hi, state.parent.scope())
+			paint(lo, hi, state.rule.name)
+			captures := state.rule.endCaptures
+			if len(captures) == 0 {
+				captures = state.rule.captures
+			}
+			paintCaptures(best, captures)
+			state, begunAt = state.parent, -1
+		case bestRule.match != nil:
+			paint(lo, hi, state.scope())
+			paint(lo, hi, bestRule.name)
+			paintCaptures(best, bestRule.captures)
+		default:
+			end, source, err := bestRule.endFor(text, best)
+			if err != nil {
+				// a region that could never end is not begun
+				paint(lo, hi, state.scope())
+				break
+			}
+			paint(lo, hi, state.scope())
+			paint(lo, hi, bestRule.name)
+			captures := bestRule.beginCaptures
+			if len(captures) == 0 {
+				captures = bestRule.captures
+			}
+			paintCaptures(best, captures)
+			state = &State{parent: state, rule: bestRule, end: end, endSource: source, depth: state.depth + 1}
+			begunAt = hi
+		}
+		pos = hi
+	}
+	paint(pos, len(line), state.scope())
+	return runeTokens(line, scopes), state
+}
+
+// Joins the runes of line with the same scope into tokens
+func runeTokens(line string, scopes []string) []Token {
+	tokens := []Token{}
+	offset := 0
+	for i := range line {
+		scope := scopes[i]
+		if n := len(tokens); n > 0 && tokens[n-1].Hi == offset && tokens[n-1].Scope == scope {
+			tokens[n-1].Hi++
+		} else if scope != "" {
+			tokens = append(tokens, Token{offset, offset + 1, scope})
+		}
+		offset++
+	}
+	return tokens
+}
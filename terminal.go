@@ -1,52 +1,173 @@
 package main
 
-import "github.com/gdamore/tcell/v2"
+import (
+	"io"
+	BRope "main/brope"
+	"main/syntax"
+	"main/theme"
+	"main/view"
 
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+	"github.com/rivo/uniseg"
+)
+
+// The styles of the parts of the screen, they are the ones of the highlight groups of the theme
 var DefaultStyle = tcell.StyleDefault.Background(tcell.ColorReset).Foreground(tcell.ColorReset)
 var LightStyle = tcell.StyleDefault.Background(tcell.ColorReset).Foreground(tcell.ColorLightGray)
+var ErrorStyle = tcell.StyleDefault.Background(tcell.ColorReset).Foreground(tcell.ColorRed)
+var CursorStyle = tcell.StyleDefault.Background(tcell.ColorLightGray).Foreground(tcell.ColorBlack)
+var CursorLineNrStyle = DefaultStyle
+var StatusLineStyle = DefaultStyle
+var StatusLineNCStyle = DefaultStyle
+var WildMenuStyle = LightStyle.Reverse(true)
+var WildMenuSelStyle = DefaultStyle
+
+// The styles that are drawn over the text, the colors they have none of are the ones of the text
+var SearchStyle = tcell.StyleDefault.Background(tcell.ColorYellow).Foreground(tcell.ColorBlack)
+var VisualStyle = tcell.StyleDefault.Reverse(true)
+var SelectionStyle = tcell.StyleDefault.Background(tcell.ColorGray).Foreground(tcell.ColorBlack)
+var SpecialStyle = tcell.StyleDefault.Foreground(tcell.ColorBlue)
+var CursorLineStyle = tcell.StyleDefault
+
+// The styles of the theme, syntax scopes are looked up in them
+var styles *theme.Styles
+
+// Gives the parts of the screen the styles of a theme
+func useTheme(s *theme.Styles) {
+	styles = s
+	DefaultStyle = s.Get("Normal")
+	LightStyle = s.Get("LineNr")
+	ErrorStyle = s.Get("Error")
+	CursorStyle = s.Get("Cursor")
+	CursorLineNrStyle = s.Get("CursorLineNr")
+	StatusLineStyle = s.Get("StatusLine")
+	StatusLineNCStyle = s.Get("StatusLineNC")
+	WildMenuStyle = s.Get("WildMenu")
+	WildMenuSelStyle = s.Get("WildMenuSel")
+	SearchStyle, _ = s.Layer("Search")
+	VisualStyle, _ = s.Layer("Visual")
+	SelectionStyle, _ = s.Layer("Selection")
+	SpecialStyle, _ = s.Layer("Special")
+	CursorLineStyle, _ = s.Layer("CursorLine")
+}
 
+// Draws text from x1, y1 on and continues in the next row at x2 and after newlines. Grapheme clusters
+// are drawn into one cell, or two for wide ones.
 func drawText(s tcell.Screen, x1, y1, x2, y2 int, style tcell.Style, text string) {
 	row := y1
 	col := x1
-	for _, r := range []rune(text) {
-		if (r == '\n') {
+	state := -1
+	for len(text) > 0 && row <= y2 {
+		var cluster string
+		cluster, text, _, state = uniseg.FirstGraphemeClusterInString(text, state)
+		runes := []rune(cluster)
+		if runes[0] == '\n' {
 			row++
 			col = x1
 			continue
 		}
 
-		s.SetContent(col, row, r, nil, style)
-		col++
-		if col >= x2 {
+		width := max(1, runewidth.RuneWidth(runes[0]))
+		if col+width > x2 {
 			row++
 			col = x1
+			if row > y2 {
+				break
+			}
 		}
-		if row > y2 {
-			break
-		}
+		s.SetContent(col, row, runes[0], runes[1:], style)
+		col += width
 	}
 }
 
-func drawRunes(s tcell.Screen, x1, y1, x2, y2 int, style tcell.Style, runes []rune) {
-	row := y1
-	col := x1
-	for _, r := range runes {
-		if (r == '\n') {
-			row++
-			col = x1
+// Runes inside of the ascending intervals are drawn over with the style
+type highlight struct {
+	style     tcell.Style
+	intervals []BRope.Interval
+}
+
+// Highlights for the tokens of the lines of rows, one per style. A scope without a group in the theme
+// has the one of its parent scope, like "keyword.control.go" the one of "keyword".
+func syntaxHighlights(r BRope.Rope, h *syntax.Highlighter, rows []view.Row) []highlight {
+	highlights := []highlight{}
+	index := map[tcell.Style]int{}
+	for i, row := range rows {
+		if i > 0 && rows[i-1].Line == row.Line {
 			continue
 		}
-
-		s.SetContent(col, row, r, nil, style)
-		col++
-		if col >= x2 {
-			row++
-			col = x1
+		start := r.OffsetOfLine(row.Line)
+		for _, token := range h.Tokens(r, row.Line) {
+			style, ok := styles.Layer(token.Scope)
+			if !ok {
+				continue
+			}
+			if _, ok := index[style]; !ok {
+				index[style] = len(highlights)
+				highlights = append(highlights, highlight{style: style})
+			}
+			target := &highlights[index[style]]
+			target.intervals = append(target.intervals, BRope.IV(start+token.Lo, start+token.Hi))
 		}
-		if row > y2 {
+	}
+	return highlights
+}
+
+// Draws the rows of a view from the column left on, one per row of the screen, the cells past x2 are cut off.
+// The intervals of the highlights are rope offsets, a cell is highlighted if its first rune is.
+// Later highlights are drawn over earlier ones, and keep the colors they have none of.
+func drawRows(s tcell.Screen, x1, y1, x2, y2 int, style tcell.Style, rows []view.Row, left int, highlights ...highlight) {
+	for i, row := range rows {
+		y := y1 + i
+		if y > y2 {
 			break
 		}
+		col := x1 + row.Indent - left
+		for _, cell := range row.Cells {
+			if col < x1 || col+cell.Width > x2 {
+				col += cell.Width
+				continue
+			}
+
+			cellStyle := style
+			if cell.Control {
+				cellStyle = theme.Merge(cellStyle, SpecialStyle)
+			}
+			for h := range highlights {
+				intervals := highlights[h].intervals
+				for len(intervals) > 0 && intervals[0].Hi <= cell.Offset {
+					intervals = intervals[1:]
+				}
+				highlights[h].intervals = intervals
+				if len(intervals) > 0 && intervals[0].Lo <= cell.Offset {
+					cellStyle = theme.Merge(cellStyle, highlights[h].style)
+				}
+			}
+			switch {
+			case cell.Runes == nil:
+				// a tab
+				for c := col; c < col+cell.Width; c++ {
+					s.SetContent(c, y, ' ', nil, cellStyle)
+				}
+			case cell.Control:
+				for c, r := range cell.Runes {
+					s.SetContent(col+c, y, r, nil, cellStyle)
+				}
+			default:
+				s.SetContent(col, y, cell.Runes[0], cell.Runes[1:], cellStyle)
+			}
+			col += cell.Width
+		}
+	}
+}
+
+// Draws a cursor over the cell at x, y, for the cursors of selections the terminal does not show
+func drawCursor(s tcell.Screen, x, y, x1, y1, x2, y2 int) {
+	if x < x1 || y < y1 || x >= x2 || y > y2 {
+		return
 	}
+	r, combining, _, _ := s.GetContent(x, y)
+	s.SetContent(x, y, r, combining, CursorStyle)
 }
 
 func drawBox(s tcell.Screen, x1, y1, x2, y2 int, style tcell.Style) {
@@ -81,4 +202,18 @@ func drawBox(s tcell.Screen, x1, y1, x2, y2 int, style tcell.Style) {
 		s.SetContent(x1, y2, tcell.RuneLLCorner, nil, style)
 		s.SetContent(x2, y2, tcell.RuneLRCorner, nil, style)
 	}
-}
\ No newline at end of file
+}
+
+// Writes escape sequences of the application to the terminal of a screen, like the one of OSC 52.
+// tcell 2.7 has no way to send them itself, so the screen is drawn first: Show writes tcell's buffered
+// output to the terminal before it returns, and since the screen is only drawn from the event loop,
+// which also runs the commands that write, nothing of tcell is pending or written in between.
+type screenWriter struct {
+	screen tcell.Screen
+	tty    io.Writer
+}
+
+func (w screenWriter) Write(p []byte) (int, error) {
+	w.screen.Show()
+	return w.tty.Write(p)
+}
@@ -0,0 +1,97 @@
+package theme
+
+import (
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// Styles are the groups of a theme resolved for a screen. Colors the screen cannot show are replaced
+// by the closest ones it can, so a theme of hex colors works on terminals of 256 or 16 colors too.
+type Styles struct {
+	normal tcell.Style
+	// the styles of the groups with only the colors the theme gives them
+	layers map[string]tcell.Style
+}
+
+// The groups a link is followed through, a longer chain is taken as a loop
+const maxLinks = 8
+
+// Styles resolves the groups of the theme for a screen that shows colors colors, like the one of
+// tcell.Screen.Colors. A screen of true colors shows 1<<24.
+func (t *Theme) Styles(colors int) *Styles {
+	fit := func(color string) tcell.Color {
+		c, _ := parseColor(color)
+		return fitColor(c, colors)
+	}
+	s := &Styles{layers: map[string]tcell.Style{}}
+	for name, g := range t.groups {
+		for i := 0; g.Link != "" && i < maxLinks; i++ {
+			g = t.groups[g.Link]
+		}
+		s.layers[name] = tcell.StyleDefault.Foreground(fit(g.Fg)).Background(fit(g.Bg)).
+			Bold(g.Bold).Italic(g.Italic).Underline(g.Underline).Reverse(g.Reverse).Dim(g.Dim)
+	}
+	// the text has the colors of the terminal unless the theme gives it others
+	fg, bg, attrs := s.layers["Normal"].Decompose()
+	if fg == tcell.ColorDefault {
+		fg = tcell.ColorReset
+	}
+	if bg == tcell.ColorDefault {
+		bg = tcell.ColorReset
+	}
+	s.normal = tcell.StyleDefault.Foreground(fg).Background(bg).Attributes(attrs)
+	return s
+}
+
+// The closest color to c that a screen of colors colors shows
+func fitColor(c tcell.Color, colors int) tcell.Color {
+	if !c.Valid() || colors >= 1<<24 {
+		return c
+	}
+	n := min(colors, 256)
+	if n < 8 {
+		// colors are left to the terminal
+		return tcell.ColorDefault
+	}
+	if !c.IsRGB() && int(c-tcell.ColorValid) < n {
+		return c
+	}
+	palette := make([]tcell.Color, n)
+	for i := range palette {
+		palette[i] = tcell.PaletteColor(i)
+	}
+	return tcell.FindColor(c, palette)
+}
+
+// Get returns the style of a group, the colors it has none of are the ones of Normal
+func (s *Styles) Get(name string) tcell.Style {
+	layer, _ := s.Layer(name)
+	return Merge(s.normal, layer)
+}
+
+// Layer returns the style of a group or a syntax scope to draw over another style, the colors it has
+// none of are left to the style below. A scope without a group has the one of its parent scope, like
+// "keyword.control.go" the one of "keyword". Returns false if there is none.
+func (s *Styles) Layer(name string) (tcell.Style, bool) {
+	for ; name != ""; name = name[:max(0, strings.LastIndexByte(name, '.'))] {
+		if layer, ok := s.layers[name]; ok {
+			return layer, true
+		}
+	}
+	return tcell.StyleDefault, false
+}
+
+// Merge draws over on below, the colors over has none of are the ones of below and the attributes
+// are the ones of both
+func Merge(below, over tcell.Style) tcell.Style {
+	fg, bg, attrs := below.Decompose()
+	overFg, overBg, overAttrs := over.Decompose()
+	if overFg != tcell.ColorDefault {
+		fg = overFg
+	}
+	if overBg != tcell.ColorDefault {
+		bg = overBg
+	}
+	return tcell.StyleDefault.Foreground(fg).Background(bg).Attributes(attrs | overAttrs)
+}
@@ -0,0 +1,143 @@
+package theme
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+//go:embed themes/*.json
+var builtin embed.FS
+
+// A Theme gives the highlight groups of the editor their colors. Groups are the parts of the screen,
+// like "Normal" for the text, "LineNr" for the line numbers or "Search" for matches, and the scopes
+// of syntax highlighting, like "comment" or "keyword.control".
+type Theme struct {
+	Name   string
+	groups map[string]group
+}
+
+// The attributes of a group as they are written in the theme file. Colors are names like "red",
+// palette numbers like "208", hex colors like "#ff8700", or "reset" for the color of the terminal.
+type group struct {
+	Fg        string `json:"fg"`
+	Bg        string `json:"bg"`
+	Bold      bool   `json:"bold"`
+	Italic    bool   `json:"italic"`
+	Underline bool   `json:"underline"`
+	Reverse   bool   `json:"reverse"`
+	Dim       bool   `json:"dim"`
+	// the group looks like the linked one
+	Link string `json:"link"`
+}
+
+type themeFile struct {
+	Groups map[string]group `json:"groups"`
+}
+
+// LoadTheme reads a theme from JSON
+func LoadTheme(name string, data []byte) (*Theme, error) {
+	var file themeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("theme %v: %v", name, err)
+	}
+	for groupName, g := range file.Groups {
+		for _, color := range []string{g.Fg, g.Bg} {
+			if _, err := parseColor(color); err != nil {
+				return nil, fmt.Errorf("theme %v: %v: %v", name, groupName, err)
+			}
+		}
+		if _, ok := file.Groups[g.Link]; g.Link != "" && !ok {
+			return nil, fmt.Errorf("theme %v: %v links to unknown group %v", name, groupName, g.Link)
+		}
+	}
+	return &Theme{Name: name, groups: file.Groups}, nil
+}
+
+// Load loads the theme with name from the JSON files in dir, or from the built in themes
+func Load(name, dir string) (*Theme, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("no theme %v", name)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, name+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		data, err = builtin.ReadFile("themes/" + name + ".json")
+		if err != nil {
+			return nil, fmt.Errorf("no theme %v", name)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return LoadTheme(name, data)
+}
+
+// Default returns the built in theme the editor starts with
+func Default() *Theme {
+	data, err := builtin.ReadFile("themes/default.json")
+	if err != nil {
+		panic(err)
+	}
+	t, err := LoadTheme("default", data)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Names returns the names of the built in themes and the ones in dir
+func Names(dir string) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	add := func(file string) {
+		if name := strings.TrimSuffix(file, ".json"); !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	entries, _ := builtin.ReadDir("themes")
+	for _, entry := range entries {
+		add(entry.Name())
+	}
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	for _, path := range paths {
+		add(filepath.Base(path))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Parses a color of a theme file, the empty string is no color
+func parseColor(color string) (tcell.Color, error) {
+	color = strings.ToLower(color)
+	switch color {
+	case "":
+		return tcell.ColorDefault, nil
+	case "reset", "none":
+		return tcell.ColorReset, nil
+	}
+	if n, err := strconv.Atoi(color); err == nil {
+		if n < 0 || n > 255 {
+			return tcell.ColorDefault, fmt.Errorf("palette color %v is not between 0 and 255", n)
+		}
+		return tcell.PaletteColor(n), nil
+	}
+	if strings.HasPrefix(color, "#") {
+		if v, err := strconv.ParseInt(color[1:], 16, 32); err == nil && len(color) == 7 {
+			return tcell.NewHexColor(int32(v)), nil
+		}
+		return tcell.ColorDefault, fmt.Errorf("%v is not a hex color like #ff8700", color)
+	}
+	if c, ok := tcell.ColorNames[color]; ok {
+		return c, nil
+	}
+	return tcell.ColorDefault, fmt.Errorf("unknown color %v", color)
+}
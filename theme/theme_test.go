@@ -0,0 +1,163 @@
+package theme
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+const testTheme = `{
+  "groups": {
+    "Normal": {"fg": "#d0d0d0", "bg": "#1c1c1c"},
+    "LineNr": {"fg": "244"},
+    "Search": {"fg": "black", "bg": "yellow", "bold": true},
+    "Visual": {"reverse": true},
+    "Selection": {"link": "Visual"},
+    "comment": {"fg": "#808080", "italic": true},
+    "keyword": {"fg": "#ff8700"}
+  }
+}`
+
+func loadTestTheme(t *testing.T) *Theme {
+	t.Helper()
+	theme, err := LoadTheme("test", []byte(testTheme))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return theme
+}
+
+func expectStyle(got, expected tcell.Style, t *testing.T) {
+	t.Helper()
+	if got != expected {
+		fg, bg, attrs := got.Decompose()
+		t.Fatalf("expected %v, got fg %v bg %v attrs %v", expected, fg, bg, attrs)
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	for _, c := range []struct {
+		color    string
+		expected tcell.Color
+	}{
+		{"", tcell.ColorDefault},
+		{"reset", tcell.ColorReset},
+		{"Red", tcell.ColorRed},
+		{"208", tcell.PaletteColor(208)},
+		{"#ff8700", tcell.NewRGBColor(0xff, 0x87, 0x00)},
+	} {
+		if got, err := parseColor(c.color); err != nil || got != c.expected {
+			t.Fatalf("expected %q to be %v, got %v %v", c.color, c.expected, got, err)
+		}
+	}
+	for _, color := range []string{"256", "#ff87", "#gg8700", "reddish"} {
+		if _, err := parseColor(color); err == nil {
+			t.Fatalf("expected %q to be no color", color)
+		}
+	}
+}
+
+func TestLoadThemeErrors(t *testing.T) {
+	for _, c := range []struct{ data, err string }{
+		{`{"groups": {"Normal": {"fg": "nope"}}}`, "Normal: unknown color nope"},
+		{`{"groups": {"Visual": {"link": "Missing"}}}`, "Visual links to unknown group Missing"},
+		{`{"groups": [}`, "theme broken"},
+	} {
+		if _, err := LoadTheme("broken", []byte(c.data)); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Fatalf("expected an error with %q, got %v", c.err, err)
+		}
+	}
+}
+
+func TestStyles(t *testing.T) {
+	s := loadTestTheme(t).Styles(1 << 24)
+	normal := tcell.StyleDefault.Foreground(tcell.NewHexColor(0xd0d0d0)).Background(tcell.NewHexColor(0x1c1c1c))
+	expectStyle(s.Get("Normal"), normal, t)
+	// groups have the colors of Normal they have none of
+	expectStyle(s.Get("LineNr"), normal.Foreground(tcell.PaletteColor(244)), t)
+	expectStyle(s.Get("Selection"), normal.Reverse(true), t)
+	expectStyle(s.Get("Unknown"), normal, t)
+
+	layer, ok := s.Layer("keyword.control.go")
+	if !ok {
+		t.Fatalf("expected the layer of keyword for keyword.control.go")
+	}
+	expectStyle(layer, tcell.StyleDefault.Foreground(tcell.NewHexColor(0xff8700)), t)
+	if _, ok := s.Layer("string.quoted"); ok {
+		t.Fatalf("expected no layer for a scope without a group")
+	}
+
+	// layers keep the colors and attributes of the style below that they have none of
+	comment, _ := s.Layer("comment.line")
+	search, _ := s.Layer("Search")
+	expectStyle(Merge(Merge(normal, comment), search),
+		tcell.StyleDefault.Foreground(tcell.ColorBlack).Background(tcell.ColorYellow).Bold(true).Italic(true), t)
+	visual, _ := s.Layer("Visual")
+	expectStyle(Merge(Merge(normal, comment), visual), normal.Foreground(tcell.NewHexColor(0x808080)).Italic(true).Reverse(true), t)
+}
+
+func TestStylesWithoutTrueColors(t *testing.T) {
+	theme := loadTestTheme(t)
+	for _, c := range []struct {
+		colors          int
+		keyword, lineNr tcell.Color
+	}{
+		{256, tcell.PaletteColor(208), tcell.PaletteColor(244)},
+		{16, tcell.PaletteColor(9), tcell.PaletteColor(8)},
+		{8, tcell.PaletteColor(1), tcell.PaletteColor(7)},
+		{0, tcell.ColorDefault, tcell.ColorDefault},
+	} {
+		s := theme.Styles(c.colors)
+		keyword, _ := s.Layer("keyword")
+		lineNr, _ := s.Layer("LineNr")
+		if fg, _, _ := keyword.Decompose(); fg != c.keyword {
+			t.Fatalf("expected keyword to be %v with %v colors, got %v", c.keyword, c.colors, fg)
+		}
+		if fg, _, _ := lineNr.Decompose(); fg != c.lineNr {
+			t.Fatalf("expected LineNr to be %v with %v colors, got %v", c.lineNr, c.colors, fg)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "mine.json"), []byte(testTheme), 0644)
+	os.WriteFile(filepath.Join(dir, "dark.json"), []byte(`{"groups": {"Normal": {"fg": "white"}}}`), 0644)
+	if theme, err := Load("mine", dir); err != nil || theme.Name != "mine" {
+		t.Fatalf("expected the theme of the dir, got %v", err)
+	}
+	// themes of the dir are used instead of the built in ones of the same name
+	if theme, err := Load("dark", dir); err != nil || len(theme.groups) != 1 {
+		t.Fatalf("expected the dark theme of the dir, got %v", err)
+	}
+	for _, name := range []string{"missing", "../mine", ""} {
+		if _, err := Load(name, dir); err == nil {
+			t.Fatalf("expected no theme %q", name)
+		}
+	}
+	if names := Names(dir); !reflect.DeepEqual(names, []string{"dark", "default", "mine"}) {
+		t.Fatalf("expected the built in themes and the ones of the dir, got %v", names)
+	}
+}
+
+func TestBuiltinThemes(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range Names(dir) {
+		theme, err := Load(name, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := theme.Styles(256)
+		for _, group := range []string{"Normal", "LineNr", "CursorLineNr", "CursorLine", "StatusLine", "StatusLineNC", "Search", "Visual",
+			"Selection", "Cursor", "Special", "Error", "WildMenu", "WildMenuSel", "DiagnosticError", "DiagnosticWarn",
+			"DiagnosticInfo", "DiagnosticHint", "comment", "string", "keyword"} {
+			if _, ok := s.Layer(group); !ok {
+				t.Fatalf("expected theme %v to have group %v", name, group)
+			}
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package vi
+
+import (
+	BRope "main/brope"
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// An insertSession lasts from entering insert or replace mode until leaving it
+type insertSession struct {
+	// the typed text is inserted count times
+	count int
+	// keys that edited the text, they are typed again for every repetition
+	keys []Key
+	// typed before each repetition, the newline of "o"
+	prefix []Key
+	// where the session started
+	start int
+	// lines of a visual block that get the typed text too
+	block *blockInsert
+	// runes overwritten in replace mode, restored by backspace. -1 for runes that were appended.
+	replaced []rune
+	// Ctrl-R was typed, the next key is the register to insert
+	pasteRegister bool
+}
+
+type blockInsert struct {
+	firstLine, lastLine, col int
+}
+
+func (e *Engine) enterInsert(mode Mode, count int, prefix string) {
+	e.insert = insertSession{count: max(1, count), prefix: Keys(prefix), start: e.cursor()}
+	e.mode = mode
+}
+
+// Starts insert mode at col of the first line, the text typed into it is inserted into the other lines
+// of the block at the same column when insert mode is left
+func (e *Engine) startBlockInsert(firstLine, lines, col int) {
+	r := e.rope()
+	start := r.OffsetOfLine(firstLine)
+	e.setCursor(min(start+col, lineEnd(r, start)))
+	e.enterInsert(Insert, 1, "")
+	if lines > 1 {
+		e.insert.block = &blockInsert{firstLine: firstLine, lastLine: firstLine + lines - 1, col: col}
+	}
+}
+
+// Handles a key in insert and replace mode
+func (e *Engine) insertKey(key Key) {
+	if e.recordInsert {
+		e.change.keys = append(e.change.keys, key)
+	}
+	if key == escape || key.Code == tcell.KeyCtrlC {
+		e.leaveInsert()
+		return
+	}
+	if e.typeKey(key) {
+		e.insert.keys = append(e.insert.keys, key)
+	} else if e.moveInInsert(key) {
+		// moving starts a new undo step, only the text typed after it is repeated
+		e.buffer().History.EndGroup()
+		e.buffer().History.BeginGroup()
+		e.insert = insertSession{count: 1, start: e.cursor()}
+		if e.recordInsert {
+			e.change = change{keys: Keys("i")}
+			if e.mode == Replace {
+				e.change = change{keys: Keys("R")}
+			}
+		}
+	}
+}
+
+// Edits the text for a key, returns false if the key does not edit
+func (e *Engine) typeKey(key Key) bool {
+	r := e.rope()
+	if e.insert.pasteRegister {
+		e.insert.pasteRegister = false
+		if reg, ok := e.registers.Get(key.Rune); key.Code == tcell.KeyRune && ok {
+			e.insertAtCursors([]rune(reg.String()))
+		}
+		return true
+	}
+	switch key.Code {
+	case tcell.KeyRune:
+		e.typeRune(key.Rune)
+	case tcell.KeyEnter:
+		e.typeRune('\n')
+	case tcell.KeyTab:
+		e.typeRune('\t')
+	case tcell.KeyBackspace:
+		if e.mode == Replace {
+			e.unreplace()
+			break
+		}
+		e.editCursors(func(cursor int) (BRope.Interval, []rune, bool) {
+			return BRope.IV(prevCluster(r, cursor), cursor), nil, cursor > 0
+		})
+	case tcell.KeyDelete:
+		e.editCursors(func(cursor int) (BRope.Interval, []rune, bool) {
+			return BRope.IV(cursor, nextCluster(r, cursor)), nil, cursor < r.Length()
+		})
+	case tcell.KeyCtrlW:
+		e.editCursors(func(cursor int) (BRope.Interval, []rune, bool) {
+			return BRope.IV(wordStartBefore(r, cursor), cursor), nil, true
+		})
+	case tcell.KeyCtrlR:
+		e.insert.pasteRegister = true
+	case tcell.KeyCtrlU:
+		e.editCursors(func(cursor int) (BRope.Interval, []rune, bool) {
+			start := lineStart(r, cursor)
+			if start == cursor {
+				start = max(0, cursor-1)
+			}
+			return BRope.IV(start, cursor), nil, true
+		})
+	default:
+		return false
+	}
+	return true
+}
+
+func (e *Engine) typeRune(ch rune) {
+	cursor := e.cursor()
+	if e.mode == Replace {
+		// newlines and the end of the line are not overwritten
+		if old, ok := runeAt(e.rope(), cursor); ok && old != '\n' && ch != '\n' {
+			e.insert.replaced = append(e.insert.replaced, old)
+			e.setCursor(e.edit(BRope.IV(cursor, cursor+1), []rune{ch}))
+			return
+		}
+		e.insert.replaced = append(e.insert.replaced, -1)
+	}
+	e.insertAtCursors([]rune{ch})
+}
+
+// Moves back in replace mode and restores the rune that was overwritten
+func (e *Engine) unreplace() {
+	replaced := e.insert.replaced
+	cursor := e.cursor()
+	if len(replaced) == 0 || cursor == 0 {
+		if cursor > lineStart(e.rope(), cursor) {
+			e.setCursor(cursor - 1)
+		}
+		return
+	}
+	old := replaced[len(replaced)-1]
+	e.insert.replaced = replaced[:len(replaced)-1]
+	if old < 0 {
+		e.setCursor(e.edit(BRope.IV(cursor-1, cursor), nil))
+	} else {
+		e.edit(BRope.IV(cursor-1, cursor), []rune{old})
+		e.setCursor(cursor - 1)
+	}
+}
+
+// Moves the cursors for the arrow keys, returns false for other keys
+func (e *Engine) moveInInsert(key Key) bool {
+	r := e.rope()
+	moves := map[tcell.Key]func(cursor int) int{
+		tcell.KeyLeft:  func(cursor int) int { return max(lineStart(r, cursor), prevCluster(r, cursor)) },
+		tcell.KeyRight: func(cursor int) int { return min(lineEnd(r, cursor), nextCluster(r, cursor)) },
+		tcell.KeyUp:    func(cursor int) int { return moveLines(r, cursor, -1) },
+		tcell.KeyDown:  func(cursor int) int { return moveLines(r, cursor, 1) },
+		tcell.KeyHome:  func(cursor int) int { return lineStart(r, cursor) },
+		tcell.KeyEnd:   func(cursor int) int { return lineEnd(r, cursor) },
+	}
+	move, ok := moves[key.Code]
+	if !ok {
+		return false
+	}
+	if key.Code == tcell.KeyUp || key.Code == tcell.KeyDown {
+		// the cursor keeps to its wanted column, the other cursors to their own
+		e.editor.CursorToLine(r.LineOfOffset(move(e.cursor())), true)
+		e.moveOthers(move)
+	} else {
+		e.moveCursors(move)
+	}
+	if key.Code == tcell.KeyEnd {
+		e.editor.KeepLineEnd()
+	}
+	return true
+}
+
+// Paste inserts text the terminal pasted in a single edit. In insert and replace mode it is inserted
+// at every cursor as a part of the insert and repeated with it, in the other modes it is inserted at
+// the cursor as a change of its own, with the cursor on its last rune, or behind it if the text ends
+// with a line break. Macros record a paste in insert and replace mode as the keys that type it.
+func (e *Engine) Paste(text string) {
+	runes := []rune(text)
+	if len(runes) == 0 {
+		return
+	}
+	if e.mode == Insert || e.mode == Replace {
+		e.insert.pasteRegister = false
+		e.insertAtCursors(runes)
+		keys := pastedKeys(runes)
+		e.insert.keys = append(e.insert.keys, keys...)
+		if e.recordInsert {
+			e.change.keys = append(e.change.keys, keys...)
+		}
+		if e.recording != 0 {
+			e.recorded = append(e.recorded, keys...)
+		}
+		if e.mode == Replace {
+			// nothing was overwritten, backspace deletes the pasted runes
+			for range runes {
+				e.insert.replaced = append(e.insert.replaced, -1)
+			}
+		}
+		return
+	}
+	if e.mode != Normal || len(e.keys) > 0 || e.count > 0 || e.arg != nil || e.register != 0 || e.selectRegister {
+		e.cancel()
+		e.mode = Normal
+	}
+	e.beginChange()
+	cursor := e.cursor()
+	end := e.edit(BRope.IV(cursor, cursor), runes)
+	if runes[len(runes)-1] != '\n' {
+		end--
+	}
+	e.setCursor(end)
+	e.finish(false)
+}
+
+// Keys that type the runes, for repeating pasted text
+func pastedKeys(runes []rune) []Key {
+	keys := make([]Key, len(runes))
+	for i, ch := range runes {
+		switch ch {
+		case '\n':
+			keys[i] = Key{Code: tcell.KeyEnter}
+		case '\t':
+			keys[i] = Key{Code: tcell.KeyTab}
+		default:
+			keys[i] = RuneKey(ch)
+		}
+	}
+	return keys
+}
+
+// Repeats the typed text for a count and returns to normal mode, with the cursor on the last typed rune.
+// The typed text is kept in the "." register.
+func (e *Engine) leaveInsert() {
+	s := &e.insert
+	e.buffer().Marks.Set('^', e.cursor())
+	if cursor := e.cursor(); cursor > s.start {
+		e.registers.registers['.'] = Register{Text: e.rope().Slice(BRope.IV(s.start, cursor)), Kind: Charwise}
+	}
+	for i := 1; i < s.count; i++ {
+		for _, key := range append(append([]Key{}, s.prefix...), s.keys...) {
+			e.typeKey(key)
+		}
+	}
+	if s.block != nil {
+		e.copyBlockInsert()
+	} else {
+		r := e.rope()
+		e.moveCursors(func(cursor int) int {
+			if cursor > lineStart(r, cursor) {
+				return prevCluster(r, cursor)
+			}
+			return cursor
+		})
+	}
+	e.mode = Normal
+	e.finish(e.recordInsert)
+}
+
+// Inserts the text typed into the first line of a visual block into the other lines
+func (e *Engine) copyBlockInsert() {
+	r := e.rope()
+	b := e.insert.block
+	start, cursor := e.insert.start, e.cursor()
+	if cursor < start || r.LineOfOffset(cursor) != b.firstLine || r.LineOfOffset(start) != b.firstLine {
+		return
+	}
+	text := append([]rune{}, r.Slice(BRope.IV(start, cursor)).Runes()...)
+	ivs, texts := []BRope.Interval{}, [][]rune{}
+	for line := b.firstLine + 1; line <= b.lastLine && line < r.LineCount(); line++ {
+		lineStart := r.OffsetOfLine(line)
+		if lineEnd(r, lineStart)-lineStart >= b.col {
+			ivs, texts = append(ivs, BRope.IV(lineStart+b.col, lineStart+b.col)), append(texts, text)
+		}
+	}
+	e.editAll(ivs, texts, start)
+	e.setCursor(start)
+}
+
+// Start of the word before offset for Ctrl-W, spaces before the offset are deleted with it.
+// At the start of a line, the newline before it is deleted.
+func wordStartBefore(r BRope.Rope, offset int) int {
+	start := lineStart(r, offset)
+	if start == offset {
+		return max(0, offset-1)
+	}
+	line := r.Slice(BRope.IV(start, offset)).Runes()
+	i := len(line)
+	for i > 0 && unicode.IsSpace(line[i-1]) {
+		i--
+	}
+	if i > 0 {
+		word := isWordRune(line[i-1])
+		for i > 0 && !unicode.IsSpace(line[i-1]) && isWordRune(line[i-1]) == word {
+			i--
+		}
+	}
+	return start + i
+}
@@ -0,0 +1,47 @@
+package vi
+
+// A binding is what a key sequence does: move the cursor, start an operator, select a text object or run an action
+type binding struct {
+	motion   *Motion
+	operator *operator
+	object   *textObject
+	action   func(e *Engine, count int, arg rune)
+	// the action changes the buffer, so it is undone in one step and repeated by "."
+	change bool
+	// the keys are followed by a character that is passed to the action, like the one of "r"
+	takesChar bool
+}
+
+// A keymap is a trie of key sequences
+type keymap struct {
+	children map[Key]*keymap
+	binding  *binding
+}
+
+func newKeymap() *keymap {
+	return &keymap{children: map[Key]*keymap{}}
+}
+
+func (m *keymap) add(keys []Key, b *binding) {
+	node := m
+	for _, key := range keys {
+		child, ok := node.children[key]
+		if !ok {
+			child = newKeymap()
+			node.children[key] = child
+		}
+		node = child
+	}
+	node.binding = b
+}
+
+// Returns the node of the keys, or nil if no sequence starts with them
+func (m *keymap) find(keys []Key) *keymap {
+	node := m
+	for _, key := range keys {
+		if node = node.children[key]; node == nil {
+			return nil
+		}
+	}
+	return node
+}
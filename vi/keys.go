@@ -0,0 +1,134 @@
+package vi
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// A Key is a single key press, either a rune or a special key like Esc or Ctrl-R.
+type Key struct {
+	Code tcell.Key
+	Rune rune
+}
+
+func RuneKey(r rune) Key {
+	return Key{Code: tcell.KeyRune, Rune: r}
+}
+
+var (
+	escape    = Key{Code: tcell.KeyEscape}
+	enter     = Key{Code: tcell.KeyEnter}
+	backspace = Key{Code: tcell.KeyBackspace}
+)
+
+// KeyOf returns the key of a key event
+func KeyOf(ev *tcell.EventKey) Key {
+	switch ev.Key() {
+	case tcell.KeyRune:
+		return RuneKey(ev.Rune())
+	case tcell.KeyBackspace2:
+		// most terminals send DEL for backspace
+		return backspace
+	}
+	return Key{Code: ev.Key()}
+}
+
+// Event returns a key event of the key, for keys that are played back
+func (k Key) Event() *tcell.EventKey {
+	return tcell.NewEventKey(k.Code, k.Rune, tcell.ModNone)
+}
+
+// names of special keys in vim's key notation, e.g. "<Esc>"
+var keyNames = map[tcell.Key]string{
+	tcell.KeyEscape:    "Esc",
+	tcell.KeyEnter:     "CR",
+	tcell.KeyBackspace: "BS",
+	tcell.KeyTab:       "Tab",
+	tcell.KeyBacktab:   "S-Tab",
+	tcell.KeyDelete:    "Del",
+	tcell.KeyInsert:    "Insert",
+	tcell.KeyUp:        "Up",
+	tcell.KeyDown:      "Down",
+	tcell.KeyLeft:      "Left",
+	tcell.KeyRight:     "Right",
+	tcell.KeyHome:      "Home",
+	tcell.KeyEnd:       "End",
+	tcell.KeyPgUp:      "PageUp",
+	tcell.KeyPgDn:      "PageDown",
+}
+
+// String returns the key in vim's key notation, like "a", "<lt>", "<CR>" or "<C-r>"
+func (k Key) String() string {
+	if k.Code == tcell.KeyRune {
+		switch k.Rune {
+		case '<':
+			return "<lt>"
+		case ' ':
+			return "<Space>"
+		}
+		return string(k.Rune)
+	}
+	if name, ok := keyNames[k.Code]; ok {
+		return "<" + name + ">"
+	}
+	if k.Code >= tcell.KeyCtrlA && k.Code <= tcell.KeyCtrlZ {
+		return "<C-" + string(rune('a'+k.Code-tcell.KeyCtrlA)) + ">"
+	}
+	if name, ok := tcell.KeyNames[k.Code]; ok {
+		return "<" + name + ">"
+	}
+	return ""
+}
+
+// KeysString returns the keys in vim's key notation
+func KeysString(keys []Key) string {
+	var sb strings.Builder
+	for _, key := range keys {
+		sb.WriteString(key.String())
+	}
+	return sb.String()
+}
+
+// Keys parses keys in vim's key notation, e.g. "d2w", "ihello<Esc>" or "<C-r>".
+// A '<' that does not start a key name is taken literally.
+func Keys(notation string) []Key {
+	keys := []Key{}
+	for notation != "" {
+		if notation[0] == '<' {
+			if end := strings.IndexByte(notation, '>'); end > 1 {
+				if key, ok := parseKeyName(notation[1:end]); ok {
+					keys = append(keys, key)
+					notation = notation[end+1:]
+					continue
+				}
+			}
+		}
+		r, size := utf8.DecodeRuneInString(notation)
+		keys = append(keys, RuneKey(r))
+		notation = notation[size:]
+	}
+	return keys
+}
+
+// Parses the name of a key between '<' and '>'
+func parseKeyName(name string) (Key, bool) {
+	switch strings.ToLower(name) {
+	case "lt":
+		return RuneKey('<'), true
+	case "space":
+		return RuneKey(' '), true
+	case "enter", "return":
+		return enter, true
+	}
+	if lower := strings.ToLower(name); strings.HasPrefix(lower, "c-") && len(lower) == 3 && lower[2] >= 'a' && lower[2] <= 'z' {
+		return Key{Code: tcell.KeyCtrlA + tcell.Key(lower[2]-'a')}, true
+	}
+	for code, n := range keyNames {
+		if strings.EqualFold(n, name) {
+			return Key{Code: code}, true
+		}
+	}
+	return Key{}, false
+}
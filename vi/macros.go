@@ -0,0 +1,103 @@
+package vi
+
+import (
+	BRope "main/brope"
+	"unicode"
+)
+
+// macros that play themselves stop at this depth
+const maxMacroDepth = 100
+
+// Macros are kept in registers in key notation, so they can be put, edited and yanked back.
+// The application passes the keys that are typed to Record and plays macros, so keys typed into
+// the command line are a part of them too.
+func (e *Engine) registerMacros() {
+	e.addCharAction(Normal, "q", false, func(e *Engine, _ int, name rune) {
+		if unicode.IsLetter(name) || unicode.IsDigit(name) || name == '"' {
+			e.recording, e.recorded = name, nil
+		}
+	})
+	e.addCharAction(Normal, "@", false, func(e *Engine, count int, name rune) {
+		e.playMacro(name, max(1, count))
+	})
+}
+
+// Recording returns the register a macro is recorded into, 0 if none is
+func (e *Engine) Recording() rune {
+	return e.recording
+}
+
+// Record adds a key that was typed to the macro that is recorded
+func (e *Engine) Record(key Key) {
+	if e.recording != 0 {
+		e.recorded = append(e.recorded, key)
+	}
+}
+
+// SetPlayer sets how the keys of macros are played, the keys are fed into the engine if it is not set
+func (e *Engine) SetPlayer(play func(keys []Key)) {
+	e.player = play
+}
+
+// Stores the recorded keys without the "q" that stopped the recording
+func (e *Engine) stopRecording() {
+	keys := e.recorded
+	if n := len(keys); n > 0 && keys[n-1] == RuneKey('q') {
+		keys = keys[:n-1]
+	}
+	e.registers.Set(e.recording, Register{Text: BRope.NewRopeString(KeysString(keys)), Kind: Charwise})
+	e.recording, e.recorded = 0, nil
+}
+
+// Plays the keys of a register count times, after the command that plays them is finished.
+// "@@" plays the last macro again and "@:" runs the last command line.
+func (e *Engine) playMacro(name rune, count int) {
+	if name == '@' {
+		name = e.lastMacro
+	}
+	reg, ok := e.registers.Get(name)
+	if !ok {
+		return
+	}
+	e.lastMacro = name
+	var keys []Key
+	if name == ':' {
+		keys = append(keys, RuneKey(':'))
+		for _, r := range reg.String() {
+			keys = append(keys, RuneKey(r))
+		}
+		keys = append(keys, enter)
+	} else {
+		keys = macroKeys(reg.String())
+	}
+	for i := 0; i < count; i++ {
+		e.macro = append(e.macro, keys...)
+	}
+}
+
+// Parses the keys of a macro, line breaks are Enter
+func macroKeys(text string) []Key {
+	keys := Keys(text)
+	for i, key := range keys {
+		if key == RuneKey('\n') {
+			keys[i] = enter
+		}
+	}
+	return keys
+}
+
+// Plays the macro of the last command
+func (e *Engine) play() {
+	keys := e.macro
+	e.macro = nil
+	if e.macroDepth >= maxMacroDepth {
+		return
+	}
+	e.macroDepth++
+	defer func() { e.macroDepth-- }()
+	if e.player != nil {
+		e.player(keys)
+	} else {
+		e.FeedKeys(keys)
+	}
+}
@@ -0,0 +1,84 @@
+package vi
+
+import (
+	BRope "main/brope"
+	"testing"
+)
+
+// Types the keys like the application does, which records them before feeding them
+func typeKeys(e *Engine, keys string) {
+	for _, key := range Keys(keys) {
+		e.Record(key)
+		e.Feed(key)
+	}
+}
+
+func TestMacros(t *testing.T) {
+	e := newTestEngine("|a\nb\nc\nd\ne")
+	typeKeys(e, "qaA!<Esc>jq")
+	expectRegister(e, 'a', "A!<Esc>j", Charwise, t)
+	if e.Recording() != 0 {
+		t.Fatalf("expected the recording to stop")
+	}
+	typeKeys(e, "2@a")
+	if got := content(e); got != "a!\nb!\nc!\n|d\ne" {
+		t.Fatalf("expected the macro to be played twice, got %q", got)
+	}
+	typeKeys(e, "@@")
+	if got := content(e); got != "a!\nb!\nc!\nd!\n|e" {
+		t.Fatalf("expected @@ to play the macro again, got %q", got)
+	}
+	typeKeys(e, "u")
+	if got := content(e); got != "a!\nb!\nc!\n|d\ne" {
+		t.Fatalf("expected the changes of a macro to be undone one by one, got %q", got)
+	}
+
+	// macros are edited as text
+	e = newTestEngine("|ab")
+	e.Registers().Set('b', Register{Text: BRope.NewRopeString("x<lt>\n")})
+	typeKeys(e, "@b")
+	if got := content(e); got != "|b" {
+		t.Fatalf("expected the edited macro to be played, got %q", got)
+	}
+	typeKeys(e, "qBiy<Esc>q")
+	expectRegister(e, 'b', "x<lt>\niy<Esc>", Charwise, t)
+
+	typeKeys(e, "qcq@x@c")
+	if got := content(e); got != "|yb" {
+		t.Fatalf("expected empty and missing macros to do nothing, got %q", got)
+	}
+}
+
+func TestMacroPaste(t *testing.T) {
+	// a paste is recorded as typed text, so its keys are not played as commands
+	e := newTestEngine("|ab\ncd")
+	typeKeys(e, "qaA")
+	e.Paste("dd\tx")
+	typeKeys(e, "<Esc>jq")
+	expectRegister(e, 'a', "Add<Tab>x<Esc>j", Charwise, t)
+	typeKeys(e, "@a")
+	if got := content(e); got != "abdd\tx\ncddd\t|x" {
+		t.Fatalf("expected the paste to be inserted by the macro, got %q", got)
+	}
+}
+
+func TestMacroPlayer(t *testing.T) {
+	e := newTestEngine("|ab")
+	played := []string{}
+	e.SetPlayer(func(keys []Key) { played = append(played, KeysString(keys)) })
+	e.Registers().Provide(':', func() string { return "s/a/<b>" }, nil)
+	typeKeys(e, "q1:w<CR>q2@:")
+	expectRegister(e, '1', ":w<CR>", Charwise, t)
+	if len(played) != 1 || played[0] != ":s/a/<lt>b><CR>:s/a/<lt>b><CR>" {
+		t.Fatalf("expected the command line to be played twice, got %q", played)
+	}
+}
+
+func TestRecursiveMacro(t *testing.T) {
+	e := newTestEngine("|a")
+	e.Registers().Set('a', Register{Text: BRope.NewRopeString("ix<Esc>@a")})
+	typeKeys(e, "@a")
+	if got := len(e.rope().Runes()); got != maxMacroDepth+1 {
+		t.Fatalf("expected the macro to stop at a depth of %v, got %v runes", maxMacroDepth, got)
+	}
+}
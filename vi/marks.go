@@ -0,0 +1,89 @@
+package vi
+
+import (
+	BRope "main/brope"
+	"unicode"
+)
+
+// FileMarks keep the upper case marks, which belong to a file instead of a buffer. Without them,
+// upper case marks are kept in the buffer like lower case ones.
+type FileMarks interface {
+	// sets the mark to the offset in the current buffer
+	SetFileMark(name rune, offset int)
+	// switches to the buffer of the mark and returns the offset of the mark in it
+	GoToFileMark(name rune) (int, bool)
+}
+
+// SetFileMarks sets where upper case marks are kept
+func (e *Engine) SetFileMarks(marks FileMarks) {
+	e.fileMarks = marks
+}
+
+// Marks are kept by the buffer, which moves them with the edits. "'" and "`" jump to them,
+// the first one to the line of the mark.
+func (e *Engine) registerMarks() {
+	e.addCharAction(Normal, "m", false, func(e *Engine, _ int, name rune) {
+		e.setMark(name)
+	})
+	e.addMotion(&Motion{Linewise: true, TakesChar: true, Jump: true, Move: e.moveToMark(true)}, "'")
+	e.addMotion(&Motion{TakesChar: true, Jump: true, Move: e.moveToMark(false)}, "`")
+
+	e.addAction(Normal, "<C-o>", false, func(e *Engine, count int, _ rune) {
+		if offset, ok := e.buffer().Jump(-max(1, count), e.cursor()); ok {
+			e.setCursor(offset)
+		}
+	})
+	e.addAction(Normal, "<Tab>", false, func(e *Engine, count int, _ rune) {
+		if offset, ok := e.buffer().Jump(max(1, count), e.cursor()); ok {
+			e.setCursor(offset)
+		}
+	})
+	e.addAction(Normal, "g;", false, func(e *Engine, count int, _ rune) {
+		if offset, ok := e.buffer().Change(-max(1, count)); ok {
+			e.setCursor(offset)
+		}
+	})
+	e.addAction(Normal, "g,", false, func(e *Engine, count int, _ rune) {
+		if offset, ok := e.buffer().Change(max(1, count)); ok {
+			e.setCursor(offset)
+		}
+	})
+}
+
+// Sets a mark to the cursor, "m'" and "m`" add the cursor to the jump list
+func (e *Engine) setMark(name rune) {
+	cursor := e.cursor()
+	switch {
+	case name >= 'a' && name <= 'z':
+		e.buffer().Marks.Set(name, cursor)
+	case name >= 'A' && name <= 'Z' && e.fileMarks != nil:
+		e.fileMarks.SetFileMark(name, cursor)
+	case name >= 'A' && name <= 'Z':
+		e.buffer().Marks.Set(name, cursor)
+	case name == '\'' || name == '`':
+		e.buffer().PushJump(cursor)
+	}
+}
+
+// The motion to a mark. Upper case marks in other files switch to their buffer, unless they are
+// the target of an operator.
+func (e *Engine) moveToMark(linewise bool) func(BRope.Rope, int, int, rune) (int, bool) {
+	return func(_ BRope.Rope, offset, _ int, name rune) (int, bool) {
+		if name == '`' {
+			name = '\''
+		}
+		target, ok := e.buffer().Marks.Get(name)
+		if !ok && unicode.IsUpper(name) && e.fileMarks != nil && e.mode != OperatorPending {
+			target, ok = e.fileMarks.GoToFileMark(name)
+		}
+		if !ok {
+			return offset, false
+		}
+		r := e.rope()
+		target = min(target, r.Length())
+		if linewise {
+			target = firstNonBlank(r, target)
+		}
+		return target, true
+	}
+}
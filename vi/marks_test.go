@@ -0,0 +1,97 @@
+package vi
+
+import (
+	"testing"
+)
+
+func TestMarks(t *testing.T) {
+	expectKeys("a\n  b|c\nd", "majj'a", "a\n  |bc\nd", t)
+	expectKeys("a\n  b|c\nd", "majj`a", "a\n  b|c\nd", t)
+	expectKeys("a\nb|c\nd", "maggd'a", "|d", t)
+	expectKeys("a|bcd", "ma$d`a", "a|d", t)
+	expectKeys("a|b\nc", "mAj'A", "|ab\nc", t)
+	expectKeys("a|b\nc", "j'x", "ab\n|c", t)
+
+	// marks stay on their text
+	expectKeys("a\nb|c", "maggOx<Esc>`a", "x\na\nb|c", t)
+	expectKeys("a\nb|c", "maggdd`a", "b|c", t)
+	expectKeys("a\nb|c", "maggddu`a", "a\nb|c", t)
+}
+
+func TestJumps(t *testing.T) {
+	e := expectKeys("|a\nb\nc\nd", "2GG", "a\nb\nc\n|d", t)
+	e.FeedKeys(Keys("<C-o>"))
+	if got := content(e); got != "a\n|b\nc\nd" {
+		t.Fatalf("expected to jump back to the second line, got %q", got)
+	}
+	e.FeedKeys(Keys("<C-o>"))
+	if got := content(e); got != "|a\nb\nc\nd" {
+		t.Fatalf("expected to jump back to the first line, got %q", got)
+	}
+	e.FeedKeys(Keys("<C-o>"))
+	if got := content(e); got != "|a\nb\nc\nd" {
+		t.Fatalf("expected no older jump, got %q", got)
+	}
+	e.FeedKeys(Keys("2<Tab>"))
+	if got := content(e); got != "a\nb\nc\n|d" {
+		t.Fatalf("expected to jump forward to where the jumps started, got %q", got)
+	}
+	e.FeedKeys(Keys("''"))
+	if got := content(e); got != "a\n|b\nc\nd" {
+		t.Fatalf("expected '' to go to where the last jump started, got %q", got)
+	}
+	e.FeedKeys(Keys("''"))
+	if got := content(e); got != "a\nb\nc\n|d" {
+		t.Fatalf("expected '' to go back, got %q", got)
+	}
+	expectKeys("|a\nb\nc", "jm'j``", "a\n|b\nc", t)
+}
+
+func TestChanges(t *testing.T) {
+	e := expectKeys("|a\nb\nc\nd", "xGx", "\nb\nc\n|", t)
+	e.FeedKeys(Keys("gg2jg;"))
+	if got := content(e); got != "\nb\nc\n|" {
+		t.Fatalf("expected to go to the last change, got %q", got)
+	}
+	e.FeedKeys(Keys("g;"))
+	if got := content(e); got != "|\nb\nc\n" {
+		t.Fatalf("expected to go to the change before, got %q", got)
+	}
+	e.FeedKeys(Keys("g,"))
+	if got := content(e); got != "\nb\nc\n|" {
+		t.Fatalf("expected to go forward in the changes, got %q", got)
+	}
+	expectKeys("a|bc", "ix<Esc>0`.", "a|xbc", t)
+	expectKeys("a|bc", "ixy<Esc>0`^", "axy|bc", t)
+}
+
+type testFileMarks struct {
+	marks    map[rune]int
+	switched bool
+}
+
+func (f *testFileMarks) SetFileMark(name rune, offset int) { f.marks[name] = offset }
+func (f *testFileMarks) GoToFileMark(name rune) (int, bool) {
+	offset, ok := f.marks[name]
+	f.switched = ok
+	return offset, ok
+}
+
+func TestFileMarks(t *testing.T) {
+	e := newTestEngine("a|b\nc")
+	marks := &testFileMarks{marks: map[rune]int{}}
+	e.SetFileMarks(marks)
+	e.FeedKeys(Keys("mBj"))
+	if marks.marks['B'] != 1 {
+		t.Fatalf("expected the file mark to be set, got %v", marks.marks)
+	}
+	e.FeedKeys(Keys("`B"))
+	if got := content(e); got != "a|b\nc" || !marks.switched {
+		t.Fatalf("expected to go to the file mark, got %q", got)
+	}
+	marks.switched = false
+	e.FeedKeys(Keys("d`Bx"))
+	if got := content(e); marks.switched || got != "|a\nc" {
+		t.Fatalf("expected an operator not to switch files, got %q", got)
+	}
+}
@@ -0,0 +1,358 @@
+package vi
+
+import (
+	BRope "main/brope"
+	Buffer "main/buffer"
+	"unicode"
+)
+
+// A Motion moves the cursor. After an operator, the text between the cursor and the target of the motion
+// is the region the operator works on.
+type Motion struct {
+	// returns the target of moving count times from offset, arg is the character of motions like "f"
+	Move func(r BRope.Rope, offset int, count int, arg rune) (int, bool)
+	// operators work on whole lines
+	Linewise bool
+	// the rune at the target belongs to the region of an operator
+	Inclusive bool
+	// the motion is followed by a character
+	TakesChar bool
+	// the count is a line number like the one of "G" instead of a repetition, it is 0 if none was typed
+	Absolute bool
+	// moving adds the position before it to the jump list
+	Jump bool
+
+	// "cw" changes to the end of the word, like "ce", if the cursor is on a word
+	change *Motion
+	// after an operator, the motion ends at the end of the line of the last word it moved over
+	word bool
+	// the motion moves up or down, the cursor keeps to the column it wants to be in
+	vertical bool
+	// moving up and down after the motion keeps to the end of the lines
+	lineEnd bool
+}
+
+var (
+	leftMotion = &Motion{Move: func(r BRope.Rope, offset, count int, _ rune) (int, bool) {
+		start := lineStart(r, offset)
+		target := offset
+		for ; count > 0 && target > start; count-- {
+			target = prevCluster(r, target)
+		}
+		return target, offset > start
+	}}
+	rightMotion = &Motion{Move: func(r BRope.Rope, offset, count int, _ rune) (int, bool) {
+		end := lineEnd(r, offset)
+		target := offset
+		for ; count > 0 && target < end; count-- {
+			target = nextCluster(r, target)
+		}
+		return target, offset < end
+	}}
+	upMotion = &Motion{Linewise: true, vertical: true, Move: func(r BRope.Rope, offset, count int, _ rune) (int, bool) {
+		return moveLines(r, offset, -count), r.LineOfOffset(offset) > 0
+	}}
+	downMotion = &Motion{Linewise: true, vertical: true, Move: func(r BRope.Rope, offset, count int, _ rune) (int, bool) {
+		return moveLines(r, offset, count), r.LineOfOffset(offset) < r.LineCount()-1
+	}}
+	lineStartMotion = &Motion{Move: func(r BRope.Rope, offset, _ int, _ rune) (int, bool) {
+		return lineStart(r, offset), true
+	}}
+	firstNonBlankMotion = &Motion{Move: func(r BRope.Rope, offset, _ int, _ rune) (int, bool) {
+		return firstNonBlank(r, offset), true
+	}}
+	// the last rune of the line count-1 lines below
+	lineEndMotion = &Motion{Inclusive: true, lineEnd: true, Move: func(r BRope.Rope, offset, count int, _ rune) (int, bool) {
+		line := min(r.LineOfOffset(offset)+count-1, r.LineCount()-1)
+		start := r.OffsetOfLine(line)
+		return max(start, prevCluster(r, lineEnd(r, start))), true
+	}}
+
+	wordMotion          = &Motion{Move: repeatMove(nextWordStart, false), word: true, change: wordEndMotion}
+	bigWordMotion       = &Motion{Move: repeatMove(nextWordStart, true), word: true, change: bigWordEndMotion}
+	wordEndMotion       = &Motion{Move: repeatMove(nextWordEnd, false), Inclusive: true}
+	bigWordEndMotion    = &Motion{Move: repeatMove(nextWordEnd, true), Inclusive: true}
+	wordBackMotion      = &Motion{Move: repeatMove(prevWordStart, false)}
+	bigWordBackMotion   = &Motion{Move: repeatMove(prevWordStart, true)}
+	paragraphMotion     = &Motion{Move: nextParagraph, Jump: true}
+	paragraphBackMotion = &Motion{Move: prevParagraph, Jump: true}
+	// the bracket matching the first one at or after the cursor in its line
+	matchMotion = &Motion{Inclusive: true, Jump: true, Move: func(r BRope.Rope, offset, _ int, _ rune) (int, bool) {
+		c := BRope.NewCursor(r, offset)
+		for ch, ok := c.PeekRune(); ok && ch != '\n'; ch, ok = c.PeekRune() {
+			for _, pair := range []string{"()", "[]", "{}"} {
+				if open, close := rune(pair[0]), rune(pair[1]); ch == open || ch == close {
+					return matchBracket(r, c.Pos(), open, close)
+				}
+			}
+			c.NextRune()
+		}
+		return offset, false
+	}}
+	findMotion = &Motion{Inclusive: true, TakesChar: true, Move: func(r BRope.Rope, offset, count int, ch rune) (int, bool) {
+		return findInLine(r, offset, count, ch, true)
+	}}
+	findBackMotion = &Motion{TakesChar: true, Move: func(r BRope.Rope, offset, count int, ch rune) (int, bool) {
+		return findInLine(r, offset, count, ch, false)
+	}}
+	tillMotion = &Motion{Inclusive: true, TakesChar: true, Move: func(r BRope.Rope, offset, count int, ch rune) (int, bool) {
+		target, ok := findInLine(r, offset, count, ch, true)
+		return target - 1, ok
+	}}
+	tillBackMotion = &Motion{TakesChar: true, Move: func(r BRope.Rope, offset, count int, ch rune) (int, bool) {
+		target, ok := findInLine(r, offset, count, ch, false)
+		return target + 1, ok
+	}}
+	// the first non-blank of the line of the count, the first line without one
+	firstLineMotion = &Motion{Linewise: true, Absolute: true, Jump: true, Move: func(r BRope.Rope, _, count int, _ rune) (int, bool) {
+		return firstNonBlank(r, r.OffsetOfLine(min(max(1, count), r.LineCount())-1)), true
+	}}
+	// the first non-blank of the line of the count, the last line without one
+	lastLineMotion = &Motion{Linewise: true, Absolute: true, Jump: true, Move: func(r BRope.Rope, _, count int, _ rune) (int, bool) {
+		if count == 0 {
+			count = r.LineCount()
+		}
+		return firstNonBlank(r, r.OffsetOfLine(min(count, r.LineCount())-1)), true
+	}}
+)
+
+// Turns a move by one into a motion that moves count times, it fails if the first move does not get anywhere
+func repeatMove(move func(r BRope.Rope, offset int, big bool) int, big bool) func(BRope.Rope, int, int, rune) (int, bool) {
+	return func(r BRope.Rope, offset, count int, _ rune) (int, bool) {
+		target := offset
+		for i := 0; i < count; i++ {
+			next := move(r, target, big)
+			if next == target {
+				break
+			}
+			target = next
+		}
+		return target, target != offset
+	}
+}
+
+// Start of the next word, empty lines count as words. At the end of the rope, this is its length.
+func nextWordStart(r BRope.Rope, offset int, big bool) int {
+	c := BRope.NewCursor(r, offset)
+	ch, ok := c.NextRune()
+	if !ok {
+		return offset
+	}
+	if class := runeClass(ch, big); class != blankClass {
+		for next, ok := c.PeekRune(); ok && runeClass(next, big) == class; next, ok = c.PeekRune() {
+			c.NextRune()
+		}
+	} else if ch == '\n' {
+		// the cursor was on an empty line or behind the last word of its line
+		c.Set(offset)
+	}
+	for {
+		ch, ok := c.PeekRune()
+		if !ok || !unicode.IsSpace(ch) {
+			return c.Pos()
+		}
+		c.NextRune()
+		if next, _ := c.PeekRune(); ch == '\n' && next == '\n' {
+			return c.Pos()
+		}
+	}
+}
+
+// Last rune of the word after offset, or offset if there is none
+func nextWordEnd(r BRope.Rope, offset int, big bool) int {
+	c := BRope.NewCursor(r, offset+1)
+	for ch, ok := c.PeekRune(); ok && unicode.IsSpace(ch); ch, ok = c.PeekRune() {
+		c.NextRune()
+	}
+	ch, ok := c.NextRune()
+	if !ok {
+		return offset
+	}
+	class := runeClass(ch, big)
+	for next, ok := c.PeekRune(); ok && runeClass(next, big) == class; next, ok = c.PeekRune() {
+		c.NextRune()
+	}
+	return c.Pos() - 1
+}
+
+// Start of the word before offset, empty lines count as words
+func prevWordStart(r BRope.Rope, offset int, big bool) int {
+	c := BRope.NewCursor(r, offset)
+	for {
+		ch, ok := c.PrevRune()
+		if !ok {
+			return 0
+		}
+		if ch == '\n' {
+			// stop at an empty line
+			if prev, _ := runeAt(r, c.Pos()-1); c.Pos() == 0 || prev == '\n' {
+				return c.Pos()
+			}
+			continue
+		}
+		if !isBlank(ch) {
+			return runStart(r, c.Pos(), big)
+		}
+	}
+}
+
+// Start of the count-th empty line after the paragraph of offset, or the end of the rope
+func nextParagraph(r BRope.Rope, offset, count int, _ rune) (int, bool) {
+	line := r.LineOfOffset(offset)
+	for i := 0; i < count; i++ {
+		for line < r.LineCount() && isEmptyLine(r, line) {
+			line++
+		}
+		for line < r.LineCount() && !isEmptyLine(r, line) {
+			line++
+		}
+	}
+	if line >= r.LineCount() {
+		return r.Length(), offset < r.Length()
+	}
+	return r.OffsetOfLine(line), true
+}
+
+// Start of the count-th empty line before the paragraph of offset, or the start of the rope
+func prevParagraph(r BRope.Rope, offset, count int, _ rune) (int, bool) {
+	line := r.LineOfOffset(offset)
+	for i := 0; i < count; i++ {
+		for line > 0 && isEmptyLine(r, line) {
+			line--
+		}
+		for line > 0 && !isEmptyLine(r, line) {
+			line--
+		}
+	}
+	return r.OffsetOfLine(line), offset > 0
+}
+
+// Finds the count-th ch after or before offset inside of its line
+func findInLine(r BRope.Rope, offset, count int, ch rune, forward bool) (int, bool) {
+	if ch, ok := runeAt(r, offset); forward && (!ok || ch == '\n') {
+		return offset, false
+	}
+	c := BRope.NewCursor(r, offset)
+	step := c.PrevRune
+	if forward {
+		c.NextRune()
+		step = c.NextRune
+	}
+	for {
+		pos := c.Pos()
+		next, ok := step()
+		if !ok || next == '\n' {
+			return offset, false
+		}
+		if !forward {
+			pos = c.Pos()
+		}
+		if next == ch {
+			if count--; count == 0 {
+				return pos, true
+			}
+		}
+	}
+}
+
+func (e *Engine) runMotion(m *Motion, arg rune) {
+	cursor := e.cursor()
+	count := e.motionCount(m)
+	if e.mode == OperatorPending {
+		region, ok := e.operatorRegion(m, cursor, count, arg)
+		if !ok {
+			e.cancel()
+			return
+		}
+		e.applyOperator(region, func(sel Buffer.Selection) Region {
+			if region, ok := e.operatorRegion(m, sel.Head, count, arg); ok {
+				return region
+			}
+			return Region{Kind: Charwise, Intervals: []BRope.Interval{BRope.IV(sel.Head, sel.Head)}}
+		})
+		return
+	}
+	// a mark can be in another buffer
+	buffer := e.buffer()
+	if target, ok := m.Move(e.rope(), cursor, count, arg); ok {
+		if m.Jump {
+			buffer.PushJump(cursor)
+		}
+		if m.vertical {
+			e.editor.CursorToLine(e.rope().LineOfOffset(target), false)
+		} else {
+			e.setCursor(target)
+		}
+		if m.lineEnd {
+			e.editor.KeepLineEnd()
+		}
+	}
+	if e.buffer() == buffer {
+		r := e.rope()
+		e.moveOthers(func(head int) int {
+			if target, ok := m.Move(r, head, count, arg); ok {
+				return target
+			}
+			return head
+		})
+	}
+	e.finish(false)
+}
+
+// Moves count rows of the window up or down, only the editor knows where wrapped lines are split into rows
+func (e *Engine) moveRows(dir int) func(r BRope.Rope, offset, count int, _ rune) (int, bool) {
+	return func(_ BRope.Rope, offset, count int, _ rune) (int, bool) {
+		return e.editor.RowOffset(offset, dir*count)
+	}
+}
+
+// The region an operator works on after moving from the cursor
+func (e *Engine) operatorRegion(m *Motion, cursor, count int, arg rune) (Region, bool) {
+	from := cursor
+	if ch, ok := runeAt(e.rope(), cursor); m.change != nil && e.operator == changeOperator && ok && !unicode.IsSpace(ch) {
+		// moving from the rune before the cursor, the end of the current word is the first target
+		m, from = m.change, cursor-1
+	}
+	target, ok := m.Move(e.rope(), from, count, arg)
+	if !ok {
+		return Region{}, false
+	}
+	return e.motionRegion(m, cursor, target), true
+}
+
+// The count of a motion times the count of its operator. Absolute motions get 0 if there is no count.
+func (e *Engine) motionCount(m *Motion) int {
+	if m.Absolute && e.count == 0 && e.opCount == 0 {
+		return 0
+	}
+	return e.operatorCount()
+}
+
+// The region between the cursor and the target of a motion
+func (e *Engine) motionRegion(m *Motion, from, to int) Region {
+	r := e.rope()
+	lo, hi := min(from, to), max(from, to)
+	if m.Linewise {
+		return e.linesBetween(r.LineOfOffset(lo), r.LineOfOffset(hi))
+	}
+	if ch, ok := runeAt(r, hi); m.Inclusive && ok && ch != '\n' {
+		hi = nextCluster(r, hi)
+	}
+	if !m.Inclusive && r.LineOfOffset(hi) > r.LineOfOffset(lo) {
+		if m.word {
+			// "dw" on the last word of a line does not join the next line
+			c := BRope.NewCursor(r, hi)
+			for ch, ok := c.PrevRune(); ok && unicode.IsSpace(ch) && c.Pos() > lo; ch, ok = c.PrevRune() {
+			}
+			hi = lineEnd(r, c.Pos())
+		} else if hi == lineStart(r, hi) {
+			// a motion to the start of a line ends at the end of the line before,
+			// and works on whole lines if it started before the text of its line
+			hi--
+			if lo <= firstNonBlank(r, lo) {
+				return e.linesBetween(r.LineOfOffset(lo), r.LineOfOffset(hi))
+			}
+		}
+	}
+	return Region{Kind: Charwise, Intervals: []BRope.Interval{BRope.IV(lo, hi)}}
+}
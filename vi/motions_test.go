@@ -0,0 +1,132 @@
+package vi
+
+import (
+	BRope "main/brope"
+	Buffer "main/buffer"
+	"main/view"
+	"strings"
+	"testing"
+)
+
+// Lines around the text of a test, long enough to fill a leaf of their own
+var (
+	leafPrefix = strings.Repeat(".", 600) + "\n"
+	leafSuffix = "\n" + strings.Repeat(".", 600)
+)
+
+// Builds a rope of two leaves, the first one ends at split of text. The text is put between lines
+// of padding, so both leaves are long enough.
+func splitRope(text []rune, split int, t *testing.T) BRope.Rope {
+	t.Helper()
+	b := BRope.NewTreeBuilder()
+	b.Push(BRope.NewRope([]rune(leafPrefix + string(text[:split]))))
+	b.Push(BRope.NewRope([]rune(string(text[split:]) + leafSuffix)))
+	rope := b.Build()
+	if rope.Height() != 1 || len(rope.Runes()) != rope.Length() {
+		t.Fatalf("expected a rope of two leaves, got a height of %v", rope.Height())
+	}
+	return rope
+}
+
+// Like expectKeys, but for every offset of text, the keys are fed into a rope with a leaf border at that offset
+func expectKeysAcrossLeaves(text, keys, expected string, t *testing.T) {
+	t.Helper()
+	cursor := max(0, strings.Index(text, "|"))
+	runes := []rune(strings.Replace(text, "|", "", 1))
+	prefix := len([]rune(leafPrefix))
+	for split := 0; split <= len(runes); split++ {
+		rope := splitRope(runes, split, t)
+		editor := view.New(Buffer.NewBuffer("test", rope))
+		editor.SetCursor(prefix + len([]rune(text[:cursor])))
+		e := NewEngine(editor)
+		e.FeedKeys(Keys(keys))
+
+		result := e.rope().Runes()
+		if !strings.HasPrefix(string(result), leafPrefix) || !strings.HasSuffix(string(result), leafSuffix) {
+			t.Fatalf("%q with %q split at %v: the padding was changed", text, keys, split)
+		}
+		result = result[prefix : len(result)-len([]rune(leafSuffix))]
+		pos := editor.Cursor() - prefix
+		if pos < 0 || pos > len(result) {
+			t.Fatalf("%q with %q split at %v: the cursor left the text to %v", text, keys, split, pos)
+		}
+		if got := string(result[:pos]) + "|" + string(result[pos:]); got != expected {
+			t.Fatalf("%q with %q split at %v: expected %q, got %q", text, keys, split, expected, got)
+		}
+	}
+}
+
+func TestWordMotions(t *testing.T) {
+	expectKeysAcrossLeaves("|foo bar", "w", "foo |bar", t)
+	expectKeysAcrossLeaves("|foo.bar baz", "w", "foo|.bar baz", t)
+	expectKeysAcrossLeaves("|foo.bar baz", "W", "foo.bar |baz", t)
+	expectKeysAcrossLeaves("|foo.bar baz", "3w", "foo.bar |baz", t)
+	expectKeysAcrossLeaves("f|oo\n  bar", "w", "foo\n  |bar", t)
+	expectKeysAcrossLeaves("f|oo\n\nbar", "w", "foo\n|\nbar", t)
+	expectKeysAcrossLeaves("f|oo\n\nbar", "2w", "foo\n\n|bar", t)
+	expectKeysAcrossLeaves("f|oo bar", "e", "fo|o bar", t)
+	expectKeysAcrossLeaves("fo|o bar", "e", "foo ba|r", t)
+	expectKeysAcrossLeaves("|a.b c", "E", "a.|b c", t)
+	expectKeysAcrossLeaves("fo|o\n\n bar", "e", "foo\n\n ba|r", t)
+	expectKeysAcrossLeaves("foo ba|r", "b", "foo |bar", t)
+	expectKeysAcrossLeaves("foo |bar", "b", "|foo bar", t)
+	expectKeysAcrossLeaves("foo.bar |baz", "b", "foo.|bar baz", t)
+	expectKeysAcrossLeaves("foo.bar |baz", "B", "|foo.bar baz", t)
+	expectKeysAcrossLeaves("foo\n\n|bar", "b", "foo\n|\nbar", t)
+	expectKeysAcrossLeaves("foo\n  |bar", "b", "|foo\n  bar", t)
+}
+
+func TestWordOperators(t *testing.T) {
+	expectKeysAcrossLeaves("|foo bar", "dw", "|bar", t)
+	expectKeysAcrossLeaves("a |foo\nbar", "dw", "a| \nbar", t)
+	expectKeysAcrossLeaves("a |foo bar\nbaz", "d2w", "a| \nbaz", t)
+	expectKeysAcrossLeaves("|foo bar", "cwx<Esc>", "|x bar", t)
+	expectKeysAcrossLeaves("fo|o bar", "cwx<Esc>", "fo|x bar", t)
+	expectKeysAcrossLeaves("|foo bar baz", "c2wx<Esc>", "|x baz", t)
+	expectKeysAcrossLeaves("|foo  bar", "de", "|  bar", t)
+	expectKeysAcrossLeaves("foo b|ar", "db", "foo |ar", t)
+	expectKeysAcrossLeaves("foo.bar b|az", "dB", "foo.bar |az", t)
+}
+
+func TestParagraphMotions(t *testing.T) {
+	text := "a\n|b\n\nc\nd\n\n\ne"
+	expectKeysAcrossLeaves(text, "}", "a\nb\n|\nc\nd\n\n\ne", t)
+	expectKeysAcrossLeaves(text, "2}", "a\nb\n\nc\nd\n|\n\ne", t)
+	expectKeysAcrossLeaves("a\n\nb\n\n|\nc", "{", "a\n|\nb\n\n\nc", t)
+	expectKeysAcrossLeaves("a\n\nb\nc|c\n\nd", "{", "a\n|\nb\ncc\n\nd", t)
+	expectKeysAcrossLeaves("a\n\n|b\nc\n\nd", "d}", "a\n\n|\nd", t)
+	expectKeysAcrossLeaves("a\n\nb\nc|c\n\nd", "d}", "a\n\nb\n|c\n\nd", t)
+}
+
+func TestMatchMotion(t *testing.T) {
+	expectKeysAcrossLeaves("|f(a, (b)) c", "%", "f(a, (b)|) c", t)
+	expectKeysAcrossLeaves("f(a, (b)|) c", "%", "f|(a, (b)) c", t)
+	expectKeysAcrossLeaves("x |[a\n{\n}] y", "%", "x [a\n{\n}|] y", t)
+	expectKeysAcrossLeaves("x [a\n|{\n}] y", "%", "x [a\n{\n|}] y", t)
+	expectKeysAcrossLeaves("|f(a) b", "d%", "| b", t)
+	expectKeysAcrossLeaves("|f(a b", "%", "|f(a b", t)
+	expectKeysAcrossLeaves("|f a\n(b)", "%", "|f a\n(b)", t)
+}
+
+func TestFindMotions(t *testing.T) {
+	expectKeysAcrossLeaves("|a,b,c,d", "f,", "a|,b,c,d", t)
+	expectKeysAcrossLeaves("|a,b,c,d", "3f,", "a,b,c|,d", t)
+	expectKeysAcrossLeaves("|a,b\n,c", "2f,", "|a,b\n,c", t)
+	expectKeysAcrossLeaves("|a,b,c,d", "2t,", "a,|b,c,d", t)
+	expectKeysAcrossLeaves("a,b,c,|d", "F,", "a,b,c|,d", t)
+	expectKeysAcrossLeaves("a,b,c,|d", "2T,", "a,b,|c,d", t)
+	expectKeysAcrossLeaves("|a,b,c,d", "dt,", "|,b,c,d", t)
+	expectKeysAcrossLeaves("|a,b,c,d", "d2f,", "|c,d", t)
+	expectKeysAcrossLeaves("a,b,c,|d", "dF,", "a,b,c|d", t)
+}
+
+func TestLineJumps(t *testing.T) {
+	expectKeys("a\n  b\nc|c", "gg", "|a\n  b\ncc", t)
+	expectKeys("|a\n  b\ncc", "2gg", "a\n  |b\ncc", t)
+	expectKeys("|a\n  b\ncc", "G", "a\n  b\n|cc", t)
+	expectKeys("|a\n  b\ncc", "2G", "a\n  |b\ncc", t)
+	expectKeys("|a\n  b\ncc", "9G", "a\n  b\n|cc", t)
+	expectKeys("a\n|b\nc\nd", "dG", "|a", t)
+	expectKeys("a\nb\n|c\nd", "dgg", "|d", t)
+	expectKeys("a\nb\nc\n|d", "d2G", "|a", t)
+}
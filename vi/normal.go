@@ -0,0 +1,445 @@
+package vi
+
+import (
+	BRope "main/brope"
+	Buffer "main/buffer"
+	"strings"
+)
+
+// Registers vi's motions, operators and commands
+func (e *Engine) registerDefaults() {
+	e.addMotion(leftMotion, "h", "<Left>", "<BS>")
+	e.addMotion(rightMotion, "l", "<Right>", "<Space>")
+	e.addMotion(upMotion, "k", "<Up>")
+	e.addMotion(downMotion, "j", "<Down>")
+	e.addMotion(&Motion{Move: e.moveRows(-1)}, "gk", "g<Up>")
+	e.addMotion(&Motion{Move: e.moveRows(1)}, "gj", "g<Down>")
+	e.addMotion(lineStartMotion, "0", "<Home>")
+	e.addMotion(firstNonBlankMotion, "^")
+	e.addMotion(lineEndMotion, "$", "<End>")
+	e.addMotion(wordMotion, "w")
+	e.addMotion(bigWordMotion, "W")
+	e.addMotion(wordEndMotion, "e")
+	e.addMotion(bigWordEndMotion, "E")
+	e.addMotion(wordBackMotion, "b")
+	e.addMotion(bigWordBackMotion, "B")
+	e.addMotion(paragraphMotion, "}")
+	e.addMotion(paragraphBackMotion, "{")
+	e.addMotion(matchMotion, "%")
+	e.addMotion(findMotion, "f")
+	e.addMotion(findBackMotion, "F")
+	e.addMotion(tillMotion, "t")
+	e.addMotion(tillBackMotion, "T")
+	e.addMotion(firstLineMotion, "gg")
+	e.addMotion(lastLineMotion, "G")
+	e.registerTextObjects()
+	e.registerMacros()
+	e.registerMarks()
+	e.registerSelections()
+
+	for _, op := range []*operator{deleteOperator, changeOperator, yankOperator, shiftRightOperator, shiftLeftOperator, lowerOperator, upperOperator, toggleOperator} {
+		e.normalKeys.add(op.keys, &binding{operator: op})
+		e.visualKeys.add(op.keys, &binding{operator: op})
+	}
+
+	e.addAction(Normal, "i", true, func(e *Engine, count int, _ rune) {
+		e.enterInsert(Insert, count, "")
+	})
+	e.addAction(Normal, "<Insert>", true, func(e *Engine, count int, _ rune) {
+		e.enterInsert(Insert, count, "")
+	})
+	e.addAction(Normal, "a", true, func(e *Engine, count int, _ rune) {
+		r := e.rope()
+		e.moveCursors(func(cursor int) int {
+			if cursor < lineEnd(r, cursor) {
+				return nextCluster(r, cursor)
+			}
+			return cursor
+		})
+		e.enterInsert(Insert, count, "")
+	})
+	e.addAction(Normal, "I", true, func(e *Engine, count int, _ rune) {
+		r := e.rope()
+		e.moveCursors(func(cursor int) int { return firstNonBlank(r, cursor) })
+		e.enterInsert(Insert, count, "")
+	})
+	e.addAction(Normal, "A", true, func(e *Engine, count int, _ rune) {
+		r := e.rope()
+		e.moveCursors(func(cursor int) int { return lineEnd(r, cursor) })
+		e.enterInsert(Insert, count, "")
+	})
+	e.addAction(Normal, "o", true, func(e *Engine, count int, _ rune) {
+		r := e.rope()
+		e.editCursors(func(cursor int) (BRope.Interval, []rune, bool) {
+			end := lineEnd(r, cursor)
+			return BRope.IV(end, end), []rune{'\n'}, true
+		})
+		e.enterInsert(Insert, count, "<CR>")
+	})
+	e.addAction(Normal, "O", true, func(e *Engine, count int, _ rune) {
+		r := e.rope()
+		e.editCursors(func(cursor int) (BRope.Interval, []rune, bool) {
+			start := lineStart(r, cursor)
+			return BRope.IV(start, start), []rune{'\n'}, true
+		})
+		e.moveCursors(func(cursor int) int { return cursor - 1 })
+		e.enterInsert(Insert, count, "<CR>")
+	})
+	e.addAction(Normal, "R", true, func(e *Engine, count int, _ rune) {
+		// the runes replace mode overwrites are restored by backspace, which is only done for the cursor
+		e.selections().Clear()
+		e.enterInsert(Replace, count, "")
+	})
+	e.addCharAction(Normal, "r", true, (*Engine).replaceChars)
+	e.addAction(Normal, "J", true, func(e *Engine, count int, _ rune) {
+		e.join(count)
+	})
+	e.addAction(Normal, "~", true, func(e *Engine, count int, _ rune) {
+		e.toggleChars(count)
+	})
+
+	e.addAlias(Normal, "x", "dl", true)
+	e.addAlias(Normal, "<Del>", "dl", true)
+	e.addAlias(Normal, "X", "dh", true)
+	e.addAlias(Normal, "D", "d$", true)
+	e.addAlias(Normal, "C", "c$", true)
+	e.addAlias(Normal, "s", "cl", true)
+	e.addAlias(Normal, "S", "cc", true)
+	e.addAlias(Normal, "Y", "yy", false)
+
+	for keys, put := range map[string]struct{ before, cursorAfter bool }{"p": {}, "P": {before: true}, "gp": {cursorAfter: true}, "gP": {true, true}} {
+		put := put
+		e.addAction(Normal, keys, true, func(e *Engine, count int, _ rune) {
+			if reg, ok := e.registers.Get(e.registerName()); ok {
+				e.put(reg, count, put.before, put.cursorAfter)
+			}
+		})
+	}
+	e.addAction(Normal, "u", false, func(e *Engine, count int, _ rune) {
+		e.undo(count, e.buffer().Undo)
+	})
+	e.addAction(Normal, "<C-r>", false, func(e *Engine, count int, _ rune) {
+		e.undo(count, e.buffer().Redo)
+	})
+	e.addAction(Normal, ".", false, func(e *Engine, count int, _ rune) {
+		e.repeat(count)
+	})
+
+	for keys, mode := range map[string]Mode{"v": Visual, "V": VisualLine, "<C-v>": VisualBlock} {
+		mode := mode
+		toggle := func(e *Engine, _ int, _ rune) {
+			e.toggleVisual(mode)
+		}
+		e.addAction(Normal, keys, false, toggle)
+		e.addAction(Visual, keys, false, toggle)
+	}
+	e.addAction(Visual, "o", false, func(e *Engine, _ int, _ rune) {
+		start := e.visualStart
+		e.visualStart = e.cursor()
+		e.setCursor(start)
+		sels := e.selections().All()
+		for i := range sels {
+			sels[i].Anchor, sels[i].Head = sels[i].Head, sels[i].Anchor
+		}
+		e.setSelections(sels)
+	})
+	e.addAlias(Visual, "x", "d", false)
+	e.addAlias(Visual, "<Del>", "d", false)
+	e.addAlias(Visual, "s", "c", false)
+	e.addAlias(Visual, "u", "gu", false)
+	e.addAlias(Visual, "U", "gU", false)
+	e.addAlias(Visual, "~", "g~", false)
+	e.addAction(Visual, "J", false, func(e *Engine, _ int, _ rune) {
+		r := e.rope()
+		first, last := r.LineOfOffset(min(e.visualStart, e.cursor())), r.LineOfOffset(max(e.visualStart, e.cursor()))
+		e.mode = Normal
+		e.beginChange()
+		e.setCursor(r.OffsetOfLine(first))
+		e.join(last - first + 1)
+	})
+	e.addCharAction(Visual, "r", false, func(e *Engine, _ int, ch rune) {
+		region := e.selection()
+		e.mode = Normal
+		e.beginChange()
+		e.mapCase(region, func(r rune) rune {
+			if r == '\n' {
+				return r
+			}
+			return ch
+		})
+	})
+	e.addAction(Visual, "p", false, func(e *Engine, count int, _ rune) {
+		e.putOverSelection(count)
+	})
+	e.addAction(Visual, "P", false, func(e *Engine, count int, _ rune) {
+		e.putOverSelection(count)
+	})
+	e.addAction(Visual, "I", false, func(e *Engine, _ int, _ rune) {
+		e.insertAtSelection(false)
+	})
+	e.addAction(Visual, "A", false, func(e *Engine, _ int, _ rune) {
+		e.insertAtSelection(true)
+	})
+}
+
+func (e *Engine) addMotion(m *Motion, keys ...string) {
+	for _, k := range keys {
+		for _, km := range []*keymap{e.normalKeys, e.visualKeys, e.pendingKeys} {
+			km.add(Keys(k), &binding{motion: m, takesChar: m.TakesChar})
+		}
+	}
+}
+
+func (e *Engine) addAction(mode Mode, keys string, change bool, action func(e *Engine, count int, arg rune)) {
+	e.keymap(mode).add(Keys(keys), &binding{action: action, change: change})
+}
+
+// Adds an action that is followed by a character, like "r"
+func (e *Engine) addCharAction(mode Mode, keys string, change bool, action func(e *Engine, count int, arg rune)) {
+	e.keymap(mode).add(Keys(keys), &binding{action: action, change: change, takesChar: true})
+}
+
+// Adds keys that do the same as other keys, like "x" for "dl". The count is passed on.
+func (e *Engine) addAlias(mode Mode, keys string, to string, change bool) {
+	e.addAction(mode, keys, change, func(e *Engine, count int, _ rune) {
+		e.count = count
+		e.alias(to)
+	})
+}
+
+func (e *Engine) toggleVisual(mode Mode) {
+	if e.mode == mode {
+		e.mode = Normal
+		return
+	}
+	if !e.mode.IsVisual() {
+		e.visualStart = e.cursor()
+	}
+	if mode == VisualBlock {
+		// a block already has a selection in each of its lines
+		e.selections().Clear()
+	}
+	e.mode = mode
+}
+
+// Starts insert mode before or after the selection. In visual block mode, the typed text
+// is inserted into every line of the block.
+func (e *Engine) insertAtSelection(after bool) {
+	region := e.selection()
+	others := e.otherRegions(func(sel Buffer.Selection) Region {
+		return e.selectionRegion(sel.Anchor, sel.Head)
+	})
+	mode := e.mode
+	e.mode = Normal
+	e.change.fromVisual = true
+	e.beginChange()
+	first, last := region.Intervals[0], region.Intervals[len(region.Intervals)-1]
+	switch {
+	case mode == VisualBlock:
+		r := e.rope()
+		col := first.Lo - lineStart(r, first.Lo)
+		if after {
+			col = first.Hi - lineStart(r, first.Hi)
+		}
+		e.startBlockInsert(r.LineOfOffset(first.Lo), len(region.Intervals), col)
+	case after:
+		cursors := []int{last.Hi}
+		for _, other := range others {
+			cursors = append(cursors, other.Intervals[len(other.Intervals)-1].Hi)
+		}
+		e.setCursors(cursors)
+		e.enterInsert(Insert, 1, "")
+	default:
+		cursors := []int{first.Lo}
+		for _, other := range others {
+			cursors = append(cursors, other.Intervals[0].Lo)
+		}
+		e.setCursors(cursors)
+		e.enterInsert(Insert, 1, "")
+	}
+}
+
+// Replaces count runes with ch, if the line has enough of them
+func (e *Engine) replaceChars(count int, ch rune) {
+	count = max(1, count)
+	cursor := e.cursor()
+	if cursor+count > lineEnd(e.rope(), cursor) {
+		return
+	}
+	text := make([]rune, count)
+	for i := range text {
+		text[i] = ch
+	}
+	e.edit(BRope.IV(cursor, cursor+count), text)
+	e.setCursor(cursor + count - 1)
+}
+
+// Toggles the case of count runes and moves behind them
+func (e *Engine) toggleChars(count int) {
+	cursor := e.cursor()
+	end := min(cursor+max(1, count), lineEnd(e.rope(), cursor))
+	if end > cursor {
+		e.mapCase(Region{Kind: Charwise, Intervals: []BRope.Interval{BRope.IV(cursor, end)}}, toggleCase)
+	}
+	e.setCursor(end)
+}
+
+// Joins count lines, at least two, starting with the line of the cursor. The newline and the indentation
+// of each joined line are replaced by a single space.
+func (e *Engine) join(count int) {
+	r := e.rope()
+	line := r.LineOfOffset(e.cursor())
+	last := min(line+max(count, 2)-1, r.LineCount()-1)
+
+	ivs, texts := []BRope.Interval{}, [][]rune{}
+	after, shift := e.cursor(), 0
+	for l := line; l < last; l++ {
+		newline := r.OffsetOfLine(l+1) - 1
+		next := firstNonBlank(r, newline+1)
+		separator := []rune{' '}
+		if ch, ok := runeAt(r, next); !ok || ch == '\n' || ch == ')' {
+			separator = nil
+		}
+		if prev, _ := runeAt(r, newline-1); newline == lineStart(r, newline) || prev == ' ' || prev == '\t' {
+			separator = nil
+		}
+		ivs, texts = append(ivs, BRope.IV(newline, next)), append(texts, separator)
+		after = newline + shift
+		shift += len(separator) - (next - newline)
+	}
+	if len(ivs) == 0 {
+		return
+	}
+	e.editAll(ivs, texts, after)
+	e.setCursor(after)
+}
+
+// Undoes or redoes count times
+func (e *Engine) undo(count int, undo func() (int, bool)) {
+	for i := 0; i < max(1, count); i++ {
+		cursor, ok := undo()
+		if !ok {
+			return
+		}
+		e.setCursor(cursor)
+	}
+}
+
+// The register of the command, the unnamed one if none was typed
+func (e *Engine) registerName() rune {
+	if e.register == 0 {
+		return '"'
+	}
+	return e.register
+}
+
+// Inserts the register count times after the cursor, or before it. Lines are inserted below or above
+// the line of the cursor, and the lines of a block into the lines from the cursor on at its column.
+// The cursor ends up on the last inserted rune or the first inserted line, or behind the text for cursorAfter.
+func (e *Engine) put(reg Register, count int, before, cursorAfter bool) {
+	r := e.rope()
+	cursor := e.cursor()
+	text := strings.Repeat(reg.String(), max(1, count))
+	switch reg.Kind {
+	case Linewise:
+		line := r.LineOfOffset(cursor)
+		pos := r.OffsetOfLine(line)
+		if !before && line == r.LineCount()-1 {
+			// the last line has no newline to insert after
+			pos = r.Length()
+			text = "\n" + strings.TrimSuffix(text, "\n")
+		} else if !before {
+			pos = r.OffsetOfLine(line + 1)
+		}
+		end := e.edit(BRope.IV(pos, pos), []rune(text))
+		if pos == r.Length() && !before {
+			pos++
+		}
+		if cursorAfter {
+			e.setCursor(end)
+		} else {
+			e.setCursor(firstNonBlank(e.rope(), pos))
+		}
+	case Blockwise:
+		e.putBlock(reg, count, before, cursorAfter)
+	default:
+		pos := cursor
+		if ch, ok := runeAt(r, cursor); !before && ok && ch != '\n' {
+			pos++
+		}
+		end := e.edit(BRope.IV(pos, pos), []rune(text))
+		if cursorAfter {
+			e.setCursor(end)
+		} else {
+			e.setCursor(end - 1)
+		}
+	}
+}
+
+// Inserts the lines of a block at the column of the cursor, each one repeated count times.
+// Lines that are too short are filled up with spaces, unless the line of the block is empty,
+// and missing lines are appended.
+func (e *Engine) putBlock(reg Register, count int, before, cursorAfter bool) {
+	r := e.rope()
+	cursor := e.cursor()
+	start := lineStart(r, cursor)
+	col := cursor - start
+	if !before && cursor < lineEnd(r, cursor) {
+		col++
+	}
+	first := r.LineOfOffset(cursor)
+	ivs, texts := []BRope.Interval{}, [][]rune{}
+	appended := ""
+	width := 0
+	for i, line := range strings.Split(reg.String(), "\n") {
+		line = strings.Repeat(line, max(1, count))
+		width = max(width, len([]rune(line)))
+		if first+i >= r.LineCount() {
+			appended += "\n"
+			if line != "" {
+				appended += strings.Repeat(" ", col) + line
+			}
+			continue
+		}
+		if line == "" {
+			continue
+		}
+		lineStart := r.OffsetOfLine(first + i)
+		length := lineEnd(r, lineStart) - lineStart
+		padding := strings.Repeat(" ", max(0, col-length))
+		pos := lineStart + min(col, length)
+		ivs, texts = append(ivs, BRope.IV(pos, pos)), append(texts, []rune(padding+line))
+	}
+	if n := len(ivs); appended != "" && n > 0 && ivs[n-1].Lo == r.Length() {
+		texts[n-1] = append(texts[n-1], []rune(appended)...)
+	} else if appended != "" {
+		ivs, texts = append(ivs, BRope.IV(r.Length(), r.Length())), append(texts, []rune(appended))
+	}
+	e.editAll(ivs, texts, start+col)
+	if cursorAfter {
+		e.setCursor(start + col + width)
+	} else {
+		e.setCursor(start + col)
+	}
+}
+
+// Replaces the selection with the register, the replaced text goes into the unnamed register
+func (e *Engine) putOverSelection(count int) {
+	reg, ok := e.registers.Get(e.registerName())
+	if !ok {
+		return
+	}
+	region := e.selection()
+	e.mode = Normal
+	e.change.fromVisual = true
+	e.beginChange()
+	last := region.Intervals[len(region.Intervals)-1]
+	atEnd := region.Kind == Linewise && last.Hi == e.rope().Length()
+	e.setCursor(min(e.cursor(), e.visualStart))
+	e.register = 0
+	e.delete(region)
+	if region.Kind == Linewise && reg.Kind == Charwise {
+		reg = Register{Text: BRope.NewRopeString(reg.String() + "\n"), Kind: Linewise}
+	}
+	e.put(reg, count, !atEnd, false)
+}
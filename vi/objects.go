@@ -0,0 +1,358 @@
+package vi
+
+import (
+	BRope "main/brope"
+	Buffer "main/buffer"
+	"strings"
+	"unicode"
+)
+
+// A textObject selects text around the cursor, like the word of "iw". In visual mode it replaces
+// the selection, after an operator it is the region the operator works on.
+type textObject struct {
+	// returns the interval of count objects around offset
+	selectAt func(r BRope.Rope, offset, count int) (BRope.Interval, bool)
+	// the interval consists of whole lines
+	linewise bool
+}
+
+func (e *Engine) registerTextObjects() {
+	objects := map[string]*textObject{
+		"iw": {selectAt: wordObject(false, false)},
+		"aw": {selectAt: wordObject(false, true)},
+		"iW": {selectAt: wordObject(true, false)},
+		"aW": {selectAt: wordObject(true, true)},
+		"it": {selectAt: tagObject(false)},
+		"at": {selectAt: tagObject(true)},
+		"ip": {selectAt: paragraphObject(false), linewise: true},
+		"ap": {selectAt: paragraphObject(true), linewise: true},
+	}
+	for _, quote := range []string{`"`, "'", "`"} {
+		objects["i"+quote] = &textObject{selectAt: quoteObject([]rune(quote)[0], false)}
+		objects["a"+quote] = &textObject{selectAt: quoteObject([]rune(quote)[0], true)}
+	}
+	for _, pair := range []struct{ keys, brackets string }{
+		{"(", "()"}, {")", "()"}, {"b", "()"},
+		{"[", "[]"}, {"]", "[]"},
+		{"{", "{}"}, {"}", "{}"}, {"B", "{}"},
+		{"<lt>", "<>"}, {">", "<>"},
+	} {
+		open, close := rune(pair.brackets[0]), rune(pair.brackets[1])
+		objects["i"+pair.keys] = &textObject{selectAt: bracketObject(open, close, false)}
+		objects["a"+pair.keys] = &textObject{selectAt: bracketObject(open, close, true)}
+	}
+
+	for keys, object := range objects {
+		e.visualKeys.add(Keys(keys), &binding{object: object})
+		e.pendingKeys.add(Keys(keys), &binding{object: object})
+	}
+}
+
+func (e *Engine) selectObject(object *textObject) {
+	r := e.rope()
+	if e.mode == OperatorPending {
+		count := e.operatorCount()
+		region, ok := object.region(r, e.cursor(), count)
+		if !ok {
+			e.cancel()
+			return
+		}
+		e.setCursor(region.Intervals[0].Lo)
+		e.applyOperator(region, func(sel Buffer.Selection) Region {
+			region, _ := object.region(r, sel.Head, count)
+			return region
+		})
+		return
+	}
+	if iv, ok := object.selectAt(r, e.cursor(), max(1, e.count)); ok && !iv.IsEmpty() {
+		e.visualStart = iv.Lo
+		e.setCursor(iv.Hi - 1)
+		if object.linewise && e.mode == Visual {
+			e.mode = VisualLine
+		}
+	}
+	e.finish(false)
+}
+
+// The region of count objects around offset, an empty one at offset if there are none
+func (object *textObject) region(r BRope.Rope, offset, count int) (Region, bool) {
+	iv, ok := object.selectAt(r, offset, count)
+	if !ok {
+		return Region{Kind: Charwise, Intervals: []BRope.Interval{BRope.IV(offset, offset)}}, false
+	}
+	region := Region{Kind: Charwise, Intervals: []BRope.Interval{iv}}
+	if object.linewise {
+		region.Kind = Linewise
+	}
+	return region, true
+}
+
+// Words for "iw", or words with the blanks after them for "aw". Without blanks after the last word,
+// the blanks before the first one are selected instead. The blanks between words count as words for "iw".
+func wordObject(big, around bool) func(BRope.Rope, int, int) (BRope.Interval, bool) {
+	return func(r BRope.Rope, offset, count int) (BRope.Interval, bool) {
+		if ch, ok := runeAt(r, offset); !ok || ch == '\n' {
+			return BRope.IV(offset, offset), false
+		}
+		lo, hi := runStart(r, offset, big), offset
+		trailingBlanks := false
+		for i := 0; i < count && hi < lineEnd(r, hi); i++ {
+			ch, _ := runeAt(r, hi)
+			hi = runEnd(r, hi, big)
+			if !around {
+				continue
+			}
+			next, _ := runeAt(r, hi)
+			if isBlank(ch) {
+				// blanks and the word after them
+				hi = runEnd(r, hi, big)
+			} else if isBlank(next) {
+				hi = runEnd(r, hi, big)
+				trailingBlanks = true
+			}
+		}
+		if start, _ := runeAt(r, lo); around && !trailingBlanks && !isBlank(start) {
+			if prev, ok := runeAt(r, lo-1); ok && isBlank(prev) {
+				lo = runStart(r, lo-1, big)
+			}
+		}
+		return BRope.IV(lo, hi), true
+	}
+}
+
+// The quoted text of the line around offset or after it, for "a" with the quotes and the blanks after them.
+// Quotes escaped by a backslash do not count.
+func quoteObject(quote rune, around bool) func(BRope.Rope, int, int) (BRope.Interval, bool) {
+	return func(r BRope.Rope, offset, _ int) (BRope.Interval, bool) {
+		quotes := []int{}
+		c := BRope.NewCursor(r, lineStart(r, offset))
+		escaped := false
+		for ch, ok := c.PeekRune(); ok && ch != '\n'; ch, ok = c.PeekRune() {
+			if ch == quote && !escaped {
+				quotes = append(quotes, c.Pos())
+			}
+			escaped = ch == '\\' && !escaped
+			c.NextRune()
+		}
+		for i := 0; i+1 < len(quotes); i += 2 {
+			open, close := quotes[i], quotes[i+1]
+			if close < offset {
+				continue
+			}
+			if !around {
+				return BRope.IV(open+1, close), true
+			}
+			lo, hi := open, close+1
+			if next, _ := runeAt(r, hi); isBlank(next) {
+				hi = runEnd(r, hi, false)
+			} else if prev, ok := runeAt(r, lo-1); ok && isBlank(prev) {
+				lo = runStart(r, lo-1, false)
+			}
+			return BRope.IV(lo, hi), true
+		}
+		return BRope.IV(offset, offset), false
+	}
+}
+
+// The text inside of the count-th pair of brackets around offset, for "a" including the brackets.
+// If the brackets are on lines of their own, the inside is the lines between them.
+func bracketObject(open, close rune, around bool) func(BRope.Rope, int, int) (BRope.Interval, bool) {
+	return func(r BRope.Rope, offset, count int) (BRope.Interval, bool) {
+		lo, ok := enclosingBracket(r, offset, open, close, count)
+		if !ok {
+			return BRope.IV(offset, offset), false
+		}
+		hi, ok := matchBracket(r, lo, open, close)
+		if !ok {
+			return BRope.IV(offset, offset), false
+		}
+		if around {
+			return BRope.IV(lo, hi+1), true
+		}
+		lo++
+		if ch, _ := runeAt(r, lo); ch == '\n' {
+			lo++
+		}
+		if start := lineStart(r, hi); start > lo && firstNonBlank(r, start) == hi {
+			hi = start
+		}
+		return BRope.IV(lo, max(lo, hi)), true
+	}
+}
+
+// Offset of the count-th opening bracket around offset that is not closed before it. A bracket
+// at offset belongs to the pair it is a part of.
+func enclosingBracket(r BRope.Rope, offset int, open, close rune, count int) (int, bool) {
+	start := offset
+	if ch, ok := runeAt(r, offset); ok && ch == open {
+		start++
+	}
+	c := BRope.NewCursor(r, start)
+	depth := 0
+	for {
+		ch, ok := c.PrevRune()
+		if !ok {
+			return offset, false
+		}
+		switch {
+		case ch == close && c.Pos() != offset:
+			depth++
+		case ch == open && depth > 0:
+			depth--
+		case ch == open:
+			if count--; count == 0 {
+				return c.Pos(), true
+			}
+		}
+	}
+}
+
+// A tag like <a href="x">, </a> or <br/>
+type tag struct {
+	name                 string
+	closing, selfClosing bool
+	// from the '<' to behind the '>'
+	iv BRope.Interval
+}
+
+// Parses the tag starting at the '<' at offset
+func tagAt(r BRope.Rope, offset int) (tag, bool) {
+	c := BRope.NewCursor(r, offset)
+	if ch, ok := c.NextRune(); !ok || ch != '<' {
+		return tag{}, false
+	}
+	var text strings.Builder
+	for {
+		ch, ok := c.NextRune()
+		if !ok || ch == '<' {
+			return tag{}, false
+		}
+		if ch == '>' {
+			break
+		}
+		text.WriteRune(ch)
+	}
+	content := text.String()
+	t := tag{iv: BRope.IV(offset, c.Pos())}
+	t.closing = strings.HasPrefix(content, "/")
+	t.selfClosing = strings.HasSuffix(content, "/")
+	fields := strings.FieldsFunc(content, func(r rune) bool { return unicode.IsSpace(r) || r == '/' })
+	if len(fields) == 0 {
+		return tag{}, false
+	}
+	t.name = fields[0]
+	return t, true
+}
+
+// The contents of the count-th element around offset, for "at" including its tags
+func tagObject(around bool) func(BRope.Rope, int, int) (BRope.Interval, bool) {
+	return func(r BRope.Rope, offset, count int) (BRope.Interval, bool) {
+		// inside of a tag, the element of the tag is selected
+		start := offset
+		if t, ok := tagAround(r, offset); ok {
+			start = t.iv.Lo
+			if !t.closing {
+				start = t.iv.Hi
+			}
+		}
+
+		// find the opening tag that is not closed before the start
+		closed := []string{}
+		c := BRope.NewCursor(r, start)
+		var open tag
+		for count > 0 {
+			ch, ok := c.PrevRune()
+			if !ok {
+				return BRope.IV(offset, offset), false
+			}
+			if ch != '<' {
+				continue
+			}
+			t, ok := tagAt(r, c.Pos())
+			if !ok || t.iv.Hi > start || t.selfClosing {
+				continue
+			}
+			if t.closing {
+				closed = append(closed, t.name)
+			} else if n := len(closed); n > 0 && closed[n-1] == t.name {
+				closed = closed[:n-1]
+			} else if count--; count == 0 {
+				open = t
+			}
+		}
+
+		// and its closing tag
+		depth := 0
+		c.Set(open.iv.Hi)
+		for {
+			ch, ok := c.NextRune()
+			if !ok {
+				return BRope.IV(offset, offset), false
+			}
+			if ch != '<' {
+				continue
+			}
+			t, ok := tagAt(r, c.Pos()-1)
+			if !ok || t.name != open.name || t.selfClosing {
+				continue
+			}
+			if !t.closing {
+				depth++
+			} else if depth > 0 {
+				depth--
+			} else if around {
+				return BRope.IV(open.iv.Lo, t.iv.Hi), true
+			} else {
+				return BRope.IV(open.iv.Hi, t.iv.Lo), true
+			}
+		}
+	}
+}
+
+// The tag that contains offset, if there is one in the line
+func tagAround(r BRope.Rope, offset int) (tag, bool) {
+	c := BRope.NewCursor(r, offset+1)
+	for {
+		ch, ok := c.PrevRune()
+		if !ok || ch == '\n' || ch == '>' && c.Pos() != offset {
+			return tag{}, false
+		}
+		if ch == '<' {
+			t, ok := tagAt(r, c.Pos())
+			return t, ok && t.iv.Hi > offset
+		}
+	}
+}
+
+// Lines of count paragraphs for "ip", blank lines between paragraphs count as paragraphs too.
+// For "ap", each paragraph is selected with the blank lines after it, or before it if there are none after.
+func paragraphObject(around bool) func(BRope.Rope, int, int) (BRope.Interval, bool) {
+	return func(r BRope.Rope, offset, count int) (BRope.Interval, bool) {
+		lines := r.LineCount()
+		first := r.LineOfOffset(offset)
+		blank := isBlankLine(r, first)
+		for first > 0 && isBlankLine(r, first-1) == blank {
+			first--
+		}
+		// the line after the last one selected so far
+		next := first
+		// runs of lines that are blank or not
+		runs := count
+		if around {
+			runs = 2 * count
+		}
+		for i := 0; i < runs && next < lines; i++ {
+			blank := isBlankLine(r, next)
+			for next < lines && isBlankLine(r, next) == blank {
+				next++
+			}
+		}
+		if around && !isBlankLine(r, first) && !isBlankLine(r, next-1) {
+			// no blank lines after the paragraph
+			for first > 0 && isBlankLine(r, first-1) {
+				first--
+			}
+		}
+		return BRope.IV(r.OffsetOfLine(first), r.OffsetOfLine(next)), true
+	}
+}
@@ -0,0 +1,65 @@
+package vi
+
+import (
+	"testing"
+)
+
+func TestWordObjects(t *testing.T) {
+	expectKeysAcrossLeaves("foo b|ar baz", "diw", "foo | baz", t)
+	expectKeysAcrossLeaves("foo b|ar baz", "daw", "foo |baz", t)
+	expectKeysAcrossLeaves("foo bar b|az", "daw", "foo ba|r", t)
+	expectKeysAcrossLeaves("foo | bar", "diw", "foo|bar", t)
+	expectKeysAcrossLeaves("foo | bar", "daw", "fo|o", t)
+	expectKeysAcrossLeaves("f|oo.bar baz", "diw", "|.bar baz", t)
+	expectKeysAcrossLeaves("f|oo.bar baz", "diW", "| baz", t)
+	expectKeysAcrossLeaves("|foo bar baz", "d3iw", "| baz", t)
+	expectKeysAcrossLeaves("|foo bar baz", "d2aw", "|baz", t)
+	expectKeysAcrossLeaves("a\n|foo\nb", "ciwx<Esc>", "a\n|x\nb", t)
+	expectKeysAcrossLeaves("foo b|ar baz", "viwd", "foo | baz", t)
+}
+
+func TestQuoteObjects(t *testing.T) {
+	expectKeysAcrossLeaves(`x = "a |b" + "c"`, `di"`, `x = "|" + "c"`, t)
+	expectKeysAcrossLeaves(`x = "a |b" + "c"`, `da"`, `x = |+ "c"`, t)
+	expectKeysAcrossLeaves(`x = "a b" + |"c"`, `di"`, `x = "a b" + "|"`, t)
+	expectKeysAcrossLeaves(`x = "a b" + |"c"`, `da"`, `x = "a b" |+`, t)
+	expectKeysAcrossLeaves(`|x = "a \"b\""`, `di"`, `x = "|"`, t)
+	expectKeysAcrossLeaves(`|x = 'a'`, `ci'b<Esc>`, `x = '|b'`, t)
+	expectKeysAcrossLeaves("|x = \"a\nb\"", `di"`, "|x = \"a\nb\"", t)
+}
+
+func TestBracketObjects(t *testing.T) {
+	expectKeysAcrossLeaves("f(a, g(|b), c)", "di(", "f(a, g(|), c)", t)
+	expectKeysAcrossLeaves("f(a, g(|b), c)", "d2i(", "f(|)", t)
+	expectKeysAcrossLeaves("f(a, g(b)|, c)", "da(", "|f", t)
+	expectKeysAcrossLeaves("f(a, g|(b), c)", "dib", "f(a, g(|), c)", t)
+	expectKeysAcrossLeaves("f(a, g(b|), c)", "dab", "f(a, g|, c)", t)
+	expectKeysAcrossLeaves("if x {\n\ta|()\n\tb\n}", "di{", "if x {\n|}", t)
+	expectKeysAcrossLeaves("if x {\n\ta|()\n\tb\n}", "da}", "if x| ", t)
+	expectKeysAcrossLeaves("[a, |b]", "ci]x<Esc>", "[|x]", t)
+	expectKeysAcrossLeaves("<a, |b>", "di<lt>", "<|>", t)
+	expectKeysAcrossLeaves("|f(a)", "di(", "|f(a)", t)
+}
+
+func TestTagObjects(t *testing.T) {
+	html := "<div class=\"x\"><p>a <b>b|c</b></p><br/></div>"
+	expectKeysAcrossLeaves(html, "dit", "<div class=\"x\"><p>a <b>|</b></p><br/></div>", t)
+	expectKeysAcrossLeaves(html, "dat", "<div class=\"x\"><p>a |</p><br/></div>", t)
+	expectKeysAcrossLeaves(html, "d2it", "<div class=\"x\"><p>|</p><br/></div>", t)
+	expectKeysAcrossLeaves(html, "d3it", "<div class=\"x\">|</div>", t)
+	expectKeysAcrossLeaves("<a><a>x</a>|y</a>", "dit", "<a>|</a>", t)
+	expectKeysAcrossLeaves("<a>x<|/a>", "dit", "<a>|</a>", t)
+	expectKeysAcrossLeaves("<a|>x</a>", "dat", "|", t)
+	expectKeysAcrossLeaves("|<a>x", "dit", "|<a>x", t)
+}
+
+func TestParagraphObjects(t *testing.T) {
+	text := "\na\nb|\n\n\nc\nd\n\ne\n"
+	expectKeysAcrossLeaves(text, "dip", "\n|\n\nc\nd\n\ne\n", t)
+	expectKeysAcrossLeaves(text, "dap", "\n|c\nd\n\ne\n", t)
+	expectKeysAcrossLeaves(text, "d3ip", "\n|\ne\n", t)
+	expectKeys("a\n\n|c\nd", "dap", "|a", t)
+	expectKeys("|a\nb\n", "yap", "|a\nb\n", t)
+	expectKeysAcrossLeaves("a\n \n\t|\nc", "dip", "a\n|c", t)
+	expectKeysAcrossLeaves("a\n\n|b\nc\n\nd", "vipd", "a\n\n|\nd", t)
+}
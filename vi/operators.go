@@ -0,0 +1,283 @@
+package vi
+
+import (
+	BRope "main/brope"
+	Buffer "main/buffer"
+	"strings"
+	"unicode"
+)
+
+type RegionKind int
+
+const (
+	Charwise RegionKind = iota
+	Linewise
+	Blockwise
+)
+
+// A Region is the text an operator works on
+type Region struct {
+	Kind RegionKind
+	// a single interval, blockwise regions have one per line. Linewise regions include the last newline.
+	Intervals []BRope.Interval
+}
+
+// An operator like "d" works on the region of a motion, of a selection or on lines if it is doubled
+type operator struct {
+	keys  []Key
+	apply func(e *Engine, r Region)
+	// works on the regions of all selections in one edit, the first one is the primary selection's.
+	// Operators without it only work on the primary selection.
+	applyAll func(e *Engine, regions []Region)
+	change   bool
+}
+
+// Returns whether keys are the doubled operator, like "dd", "gugu" or "guu", or a prefix of it
+func (op *operator) matchDouble(keys []Key) (match bool, prefix bool) {
+	doubles := [][]Key{op.keys}
+	if len(op.keys) == 2 {
+		doubles = append(doubles, op.keys[1:])
+	}
+	for _, double := range doubles {
+		if len(keys) <= len(double) && KeysString(keys) == KeysString(double[:len(keys)]) {
+			if len(keys) == len(double) {
+				return true, true
+			}
+			prefix = true
+		}
+	}
+	return false, prefix
+}
+
+var (
+	deleteOperator     = &operator{keys: Keys("d"), apply: (*Engine).delete, applyAll: (*Engine).deleteRegions, change: true}
+	changeOperator     = &operator{keys: Keys("c"), apply: (*Engine).changeRegion, applyAll: (*Engine).changeRegions, change: true}
+	yankOperator       = &operator{keys: Keys("y"), apply: (*Engine).yankRegion, applyAll: (*Engine).yankRegions}
+	shiftRightOperator = &operator{keys: Keys(">"), apply: func(e *Engine, r Region) { e.shift(r, true) }, change: true}
+	shiftLeftOperator  = &operator{keys: Keys("<lt>"), apply: func(e *Engine, r Region) { e.shift(r, false) }, change: true}
+	lowerOperator      = caseOperator("gu", unicode.ToLower)
+	upperOperator      = caseOperator("gU", unicode.ToUpper)
+	toggleOperator     = caseOperator("g~", toggleCase)
+)
+
+func caseOperator(keys string, mapping func(rune) rune) *operator {
+	return &operator{
+		keys:     Keys(keys),
+		apply:    func(e *Engine, r Region) { e.mapCase(r, mapping) },
+		applyAll: func(e *Engine, regions []Region) { e.mapCaseRegions(regions, mapping) },
+		change:   true,
+	}
+}
+
+// Starts an operator. In visual mode it works on the selection right away, otherwise it waits for a motion.
+func (e *Engine) startOperator(op *operator) {
+	e.operator = op
+	if e.mode.IsVisual() {
+		region := e.selection()
+		e.change.fromVisual = true
+		e.setCursor(min(e.cursor(), e.visualStart))
+		e.applyOperator(region, func(sel Buffer.Selection) Region {
+			return e.selectionRegion(sel.Anchor, sel.Head)
+		})
+		return
+	}
+	e.opCount, e.count = e.count, 0
+	e.mode = OperatorPending
+}
+
+// Applies the operator to the region r of the primary selection. regionOf returns the regions of the other
+// selections, it is called before the mode changes.
+func (e *Engine) applyOperator(r Region, regionOf func(sel Buffer.Selection) Region) {
+	op := e.operator
+	others := e.otherRegions(regionOf)
+	e.operator, e.opCount, e.count = nil, 0, 0
+	e.mode = Normal
+	if op.change {
+		e.beginChange()
+	}
+	if len(others) > 0 && op.applyAll != nil {
+		op.applyAll(e, append([]Region{r}, others...))
+	} else {
+		op.apply(e, r)
+	}
+	e.finish(op.change)
+}
+
+// The count of the operator times the count of the motion
+func (e *Engine) operatorCount() int {
+	return max(1, e.opCount) * max(1, e.count)
+}
+
+// The region of count lines starting at the line of offset
+func (e *Engine) linesRegion(offset, count int) Region {
+	r := e.rope()
+	first := r.LineOfOffset(offset)
+	return e.linesBetween(first, min(first+count-1, r.LineCount()-1))
+}
+
+func (e *Engine) linesBetween(first, last int) Region {
+	r := e.rope()
+	return Region{Kind: Linewise, Intervals: []BRope.Interval{BRope.IV(r.OffsetOfLine(first), r.OffsetOfLine(last+1))}}
+}
+
+// Selection returns the selected intervals in visual mode, one per line in visual block mode
+func (e *Engine) Selection() []BRope.Interval {
+	if !e.mode.IsVisual() {
+		return nil
+	}
+	return e.selection().Intervals
+}
+
+func (e *Engine) selection() Region {
+	return e.selectionRegion(e.visualStart, e.cursor())
+}
+
+// The region of a selection from anchor to head in the current visual mode
+func (e *Engine) selectionRegion(anchor, head int) Region {
+	r := e.rope()
+	lo, hi := min(anchor, head), max(anchor, head)
+	switch e.mode {
+	case VisualLine:
+		return e.linesBetween(r.LineOfOffset(lo), r.LineOfOffset(hi))
+	case VisualBlock:
+		startCol := anchor - lineStart(r, anchor)
+		cursorCol := head - lineStart(r, head)
+		left, right := min(startCol, cursorCol), max(startCol, cursorCol)+1
+		region := Region{Kind: Blockwise}
+		for line := r.LineOfOffset(lo); line <= r.LineOfOffset(hi); line++ {
+			start := r.OffsetOfLine(line)
+			length := lineEnd(r, start) - start
+			region.Intervals = append(region.Intervals, BRope.IV(start+min(left, length), start+min(right, length)))
+		}
+		return region
+	default:
+		return Region{Kind: Charwise, Intervals: []BRope.Interval{BRope.IV(lo, min(nextCluster(r, hi), r.Length()))}}
+	}
+}
+
+// Returns the text of the region as a register
+func (e *Engine) text(region Region) Register {
+	r := e.rope()
+	if len(region.Intervals) == 1 {
+		return Register{Text: r.Slice(region.Intervals[0]), Kind: region.Kind}
+	}
+	parts := []string{}
+	for _, iv := range region.Intervals {
+		parts = append(parts, r.Slice(iv).String())
+	}
+	return Register{Text: BRope.NewRopeString(strings.Join(parts, "\n")), Kind: region.Kind}
+}
+
+func (e *Engine) yank(region Region) {
+	e.registers.yank(e.register, e.text(region))
+}
+
+func (e *Engine) yankRegion(region Region) {
+	e.yank(region)
+	if region.Kind != Linewise {
+		e.setCursor(region.Intervals[0].Lo)
+	} else if first := region.Intervals[0].Lo; e.cursor() > first {
+		e.setCursor(first)
+	}
+}
+
+func (e *Engine) delete(region Region) {
+	e.registers.delete(e.register, e.text(region))
+	r := e.rope()
+	switch region.Kind {
+	case Linewise:
+		e.setCursor(e.edit(linesToDelete(r, region.Intervals[0]), nil))
+		e.setCursor(firstNonBlank(e.rope(), e.cursor()))
+	case Blockwise:
+		e.editAll(region.Intervals, make([][]rune, len(region.Intervals)), region.Intervals[0].Lo)
+		e.setCursor(region.Intervals[0].Lo)
+	default:
+		e.setCursor(e.edit(region.Intervals[0], nil))
+	}
+}
+
+// The interval of the linewise region iv that is deleted. The last line has no newline of its own,
+// so the one before it is deleted.
+func linesToDelete(r BRope.Rope, iv BRope.Interval) BRope.Interval {
+	if ch, _ := runeAt(r, iv.Hi-1); iv.Hi == r.Length() && iv.Lo > 0 && (iv.IsEmpty() || ch != '\n') {
+		iv.Lo--
+	}
+	return iv
+}
+
+// Deletes the region and starts insert mode in its place
+func (e *Engine) changeRegion(region Region) {
+	r := e.rope()
+	switch region.Kind {
+	case Linewise:
+		// the lines are replaced by an empty one
+		iv := region.Intervals[0]
+		if ch, _ := runeAt(r, iv.Hi-1); !iv.IsEmpty() && ch == '\n' {
+			iv.Hi--
+		}
+		e.registers.delete(e.register, e.text(region))
+		e.setCursor(e.edit(iv, nil))
+		e.enterInsert(Insert, 1, "")
+	case Blockwise:
+		first := region.Intervals[0]
+		e.delete(region)
+		e.startBlockInsert(r.LineOfOffset(first.Lo), len(region.Intervals), first.Lo-lineStart(r, first.Lo))
+	default:
+		e.registers.delete(e.register, e.text(region))
+		e.setCursor(e.edit(region.Intervals[0], nil))
+		e.enterInsert(Insert, 1, "")
+	}
+}
+
+// Indents the lines of the region by a tab, or removes a tab or the spaces of indentation that are as
+// wide as a tab, up to the tab stop
+func (e *Engine) shift(region Region, right bool) {
+	r := e.rope()
+	width := e.editor.TabStop()
+	end := region.Intervals[len(region.Intervals)-1]
+	first, last := r.LineOfOffset(region.Intervals[0].Lo), r.LineOfOffset(max(end.Lo, end.Hi-1))
+
+	ivs, texts := []BRope.Interval{}, [][]rune{}
+	for line := first; line <= last; line++ {
+		start := r.OffsetOfLine(line)
+		if right {
+			if lineEnd(r, start) > start {
+				ivs, texts = append(ivs, BRope.IV(start, start)), append(texts, []rune{'\t'})
+			}
+			continue
+		}
+		end := start
+		for ch, ok := runeAt(r, end); ok && ch == ' ' && end-start < width; ch, ok = runeAt(r, end) {
+			end++
+		}
+		if ch, ok := runeAt(r, start); ok && ch == '\t' {
+			end = start + 1
+		}
+		if end > start {
+			ivs, texts = append(ivs, BRope.IV(start, end)), append(texts, nil)
+		}
+	}
+	e.editAll(ivs, texts, r.OffsetOfLine(first))
+	e.setCursor(firstNonBlank(e.rope(), e.rope().OffsetOfLine(first)))
+}
+
+func (e *Engine) mapCase(region Region, mapping func(rune) rune) {
+	ivs, texts := []BRope.Interval{}, [][]rune{}
+	for _, iv := range region.Intervals {
+		text := e.rope().Slice(iv).Runes()
+		mapped := make([]rune, len(text))
+		for i, r := range text {
+			mapped[i] = mapping(r)
+		}
+		ivs, texts = append(ivs, iv), append(texts, mapped)
+	}
+	e.editAll(ivs, texts, region.Intervals[0].Lo)
+	e.setCursor(region.Intervals[0].Lo)
+}
+
+func toggleCase(r rune) rune {
+	if unicode.IsUpper(r) {
+		return unicode.ToLower(r)
+	}
+	return unicode.ToUpper(r)
+}
@@ -0,0 +1,170 @@
+package vi
+
+import (
+	BRope "main/brope"
+	"strings"
+	"unicode"
+)
+
+// A Register holds yanked or deleted text
+type Register struct {
+	// the lines of blockwise text are joined by newlines, linewise text ends with one
+	Text BRope.Rope
+	Kind RegionKind
+}
+
+func (r Register) String() string {
+	return r.Text.String()
+}
+
+// Registers hold the text of yanks and deletes:
+//
+//	"        the unnamed register, the text of the last yank or delete
+//	a to z   named registers, A to Z append to them
+//	0        the text of the last yank
+//	1 to 9   deleted lines, 1 is the last delete and the older ones are shifted up
+//	-        the last delete within a line
+//	_        the black hole, text that is written to it is dropped
+//	. % :    read only, the last inserted text, the file name and the last command line
+//	+ *      the clipboard and the primary selection
+type Registers struct {
+	registers map[rune]Register
+	// registers whose content comes from the application, like the file name or the clipboard
+	providers map[rune]provider
+	// yanks and deletes without a register are written to it too, 0 if there is none
+	mirror rune
+}
+
+type provider struct {
+	get func() string
+	// nil for read only registers
+	set func(text string)
+}
+
+func NewRegisters() *Registers {
+	return &Registers{registers: map[rune]Register{}, providers: map[rune]provider{}}
+}
+
+// IsRegister returns whether name is the name of a register
+func IsRegister(name rune) bool {
+	return name < unicode.MaxASCII && (unicode.IsLetter(name) || unicode.IsDigit(name) || strings.ContainsRune(`"-_.%:+*`, name))
+}
+
+// Get returns the content of a register, upper case names are the same as lower case ones.
+// Provided text that ends with a newline is linewise.
+func (r *Registers) Get(name rune) (Register, bool) {
+	name = unicode.ToLower(name)
+	if p, ok := r.providers[name]; ok {
+		text := p.get()
+		kind := Charwise
+		if strings.HasSuffix(text, "\n") {
+			kind = Linewise
+		}
+		return Register{Text: BRope.NewRopeString(text), Kind: kind}, text != ""
+	}
+	reg, ok := r.registers[name]
+	return reg, ok && reg.Text.Length() > 0
+}
+
+// Set writes a register, upper case names append to the lower case one.
+// The black hole and read only registers are not written.
+func (r *Registers) Set(name rune, reg Register) {
+	r.store(name, reg)
+}
+
+// Stores a register and returns its new content
+func (r *Registers) store(name rune, reg Register) Register {
+	if p, ok := r.providers[unicode.ToLower(name)]; ok {
+		if p.set != nil {
+			p.set(reg.String())
+		}
+		return reg
+	}
+	if !IsRegister(name) || strings.ContainsRune("_.%:", name) {
+		return reg
+	}
+	if reg.Kind == Linewise && !strings.HasSuffix(reg.String(), "\n") {
+		reg.Text = BRope.NewRopeString(reg.String() + "\n")
+	}
+	if unicode.IsUpper(name) {
+		name = unicode.ToLower(name)
+		if old, ok := r.registers[name]; ok {
+			reg = appendRegister(old, reg)
+		}
+	}
+	r.registers[name] = reg
+	return reg
+}
+
+// Appending to or with lines starts a new line, other text is appended as it is
+func appendRegister(old, reg Register) Register {
+	if old.Kind != Linewise && reg.Kind != Linewise {
+		return Register{Text: BRope.NewRopeString(old.String() + reg.String()), Kind: old.Kind}
+	}
+	text := strings.TrimSuffix(old.String(), "\n") + "\n" + strings.TrimSuffix(reg.String(), "\n") + "\n"
+	return Register{Text: BRope.NewRopeString(text), Kind: Linewise}
+}
+
+// Provide makes the content of a register come from get, for registers the application knows about.
+// Text written to the register is passed to set, the register is read only if it is nil.
+func (r *Registers) Provide(name rune, get func() string, set func(text string)) {
+	r.providers[name] = provider{get: get, set: set}
+}
+
+// Mirror makes yanks and deletes without a register write the register name too, like the clipboard
+// with vim's clipboard=unnamedplus. 0 turns it off.
+func (r *Registers) Mirror(name rune) {
+	r.mirror = name
+}
+
+// Stored returns the registers that can be written and hold text
+func (r *Registers) Stored() map[rune]Register {
+	stored := map[rune]Register{}
+	for name, reg := range r.registers {
+		if _, ok := r.providers[name]; !ok && name != '.' && reg.Text.Length() > 0 {
+			stored[name] = reg
+		}
+	}
+	return stored
+}
+
+// Stores yanked text into the register, or into "0 if there is none
+func (r *Registers) yank(name rune, reg Register) {
+	if name == '_' {
+		return
+	}
+	if name == 0 {
+		name = '0'
+		r.writeMirror(reg)
+	}
+	r.store('"', r.store(name, reg))
+}
+
+// Stores deleted text into the register. Without one, deleted lines are shifted into the numbered registers
+// and deletes within a line go to "-.
+func (r *Registers) delete(name rune, reg Register) {
+	switch {
+	case name == '_':
+		return
+	case name != 0:
+		reg = r.store(name, reg)
+	case reg.Kind == Linewise || strings.ContainsRune(reg.String(), '\n'):
+		for i := '9'; i > '1'; i-- {
+			if prev, ok := r.registers[i-1]; ok {
+				r.registers[i] = prev
+			}
+		}
+		reg = r.store('1', reg)
+		r.writeMirror(reg)
+	default:
+		reg = r.store('-', reg)
+		r.writeMirror(reg)
+	}
+	r.store('"', reg)
+}
+
+func (r *Registers) writeMirror(reg Register) {
+	if r.mirror != 0 {
+		r.store(r.mirror, reg)
+	}
+}
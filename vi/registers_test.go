@@ -0,0 +1,116 @@
+package vi
+
+import (
+	BRope "main/brope"
+	"testing"
+)
+
+func expectRegister(e *Engine, name rune, text string, kind RegionKind, t *testing.T) {
+	t.Helper()
+	reg, ok := e.Registers().Get(name)
+	if text == "" && ok {
+		t.Fatalf("expected register %c to be empty, got %q", name, reg.String())
+	}
+	if text != "" && (!ok || reg.String() != text || reg.Kind != kind) {
+		t.Fatalf("expected %q of kind %v in register %c, got %q of kind %v", text, kind, name, reg.String(), reg.Kind)
+	}
+}
+
+func TestRegisters(t *testing.T) {
+	e := expectKeys("|foo bar\nbaz", "yw", "|foo bar\nbaz", t)
+	expectRegister(e, '"', "foo ", Charwise, t)
+	expectRegister(e, '0', "foo ", Charwise, t)
+
+	e.FeedKeys(Keys(`"ayy"Ayw`))
+	expectRegister(e, 'a', "foo bar\nfoo \n", Linewise, t)
+	expectRegister(e, '"', "foo bar\nfoo \n", Linewise, t)
+	expectRegister(e, '0', "foo ", Charwise, t)
+
+	e.FeedKeys(Keys("x"))
+	expectRegister(e, '-', "f", Charwise, t)
+	expectRegister(e, '"', "f", Charwise, t)
+	expectRegister(e, '1', "", Charwise, t)
+
+	e.FeedKeys(Keys("ddddu"))
+	expectRegister(e, '1', "baz\n", Linewise, t)
+	expectRegister(e, '2', "oo bar\n", Linewise, t)
+
+	e.FeedKeys(Keys(`"_dd`))
+	expectRegister(e, '"', "baz\n", Linewise, t)
+	expectRegister(e, '1', "baz\n", Linewise, t)
+	expectRegister(e, 'a', "foo bar\nfoo \n", Linewise, t)
+
+	e.FeedKeys(Keys("ix<Esc>"))
+	expectRegister(e, '.', "x", Charwise, t)
+	e.Registers().Set('.', Register{Text: BRope.NewRopeString("y")})
+	expectRegister(e, '.', "x", Charwise, t)
+
+	e.Registers().Provide('%', func() string { return "file.go" }, nil)
+	e.Registers().Set('%', Register{Text: BRope.NewRopeString("x")})
+	expectRegister(e, '%', "file.go", Charwise, t)
+	if _, ok := e.Registers().Stored()['%']; ok {
+		t.Fatalf("expected provided registers not to be stored")
+	}
+}
+
+func TestProvidedRegisters(t *testing.T) {
+	e := newTestEngine("|foo bar\nbaz")
+	clipboard := ""
+	e.Registers().Provide('+', func() string { return clipboard }, func(text string) { clipboard = text })
+	e.FeedKeys(Keys(`"+yw`))
+	if clipboard != "foo " {
+		t.Fatalf("expected the yank in the clipboard, got %q", clipboard)
+	}
+	expectRegister(e, '"', "foo ", Charwise, t)
+
+	clipboard = "x\n"
+	e.FeedKeys(Keys(`"+p`))
+	if got := content(e); got != "foo bar\n|x\nbaz" {
+		t.Fatalf("expected the clipboard to be put as a line, got %q", got)
+	}
+
+	e.Registers().Mirror('+')
+	e.FeedKeys(Keys("yiw"))
+	if clipboard != "x" {
+		t.Fatalf("expected the yank to be mirrored into the clipboard, got %q", clipboard)
+	}
+	e.FeedKeys(Keys(`"ayy`))
+	if clipboard != "x" {
+		t.Fatalf("expected a yank into a register not to be mirrored, got %q", clipboard)
+	}
+}
+
+func TestPut(t *testing.T) {
+	expectKeys("|ab", "ylp", "a|ab", t)
+	expectKeys("|ab", "ylP", "|aab", t)
+	expectKeys("|ab", "yl3p", "aaa|ab", t)
+	expectKeys("|ab", "ylgp", "aa|b", t)
+	expectKeys("a|b\ncd", "yyjp", "ab\ncd\n|ab", t)
+	expectKeys("a|b\ncd", "yyjP", "ab\n|ab\ncd", t)
+	expectKeys("a|b\ncd", "yy2p", "ab\n|ab\nab\ncd", t)
+	expectKeys("a|b\ncd", "yygp", "ab\nab\n|cd", t)
+	expectKeys("  a|b\ncd", "ddp", "cd\n  |ab", t)
+	expectKeys("|ab\ncd\nef", "<C-v>jyjjp", "ab\ncd\ne|af\n c", t)
+	expectKeys("|ab\ncd\nef", "<C-v>jy$P", "a|ab\nccd\nef", t)
+	expectKeys("|ab\ncd", "<C-v>jy$p", "ab|a\ncdc", t)
+	expectKeys("|ab\n\ncd", "<C-v>jylp", "ab|a\n\ncd", t)
+	expectKeys("|ab\ncd", `"ayl"ap`, "a|ab\ncd", t)
+	expectKeys("|ab\ncd", `"byy"Bylj"bp`, "ab\ncd\n|ab\na", t)
+	expectKeys("|ab", "p", "|ab", t)
+}
+
+func TestPutOverSelection(t *testing.T) {
+	e := expectKeys("|foo bar", "yiwwviwp", "foo fo|o", t)
+	expectRegister(e, '"', "bar", Charwise, t)
+	expectKeys("|a\nb\nc", "yyjVp", "a\n|a\nc", t)
+	expectKeys("|a\nb\nc", "yyjjVp", "a\nb\n|a", t)
+	expectKeys("|a\nb\nc", "yljVp", "a\n|a\nc", t)
+	expectKeys("|ab cd", "yiwwvlp", "ab a|b", t)
+}
+
+func TestInsertRegister(t *testing.T) {
+	expectKeys("|ab", "yiwA <C-r>\"!<Esc>", "ab ab|!", t)
+	expectKeys("|ab", "yiwo<C-r>0<C-r>0<Esc>", "ab\naba|b", t)
+	expectKeys("|ab", "A<C-r>x<Esc>", "a|b", t)
+	expectKeys("|ab", "yiw2A-<C-r>\"<Esc>", "ab-ab-a|b", t)
+}
@@ -0,0 +1,386 @@
+package vi
+
+import (
+	BRope "main/brope"
+	Buffer "main/buffer"
+	"sort"
+	"strings"
+)
+
+// Besides the primary selection, which is the cursor and visualStart, the buffer keeps other selections.
+// Motions move all of them, and text typed in insert mode as well as deletes, changes, yanks and case
+// changes work on all of them in one edit. Other commands only work on the primary selection.
+func (e *Engine) registerSelections() {
+	for _, mode := range []Mode{Normal, Visual} {
+		e.addAction(mode, "<C-j>", false, func(e *Engine, count int, _ rune) {
+			e.addSelections(max(1, count), 1)
+		})
+		e.addAction(mode, "<C-k>", false, func(e *Engine, count int, _ rune) {
+			e.addSelections(max(1, count), -1)
+		})
+		e.addAction(mode, "<C-n>", false, func(e *Engine, count int, _ rune) {
+			e.addNextMatch(max(1, count))
+		})
+	}
+	e.addAction(Visual, "<C-s>", false, func(e *Engine, _ int, _ rune) {
+		e.splitLines()
+	})
+}
+
+// OtherSelections returns the selected intervals of the selections besides the primary one in visual mode
+func (e *Engine) OtherSelections() []BRope.Interval {
+	if !e.mode.IsVisual() {
+		return nil
+	}
+	ivs := []BRope.Interval{}
+	for _, sel := range e.selections().All() {
+		ivs = append(ivs, e.selectionRegion(sel.Anchor, sel.Head).Intervals...)
+	}
+	sort.Slice(ivs, func(i, j int) bool { return ivs[i].Lo < ivs[j].Lo })
+	return ivs
+}
+
+// OtherCursors returns the offsets of the cursors of the selections besides the primary one
+func (e *Engine) OtherCursors() []int {
+	return e.cursors()[1:]
+}
+
+func (e *Engine) selections() *Buffer.Selections {
+	return e.buffer().Selections
+}
+
+// The selection of the cursor, it is only the cursor outside of visual mode
+func (e *Engine) primary() Buffer.Selection {
+	if e.mode.IsVisual() {
+		return Buffer.Selection{Anchor: e.visualStart, Head: e.cursor()}
+	}
+	return Buffer.Selection{Anchor: e.cursor(), Head: e.cursor()}
+}
+
+// Sets the selections besides the primary one, the ones that are the same as the primary one are dropped
+func (e *Engine) setSelections(sels []Buffer.Selection) {
+	primary := e.primary()
+	length := e.rope().Length()
+	kept := []Buffer.Selection{}
+	for _, sel := range sels {
+		sel.Anchor, sel.Head = max(0, min(sel.Anchor, length)), max(0, min(sel.Head, length))
+		if sel != primary {
+			kept = append(kept, sel)
+		}
+	}
+	e.selections().Set(kept)
+}
+
+// The cursors of all selections, the primary one first and the others in the order of Selections.All
+func (e *Engine) cursors() []int {
+	cursors := []int{e.cursor()}
+	for _, sel := range e.selections().All() {
+		cursors = append(cursors, sel.Head)
+	}
+	return cursors
+}
+
+// Puts the primary cursor to offsets[0] and makes the other selections cursors at the other offsets
+func (e *Engine) setCursors(offsets []int) {
+	e.setCursor(offsets[0])
+	sels := make([]Buffer.Selection, len(offsets)-1)
+	for i, offset := range offsets[1:] {
+		sels[i] = Buffer.Selection{Anchor: offset, Head: offset}
+	}
+	e.setSelections(sels)
+}
+
+// Moves the cursor of every selection to f of its offset. The primary cursor is only set if it moves,
+// so it keeps the column it wants to be in.
+func (e *Engine) moveCursors(f func(offset int) int) {
+	if cursor := e.cursor(); f(cursor) != cursor {
+		e.setCursor(f(cursor))
+	}
+	e.moveOthers(f)
+}
+
+// Moves the heads of the selections besides the primary one to f of their offsets. Outside of visual mode
+// their anchors go along.
+func (e *Engine) moveOthers(f func(offset int) int) {
+	sels := e.selections().All()
+	for i := range sels {
+		sels[i].Head = f(sels[i].Head)
+		if !e.mode.IsVisual() {
+			sels[i].Anchor = sels[i].Head
+		}
+	}
+	e.setSelections(sels)
+}
+
+// The regions of the selections besides the primary one, in the order of Selections.All
+func (e *Engine) otherRegions(regionOf func(sel Buffer.Selection) Region) []Region {
+	regions := []Region{}
+	for _, sel := range e.selections().All() {
+		regions = append(regions, regionOf(sel))
+	}
+	return regions
+}
+
+// Replaces an interval at the cursor of every selection in one edit, like text typed in insert mode.
+// Every cursor goes behind the text that replaced its interval, edit returns false to keep a cursor where
+// it is. An edit that overlaps the one of a cursor before it is dropped and its cursor joins that one.
+func (e *Engine) editCursors(edit func(cursor int) (BRope.Interval, []rune, bool)) {
+	cursors := e.cursors()
+	if len(cursors) == 1 {
+		if iv, text, ok := edit(cursors[0]); ok {
+			e.setCursor(e.edit(iv, text))
+		}
+		return
+	}
+	type cursorEdit struct {
+		iv   BRope.Interval
+		text []rune
+	}
+	edits, order := make([]cursorEdit, len(cursors)), []int{}
+	for i, cursor := range cursors {
+		var ok bool
+		if edits[i].iv, edits[i].text, ok = edit(cursor); ok {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool { return edits[order[i]].iv.Lo < edits[order[j]].iv.Lo })
+
+	// the index of the edit that moves each cursor, -1 for cursors without one
+	owner := make([]int, len(cursors))
+	for i := range owner {
+		owner[i] = -1
+	}
+	ivs, texts := []BRope.Interval{}, [][]rune{}
+	for _, i := range order {
+		if n := len(ivs); n > 0 && (edits[i].iv.Lo < ivs[n-1].Hi || edits[i].iv.Lo == ivs[n-1].Lo) {
+			owner[i] = n - 1
+			continue
+		}
+		owner[i] = len(ivs)
+		ivs, texts = append(ivs, edits[i].iv), append(texts, edits[i].text)
+	}
+	d := e.delta(ivs, texts)
+	after := make([]int, len(cursors))
+	for i, cursor := range cursors {
+		if k := owner[i]; k >= 0 {
+			after[i] = d.TransformOffset(ivs[k].Lo, false) + len(texts[k])
+		} else {
+			after[i] = d.TransformOffset(cursor, true)
+		}
+	}
+	e.buffer().ApplyDelta(d, cursors[0], after[0])
+	e.setCursors(after)
+}
+
+// Inserts text at the cursor of every selection
+func (e *Engine) insertAtCursors(text []rune) {
+	e.editCursors(func(cursor int) (BRope.Interval, []rune, bool) {
+		return BRope.IV(cursor, cursor), text, true
+	})
+}
+
+// Deletes the intervals in one edit, overlapping ones are merged. Returns where each interval starts after it.
+func (e *Engine) deleteAll(ivs []BRope.Interval) []int {
+	merged := mergeIntervals(ivs)
+	d := e.delta(merged, make([][]rune, len(merged)))
+	starts := make([]int, len(ivs))
+	for i, iv := range ivs {
+		starts[i] = d.TransformOffset(iv.Lo, false)
+	}
+	e.buffer().ApplyDelta(d, e.cursor(), starts[0])
+	return starts
+}
+
+// Sorts the intervals and joins the ones that overlap or touch
+func mergeIntervals(ivs []BRope.Interval) []BRope.Interval {
+	sorted := append([]BRope.Interval{}, ivs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Lo < sorted[j].Lo })
+	merged := []BRope.Interval{}
+	for _, iv := range sorted {
+		if n := len(merged); n > 0 && iv.Lo <= merged[n-1].Hi {
+			merged[n-1].Hi = max(merged[n-1].Hi, iv.Hi)
+		} else {
+			merged = append(merged, iv)
+		}
+	}
+	return merged
+}
+
+// The text of the regions of all selections as one register, in the order of the buffer. Charwise
+// texts are put into lines of their own, empty ones are left out.
+func (e *Engine) textAll(regions []Region) Register {
+	sorted := append([]Region{}, regions...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Intervals[0].Lo < sorted[j].Intervals[0].Lo })
+	parts := []string{}
+	for _, region := range sorted {
+		if text := e.text(region).String(); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	if regions[0].Kind == Linewise {
+		return Register{Text: BRope.NewRopeString(strings.Join(parts, "")), Kind: Linewise}
+	}
+	return Register{Text: BRope.NewRopeString(strings.Join(parts, "\n")), Kind: regions[0].Kind}
+}
+
+// Deletes the regions of all selections in one edit, regions[0] is the one of the primary selection
+func (e *Engine) deleteRegions(regions []Region) {
+	e.registers.delete(e.register, e.textAll(regions))
+	r := e.rope()
+	ivs := make([]BRope.Interval, len(regions))
+	for i, region := range regions {
+		ivs[i] = region.Intervals[0]
+		if region.Kind == Linewise {
+			ivs[i] = linesToDelete(r, ivs[i])
+		}
+	}
+	starts := e.deleteAll(ivs)
+	for i, region := range regions {
+		if region.Kind == Linewise {
+			starts[i] = firstNonBlank(e.rope(), starts[i])
+		}
+	}
+	e.setCursors(starts)
+}
+
+// Deletes the regions of all selections in one edit and starts insert mode at each of them
+func (e *Engine) changeRegions(regions []Region) {
+	e.registers.delete(e.register, e.textAll(regions))
+	r := e.rope()
+	ivs := make([]BRope.Interval, len(regions))
+	for i, region := range regions {
+		ivs[i] = region.Intervals[0]
+		if ch, _ := runeAt(r, ivs[i].Hi-1); region.Kind == Linewise && !ivs[i].IsEmpty() && ch == '\n' {
+			// the lines are replaced by an empty one
+			ivs[i].Hi--
+		}
+	}
+	e.setCursors(e.deleteAll(ivs))
+	e.enterInsert(Insert, 1, "")
+}
+
+// Yanks the regions of all selections into one register
+func (e *Engine) yankRegions(regions []Region) {
+	e.registers.yank(e.register, e.textAll(regions))
+	cursors := e.cursors()
+	for i, region := range regions {
+		if first := region.Intervals[0].Lo; region.Kind != Linewise || cursors[i] > first {
+			cursors[i] = first
+		}
+	}
+	e.setCursors(cursors)
+}
+
+// Maps the case of the regions of all selections in one edit
+func (e *Engine) mapCaseRegions(regions []Region, mapping func(rune) rune) {
+	ivs, starts := []BRope.Interval{}, []int{}
+	for _, region := range regions {
+		ivs, starts = append(ivs, region.Intervals[0]), append(starts, region.Intervals[0].Lo)
+	}
+	e.mapCase(Region{Kind: Charwise, Intervals: mergeIntervals(ivs)}, mapping)
+	e.setCursors(starts)
+}
+
+// Adds a selection count lines below the last selection, or above the first one for a negative delta
+func (e *Engine) addSelections(count, delta int) {
+	if e.mode == VisualBlock {
+		return
+	}
+	r := e.rope()
+	for i := 0; i < count; i++ {
+		edge := e.primary()
+		for _, sel := range e.selections().All() {
+			if delta > 0 && sel.Hi() > edge.Hi() || delta < 0 && sel.Lo() < edge.Lo() {
+				edge = sel
+			}
+		}
+		if delta > 0 && r.LineOfOffset(edge.Hi()) == r.LineCount()-1 || delta < 0 && r.LineOfOffset(edge.Lo()) == 0 {
+			return
+		}
+		e.selections().Add(Buffer.Selection{Anchor: moveLines(r, edge.Anchor, delta), Head: moveLines(r, edge.Head, delta)})
+	}
+}
+
+// In normal mode, selects the word of the cursor. In visual mode, adds selections of the next matches
+// of the primary selection's text that are not selected yet, from the primary selection on and
+// starting over at the top of the buffer.
+func (e *Engine) addNextMatch(count int) {
+	r := e.rope()
+	if e.mode == Normal {
+		iv, ok := wordObject(false, false)(r, e.cursor(), 1)
+		if ch, _ := runeAt(r, iv.Lo); !ok || iv.IsEmpty() || !isWordRune(ch) {
+			return
+		}
+		e.visualStart = iv.Lo
+		e.setCursor(iv.Hi - 1)
+		e.mode = Visual
+		return
+	}
+	if e.mode != Visual {
+		return
+	}
+	primary := e.primary()
+	pattern := BRope.Literal(r.Slice(BRope.IV(primary.Lo(), min(nextCluster(r, primary.Hi()), r.Length()))).String(), false)
+	matches := r.FindAll(pattern, BRope.IV(0, r.Length()))
+	// the matches behind the primary selection come first
+	start := sort.Search(len(matches), func(i int) bool { return matches[i].Lo > primary.Lo() })
+	matches = append(matches[start:], matches[:start]...)
+	for _, match := range matches {
+		if count == 0 {
+			return
+		}
+		selected := false
+		for _, sel := range append(e.selections().All(), primary) {
+			selected = selected || sel.Lo() == match.Lo
+		}
+		if !selected && !match.IsEmpty() {
+			e.selections().Add(Buffer.Selection{Anchor: match.Lo, Head: match.Hi - 1})
+			count--
+		}
+	}
+}
+
+// Splits every selection into a selection for each of its lines. The part in the line of the cursor
+// becomes the primary selection.
+func (e *Engine) splitLines() {
+	if e.mode == VisualBlock {
+		return
+	}
+	r := e.rope()
+	split := func(sel Buffer.Selection) []Buffer.Selection {
+		lo, hi := sel.Lo(), sel.Hi()
+		if e.mode == VisualLine {
+			lo, hi = lineStart(r, lo), max(lineStart(r, hi), lineEnd(r, hi)-1)
+		}
+		parts := []Buffer.Selection{}
+		for line := r.LineOfOffset(lo); line <= r.LineOfOffset(hi); line++ {
+			start := r.OffsetOfLine(line)
+			// the newline is only selected in empty lines
+			from := max(lo, start)
+			to := max(from, min(hi, max(start, lineEnd(r, start)-1)))
+			part := Buffer.Selection{Anchor: from, Head: to}
+			if sel.Head < sel.Anchor {
+				part.Anchor, part.Head = to, from
+			}
+			parts = append(parts, part)
+		}
+		return parts
+	}
+	others := []Buffer.Selection{}
+	for _, sel := range e.selections().All() {
+		others = append(others, split(sel)...)
+	}
+	primary := e.primary()
+	line := r.LineOfOffset(primary.Head)
+	for _, part := range split(primary) {
+		if r.LineOfOffset(part.Head) == line {
+			primary = part
+		} else {
+			others = append(others, part)
+		}
+	}
+	e.mode = Visual
+	e.visualStart = primary.Anchor
+	e.setCursor(primary.Head)
+	e.setSelections(others)
+}
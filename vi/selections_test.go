@@ -0,0 +1,97 @@
+package vi
+
+import (
+	"sort"
+	"testing"
+)
+
+// Returns the text of the buffer with '|' at the cursor and '*' at the cursors of the other selections
+func cursorsContent(e *Engine) string {
+	runes := e.rope().Runes()
+	cursors := e.cursors()
+	marks := map[int]rune{cursors[0]: '|'}
+	for _, cursor := range cursors[1:] {
+		marks[cursor] = '*'
+	}
+	offsets := []int{}
+	for offset := range marks {
+		offsets = append(offsets, offset)
+	}
+	sort.Ints(offsets)
+	text, last := "", 0
+	for _, offset := range offsets {
+		text += string(runes[last:offset]) + string(marks[offset])
+		last = offset
+	}
+	return text + string(runes[last:])
+}
+
+// Feeds keys into an engine for text and compares the result, '|' marks the cursor and '*' the other cursors
+func expectCursors(text, keys, expected string, t *testing.T) *Engine {
+	t.Helper()
+	e := newTestEngine(text)
+	e.FeedKeys(Keys(keys))
+	if got := cursorsContent(e); got != expected {
+		t.Fatalf("%q with %q: expected %q, got %q", text, keys, expected, got)
+	}
+	return e
+}
+
+func TestAddCursors(t *testing.T) {
+	expectCursors("a|bc\ndef\ng", "<C-j>", "a|bc\nd*ef\ng", t)
+	expectCursors("a|bc\ndef\ng", "2<C-j>", "a|bc\nd*ef\n*g", t)
+	expectCursors("abc\nd|ef", "<C-k><C-k>", "a*bc\nd|ef", t)
+	expectCursors("|abc def\nghi jkl", "<C-j>w", "abc |def\nghi *jkl", t)
+	expectCursors("|abc def\nghi jkl", "<C-j>$", "abc de|f\nghi jk*l", t)
+	expectCursors("|abc\ndef", "<C-j><Esc>", "|abc\ndef", t)
+	expectCursors("|abc\ndef", "<C-j>G", "abc\n|def", t)
+}
+
+func TestInsertAtCursors(t *testing.T) {
+	expectCursors("|ab\ncd", "<C-j>ix<Esc>", "|xab\n*xcd", t)
+	expectCursors("a|b\ncd", "<C-j>i<BS><Esc>", "|b\n*d", t)
+	expectCursors("a|b\ncd", "<C-j>i<Del><Esc>", "|a\n*c", t)
+	expectCursors("|ab\nc", "<C-j>A!<Esc>", "ab|!\nc*!", t)
+	expectCursors("|a\nb", "<C-j>ox<Esc>", "a\n|x\nb\n*x", t)
+	expectCursors("|a\nb", "<C-j>Ox<Esc>", "|x\na\n*x\nb", t)
+	expectCursors("|ab\ncd", "<C-j>2ix<Esc>", "x|xab\nx*xcd", t)
+	expectCursors("|ab\ncd", "<C-j>ix<Esc>.", "|xxab\n*xxcd", t)
+	// the inserts of all cursors are undone at once
+	expectCursors("|ab\ncd", "<C-j>ix<Esc>u", "|ab\n*cd", t)
+}
+
+func TestOperatorsOnSelections(t *testing.T) {
+	e := expectCursors("|foo bar\nfoo bar", "<C-j>dw", "|bar\n*bar", t)
+	expectRegister(e, '"', "foo \nfoo ", Charwise, t)
+	e = expectCursors("|a\nb\nc\nd", "<C-j>jdd", "a\n|d", t)
+	expectRegister(e, '"', "b\nc\n", Linewise, t)
+	expectCursors("|ab cd\nef gh", "<C-j>cwx<Esc>", "|x cd\n*x gh", t)
+	expectCursors("|ab cd\nef gh", "<C-j>wgUiw", "ab |CD\nef *GH", t)
+	expectCursors("|ab\ncd", "<C-j>x", "|b\n*d", t)
+	e = expectCursors("a|b\ncd", "<C-j>yl", "a|b\nc*d", t)
+	expectRegister(e, '"', "b\nd", Charwise, t)
+	// operators that do not work on all selections only change the primary one
+	expectCursors("|a\nb", "<C-j>>>", "\t|a\n*b", t)
+}
+
+func TestAddNextMatch(t *testing.T) {
+	e := expectCursors("f|oo bar foo\nfoo", "<C-n>", "fo|o bar foo\nfoo", t)
+	if e.Mode() != Visual {
+		t.Fatalf("expected the word to be selected, got mode %v", e.Mode())
+	}
+	expectCursors("f|oo bar foo\nfoo", "<C-n><C-n>cx<Esc>", "|x bar *x\nfoo", t)
+	expectCursors("foo bar f|oo\nfoo", "<C-n>3<C-n>cx<Esc>", "*x bar |x\n*x", t)
+	expectCursors("f|oo bar foo\nfoo", "<C-n>5<C-n>d", "| bar* \n*", t)
+	expectCursors(" |  a", "<C-n>", " |  a", t)
+}
+
+func TestSplitLines(t *testing.T) {
+	e := expectCursors("|ab\ncd\nef", "Vj<C-s>", "a*b\nc|d\nef", t)
+	if e.Mode() != Visual {
+		t.Fatalf("expected the lines to be selected charwise, got mode %v", e.Mode())
+	}
+	expectCursors("|ab\ncd\nef", "Vj<C-s>I-<Esc>", "*-ab\n|-cd\nef", t)
+	e = expectCursors("a|b\ncd\nef", "vjj<C-s>d", "*a\n*\n|", t)
+	expectRegister(e, '"', "b\ncd\nef", Charwise, t)
+	expectCursors("|ab\n\ncd", "vjj<C-s>y", "*ab\n*\n|cd", t)
+}
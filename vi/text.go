@@ -0,0 +1,179 @@
+package vi
+
+import (
+	BRope "main/brope"
+	"unicode"
+)
+
+// Offset of the first rune of the line containing offset
+func lineStart(r BRope.Rope, offset int) int {
+	return r.OffsetOfLine(r.LineOfOffset(offset))
+}
+
+// Offset of the '\n' that ends the line containing offset, or the end of the rope on the last line
+func lineEnd(r BRope.Rope, offset int) int {
+	line := r.LineOfOffset(offset)
+	if line == r.LineCount()-1 {
+		return r.Length()
+	}
+	return r.OffsetOfLine(line+1) - 1
+}
+
+// Returns the rune at offset, false at the end of the rope
+func runeAt(r BRope.Rope, offset int) (rune, bool) {
+	if offset < 0 {
+		return 0, false
+	}
+	return BRope.NewCursor(r, offset).PeekRune()
+}
+
+// Offset of the grapheme cluster after the one at offset, the one after the newline at the end of a line.
+// A cluster is a rune and the runes that combine with it, the cursor moves over it as a whole.
+func nextCluster(r BRope.Rope, offset int) int {
+	end := lineEnd(r, offset)
+	if offset >= end {
+		return offset + 1
+	}
+	next, _ := BRope.NewCursor(r, offset).Next(BRope.GraphemeMetric{})
+	// "\r\n" is a single cluster, the cursor stays in front of the newline
+	return min(next, end)
+}
+
+// Offset of the grapheme cluster before the one at offset, the newline before it at the start of a line
+func prevCluster(r BRope.Rope, offset int) int {
+	start := lineStart(r, offset)
+	if offset <= start {
+		return offset - 1
+	}
+	prev, _ := BRope.NewCursor(r, offset).Prev(BRope.GraphemeMetric{})
+	return max(prev, start)
+}
+
+// Offset of the first rune of the line that is not a space or a tab
+func firstNonBlank(r BRope.Rope, offset int) int {
+	c := BRope.NewCursor(r, lineStart(r, offset))
+	for {
+		if ch, ok := c.PeekRune(); !ok || ch != ' ' && ch != '\t' {
+			return c.Pos()
+		}
+		c.NextRune()
+	}
+}
+
+// Moves offset by delta lines, keeping its column if the target line is long enough
+func moveLines(r BRope.Rope, offset, delta int) int {
+	line := r.LineOfOffset(offset)
+	col := offset - r.OffsetOfLine(line)
+	target := max(0, min(line+delta, r.LineCount()-1))
+	start := r.OffsetOfLine(target)
+	return min(start+col, lineEnd(r, start))
+}
+
+// Letters, digits and underscores form words, other runes that are not spaces are punctuation
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Classes of runes for word motions, a word is a run of runes of the same class
+const (
+	blankClass = iota
+	punctuationClass
+	wordClass
+)
+
+// Returns the class of a rune. For WORDs, big is set and punctuation belongs to words.
+func runeClass(r rune, big bool) int {
+	switch {
+	case unicode.IsSpace(r):
+		return blankClass
+	case big || isWordRune(r):
+		return wordClass
+	default:
+		return punctuationClass
+	}
+}
+
+func isBlank(r rune) bool {
+	return r == ' ' || r == '\t'
+}
+
+// Whether the line is empty, not even containing blanks
+func isEmptyLine(r BRope.Rope, line int) bool {
+	start := r.OffsetOfLine(line)
+	return lineEnd(r, start) == start
+}
+
+// Whether the line contains nothing but blanks
+func isBlankLine(r BRope.Rope, line int) bool {
+	start := r.OffsetOfLine(line)
+	return firstNonBlank(r, start) == lineEnd(r, start)
+}
+
+// Start of the run of runes of the same class as the one at offset, inside of its line
+func runStart(r BRope.Rope, offset int, big bool) int {
+	c := BRope.NewCursor(r, offset)
+	ch, _ := c.PeekRune()
+	class := runeClass(ch, big)
+	for {
+		prev, ok := c.PrevRune()
+		if !ok {
+			return 0
+		}
+		if prev == '\n' || runeClass(prev, big) != class {
+			return c.Pos() + 1
+		}
+	}
+}
+
+// End of the run of runes of the same class as the one at offset, inside of its line
+func runEnd(r BRope.Rope, offset int, big bool) int {
+	c := BRope.NewCursor(r, offset)
+	ch, ok := c.NextRune()
+	if !ok || ch == '\n' {
+		return offset
+	}
+	class := runeClass(ch, big)
+	for {
+		next, ok := c.PeekRune()
+		if !ok || next == '\n' || runeClass(next, big) != class {
+			return c.Pos()
+		}
+		c.NextRune()
+	}
+}
+
+// Returns the offset of the bracket matching the one at offset, open and close are the pair of brackets.
+// The search goes forward from an opening bracket and backward from a closing one.
+func matchBracket(r BRope.Rope, offset int, open, close rune) (int, bool) {
+	ch, ok := runeAt(r, offset)
+	if !ok || ch != open && ch != close {
+		return offset, false
+	}
+	c := BRope.NewCursor(r, offset)
+	if ch == open {
+		c.NextRune()
+	}
+	depth := 0
+	for {
+		var next rune
+		pos := c.Pos()
+		if ch == open {
+			next, ok = c.NextRune()
+		} else {
+			next, ok = c.PrevRune()
+			pos = c.Pos()
+		}
+		if !ok {
+			return offset, false
+		}
+		switch {
+		case next == ch:
+			depth++
+		case next == open || next == close:
+			if depth == 0 {
+				return pos, true
+			}
+			depth--
+		}
+	}
+}
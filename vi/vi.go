@@ -1,7 +1,389 @@
 package vi
 
+import (
+	BRope "main/brope"
+	Buffer "main/buffer"
+	"strconv"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+type Mode int
+
 const (
-  normal mode = iota
-  insert
+	Normal Mode = iota
+	Insert
+	Visual
+	VisualLine
+	VisualBlock
+	OperatorPending
+	Replace
 )
-type mode int
+
+func (m Mode) String() string {
+	return [...]string{"Normal", "Insert", "Visual", "V-Line", "V-Block", "Op-Pending", "Replace"}[m]
+}
+
+func (m Mode) IsVisual() bool {
+	return m == Visual || m == VisualLine || m == VisualBlock
+}
+
+// Editor is the part of the application the engine edits.
+type Editor interface {
+	Buffer() *Buffer.Buffer
+	// rope offset of the cursor
+	Cursor() int
+	// moves the cursor and makes its column the one moving up and down keeps to
+	SetCursor(offset int)
+	// moves the cursor to the column it keeps to in line, after the last rune of the line if pastEnd is set
+	CursorToLine(line int, pastEnd bool)
+	// makes moving up and down keep to the end of the lines, like after "$"
+	KeepLineEnd()
+	// the offset rows rows of the window below offset, above for negative rows. Rows differ from lines
+	// where lines are wrapped.
+	RowOffset(offset, rows int) (int, bool)
+	// the columns between tab stops
+	TabStop() int
+}
+
+// Engine is the state machine of vi's modes. Every key press is fed into it, keys that do not complete
+// a command yet, like the "d" of "dw", are kept until the command is complete.
+type Engine struct {
+	editor Editor
+	mode   Mode
+
+	normalKeys, visualKeys, pendingKeys *keymap
+
+	// keys of the command that are not resolved yet, e.g. "g" while waiting for "gu"
+	keys []Key
+	// all keys of the command that is being typed, like "\"a2d" of "\"a2dw", shown until it is complete
+	typed []Key
+	// count typed before the command, 0 if there is none
+	count int
+	// binding that waits for a character, like r or f
+	arg *binding
+
+	// operator waiting for a motion and the count that was typed before it
+	operator *operator
+	opCount  int
+
+	// the other end of the selection in visual mode
+	visualStart int
+
+	// keys of the change in progress and of the last one, which is repeated by "."
+	change     change
+	lastChange change
+	// whether the keys of the current command are recorded, they are not while keys are replayed
+	record bool
+	// the change entered insert mode and its keys are recorded until it is left
+	recordInsert bool
+
+	insert insertSession
+
+	registers *Registers
+	// the register typed before the command, like the "a of "ayy. 0 if there is none.
+	register rune
+	// a '"' was typed and the name of the register comes next
+	selectRegister bool
+
+	// the register a macro is recorded into, 0 if none is, and the keys typed so far
+	recording rune
+	recorded  []Key
+	// keys of a macro that are played when the command that plays them is done
+	macro      []Key
+	lastMacro  rune
+	macroDepth int
+	player     func(keys []Key)
+
+	// where upper case marks are kept, nil to keep them in the buffer
+	fileMarks FileMarks
+}
+
+type change struct {
+	count int
+	keys  []Key
+	// changes of a selection are not repeated
+	fromVisual bool
+}
+
+func NewEngine(editor Editor) *Engine {
+	e := &Engine{editor: editor, record: true, registers: NewRegisters()}
+	e.normalKeys, e.visualKeys, e.pendingKeys = newKeymap(), newKeymap(), newKeymap()
+	e.registerDefaults()
+	return e
+}
+
+func (e *Engine) Mode() Mode {
+	return e.mode
+}
+
+func (e *Engine) Registers() *Registers {
+	return e.registers
+}
+
+// ExitVisual returns from a visual mode to normal mode, for bindings that leave it like ":"
+func (e *Engine) ExitVisual() {
+	if e.mode.IsVisual() {
+		e.mode = Normal
+	}
+}
+
+// Pending returns the keys of the command that is being typed in vim's key notation, empty if there
+// is none
+func (e *Engine) Pending() string {
+	return KeysString(e.typed)
+}
+
+// Bind adds a command to the keys of a mode, for commands the application implements itself,
+// like ":" or "n". Visual binds the keys in all visual modes.
+func (e *Engine) Bind(mode Mode, keys string, run func(count int)) {
+	e.keymap(mode).add(Keys(keys), &binding{action: func(e *Engine, count int, _ rune) { run(count) }})
+}
+
+func (e *Engine) keymap(mode Mode) *keymap {
+	switch {
+	case mode.IsVisual():
+		return e.visualKeys
+	case mode == OperatorPending:
+		return e.pendingKeys
+	default:
+		return e.normalKeys
+	}
+}
+
+// Feed processes a key press
+func (e *Engine) Feed(key Key) {
+	switch e.mode {
+	case Insert, Replace:
+		e.insertKey(key)
+	default:
+		e.typed = append(e.typed, key)
+		e.commandKey(key)
+		if e.mode != OperatorPending && len(e.keys) == 0 && e.count == 0 && e.arg == nil && e.register == 0 && !e.selectRegister {
+			e.typed = nil
+		}
+	}
+	if e.macro != nil {
+		e.play()
+	}
+}
+
+// FeedKeys processes the keys one after another
+func (e *Engine) FeedKeys(keys []Key) {
+	for _, key := range keys {
+		e.Feed(key)
+	}
+}
+
+// Handles a key in normal, visual and operator pending mode
+func (e *Engine) commandKey(key Key) {
+	isRune := key.Code == tcell.KeyRune
+	if e.record && (len(e.change.keys) > 0 || !isRune || key.Rune < '0' || key.Rune > '9' || len(e.keys) > 0) {
+		if len(e.change.keys) == 0 {
+			// the count before the first key is replaced by the count of "."
+			e.change.count = e.count
+		}
+		e.change.keys = append(e.change.keys, key)
+	}
+
+	if e.arg != nil {
+		b := e.arg
+		e.arg = nil
+		if !isRune {
+			e.cancel()
+			return
+		}
+		e.run(b, key.Rune)
+		return
+	}
+
+	if e.selectRegister {
+		e.selectRegister = false
+		if !isRune || !IsRegister(key.Rune) {
+			e.cancel()
+			return
+		}
+		e.register = key.Rune
+		return
+	}
+	if len(e.keys) == 0 && key == RuneKey('"') && e.mode != OperatorPending {
+		e.selectRegister = true
+		return
+	}
+
+	if e.recording != 0 && key == RuneKey('q') && len(e.keys) == 0 && e.mode != OperatorPending {
+		e.stopRecording()
+		e.finish(false)
+		return
+	}
+
+	if len(e.keys) == 0 && isRune && (key.Rune >= '1' && key.Rune <= '9' || key.Rune == '0' && e.count > 0) {
+		e.count = e.count*10 + int(key.Rune-'0')
+		return
+	}
+	if key == escape && len(e.keys) == 0 {
+		if e.mode == Normal && e.count == 0 && e.register == 0 {
+			// there is no command to cancel, Esc removes the other selections
+			e.selections().Clear()
+		}
+		e.cancel()
+		return
+	}
+
+	e.keys = append(e.keys, key)
+	if e.mode == OperatorPending {
+		if match, prefix := e.operator.matchDouble(e.keys); match {
+			// a doubled operator like "dd" works on whole lines
+			e.keys = nil
+			count := e.operatorCount()
+			e.applyOperator(e.linesRegion(e.cursor(), count), func(sel Buffer.Selection) Region {
+				return e.linesRegion(sel.Head, count)
+			})
+			return
+		} else if prefix && e.pendingKeys.find(e.keys) == nil {
+			return
+		}
+	}
+
+	node := e.keymap(e.mode).find(e.keys)
+	if node == nil {
+		e.cancel()
+		return
+	}
+	if node.binding == nil || len(node.children) > 0 {
+		// wait for the rest of the keys
+		return
+	}
+	e.keys = nil
+	if node.binding.takesChar {
+		e.arg = node.binding
+		return
+	}
+	e.run(node.binding, 0)
+}
+
+func (e *Engine) run(b *binding, arg rune) {
+	switch {
+	case b.motion != nil:
+		e.runMotion(b.motion, arg)
+	case b.operator != nil:
+		e.startOperator(b.operator)
+	case b.object != nil:
+		e.selectObject(b.object)
+	default:
+		count := e.count
+		e.count = 0
+		if b.change {
+			e.beginChange()
+		}
+		b.action(e, count, arg)
+		e.finish(b.change)
+	}
+}
+
+// Cancels the command that is being typed
+func (e *Engine) cancel() {
+	if e.mode.IsVisual() && len(e.keys) == 0 && e.count == 0 && e.arg == nil {
+		e.mode = Normal
+	}
+	e.operator, e.opCount = nil, 0
+	if e.mode == OperatorPending {
+		e.mode = Normal
+	}
+	e.finish(false)
+}
+
+func (e *Engine) beginChange() {
+	e.buffer().History.BeginGroup()
+}
+
+// Ends the command. If it was a change, it is remembered for "." unless it continues in insert mode.
+func (e *Engine) finish(changed bool) {
+	e.keys, e.count, e.arg, e.register = nil, 0, nil, 0
+	if !e.record {
+		// the command is a part of an alias, which is finished by its own command
+		return
+	}
+	if e.mode == Insert || e.mode == Replace {
+		e.recordInsert = changed && !e.change.fromVisual
+		return
+	}
+	if changed && !e.change.fromVisual {
+		e.lastChange = e.change
+	}
+	e.change = change{}
+	e.buffer().History.EndGroup()
+	e.clampCursor()
+}
+
+// Runs the keys of the last change again. A count replaces the count of the change.
+func (e *Engine) repeat(count int) {
+	c := e.lastChange
+	if len(c.keys) == 0 {
+		return
+	}
+	if count > 0 {
+		c.count = count
+	}
+	e.change = change{}
+	if c.count > 0 {
+		for _, r := range strconv.Itoa(c.count) {
+			e.Feed(RuneKey(r))
+		}
+	}
+	e.FeedKeys(c.keys)
+}
+
+// Runs keys as a part of the current command, without recording them
+func (e *Engine) alias(keys string) {
+	record := e.record
+	e.record = false
+	defer func() { e.record = record }()
+	e.FeedKeys(Keys(keys))
+}
+
+func (e *Engine) buffer() *Buffer.Buffer {
+	return e.editor.Buffer()
+}
+
+func (e *Engine) rope() BRope.Rope {
+	return e.editor.Buffer().Rope
+}
+
+func (e *Engine) cursor() int {
+	return e.editor.Cursor()
+}
+
+func (e *Engine) setCursor(offset int) {
+	e.editor.SetCursor(max(0, min(offset, e.rope().Length())))
+}
+
+// In normal mode the cursors are on a character, not behind the last one of a line
+func (e *Engine) clampCursor() {
+	r := e.rope()
+	e.moveCursors(func(cursor int) int {
+		if cursor > lineStart(r, cursor) && cursor >= lineEnd(r, cursor) {
+			return prevCluster(r, cursor)
+		}
+		return cursor
+	})
+}
+
+// Replaces iv with text as a part of the current change and returns the offset after the text
+func (e *Engine) edit(iv BRope.Interval, text []rune) int {
+	return e.buffer().Edit(iv, text, e.cursor())
+}
+
+// Replaces the ascending intervals with the texts in a single edit
+func (e *Engine) editAll(ivs []BRope.Interval, texts [][]rune, cursorAfter int) {
+	e.buffer().ApplyDelta(e.delta(ivs, texts), e.cursor(), cursorAfter)
+}
+
+// The delta that replaces the ascending intervals with the texts
+func (e *Engine) delta(ivs []BRope.Interval, texts [][]rune) BRope.Delta {
+	builder := BRope.NewDeltaBuilder(e.rope().Length())
+	for i, iv := range ivs {
+		builder.Replace(iv, BRope.NewRope(texts[i]))
+	}
+	return builder.Build()
+}
@@ -0,0 +1,344 @@
+package vi
+
+import (
+	BRope "main/brope"
+	Buffer "main/buffer"
+	"main/view"
+	"strings"
+	"testing"
+)
+
+// Creates an engine for text, in which '|' marks the cursor
+func newTestEngine(text string) *Engine {
+	cursor := max(0, strings.Index(text, "|"))
+	text = strings.Replace(text, "|", "", 1)
+	editor := view.New(Buffer.NewBuffer("test", BRope.NewRopeString(text)))
+	editor.SetCursor(len([]rune(text[:cursor])))
+	return NewEngine(editor)
+}
+
+// Returns the text of the buffer with '|' at the cursor
+func content(e *Engine) string {
+	runes := e.rope().Runes()
+	cursor := e.cursor()
+	return string(runes[:cursor]) + "|" + string(runes[cursor:])
+}
+
+// Feeds keys into an engine for text and compares the result, '|' marks the cursor
+func expectKeys(text, keys, expected string, t *testing.T) *Engine {
+	t.Helper()
+	e := newTestEngine(text)
+	e.FeedKeys(Keys(keys))
+	if got := content(e); got != expected {
+		t.Fatalf("%q with %q: expected %q, got %q", text, keys, expected, got)
+	}
+	return e
+}
+
+func TestKeys(t *testing.T) {
+	for _, notation := range []string{"d2w", "ihello<Esc>", "<C-r>", "<lt>", "<CR><BS><Tab><Up>"} {
+		if got := KeysString(Keys(notation)); got != notation {
+			t.Fatalf("expected %q, got %q", notation, got)
+		}
+	}
+	if keys := Keys("<nope>"); len(keys) != 6 {
+		t.Fatalf("expected an unknown key name to be taken literally, got %v", keys)
+	}
+	if got := KeysString(Keys("a<Space><space>b")); got != "a<Space><Space>b" {
+		t.Fatalf("unexpected keys %q", got)
+	}
+	for _, key := range Keys("a<CR><BS><Esc><C-r><Tab><Up>") {
+		if got := KeyOf(key.Event()); got != key {
+			t.Fatalf("expected the event of %v to be the same key, got %v", key, got)
+		}
+	}
+}
+
+func TestMotions(t *testing.T) {
+	expectKeys("ab|cd", "h", "a|bcd", t)
+	expectKeys("ab|cd", "5h", "|abcd", t)
+	expectKeys("ab|cd", "l", "abc|d", t)
+	expectKeys("ab|cd", "9l", "abc|d", t)
+	expectKeys("a|bc\ndef", "j", "abc\nd|ef", t)
+	expectKeys("abc\nd\nde|f", "k", "abc\n|d\ndef", t)
+	expectKeys("abc\nd\nde|f", "2k", "ab|c\nd\ndef", t)
+	expectKeys("  ab|c", "0", "|  abc", t)
+	expectKeys("  ab|c", "^", "  |abc", t)
+	expectKeys("|abc\ndef", "$", "ab|c\ndef", t)
+	expectKeys("|abc\ndef", "2$", "abc\nde|f", t)
+}
+
+func TestVerticalMotionsKeepColumn(t *testing.T) {
+	expectKeys("abc|d\nx\nabcdef", "jj", "abcd\nx\nabc|def", t)
+	expectKeys("abc|d\n\nabcdef", "jjk", "abcd\n|\nabcdef", t)
+	expectKeys("ab|c\nabcdef\nx", "$j", "abc\nabcde|f\nx", t)
+	expectKeys("ab|c\nx\nabcdef", "$jj", "abc\nx\nabcde|f", t)
+	// moving left or right wants the new column
+	expectKeys("abc|d\nx\nabcdef", "jjhkk", "ab|cd\nx\nabcdef", t)
+	expectKeys("abc|d\nx\nabcdef", "i<Down><Down>", "abcd\nx\nabc|def", t)
+	expectKeys("abc|d\nx\nabcdef", "i<Down><Esc>j", "abcd\nx\n|abcdef", t)
+}
+
+func TestRowMotions(t *testing.T) {
+	for _, c := range []struct{ keys, expected string }{
+		{"gj", "abcd|ef\nx"},
+		{"gjgj", "abcdef\n|x"},
+		{"gjgk", "a|bcdef\nx"},
+		{"dgj", "a|ef\nx"},
+	} {
+		e := newTestEngine("a|bcdef\nx")
+		v := e.editor.(*view.View)
+		v.SetSize(3, 10)
+		v.SetWrap(view.Wrap{Mode: view.WrapWindow})
+		e.FeedKeys(Keys(c.keys))
+		if got := content(e); got != c.expected {
+			t.Fatalf("%q: expected %q, got %q", c.keys, c.expected, got)
+		}
+	}
+}
+
+func TestClusters(t *testing.T) {
+	// "e" with a combining accent and a thumbs up with a skin tone are one cluster each
+	expectKeys("|ae\u0301b", "l", "a|e\u0301b", t)
+	expectKeys("|ae\u0301b", "2l", "ae\u0301|b", t)
+	expectKeys("ae\u0301|b", "h", "a|e\u0301b", t)
+	expectKeys("|ae\u0301b", "lx", "a|b", t)
+	expectKeys("|a\U0001F44D\U0001F3FD", "$", "a|\U0001F44D\U0001F3FD", t)
+	expectKeys("|a\U0001F44D\U0001F3FD", "d$", "|", t)
+	expectKeys("|a\U0001F44D\U0001F3FDb", "lvd", "a|b", t)
+	expectKeys("|ae\u0301", "A<BS><Esc>", "|a", t)
+	expectKeys("|ae\u0301b", "a<Del><Esc>", "|ab", t)
+	expectKeys("|ae\u0301b", "A<Left><Left>x<Esc>", "a|xe\u0301b", t)
+	expectKeys("ae\u0301|b", "ix<Esc>", "ae\u0301|xb", t)
+	// lines longer than a leaf are stepped through by the cursor of the rope
+	long := strings.Repeat("a", 3000)
+	expectKeys(long+"e\u0301|b", "h", long+"|e\u0301b", t)
+	expectKeys(long+"e\u0301|b", "1001h", long[:2000]+"|"+long[2000:]+"e\u0301b", t)
+	expectKeys("|"+long+"e\u0301b", "3001l", long+"e\u0301|b", t)
+}
+
+func TestOperators(t *testing.T) {
+	expectKeys("a|bcd", "dl", "a|cd", t)
+	expectKeys("a|bcd", "3x", "|a", t)
+	expectKeys("a|bcd", "X", "|bcd", t)
+	expectKeys("a|bcd", "d$", "|a", t)
+	expectKeys("a|bcd\nefg", "D", "|a\nefg", t)
+	expectKeys("one\nt|wo\nthree", "dd", "one\n|three", t)
+	expectKeys("one\ntwo\nthr|ee", "dd", "one\n|two", t)
+	expectKeys("one\n  t|wo\nthree\nfour", "2dd", "one\n|four", t)
+	expectKeys("one\nt|wo\nthree", "dj", "|one", t)
+	expectKeys("one\nt|wo\nthree", "dk", "|three", t)
+	expectKeys("|one\ntwo", "d3j", "|", t)
+	expectKeys("a|bc", "yl", "a|bc", t)
+	expectKeys("a|bc\ndef", "guu", "|abc\ndef", t)
+	expectKeys("a|bc\ndef", "gUj", "|ABC\nDEF", t)
+	expectKeys("a|bC", "g~$", "a|Bc", t)
+	expectKeys("a|bC", "g~g~", "|ABc", t)
+	expectKeys("a|b\n\ncd", ">2j", "\t|ab\n\n\tcd", t)
+	expectKeys("\t\ta|b\n      cd", "<lt>j", "\t|ab\ncd", t)
+	expectKeys("a|b\n          cd", "<lt>j", "|ab\n  cd", t)
+	// "<" removes as many spaces as the tab stop is wide
+	e := newTestEngine("a|b\n      cd")
+	e.editor.(*view.View).SetTabStop(4)
+	e.FeedKeys(Keys("<lt>j"))
+	if got := content(e); got != "|ab\n  cd" {
+		t.Fatalf("expected the spaces of a tab stop of 4 to be removed, got %q", got)
+	}
+	expectKeys("a|b\ncd", ">>.", "\t\t|ab\ncd", t)
+}
+
+func TestCounts(t *testing.T) {
+	expectKeys("|abcdefgh", "2d3l", "|gh", t)
+	expectKeys("|abcdefghijkl", "10x", "|kl", t)
+	expectKeys("|1\n2\n3\n4\n5", "d2d", "|3\n4\n5", t)
+}
+
+func TestInsert(t *testing.T) {
+	expectKeys("a|bc", "ix<Esc>", "a|xbc", t)
+	expectKeys("a|bc", "ax<Esc>", "ab|xc", t)
+	expectKeys("  a|bc", "Ix<Esc>", "  |xabc", t)
+	expectKeys("a|bc", "Ax<Esc>", "abc|x", t)
+	expectKeys("a|bc\nd", "ox<Esc>", "abc\n|x\nd", t)
+	expectKeys("a|bc\nd", "Ox<Esc>", "|x\nabc\nd", t)
+	expectKeys("a|bc", "3ix<Esc>", "axx|xbc", t)
+	expectKeys("a|bc", "2ox<Esc>", "abc\nx\n|x", t)
+	expectKeys("a|bc", "ixy<BS>z<Esc>", "ax|zbc", t)
+	expectKeys("ab|c", "ifoo bar<C-w>x<Esc>", "abfoo |xc", t)
+	expectKeys("ab|c", "ifoo<C-u><Esc>", "|c", t)
+	expectKeys("ab|c", "i1<Left>2<Esc>", "ab|21c", t)
+	expectKeys("a|bc", "cl<Esc>", "|ac", t)
+	expectKeys("a|bc de", "c$x<Esc>", "a|x", t)
+	expectKeys("x\n a|bc\ny", "ccz<Esc>", "x\n|z\ny", t)
+	expectKeys("a|bc", "sxy<Esc>", "ax|yc", t)
+}
+
+func TestReplace(t *testing.T) {
+	expectKeys("a|bc", "rx", "a|xc", t)
+	expectKeys("a|bc", "2rx", "ax|x", t)
+	expectKeys("a|bc", "3rx", "a|bc", t)
+	expectKeys("a|bc", "Rxyz<Esc>", "axy|z", t)
+	expectKeys("a|bc", "Rxyz<BS><BS><Esc>", "a|xc", t)
+	expectKeys("a|bc", "~~", "aB|C", t)
+}
+
+func TestJoin(t *testing.T) {
+	expectKeys("a|b\n  cd\nef", "J", "ab| cd\nef", t)
+	expectKeys("a|b\n  cd\nef", "3J", "ab cd| ef", t)
+	expectKeys("a|b\n\nef", "J", "a|b\nef", t)
+}
+
+func TestRepeat(t *testing.T) {
+	expectKeys("|abcdef", "x..", "|def", t)
+	expectKeys("|abcdef", "2x.", "|ef", t)
+	expectKeys("|abcdef", "2x3.", "|f", t)
+	expectKeys("|a\nb", "Ax<Esc>j.", "ax\nb|x", t)
+	expectKeys("|a\nb\nc", "ddu.", "|b\nc", t)
+	expectKeys("|ab ab", "cl-<Esc>3l.", "-b |-b", t)
+	// moving in insert mode starts a new change
+	expectKeys("|abc", "ix<Right>y<Esc>0.", "|yxaybc", t)
+	// yanking is not a change
+	expectKeys("|abc", "xyl.", "|c", t)
+}
+
+func TestUndo(t *testing.T) {
+	e := expectKeys("|abc", "ixy<Esc>x", "x|abc", t)
+	e.FeedKeys(Keys("u"))
+	if got := content(e); got != "x|yabc" {
+		t.Fatalf("expected the deletion to be undone, got %q", got)
+	}
+	e.FeedKeys(Keys("u"))
+	if got := content(e); got != "|abc" {
+		t.Fatalf("expected the insertion to be undone in one step, got %q", got)
+	}
+	e.FeedKeys(Keys("2<C-r>"))
+	if got := content(e); got != "x|abc" {
+		t.Fatalf("expected both edits to be redone, got %q", got)
+	}
+}
+
+func TestPaste(t *testing.T) {
+	e := newTestEngine("a|b")
+	e.Paste("x\n  y\n")
+	if got := content(e); got != "ax\n  y\n|b" {
+		t.Fatalf("expected the text before the cursor, got %q", got)
+	}
+	e.FeedKeys(Keys("u"))
+	if got := content(e); got != "a|b" {
+		t.Fatalf("expected the paste to be undone in one step, got %q", got)
+	}
+
+	e = newTestEngine("a|b")
+	e.Paste("xy")
+	if got := content(e); got != "ax|yb" {
+		t.Fatalf("expected the cursor on the last pasted rune, got %q", got)
+	}
+
+	e = newTestEngine("|ab")
+	e.FeedKeys(Keys("2i-"))
+	e.Paste("x\ny")
+	e.FeedKeys(Keys("<Esc>"))
+	if got := content(e); got != "-x\ny-x\n|yab" {
+		t.Fatalf("expected the paste to be repeated with the insert, got %q", got)
+	}
+	e.FeedKeys(Keys("u"))
+	if got := content(e); got != "|ab" {
+		t.Fatalf("expected the insert to be undone in one step, got %q", got)
+	}
+	e.FeedKeys(Keys("."))
+	if got := content(e); got != "-x\ny-x\n|yab" {
+		t.Fatalf("expected the paste to be repeated by \".\", got %q", got)
+	}
+
+	e = newTestEngine("|ab")
+	e.FeedKeys(Keys("vl"))
+	e.Paste("x")
+	if got := content(e); got != "a|xb" || e.Mode() != Normal {
+		t.Fatalf("expected the paste to leave visual mode, got %q in %v", got, e.Mode())
+	}
+}
+
+func TestVisual(t *testing.T) {
+	expectKeys("a|bcd", "vld", "a|d", t)
+	expectKeys("ab|cd", "vhd", "a|d", t)
+	expectKeys("a|bcd", "vlohd", "|d", t)
+	expectKeys("a|b\ncd\nef", "Vjd", "|ef", t)
+	expectKeys("a|b\ncd\nef", "VjU", "|AB\nCD\nef", t)
+	expectKeys("a|bc\ndef", "vjx", "a|f", t)
+	expectKeys("a|bc", "vlcx<Esc>", "a|x", t)
+	expectKeys("a|bc\ndef", "Vj>", "\t|abc\n\tdef", t)
+	expectKeys("a|b\ncd", "vjJ", "ab| cd", t)
+	expectKeys("a|bc", "vlrx", "a|xx", t)
+	expectKeys("a|bc", "v<Esc>x", "a|c", t)
+	expectKeys("a|bc", "vVvd", "a|c", t)
+
+	e := newTestEngine("a|bc\ndef")
+	e.FeedKeys(Keys("vj"))
+	if e.Mode() != Visual {
+		t.Fatalf("expected visual mode, got %v", e.Mode())
+	}
+	if sel := e.Selection(); len(sel) != 1 || sel[0] != BRope.IV(1, 6) {
+		t.Fatalf("unexpected selection %v", sel)
+	}
+}
+
+func TestVisualBlock(t *testing.T) {
+	expectKeys("a|bcd\nefgh\nijkl", "<C-v>jld", "a|d\neh\nijkl", t)
+	expectKeys("a|bcd\nef\nijkl", "<C-v>2jld", "a|d\ne\nil", t)
+	expectKeys("a|bcd\nefgh\nijkl", "<C-v>jIxy<Esc>", "a|xybcd\nexyfgh\nijkl", t)
+	expectKeys("a|bcd\nefgh", "<C-v>jlA-<Esc>", "abc|-d\nefg-h", t)
+	expectKeys("a|bcd\nefgh", "<C-v>jlc-<Esc>", "a|-d\ne-h", t)
+	expectKeys("a|bcd\nefgh", "<C-v>jly", "a|bcd\nefgh", t)
+
+	e := newTestEngine("a|bcd\nefgh")
+	e.FeedKeys(Keys("<C-v>jl"))
+	if sel := e.Selection(); len(sel) != 2 || sel[0] != BRope.IV(1, 3) || sel[1] != BRope.IV(6, 8) {
+		t.Fatalf("unexpected selection %v", sel)
+	}
+	e.FeedKeys(Keys("y"))
+	if reg, _ := e.registers.Get('"'); reg.String() != "bc\nfg" || reg.Kind != Blockwise {
+		t.Fatalf("unexpected yank %q of kind %v", reg.String(), reg.Kind)
+	}
+}
+
+func TestModes(t *testing.T) {
+	e := newTestEngine("|abc")
+	for _, step := range []struct {
+		keys string
+		mode Mode
+	}{
+		{"d", OperatorPending}, {"<Esc>", Normal}, {"i", Insert}, {"<Esc>", Normal},
+		{"R", Replace}, {"<Esc>", Normal}, {"V", VisualLine}, {"<C-v>", VisualBlock}, {"<Esc>", Normal},
+		{"g", Normal}, {"U", OperatorPending}, {"<Esc>", Normal},
+	} {
+		e.FeedKeys(Keys(step.keys))
+		if e.Mode() != step.mode {
+			t.Fatalf("expected %v after %q, got %v", step.mode, step.keys, e.Mode())
+		}
+	}
+}
+
+func TestPending(t *testing.T) {
+	e := newTestEngine("|abc def")
+	for _, step := range []struct{ keys, pending string }{
+		{"\"", "\""}, {"a", "\"a"}, {"2", "\"a2"}, {"d", "\"a2d"}, {"f", "\"a2df"}, {"e", ""},
+		{"g", "g"}, {"<Esc>", ""}, {"v", ""}, {"i", "i"}, {"w", ""}, {"<Esc>", ""}, {"i", ""}, {"x", ""},
+	} {
+		e.FeedKeys(Keys(step.keys))
+		if got := e.Pending(); got != step.pending {
+			t.Fatalf("expected %q to be pending after %q, got %q", step.pending, step.keys, got)
+		}
+	}
+}
+
+func TestBind(t *testing.T) {
+	e := newTestEngine("|abc")
+	calls := []int{}
+	e.Bind(Normal, "gx", func(count int) { calls = append(calls, count) })
+	e.FeedKeys(Keys("gx3gxgux"))
+	if len(calls) != 2 || calls[0] != 0 || calls[1] != 3 {
+		t.Fatalf("unexpected calls %v", calls)
+	}
+	if content(e) != "|abc" {
+		t.Fatalf("unexpected content %q", content(e))
+	}
+}
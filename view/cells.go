@@ -0,0 +1,114 @@
+package view
+
+import (
+	"fmt"
+	"sort"
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/rivo/uniseg"
+)
+
+// A Cell is what the view shows of a grapheme cluster, the unit the cursor moves by. A cluster is a rune
+// and the runes that combine with it, like accents or the parts of an emoji.
+type Cell struct {
+	// rope offset of the first rune of the cluster
+	Offset int
+	// the runes of the cluster, or what is shown for a control character, nil for a tab
+	Runes []rune
+	// the columns the cell takes
+	Width int
+	// the runes are shown for a control character, one per column
+	Control bool
+}
+
+// The cells of a line and where they are wrapped into rows
+type lineLayout struct {
+	cells []Cell
+	// the columns of the cells, from the start of the line
+	cols []int
+	// the runes of the line and the columns of all its cells
+	length, width int
+	// the first cell of every row
+	rows []int
+	// the empty columns before the rows after the first one
+	indent int
+}
+
+// Lays out the runes of a line in cells, offsets of the cells are relative to the line. Tabs reach
+// to the next multiple of tabStop.
+func layoutLine(runes []rune, tabStop int) lineLayout {
+	l := lineLayout{length: len(runes)}
+	rest, state, offset := string(runes), -1, 0
+	for len(rest) > 0 {
+		var cluster string
+		cluster, rest, _, state = uniseg.FirstGraphemeClusterInString(rest, state)
+		clusterRunes := []rune(cluster)
+		cell := shownCell(clusterRunes, l.width, tabStop)
+		cell.Offset = offset
+		l.cells = append(l.cells, cell)
+		l.cols = append(l.cols, l.width)
+		l.width += cell.Width
+		offset += len(clusterRunes)
+	}
+	l.rows = []int{0}
+	return l
+}
+
+// The cell of a cluster at col. Widths are the ones of go-runewidth, which tcell draws with.
+func shownCell(runes []rune, col, tabStop int) Cell {
+	r := runes[0]
+	switch {
+	case r == '\t':
+		return Cell{Width: tabStop - col%tabStop}
+	case r < 0x20 || r == 0x7f:
+		return Cell{Runes: []rune{'^', r ^ 0x40}, Width: 2, Control: true}
+	case unicode.IsControl(r) || unicode.Is(unicode.Cf, r):
+		// invisible runes like zero width spaces are shown by their code point, like <200b>
+		shown := []rune(fmt.Sprintf("<%x>", r))
+		return Cell{Runes: shown, Width: len(shown), Control: true}
+	}
+	if width := runewidth.RuneWidth(r); width > 0 {
+		return Cell{Runes: runes, Width: width}
+	}
+	// a mark that combines with nothing is shown on a space
+	return Cell{Runes: append([]rune{' '}, runes...), Width: 1}
+}
+
+// The index of the cell that contains the rune at offset, len(cells) at the end of the line
+func (l *lineLayout) cellAt(offset int) int {
+	if offset >= l.length {
+		return len(l.cells)
+	}
+	// the last cell that starts at or before offset
+	return sort.Search(len(l.cells), func(i int) bool { return l.cells[i].Offset > offset }) - 1
+}
+
+// The index of the cell shown at col, len(cells) past the end of the line
+func (l *lineLayout) cellAtColumn(col int) int {
+	return sort.Search(len(l.cells), func(i int) bool { return l.cols[i]+l.cells[i].Width > col })
+}
+
+// The column of the rune at offset, the columns of the line at its end
+func (l *lineLayout) column(offset int) int {
+	if i := l.cellAt(offset); i < len(l.cells) {
+		return l.cols[i]
+	}
+	return l.width
+}
+
+// The offset of the cell at index i, the end of the line past the last cell
+func (l *lineLayout) offsetOf(i int) int {
+	if i < len(l.cells) {
+		return l.cells[i].Offset
+	}
+	return l.length
+}
+
+// The first column of row
+func (l *lineLayout) rowColumn(row int) int {
+	if i := l.rows[row]; i < len(l.cells) {
+		return l.cols[i]
+	}
+	return l.width
+}
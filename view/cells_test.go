@@ -0,0 +1,76 @@
+package view
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLayoutLine(t *testing.T) {
+	for _, c := range []struct {
+		line    string
+		offsets []int
+		cols    []int
+		shown   []string
+		width   int
+	}{
+		{"ab", []int{0, 1}, []int{0, 1}, []string{"a", "b"}, 2},
+		{"a\tb\t", []int{0, 1, 2, 3}, []int{0, 1, 4, 5}, []string{"a", "", "b", ""}, 8},
+		{"日本x", []int{0, 1, 2}, []int{0, 2, 4}, []string{"日", "本", "x"}, 5},
+		{"e\u0301x", []int{0, 2}, []int{0, 1}, []string{"e\u0301", "x"}, 2},
+		{"a\r", []int{0, 1}, []int{0, 1}, []string{"a", "^M"}, 3},
+		{"a\u200bb", []int{0, 1, 2}, []int{0, 1, 7}, []string{"a", "<200b>", "b"}, 8},
+		{"\u0301a", []int{0, 1}, []int{0, 1}, []string{" \u0301", "a"}, 2},
+		{"\U0001F44D\U0001F3FD!", []int{0, 2}, []int{0, 2}, []string{"\U0001F44D\U0001F3FD", "!"}, 3},
+	} {
+		l := layoutLine([]rune(c.line), 4)
+		offsets, shown := []int{}, []string{}
+		for _, cell := range l.cells {
+			offsets = append(offsets, cell.Offset)
+			shown = append(shown, string(cell.Runes))
+		}
+		if !reflect.DeepEqual(offsets, c.offsets) || !reflect.DeepEqual(l.cols, c.cols) ||
+			!reflect.DeepEqual(shown, c.shown) || l.width != c.width {
+			t.Fatalf("expected %q in cells at %v and columns %v shown as %q, %v wide, got %v, %v, %q, %v",
+				c.line, c.offsets, c.cols, c.shown, c.width, offsets, l.cols, shown, l.width)
+		}
+	}
+}
+
+func TestColumnsOfCells(t *testing.T) {
+	v := newView("\tab\n日本語\nx")
+	v.SetTabStop(4)
+	v.SetSize(20, 5)
+	for offset, cell := range map[int][2]int{0: {0, 0}, 1: {0, 4}, 3: {0, 6}, 4: {1, 0}, 5: {1, 2}, 6: {1, 4}, 8: {2, 0}} {
+		if row, col := v.Cell(offset); row != cell[0] || col != cell[1] {
+			t.Fatalf("expected offset %v at %v, got (%v, %v)", offset, cell, row, col)
+		}
+	}
+	// a click into the middle of a cell is on the cell
+	for cell, offset := range map[[2]int]int{{0, 2}: 0, {0, 5}: 2, {1, 3}: 5, {1, 9}: 6} {
+		if got := v.OffsetAt(cell[0], cell[1], false); got != offset {
+			t.Fatalf("expected %v at %v, got %v", offset, cell, got)
+		}
+	}
+
+	// moving down keeps the column on the screen
+	v.SetCursor(2)
+	v.CursorToLine(1, false)
+	expectCursor(v, 6, t)
+	v.CursorToLine(0, false)
+	expectCursor(v, 2, t)
+}
+
+func TestWrapWideCells(t *testing.T) {
+	v := newView("ab日本語")
+	v.SetSize(5, 5)
+	v.SetWrap(Wrap{Mode: WrapWindow})
+	// a wide cell that does not fit at the end of a row goes to the next one
+	expectStarts(v, 0, []int{0, 3}, t)
+	if row, col := v.Cell(4); row != 1 || col != 2 {
+		t.Fatalf("expected the last cell at (1, 2), got (%v, %v)", row, col)
+	}
+	rows := v.Rows()
+	if len(rows) != 2 || len(rows[0].Cells) != 3 || rows[1].Cells[0].Offset != 3 {
+		t.Fatalf("expected rows of 3 and 2 cells, got %v", rows)
+	}
+}
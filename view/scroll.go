@@ -0,0 +1,193 @@
+package view
+
+import BRope "main/brope"
+
+// Where zt, zz and zb put the line of the cursor
+type Position int
+
+const (
+	Top Position = iota
+	Center
+	Bottom
+)
+
+// SetSize sets the number of columns and rows the view shows, it changes with the size of the terminal
+func (v *View) SetSize(width, height int) {
+	v.width, v.height = max(1, width), max(1, height)
+}
+
+// SetScrollOff sets the lines above and below, and the columns left and right of the cursor that are
+// kept visible. They are less for views that are too small for them.
+func (v *View) SetScrollOff(lines, columns int) {
+	v.scrollOff, v.sideScrollOff = max(0, lines), max(0, columns)
+}
+
+func (v *View) Top() int {
+	return v.top
+}
+
+func (v *View) Left() int {
+	return v.left
+}
+
+func (v *View) Height() int {
+	return v.height
+}
+
+// Visible returns the interval of the lines that are shown, the rope does not need to be flattened to draw them
+func (v *View) Visible() BRope.Interval {
+	rows := v.Rows()
+	if len(rows) == 0 {
+		return BRope.IV(v.rope().Length(), v.rope().Length())
+	}
+	return BRope.IV(rows[0].Lo, rows[len(rows)-1].Hi)
+}
+
+// The rows kept between the cursor and the top and bottom of the view
+func (v *View) lineMargin() int {
+	return min(v.scrollOff, (v.height-1)/2)
+}
+
+func (v *View) lastLine() int {
+	return v.rope().LineCount() - 1
+}
+
+// The rows of the lines from line from up to line to, negative if to is above from. Lines that are more
+// than a view apart are counted as a row each, they are not shown together anyway.
+func (v *View) rowsBetween(from, to int) int {
+	if to < from {
+		return -v.rowsBetween(to, from)
+	}
+	if to-from > v.height {
+		return to - from
+	}
+	rows := 0
+	for line := from; line < to; line++ {
+		rows += v.rowCount(line)
+	}
+	return rows
+}
+
+// The line that is shown in the row of the view, the last line for rows below the end of the buffer
+func (v *View) lineAtRow(row int) int {
+	line := v.top
+	for line < v.lastLine() && row >= v.rowCount(line) {
+		row -= v.rowCount(line)
+		line++
+	}
+	return line
+}
+
+// The rows below the row of line, up to limit
+func (v *View) rowsBelow(line, row, limit int) int {
+	rows := v.rowCount(line) - 1 - row
+	for line++; rows < limit && line <= v.lastLine(); line++ {
+		rows += v.rowCount(line)
+	}
+	return min(rows, limit)
+}
+
+// The top line that shows the row of line with at most above rows above it
+func (v *View) topFor(line, row, above int) int {
+	top := line
+	for top > 0 && row+v.rowCount(top-1) <= above {
+		top--
+		row += v.rowCount(top)
+	}
+	return top
+}
+
+// The position of the cursor by line, the row of the line it is in and the rows above it in the view
+func (v *View) cursorRow() (line, row, above int) {
+	cursor := v.Cursor()
+	line = v.rope().LineOfOffset(cursor)
+	row, _ = v.rowOfColumn(line, v.column(cursor))
+	return line, row, v.rowsBetween(v.top, line) + row
+}
+
+// Follow scrolls the view so the cursor is shown, with the margins of SetScrollOff around it. Near the end
+// of the buffer the view does not scroll past its last line to keep the margin. A cursor that is far away
+// is shown in the center.
+func (v *View) Follow() {
+	v.top = max(0, min(v.top, v.lastLine()))
+	line, row, above := v.cursorRow()
+	margin := v.lineMargin()
+	switch {
+	case above < -v.height/2 || above > v.height-1+v.height/2:
+		v.top = v.topFor(line, row, (v.height-1)/2)
+		last := v.lastLine()
+		v.top = min(v.top, v.topFor(last, v.rowCount(last)-1, v.height-1))
+	case above < margin && v.top > 0:
+		v.top = v.topFor(line, row, margin)
+	case above > v.height-1-v.rowsBelow(line, row, margin):
+		v.top = v.topFor(line, row, v.height-1-v.rowsBelow(line, row, margin))
+	}
+
+	if v.wrapWidth() > 0 {
+		v.left = 0
+		return
+	}
+	col := v.column(v.Cursor())
+	// the last column of a wide cell has to be shown too
+	right := col + v.cellWidth(v.Cursor()) - 1
+	sideMargin := min(v.sideScrollOff, (v.width-1)/2)
+	v.left = max(0, min(v.left, col-sideMargin))
+	if right > v.left+v.width-1-sideMargin {
+		v.left = right - v.width + 1 + sideMargin
+	}
+}
+
+// Scroll scrolls the view by lines, down for positive lines, like Ctrl-E and Ctrl-Y. The view scrolls
+// until the last line is at its top. A cursor that would leave the view moves to the wanted column
+// of the nearest line inside its margins, see CursorToLine for pastEnd.
+func (v *View) Scroll(lines int, pastEnd bool) {
+	v.top = max(0, min(v.top+lines, v.lastLine()))
+	v.keepCursorInside(pastEnd)
+}
+
+// ScrollWithCursor scrolls the view and moves the cursor by the same lines, like Ctrl-D and Ctrl-U.
+// The cursor moves the whole way even if the view stops at the start or the end of the buffer.
+func (v *View) ScrollWithCursor(lines int, pastEnd bool) {
+	line := v.rope().LineOfOffset(v.Cursor())
+	v.CursorToLine(max(0, min(line+lines, v.lastLine())), pastEnd)
+	if lines > 0 {
+		v.top = max(v.top, min(v.top+lines, v.lastLine()-v.height+1))
+	} else {
+		v.top = max(0, v.top+lines)
+	}
+	v.keepCursorInside(pastEnd)
+}
+
+// ScrollCursorTo scrolls the view so the line of the cursor is at the top, the center or the bottom,
+// within the margins
+func (v *View) ScrollCursorTo(position Position) {
+	line, row, _ := v.cursorRow()
+	switch position {
+	case Top:
+		v.top = v.topFor(line, row, v.lineMargin())
+	case Center:
+		v.top = v.topFor(line, row, (v.height-1)/2)
+	case Bottom:
+		v.top = v.topFor(line, row, v.height-1-v.lineMargin())
+	}
+}
+
+// Moves the cursor into the rows of the view that are inside its margins. There are no margins at the
+// start and the end of the buffer.
+func (v *View) keepCursorInside(pastEnd bool) {
+	_, _, above := v.cursorRow()
+	margin := v.lineMargin()
+	lo, hi := margin, v.height-1-margin
+	if v.top == 0 {
+		lo = 0
+	}
+	if v.rowsBetween(v.top, v.lastLine()+1) <= v.height {
+		hi = v.height - 1
+	}
+	switch {
+	case above < lo:
+		v.CursorToLine(v.lineAtRow(lo), pastEnd)
+	case above > hi:
+		v.CursorToLine(v.lineAtRow(max(lo, hi)), pastEnd)
+	}
+}
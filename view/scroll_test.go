@@ -0,0 +1,97 @@
+package view
+
+import (
+	"strings"
+	"testing"
+)
+
+// A view of 10 columns and 5 rows onto n lines of 20 runes, with a scroll off of one line and two columns
+func newScrolledView(n int) *View {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = strings.Repeat(string(rune('a'+i%26)), 20)
+	}
+	v := newView(strings.Join(lines, "\n"))
+	v.SetSize(10, 5)
+	v.SetScrollOff(1, 2)
+	return v
+}
+
+func expectTop(v *View, expected int, t *testing.T) {
+	t.Helper()
+	if v.Top() != expected {
+		t.Fatalf("expected the top line %v, got %v", expected, v.Top())
+	}
+}
+
+func expectLine(v *View, expected int, t *testing.T) {
+	t.Helper()
+	if line := v.rope().LineOfOffset(v.Cursor()); line != expected {
+		t.Fatalf("expected the cursor on line %v, got %v", expected, line)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	v := newScrolledView(20)
+	v.CursorToLine(4, false)
+	v.Follow()
+	expectTop(v, 1, t)
+	v.CursorToLine(2, false)
+	v.Follow()
+	expectTop(v, 1, t)
+	v.CursorToLine(1, false)
+	v.Follow()
+	expectTop(v, 0, t)
+	// the view does not scroll past the end to keep the margin
+	v.CursorToLine(19, false)
+	v.Follow()
+	expectTop(v, 15, t)
+
+	v.SetCursor(v.rope().OffsetOfLine(19) + 12)
+	v.Follow()
+	if v.Left() != 5 {
+		t.Fatalf("expected the left column 5, got %v", v.Left())
+	}
+	if row, col := v.Cell(v.Cursor()); row != 4 || col != 7 {
+		t.Fatalf("expected the cursor at (4, 7), got (%v, %v)", row, col)
+	}
+}
+
+func TestScroll(t *testing.T) {
+	v := newScrolledView(20)
+	v.Scroll(2, false)
+	expectTop(v, 2, t)
+	expectLine(v, 3, t)
+	v.Scroll(-2, false)
+	expectTop(v, 0, t)
+	expectLine(v, 3, t)
+	v.Scroll(100, false)
+	expectTop(v, 19, t)
+	expectLine(v, 19, t)
+
+	v = newScrolledView(20)
+	v.ScrollWithCursor(3, false)
+	expectTop(v, 3, t)
+	expectLine(v, 4, t)
+	v.ScrollWithCursor(100, false)
+	expectTop(v, 15, t)
+	expectLine(v, 19, t)
+	v.ScrollWithCursor(-3, false)
+	expectTop(v, 12, t)
+	// the margin is kept again away from the end
+	expectLine(v, 15, t)
+}
+
+func TestScrollCursorTo(t *testing.T) {
+	v := newScrolledView(20)
+	v.CursorToLine(10, false)
+	v.ScrollCursorTo(Top)
+	expectTop(v, 9, t)
+	v.ScrollCursorTo(Center)
+	expectTop(v, 8, t)
+	v.ScrollCursorTo(Bottom)
+	expectTop(v, 7, t)
+	v.CursorToLine(1, false)
+	v.ScrollCursorTo(Bottom)
+	expectTop(v, 0, t)
+}
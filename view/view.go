@@ -0,0 +1,128 @@
+package view
+
+import (
+	BRope "main/brope"
+	Buffer "main/buffer"
+	"math"
+)
+
+// EndOfLine is the column a cursor wants after "$", it keeps to the end of every line it moves to
+const EndOfLine = math.MaxInt
+
+// A View is a window onto a buffer. It owns the cursor, which is a rope offset and the column the cursor
+// wants to be in. Moving up and down goes to the wanted column, so passing a short line does not lose it.
+// Where the cursor is shown on the screen is projected from the offset, the view does not keep screen cells.
+// The view shows the lines from its top line on and the columns from its left column on. Lines that are
+// wrapped are shown in several rows. Columns are the cells of the terminal, a wide character takes two
+// and a tab takes the ones up to the next tab stop.
+type View struct {
+	buffer *Buffer.Buffer
+	cursor int
+	// the column up and down motions move to, set whenever the cursor moves to another column
+	want int
+
+	// the first line and column that are shown
+	top, left int
+	// the number of rows and columns that are shown
+	width, height int
+	// the lines and columns that are kept between the cursor and the edges of the view, when possible
+	scrollOff, sideScrollOff int
+
+	wrap    Wrap
+	tabStop int
+	index   wrapIndex
+}
+
+func New(buffer *Buffer.Buffer) *View {
+	return &View{buffer: buffer, width: 1, height: 1}
+}
+
+func (v *View) Buffer() *Buffer.Buffer {
+	return v.buffer
+}
+
+// SetBuffer shows another buffer from its start
+func (v *View) SetBuffer(buffer *Buffer.Buffer) {
+	v.buffer = buffer
+	v.top, v.left = 0, 0
+	v.SetCursor(0)
+}
+
+func (v *View) rope() BRope.Rope {
+	return v.buffer.Rope
+}
+
+// Cursor returns the offset of the cursor, the rope can have changed since it was set
+func (v *View) Cursor() int {
+	return max(0, min(v.cursor, v.rope().Length()))
+}
+
+// SetCursor moves the cursor to offset and makes its column the wanted one
+func (v *View) SetCursor(offset int) {
+	v.cursor = max(0, min(offset, v.rope().Length()))
+	v.want = v.column(v.cursor)
+}
+
+// CursorToLine moves the cursor to the wanted column of line, or to the end of the line if it is shorter.
+// The end is the last rune of the line, or the newline after it if pastEnd is set, like in insert mode.
+// The wanted column is kept.
+func (v *View) CursorToLine(line int, pastEnd bool) {
+	want := v.want
+	v.cursor = v.offsetInLine(line, want, pastEnd)
+	v.want = want
+}
+
+// KeepLineEnd makes the cursor want the end of every line it moves to
+func (v *View) KeepLineEnd() {
+	v.want = EndOfLine
+}
+
+// Cell returns the row and column offset is shown at, relative to the top line and left column of the view.
+// Offsets that are not shown are outside of the rows and columns of the view.
+func (v *View) Cell(offset int) (row, col int) {
+	r := v.rope()
+	offset = max(0, min(offset, r.Length()))
+	line := r.LineOfOffset(offset)
+	row, col = v.rowOfColumn(line, v.column(offset))
+	return v.rowsBetween(v.top, line) + row, col - v.left
+}
+
+// OffsetAt returns the offset shown at row and column, like the one of a mouse click. Cells past the end
+// of a row are at its end, see CursorToLine for pastEnd.
+func (v *View) OffsetAt(row, col int, pastEnd bool) int {
+	line := v.lineAtRow(row)
+	row -= v.rowsBetween(v.top, line)
+	row = max(0, min(row, v.rowCount(line)-1))
+	col = v.layout(line).rowColumn(row) + max(0, v.left+col-v.rowIndent(line, row))
+	return v.clampToRow(line, row, v.offsetInLine(line, col, pastEnd))
+}
+
+// The column offset is shown at in its line, columns are cells of the terminal
+func (v *View) column(offset int) int {
+	r := v.rope()
+	line := r.LineOfOffset(offset)
+	return v.layout(line).column(offset - r.OffsetOfLine(line))
+}
+
+// The columns of the cell at offset, the end of a line takes one
+func (v *View) cellWidth(offset int) int {
+	r := v.rope()
+	line := r.LineOfOffset(offset)
+	l := v.layout(line)
+	if i := l.cellAt(offset - r.OffsetOfLine(line)); i < len(l.cells) {
+		return max(1, l.cells[i].Width)
+	}
+	return 1
+}
+
+// The offset of the cell at col in line, or the end of the line if it is shorter
+func (v *View) offsetInLine(line, col int, pastEnd bool) int {
+	r := v.rope()
+	line = max(0, min(line, r.LineCount()-1))
+	l := v.layout(line)
+	i := l.cellAtColumn(col)
+	if i == len(l.cells) && !pastEnd && i > 0 {
+		i--
+	}
+	return r.OffsetOfLine(line) + l.offsetOf(i)
+}
@@ -0,0 +1,69 @@
+package view
+
+import (
+	BRope "main/brope"
+	Buffer "main/buffer"
+	"testing"
+)
+
+func newView(text string) *View {
+	return New(Buffer.NewBuffer("test", BRope.NewRopeString(text)))
+}
+
+func expectCursor(v *View, expected int, t *testing.T) {
+	t.Helper()
+	if got := v.Cursor(); got != expected {
+		t.Fatalf("expected the cursor at %v, got %v", expected, got)
+	}
+}
+
+func TestCursorToLine(t *testing.T) {
+	v := newView("abcd\nx\n\nabcdef")
+	v.SetCursor(3)
+	// short lines do not lose the wanted column
+	v.CursorToLine(1, false)
+	expectCursor(v, 5, t)
+	v.CursorToLine(2, false)
+	expectCursor(v, 7, t)
+	v.CursorToLine(3, false)
+	expectCursor(v, 11, t)
+
+	// insert mode can be after the last rune
+	v.SetCursor(3)
+	v.CursorToLine(1, true)
+	expectCursor(v, 6, t)
+
+	// a new column is wanted after the cursor was set
+	v.SetCursor(5)
+	v.CursorToLine(3, false)
+	expectCursor(v, 8, t)
+
+	v.SetCursor(0)
+	v.KeepLineEnd()
+	v.CursorToLine(3, false)
+	expectCursor(v, 13, t)
+	v.CursorToLine(0, true)
+	expectCursor(v, 4, t)
+}
+
+func TestCell(t *testing.T) {
+	v := newView("ab\ncde")
+	for offset, cell := range [][2]int{{0, 0}, {0, 1}, {0, 2}, {1, 0}, {1, 1}, {1, 2}, {1, 3}} {
+		if row, col := v.Cell(offset); row != cell[0] || col != cell[1] {
+			t.Fatalf("expected offset %v at %v, got (%v, %v)", offset, cell, row, col)
+		}
+	}
+	if got := v.OffsetAt(0, 10, false); got != 1 {
+		t.Fatalf("expected a click past the end of the line on its last rune, got %v", got)
+	}
+	if got := v.OffsetAt(5, 1, true); got != 4 {
+		t.Fatalf("expected a click below the text on its last line, got %v", got)
+	}
+}
+
+func TestCursorAfterEdit(t *testing.T) {
+	v := newView("abc")
+	v.SetCursor(3)
+	v.Buffer().Edit(BRope.IV(1, 3), nil, 3)
+	expectCursor(v, 1, t)
+}
@@ -0,0 +1,230 @@
+package view
+
+import (
+	BRope "main/brope"
+	"unicode"
+)
+
+type WrapMode int
+
+const (
+	// long lines go on past the right edge of the view, which scrolls sideways
+	WrapOff WrapMode = iota
+	// long lines are continued in the next row at the right edge of the view
+	WrapWindow
+	// long lines are continued at the wrap column, or at the right edge if the view is narrower
+	WrapColumn
+)
+
+// Wrap is how the view wraps lines that are too long for it
+type Wrap struct {
+	Mode   WrapMode
+	Column int
+	// lines are wrapped after a blank instead of inside of a word, unless the word is too long for a row
+	Words bool
+	// the rows that continue a line are indented like the line
+	BreakIndent bool
+}
+
+// A Row is the part of a line that is shown in one row of the view
+type Row struct {
+	Line int
+	// the rope offsets of the runes in the row, the newline that ends the line is in its last row
+	Lo, Hi int
+	// the empty columns before the cells, for rows that continue a line with break indent
+	Indent int
+	Cells  []Cell
+}
+
+// The layouts of lines are computed when they are needed and kept until the rope, the wrap, the width
+// or the tab stop changes
+type wrapIndex struct {
+	rope    *BRope.NodeBody
+	wrap    Wrap
+	width   int
+	tabStop int
+	lines   map[int]*lineLayout
+}
+
+// SetWrap sets how long lines are wrapped
+func (v *View) SetWrap(wrap Wrap) {
+	v.wrap = wrap
+}
+
+// SetTabStop sets the columns between tab stops
+func (v *View) SetTabStop(tabStop int) {
+	v.tabStop = tabStop
+}
+
+// TabStop returns the columns between tab stops, 8 if none were set
+func (v *View) TabStop() int {
+	if v.tabStop <= 0 {
+		return 8
+	}
+	return v.tabStop
+}
+
+// The columns a line is wrapped at, 0 if it is not wrapped
+func (v *View) wrapWidth() int {
+	switch v.wrap.Mode {
+	case WrapWindow:
+		return v.width
+	case WrapColumn:
+		if v.wrap.Column > 0 {
+			return min(v.wrap.Column, v.width)
+		}
+		return v.width
+	}
+	return 0
+}
+
+// The cells and rows of line
+func (v *View) layout(line int) *lineLayout {
+	r := v.rope()
+	width := v.wrapWidth()
+	tabStop := v.TabStop()
+	if v.index.rope != r.NodeBody || v.index.wrap != v.wrap || v.index.width != width || v.index.tabStop != tabStop {
+		v.index = wrapIndex{rope: r.NodeBody, wrap: v.wrap, width: width, tabStop: tabStop, lines: map[int]*lineLayout{}}
+	}
+	if l, ok := v.index.lines[line]; ok {
+		return l
+	}
+	l := layoutLine(r.GetLine(line), tabStop)
+	if width > 0 {
+		l.wrap(width, v.wrap)
+	}
+	v.index.lines[line] = &l
+	return &l
+}
+
+// Wraps the cells into rows of width columns
+func (l *lineLayout) wrap(width int, wrap Wrap) {
+	blank := func(i int) bool {
+		return l.cells[i].Runes == nil || unicode.IsSpace(l.cells[i].Runes[0]) && !l.cells[i].Control
+	}
+	if wrap.BreakIndent {
+		first := 0
+		for first < len(l.cells) && blank(first) {
+			first++
+		}
+		// the continued rows keep at least half of the width
+		l.indent = min(l.column(l.offsetOf(first)), width/2)
+	}
+	start, rowWidth := 0, width
+	for i := range l.cells {
+		for l.cols[i]+l.cells[i].Width-l.cols[start] > rowWidth && i > start {
+			end := i
+			if wrap.Words {
+				// after the last blank of the row, if the row is not blank up to it
+				for j := i; j > start+1; j-- {
+					if blank(j-1) && !blank(j-2) {
+						end = j
+						break
+					}
+				}
+			}
+			l.rows = append(l.rows, end)
+			start, rowWidth = end, width-l.indent
+		}
+	}
+}
+
+// The number of rows of line
+func (v *View) rowCount(line int) int {
+	return len(v.layout(line).rows)
+}
+
+// The row of line that col is in, and the column in that row
+func (v *View) rowOfColumn(line, col int) (row, rowCol int) {
+	l := v.layout(line)
+	row = len(l.rows) - 1
+	for row > 0 && l.rowColumn(row) > col {
+		row--
+	}
+	return row, col - l.rowColumn(row) + v.rowIndent(line, row)
+}
+
+// The empty columns before row of line, for break indent
+func (v *View) rowIndent(line, row int) int {
+	if row == 0 {
+		return 0
+	}
+	return v.layout(line).indent
+}
+
+// Returns the rows of the view, from the top line to the bottom of the view or the end of the buffer
+func (v *View) Rows() []Row {
+	r := v.rope()
+	rows := []Row{}
+	for line := v.top; line <= v.lastLine() && len(rows) < v.height; line++ {
+		start, end := r.OffsetOfLine(line), r.OffsetOfLine(line+1)
+		l := v.layout(line)
+		for i := 0; i < len(l.rows) && len(rows) < v.height; i++ {
+			row := Row{Line: line, Lo: start + l.offsetOf(l.rows[i]), Hi: end, Indent: v.rowIndent(line, i)}
+			last := len(l.cells)
+			if i+1 < len(l.rows) {
+				last = l.rows[i+1]
+				row.Hi = start + l.offsetOf(last)
+			}
+			for _, cell := range l.cells[l.rows[i]:last] {
+				cell.Offset += start
+				row.Cells = append(row.Cells, cell)
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// RowOffset returns the offset that is rows rows of the view below offset, or above for negative rows.
+// It is in the same column of its row, or at the end of the row if that is shorter. Like moving by lines,
+// it stops at the first and the last row of the buffer and fails if it cannot move at all.
+func (v *View) RowOffset(offset, rows int) (int, bool) {
+	r := v.rope()
+	offset = max(0, min(offset, r.Length()))
+	line := r.LineOfOffset(offset)
+	row, col := v.rowOfColumn(line, v.column(offset))
+	moved := false
+	for ; rows > 0; rows-- {
+		if row+1 < v.rowCount(line) {
+			row++
+		} else if line < v.lastLine() {
+			line, row = line+1, 0
+		} else {
+			break
+		}
+		moved = true
+	}
+	for ; rows < 0; rows++ {
+		if row > 0 {
+			row--
+		} else if line > 0 {
+			line--
+			row = v.rowCount(line) - 1
+		} else {
+			break
+		}
+		moved = true
+	}
+	l := v.layout(line)
+	target := v.offsetInLine(line, l.rowColumn(row)+max(0, col-v.rowIndent(line, row)), true)
+	return v.clampToRow(line, row, target), moved
+}
+
+// Keeps offset in line before the row after row, on the last cell of row
+func (v *View) clampToRow(line, row, offset int) int {
+	l := v.layout(line)
+	if row+1 < len(l.rows) {
+		offset = min(offset, v.rope().OffsetOfLine(line)+l.offsetOf(l.rows[row+1]-1))
+	}
+	return offset
+}
+
+// The offset of the newline that ends line, or the end of the rope on the last line
+func (v *View) lineEnd(line int) int {
+	r := v.rope()
+	if line >= v.lastLine() {
+		return r.Length()
+	}
+	return r.OffsetOfLine(line+1) - 1
+}
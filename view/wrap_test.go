@@ -0,0 +1,99 @@
+package view
+
+import (
+	BRope "main/brope"
+	"reflect"
+	"testing"
+)
+
+func expectStarts(v *View, line int, expected []int, t *testing.T) {
+	t.Helper()
+	l := v.layout(line)
+	got := []int{}
+	for _, i := range l.rows {
+		got = append(got, l.offsetOf(i))
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected line %v to be wrapped at %v, got %v", line, expected, got)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	v := newView("abcdefghij\nab cd ef gh\n  abcdefgh")
+	v.SetSize(4, 10)
+	expectStarts(v, 0, []int{0}, t)
+
+	v.SetWrap(Wrap{Mode: WrapWindow})
+	expectStarts(v, 0, []int{0, 4, 8}, t)
+	expectStarts(v, 1, []int{0, 4, 8}, t)
+
+	v.SetWrap(Wrap{Mode: WrapColumn, Column: 3})
+	expectStarts(v, 0, []int{0, 3, 6, 9}, t)
+	v.SetWrap(Wrap{Mode: WrapColumn, Column: 30})
+	expectStarts(v, 0, []int{0, 4, 8}, t)
+
+	v.SetWrap(Wrap{Mode: WrapWindow, Words: true})
+	expectStarts(v, 1, []int{0, 3, 6, 9}, t)
+	// words that are too long for a row are wrapped inside
+	expectStarts(v, 0, []int{0, 4, 8}, t)
+
+	v.SetWrap(Wrap{Mode: WrapWindow, BreakIndent: true})
+	expectStarts(v, 2, []int{0, 4, 6, 8}, t)
+	if indent := v.rowIndent(2, 1); indent != 2 {
+		t.Fatalf("expected the continued rows indented by 2, got %v", indent)
+	}
+
+	// the index follows edits
+	v.SetWrap(Wrap{Mode: WrapWindow})
+	v.Buffer().Edit(BRope.IV(0, 4), nil, 0)
+	expectStarts(v, 0, []int{0, 4}, t)
+}
+
+func TestCellOfWrappedLines(t *testing.T) {
+	v := newView("abcdef\n  abcdef\nx")
+	v.SetSize(4, 10)
+	v.SetWrap(Wrap{Mode: WrapWindow, BreakIndent: true})
+	for offset, cell := range map[int][2]int{0: {0, 0}, 5: {1, 1}, 6: {1, 2}, 10: {2, 3}, 11: {3, 2}, 16: {5, 0}} {
+		if row, col := v.Cell(offset); row != cell[0] || col != cell[1] {
+			t.Fatalf("expected offset %v at %v, got (%v, %v)", offset, cell, row, col)
+		}
+		if got := v.OffsetAt(cell[0], cell[1], true); got != offset {
+			t.Fatalf("expected %v at %v, got %v", offset, cell, got)
+		}
+	}
+	// the indent of continued rows is before their first rune
+	if got := v.OffsetAt(3, 0, false); got != 11 {
+		t.Fatalf("expected a click into the indent at the first rune of the row, got %v", got)
+	}
+}
+
+func TestRowOffset(t *testing.T) {
+	v := newView("abcdef\nab\nabcdefgh")
+	v.SetSize(4, 10)
+	v.SetWrap(Wrap{Mode: WrapWindow})
+	for _, c := range []struct{ offset, rows, expected int }{
+		{1, 1, 5}, {5, 1, 8}, {9, -1, 6}, {2, 2, 9}, {10, 1, 14}, {1, -1, 1}, {1, 10, 15}, {15, 1, 15},
+	} {
+		got, ok := v.RowOffset(c.offset, c.rows)
+		if got != c.expected || ok != (c.offset != c.expected) {
+			t.Fatalf("expected %v rows from %v at %v, got %v, %v", c.rows, c.offset, c.expected, got, ok)
+		}
+	}
+}
+
+func TestFollowWrappedLines(t *testing.T) {
+	v := newView("aaaaaaaa\nbbbbbbbb\ncccccccc\ndddddddd")
+	v.SetSize(4, 4)
+	v.SetWrap(Wrap{Mode: WrapWindow})
+	v.CursorToLine(1, false)
+	v.Follow()
+	expectTop(v, 0, t)
+	v.CursorToLine(2, false)
+	v.Follow()
+	expectTop(v, 1, t)
+	if rows := v.Rows(); len(rows) != 4 || rows[0].Line != 1 || rows[3].Line != 2 {
+		t.Fatalf("expected rows of lines 1 and 2, got %v", rows)
+	}
+	v.Scroll(1, false)
+	expectTop(v, 2, t)
+}